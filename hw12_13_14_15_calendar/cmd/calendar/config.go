@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"path"
 	"strings"
 	"time"
@@ -14,6 +15,13 @@ const EnvVarPrefix = "GOCLNDR"
 const (
 	StorageInmemoryType = "memory"
 	StorageSQLType      = "sql"
+	StorageFileType     = "file"
+)
+
+// Диалекты хранилища StorageSQLType.
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
 )
 
 // При желании конфигурацию можно вынести в internal/config.
@@ -22,8 +30,11 @@ const (
 type Config struct {
 	Logger     LoggerConf
 	Storage    StorageConf
+	Cache      CacheConf
 	HTTPServer ServerConf
 	GRPCServer ServerConf
+	// Счётчики сервиса (/debug/vars) без авторизации, только на локальном адресе; порт 0 - выключено.
+	DebugServer ServerConf
 }
 
 type LoggerConf struct {
@@ -43,6 +54,20 @@ type StorageConf struct {
 	Password string
 	SSLMode  string
 	Timeout  time.Duration
+	Dialect  string
+	// Файл БД SQLite или, для хранилища в файле, файл журнала.
+	Path string
+	// Для хранилища в файле: через сколько записей сжимать журнал.
+	CompactAfter int
+}
+
+// CacheConf - кэш событий поверх хранилища.
+type CacheConf struct {
+	Enabled bool
+	// Сколько событий (отдельных и в результатах выборок) помещается в кэш.
+	Size int
+	// Через сколько запись кэша устаревает: изменения планировщика из другого процесса идут в обход кэша.
+	TTL time.Duration
 }
 
 type ServerConf struct {
@@ -77,8 +102,13 @@ func NewConfig(filePath string) (Config, error) {
 		return config, err
 	}
 
+	config.Cache = processCacheConf()
 	config.HTTPServer = processHTTPServerConf()
 	config.GRPCServer = processGRPCServerConf()
+	config.DebugServer, err = processDebugServerConf()
+	if err != nil {
+		return config, err
+	}
 
 	return config, nil
 }
@@ -137,16 +167,31 @@ func processStorageConf() (StorageConf, error) {
 	viper.SetDefault("type", StorageInmemoryType)
 	viper.SetDefault("DBSSLMode", "require")
 	viper.SetDefault("DBTimeout", time.Second*3)
+	viper.SetDefault("DBDialect", DialectPostgres)
+	viper.SetDefault("storage.compactAfter", 1000)
 
 	conf := StorageConf{}
 
-	val, err := getAllowedStringVal("storage.type", []string{StorageInmemoryType, StorageSQLType})
+	val, err := getAllowedStringVal("storage.type", []string{StorageInmemoryType, StorageSQLType, StorageFileType})
 	if err != nil {
 		return conf, err
 	}
 	conf.Type = val
 
 	if conf.Type == StorageSQLType {
+		conf.Dialect, err = getAllowedStringVal("DBDialect", []string{DialectPostgres, DialectSQLite})
+		if err != nil {
+			return conf, err
+		}
+		conf.Timeout = viper.GetDuration("DBTimeout")
+		if conf.Dialect == DialectSQLite {
+			if !viper.IsSet("DBPath") {
+				return conf, fmt.Errorf("database file is not set, need set dbpath")
+			}
+			conf.Path = viper.GetString("DBPath")
+			return conf, nil
+		}
+
 		if !viper.IsSet("DBHost") || !viper.IsSet("DBName") || !viper.IsSet("DbUser") || !viper.IsSet("DbPassword") {
 			return conf, fmt.Errorf("not all database requisites are set, need set dbhost, dbname, dbuser, dbpassword")
 		}
@@ -156,12 +201,31 @@ func processStorageConf() (StorageConf, error) {
 		conf.User = viper.GetString("DBUser")
 		conf.Password = viper.GetString("DBPassword")
 		conf.SSLMode = viper.GetString("DBSSLMode")
-		conf.Timeout = viper.GetDuration("DBTimeout")
+	}
+
+	if conf.Type == StorageFileType {
+		if !viper.IsSet("storage.path") {
+			return conf, fmt.Errorf("storage file path is not set, need set storage.path")
+		}
+		conf.Path = viper.GetString("storage.path")
+		conf.CompactAfter = viper.GetInt("storage.compactAfter")
 	}
 
 	return conf, nil
 }
 
+func processCacheConf() CacheConf {
+	viper.SetDefault("cache.enabled", false)
+	viper.SetDefault("cache.size", 10000)
+	viper.SetDefault("cache.ttl", time.Minute)
+
+	return CacheConf{
+		Enabled: viper.GetBool("cache.enabled"),
+		Size:    viper.GetInt("cache.size"),
+		TTL:     viper.GetDuration("cache.ttl"),
+	}
+}
+
 func processHTTPServerConf() ServerConf {
 	viper.SetDefault("host", "localhost")
 	viper.SetDefault("port", 8080)
@@ -183,3 +247,22 @@ func processGRPCServerConf() ServerConf {
 
 	return conf
 }
+
+func processDebugServerConf() (ServerConf, error) {
+	viper.SetDefault("debug-server.host", "localhost")
+	viper.SetDefault("debug-server.port", 0)
+
+	conf := ServerConf{}
+	conf.Host = viper.GetString("debug-server.host")
+	conf.Port = viper.GetInt("debug-server.port")
+	if conf.Port == 0 {
+		return conf, nil
+	}
+
+	ip := net.ParseIP(conf.Host)
+	if conf.Host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return conf, fmt.Errorf(`invalid debug-server.host value: "%s", only loopback address is allowed`, conf.Host)
+	}
+
+	return conf, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"flag"
 	"fmt"
 	"log"
@@ -10,11 +11,15 @@ import (
 	"sync"
 	"syscall"
 	"time"
+	// База часовых поясов для клиентов, передающих свой пояс (в alpine-образе её нет)
+	_ "time/tzdata"
 
 	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/app"
 	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/logger"
 	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/server/grpc"
 	internalhttp "github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/server/http"
+	cachestorage "github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage/cache"
+	filestorage "github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage/file"
 	memorystorage "github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage/memory"
 	sqlstorage "github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage/sql"
 	_ "github.com/jackc/pgx/stdlib"
@@ -52,6 +57,10 @@ func main() {
 	case StorageInmemoryType:
 		storage = memorystorage.New()
 	case StorageSQLType:
+		if config.Storage.Dialect == DialectSQLite {
+			storage = sqlstorage.NewSQLite(config.Storage.Path, config.Storage.Timeout)
+			break
+		}
 		storage = sqlstorage.New(
 			config.Storage.Host,
 			config.Storage.Port,
@@ -60,16 +69,40 @@ func main() {
 			config.Storage.Password,
 			config.Storage.SSLMode,
 			config.Storage.Timeout)
+	case StorageFileType:
+		fileStorage, err := filestorage.New(config.Storage.Path, config.Storage.CompactAfter)
+		if err != nil {
+			logg.Error("failed to open storage file: " + err.Error())
+			logg.Sync()
+			os.Exit(1)
+		}
+		defer func() {
+			if err := fileStorage.Close(); err != nil {
+				logg.Error("failed to close storage file: " + err.Error())
+			}
+		}()
+		storage = fileStorage
 	default:
 		logg.Error(fmt.Sprintf("unprocessable storage type: \"%s\"\n", config.Storage.Type))
 		logg.Sync()
 		os.Exit(1) //nolint: gocritic
 	}
 
+	if config.Cache.Enabled {
+		cached := cachestorage.New(storage, config.Cache.Size, config.Cache.TTL)
+		// счётчики доступны в /debug/vars отладочного сервера
+		expvar.Publish("storageCache", expvar.Func(func() interface{} { return cached.Stats() }))
+		storage = cached
+	}
+
 	calendar := app.New(*logg, storage)
 
 	httpServer := internalhttp.NewServer(config.HTTPServer.Host, config.HTTPServer.Port, *logg, calendar)
 	grpcServer := grpc.NewServer(config.GRPCServer.Host, config.GRPCServer.Port, *logg, calendar)
+	var debugServer *internalhttp.DebugServer
+	if config.DebugServer.Port != 0 {
+		debugServer = internalhttp.NewDebugServer(config.DebugServer.Host, config.DebugServer.Port, *logg)
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(),
 		syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
@@ -97,6 +130,26 @@ func main() {
 		}
 	}()
 
+	if debugServer != nil {
+		go func() {
+			<-ctx.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+
+			if err := debugServer.Stop(ctx); err != nil {
+				logg.Error("failed to stop debug HTTP server: " + err.Error())
+			}
+		}()
+
+		// Без отладочного сервера календарь работает, поэтому его ошибка не останавливает остальные
+		go func() {
+			if err := debugServer.Start(ctx); err != nil {
+				logg.Error("failed to start debug HTTP server: " + err.Error())
+			}
+		}()
+	}
+
 	wg := sync.WaitGroup{}
 	wg.Add(2)
 	go func() {
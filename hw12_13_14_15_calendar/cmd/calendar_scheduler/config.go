@@ -16,6 +16,12 @@ const (
 	StorageSQLType      = "sql"
 )
 
+// Диалекты хранилища StorageSQLType.
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+)
+
 const (
 	Direct  = "direct"
 	FanOut  = "fanout"
@@ -31,8 +37,9 @@ type Config struct {
 }
 
 type SchedulerConf struct {
-	WorkCycle  time.Duration
-	Expiration time.Duration
+	WorkCycle      time.Duration
+	Expiration     time.Duration
+	TrashRetention time.Duration
 }
 
 type LoggerConf struct {
@@ -52,6 +59,9 @@ type StorageConf struct {
 	Password string
 	SSLMode  string
 	Timeout  time.Duration
+	Dialect  string
+	// Файл БД SQLite.
+	Path string
 }
 
 type ProducerConf struct {
@@ -123,9 +133,11 @@ func getAllowedStringVal(field string, allowed []string) (string, error) {
 func processSchedulerConf() SchedulerConf {
 	viper.SetDefault("scheduler.workcycle", time.Minute)
 	viper.SetDefault("scheduler.expiration", 24*365*time.Hour)
+	viper.SetDefault("scheduler.trashRetention", 24*30*time.Hour)
 	return SchedulerConf{
-		WorkCycle:  viper.GetDuration("scheduler.workcycle"),
-		Expiration: viper.GetDuration("scheduler.expiration"),
+		WorkCycle:      viper.GetDuration("scheduler.workcycle"),
+		Expiration:     viper.GetDuration("scheduler.expiration"),
+		TrashRetention: viper.GetDuration("scheduler.trashRetention"),
 	}
 }
 
@@ -169,6 +181,7 @@ func processStorageConf() (StorageConf, error) {
 	viper.SetDefault("type", StorageInmemoryType)
 	viper.SetDefault("DBSSLMode", "require")
 	viper.SetDefault("DBTimeout", time.Second*3)
+	viper.SetDefault("DBDialect", DialectPostgres)
 
 	conf := StorageConf{}
 
@@ -179,6 +192,19 @@ func processStorageConf() (StorageConf, error) {
 	conf.Type = val
 
 	if conf.Type == StorageSQLType {
+		conf.Dialect, err = getAllowedStringVal("DBDialect", []string{DialectPostgres, DialectSQLite})
+		if err != nil {
+			return conf, err
+		}
+		conf.Timeout = viper.GetDuration("DBTimeout")
+		if conf.Dialect == DialectSQLite {
+			if !viper.IsSet("DBPath") {
+				return conf, fmt.Errorf("database file is not set, need set dbpath")
+			}
+			conf.Path = viper.GetString("DBPath")
+			return conf, nil
+		}
+
 		if !viper.IsSet("DBHost") || !viper.IsSet("DBName") || !viper.IsSet("DbUser") || !viper.IsSet("DbPassword") {
 			return conf, fmt.Errorf("not all database requisites are set, need set dbhost, dbname, dbuser, dbpassword")
 		}
@@ -188,7 +214,6 @@ func processStorageConf() (StorageConf, error) {
 		conf.User = viper.GetString("DBUser")
 		conf.Password = viper.GetString("DBPassword")
 		conf.SSLMode = viper.GetString("DBSSLMode")
-		conf.Timeout = viper.GetDuration("DBTimeout")
 	}
 
 	return conf, nil
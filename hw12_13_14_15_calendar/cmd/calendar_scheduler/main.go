@@ -50,6 +50,10 @@ func main() {
 	case StorageInmemoryType:
 		storage = memorystorage.New()
 	case StorageSQLType:
+		if config.Storage.Dialect == DialectSQLite {
+			storage = sqlstorage.NewSQLite(config.Storage.Path, config.Storage.Timeout)
+			break
+		}
 		storage = sqlstorage.New(
 			config.Storage.Host,
 			config.Storage.Port,
@@ -77,7 +81,14 @@ func main() {
 		config.Producer.QosCount,
 	)
 
-	app := scheduler.New(config.Scheduler.WorkCycle, config.Scheduler.Expiration, *logg, storage, producer)
+	app := scheduler.New(
+		config.Scheduler.WorkCycle,
+		config.Scheduler.Expiration,
+		config.Scheduler.TrashRetention,
+		*logg,
+		storage,
+		producer,
+	)
 
 	ctx, cancel := signal.NotifyContext(
 		context.Background(),
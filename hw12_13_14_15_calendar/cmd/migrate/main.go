@@ -6,15 +6,14 @@ import (
 	"log"
 	"os"
 
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/migrations"
 	_ "github.com/jackc/pgx/stdlib"
 	"github.com/pressly/goose/v3"
 	"github.com/spf13/viper"
+	_ "modernc.org/sqlite"
 )
 
-const (
-	EnvVarPrefix = "GOCLNDR"
-	dialect      = "pgx"
-)
+const EnvVarPrefix = "GOCLNDR"
 
 var (
 	flags = flag.NewFlagSet("migrate", flag.ExitOnError)
@@ -37,6 +36,7 @@ func main() {
 
 	viper.SetEnvPrefix(EnvVarPrefix)
 	viper.AutomaticEnv()
+	driver := "pgx"
 	dbString := fmt.Sprintf(
 		"user=%s password=%s dbname=%s host=%s port=%d",
 		viper.GetString("dbuser"),
@@ -45,8 +45,15 @@ func main() {
 		viper.GetString("dbhost"),
 		viper.GetInt("dbport"),
 	)
+	dialect := migrations.DialectPostgres
+	// Миграции общие для обоих диалектов, SQL для SQLite выбирается внутри миграций
+	if viper.GetString("dbdialect") == migrations.DialectSQLite {
+		driver = "sqlite"
+		dbString = viper.GetString("dbpath")
+		dialect = migrations.DialectSQLite
+	}
 
-	db, err := goose.OpenDBWithDriver(dialect, dbString)
+	db, err := goose.OpenDBWithDriver(driver, dbString)
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
@@ -57,7 +64,7 @@ func main() {
 		}
 	}()
 
-	if err := goose.Run(command, db, *dir, args[1:]...); err != nil {
+	if err := migrations.Run(command, db, dialect, *dir, args[1:]...); err != nil {
 		log.Printf("migrate %v: %v", command, err)
 		return
 	}
@@ -1,21 +1,101 @@
 package app
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/rrule"
 	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
 	"go.uber.org/zap"
 )
 
 type Application interface {
-	GetEvent(id uuid.UUID, userID uuid.UUID) (storage.Event, error)
-	UpdateEvent(id uuid.UUID, userID uuid.UUID, event storage.Event) (storage.Event, error)
-	CreateEvent(userID uuid.UUID, event storage.Event) (storage.Event, error)
-	DeleteEvent(id uuid.UUID, userID uuid.UUID) error
-	GetEventsForPeriod(userID uuid.UUID, start, end time.Time) ([]storage.Event, error)
+	GetEvent(ctx context.Context, id uuid.UUID, userID uuid.UUID) (storage.Event, error)
+	UpdateEvent(
+		ctx context.Context,
+		id uuid.UUID,
+		userID uuid.UUID,
+		event storage.Event,
+		allowOverlap bool,
+	) (storage.Event, error)
+	PatchEvent(
+		ctx context.Context,
+		id uuid.UUID,
+		userID uuid.UUID,
+		patch func(event *storage.Event) error,
+		allowOverlap bool,
+	) (storage.Event, error)
+	CreateEvent(ctx context.Context, userID uuid.UUID, event storage.Event, allowOverlap bool) (storage.Event, error)
+	CreateEventWithID(
+		ctx context.Context,
+		id uuid.UUID,
+		userID uuid.UUID,
+		event storage.Event,
+		allowOverlap bool,
+	) (storage.Event, error)
+	DeleteEvent(ctx context.Context, id uuid.UUID, userID uuid.UUID, version int64) error
+	RestoreEvent(
+		ctx context.Context,
+		id uuid.UUID,
+		userID uuid.UUID,
+		version int64,
+		allowOverlap bool,
+	) (storage.Event, error)
+	GetTrashedEvents(ctx context.Context, userID uuid.UUID, tags []string) ([]storage.Event, error)
+	GetUserEvents(ctx context.Context, userID uuid.UUID) ([]storage.Event, error)
+	GetEventHistory(ctx context.Context, id uuid.UUID, userID uuid.UUID) ([]storage.HistoryRecord, error)
+	GetEventsForPeriod(
+		ctx context.Context,
+		userID uuid.UUID,
+		start, end time.Time,
+		page storage.Page,
+		tags []string,
+	) ([]storage.Event, storage.Cursor, error)
+	SearchEvents(ctx context.Context, userID uuid.UUID, query string, tags []string) ([]storage.Event, error)
+	ExportEvents(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]storage.Event, error)
+	GetFreeBusy(ctx context.Context, userIDs []uuid.UUID, start, end time.Time) ([]storage.FreeBusy, error)
+	GetWorkingHours(ctx context.Context, userID uuid.UUID) (storage.WorkingHours, error)
+	SetWorkingHours(ctx context.Context, userID uuid.UUID, hours storage.WorkingHours) (storage.WorkingHours, error)
+	BatchEvents(
+		ctx context.Context,
+		userID uuid.UUID,
+		ops []BatchOperation,
+		atomic bool,
+		allowOverlap bool,
+	) ([]BatchResult, error)
+	SuggestSlots(
+		ctx context.Context,
+		userID uuid.UUID,
+		userIDs []uuid.UUID,
+		duration time.Duration,
+		start, end time.Time,
+		limit int,
+	) ([]storage.Interval, error)
+	RespondToInvitation(
+		ctx context.Context,
+		id uuid.UUID,
+		userID uuid.UUID,
+		status storage.RSVPStatus,
+	) (storage.Event, error)
+	CreateCalendar(ctx context.Context, userID uuid.UUID, calendar storage.Calendar) (storage.Calendar, error)
+	UpdateCalendar(
+		ctx context.Context,
+		id uuid.UUID,
+		userID uuid.UUID,
+		calendar storage.Calendar,
+	) (storage.Calendar, error)
+	DeleteCalendar(ctx context.Context, id uuid.UUID, userID uuid.UUID) error
+	GetCalendar(ctx context.Context, id uuid.UUID, userID uuid.UUID) (storage.Calendar, error)
+	GetCalendars(ctx context.Context, userID uuid.UUID) ([]storage.Calendar, error)
 }
 
 type App struct {
@@ -24,16 +104,60 @@ type App struct {
 }
 
 type Storage interface {
-	AddEvent(event storage.Event) (storage.Event, error)
-	UpdateEvent(event storage.Event) error
-	DeleteEvent(id uuid.UUID) error
-	GetEvent(id uuid.UUID) (storage.Event, error)
-	GetEvents(filter []storage.EventCondition, sort []storage.EventSort) ([]storage.Event, error)
+	AddEvent(ctx context.Context, event storage.Event) (storage.Event, error)
+	UpdateEvent(ctx context.Context, event storage.Event) error
+	TrashEvent(ctx context.Context, id uuid.UUID, version int64, deletedAt time.Time) error
+	RestoreEvent(ctx context.Context, id uuid.UUID, version int64) error
+	SetAttendeeStatus(ctx context.Context, eventID uuid.UUID, userID uuid.UUID, status storage.RSVPStatus) error
+	GetEvent(ctx context.Context, id uuid.UUID) (storage.Event, error)
+	GetEvents(
+		ctx context.Context,
+		filter []storage.EventCondition,
+		sort []storage.EventSort,
+		page storage.Page,
+	) ([]storage.Event, error)
+	AddHistory(ctx context.Context, record storage.HistoryRecord) error
+	GetHistory(ctx context.Context, eventID uuid.UUID) ([]storage.HistoryRecord, error)
+	AddCalendar(ctx context.Context, calendar storage.Calendar) (storage.Calendar, error)
+	UpdateCalendar(ctx context.Context, calendar storage.Calendar) error
+	DeleteCalendar(ctx context.Context, id uuid.UUID) error
+	GetCalendar(ctx context.Context, id uuid.UUID) (storage.Calendar, error)
+	GetCalendars(ctx context.Context, userID uuid.UUID) ([]storage.Calendar, error)
+	GetBusyIntervals(
+		ctx context.Context,
+		userIDs []uuid.UUID,
+		from, to time.Time,
+	) (map[uuid.UUID][]storage.Interval, error)
+	SetWorkingHours(ctx context.Context, hours storage.WorkingHours) error
+	GetWorkingHours(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]storage.WorkingHours, error)
+	// WithTx выполняет fn атомарно: изменения, сделанные через tx, сохраняются, только если fn не вернула ошибку.
+	WithTx(ctx context.Context, fn func(tx Storage) error) error
+	// LockUser блокирует проверку пересечений событий пользователя в других транзакциях до конца транзакции WithTx.
+	LockUser(ctx context.Context, userID uuid.UUID) error
 }
 
 var (
 	ErrNotFound     = errors.New("not found")
 	ErrAccessDenied = errors.New("access denied")
+	ErrInvalidEvent = errors.New("invalid event")
+	ErrDateBusy     = errors.New("date busy")
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrVersionMismatch - событие было изменено с момента, когда клиент получил его версию.
+	ErrVersionMismatch = errors.New("version mismatch")
+	ErrEventExists     = errors.New("event already exists")
+)
+
+const (
+	// Ограничения меток, как в схеме БД.
+	tagNameMaxLen  = 64
+	tagColorMaxLen = 32
+	// Напоминаний у события не больше remindersMaxCount.
+	remindersMaxCount = 10
+	// Горизонт проверки пересечений для повторяющихся событий без даты окончания серии.
+	overlapHorizon = 366 * 24 * time.Hour
+	// Ограничения запроса занятости, чтобы один запрос не разворачивал повторения на годы для сотен людей.
+	freeBusyMaxUsers  = 100
+	freeBusyMaxPeriod = 92 * 24 * time.Hour
 )
 
 func New(logger zap.Logger, storage Storage) *App {
@@ -43,70 +167,990 @@ func New(logger zap.Logger, storage Storage) *App {
 	}
 }
 
-func (a *App) CreateEvent(userID uuid.UUID, event storage.Event) (storage.Event, error) {
+func (a *App) CreateEvent(
+	ctx context.Context,
+	userID uuid.UUID,
+	event storage.Event,
+	allowOverlap bool,
+) (storage.Event, error) {
+	return a.createEvent(ctx, uuid.UUID{}, userID, event, allowOverlap)
+}
+
+// CreateEventWithID создаёт событие с ID, выбранным клиентом (CalDAV-клиенты сами задают имя ресурса).
+func (a *App) CreateEventWithID(
+	ctx context.Context,
+	id uuid.UUID,
+	userID uuid.UUID,
+	event storage.Event,
+	allowOverlap bool,
+) (storage.Event, error) {
+	if id == (uuid.UUID{}) {
+		return storage.Event{}, fmt.Errorf("%w: empty ID", ErrInvalidEvent)
+	}
+	return a.createEvent(ctx, id, userID, event, allowOverlap)
+}
+
+func (a *App) createEvent(
+	ctx context.Context,
+	id uuid.UUID,
+	userID uuid.UUID,
+	event storage.Event,
+	allowOverlap bool,
+) (res storage.Event, err error) {
+	err = a.storage.WithTx(ctx, func(tx Storage) error {
+		res, err = a.withStorage(tx).addEvent(ctx, id, userID, event, allowOverlap)
+		return err
+	})
+	return res, err
+}
+
+// addEvent - проверка пересечений и сохранение события должны выполняться в одной транзакции.
+func (a *App) addEvent(
+	ctx context.Context,
+	id uuid.UUID,
+	userID uuid.UUID,
+	event storage.Event,
+	allowOverlap bool,
+) (storage.Event, error) {
+	event = withEndDate(event)
+	if err := validateEvent(event); err != nil {
+		return storage.Event{}, err
+	}
+	event.Tags = normalizeTags(event.Tags)
+	event = normalizeAllDay(event)
+	event.Reminders = normalizeReminders(event.Reminders, nil)
+	event.ID = id
 	event.UserID = userID
-	return a.storage.AddEvent(event)
+	event.DeletedAt = time.Time{}
+	event.Attendees = inviteAttendees(userID, event.Attendees, nil)
+	if err := a.checkCalendarWrite(ctx, event.CalendarID, userID); err != nil {
+		return storage.Event{}, err
+	}
+	if !allowOverlap {
+		if err := a.checkOverlap(ctx, event); err != nil {
+			return storage.Event{}, err
+		}
+	}
+
+	res, err := a.storage.AddEvent(ctx, event)
+	if err != nil {
+		return storage.Event{}, convertStorageErr(err)
+	}
+	if err = a.recordHistory(ctx, storage.ActionCreate, userID, storage.Event{}, res); err != nil {
+		return storage.Event{}, err
+	}
+
+	return res, nil
 }
 
-func (a *App) GetEvent(id uuid.UUID, userID uuid.UUID) (storage.Event, error) {
-	event, err := a.storage.GetEvent(id)
+// GetEvent возвращает событие пользователю с доступом к нему. При доступе free-busy от события остаётся
+// только занятое время.
+func (a *App) GetEvent(ctx context.Context, id uuid.UUID, userID uuid.UUID) (storage.Event, error) {
+	event, access, err := a.getEventWithAccess(ctx, id, userID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, storage.ErrEventNotFound) {
-			err = ErrNotFound
-		}
 		return storage.Event{}, err
 	}
-	if event.UserID != userID {
-		return storage.Event{}, ErrAccessDenied
+	if !access.Allows(storage.AccessRead) {
+		return busyOnly(event), nil
 	}
 
 	return event, nil
 }
 
-func (a *App) UpdateEvent(id uuid.UUID, userID uuid.UUID, event storage.Event) (storage.Event, error) {
-	// проверка на наличие в хранилище и на принадлежность пользователю
-	_, err := a.GetEvent(id, userID)
+func (a *App) getEventWithAccess(
+	ctx context.Context,
+	id uuid.UUID,
+	userID uuid.UUID,
+) (storage.Event, storage.Access, error) {
+	event, err := a.storage.GetEvent(ctx, id)
+	if err != nil {
+		return storage.Event{}, "", convertStorageErr(err)
+	}
+	access, err := a.eventAccess(ctx, event, userID)
+	if err != nil {
+		return storage.Event{}, "", err
+	}
+	if !access.Allows(storage.AccessFreeBusy) {
+		return storage.Event{}, "", ErrAccessDenied
+	}
+	// события из корзины доступны только через GetTrashedEvents и RestoreEvent
+	if event.IsTrashed() {
+		return storage.Event{}, "", fmt.Errorf("%w: event is in trash", ErrNotFound)
+	}
+
+	return event, access, nil
+}
+
+// UpdateEvent изменяет событие, если event.Version совпадает с текущей версией события.
+// Нулевая версия означает изменение текущей версии события без проверки.
+func (a *App) UpdateEvent(
+	ctx context.Context,
+	id uuid.UUID,
+	userID uuid.UUID,
+	event storage.Event,
+	allowOverlap bool,
+) (res storage.Event, err error) {
+	// чтение, проверки и запись - в одной транзакции, чтобы между ними событие не изменили
+	err = a.storage.WithTx(ctx, func(tx Storage) error {
+		res, err = a.withStorage(tx).updateEvent(ctx, id, userID, event, allowOverlap)
+		return err
+	})
+	return res, err
+}
+
+// PatchEvent изменяет часть полей события: patch применяется к текущему событию в той же транзакции, что и
+// запись. Версия события для проверки берётся только из patch, без неё событие изменяется без проверки.
+func (a *App) PatchEvent(
+	ctx context.Context,
+	id uuid.UUID,
+	userID uuid.UUID,
+	patch func(event *storage.Event) error,
+	allowOverlap bool,
+) (res storage.Event, err error) {
+	err = a.storage.WithTx(ctx, func(tx Storage) error {
+		txApp := a.withStorage(tx)
+		event, err := txApp.getWritableEvent(ctx, id, userID)
+		if err != nil {
+			return err
+		}
+		event.Version = 0
+		if err := patch(&event); err != nil {
+			return err
+		}
+		res, err = txApp.updateEvent(ctx, id, userID, event, allowOverlap)
+		return err
+	})
+	return res, err
+}
+
+func (a *App) updateEvent(
+	ctx context.Context,
+	id uuid.UUID,
+	userID uuid.UUID,
+	event storage.Event,
+	allowOverlap bool,
+) (storage.Event, error) {
+	event = withEndDate(event)
+	if err := validateEvent(event); err != nil {
+		return storage.Event{}, err
+	}
+	event.Tags = normalizeTags(event.Tags)
+	event = normalizeAllDay(event)
+	// проверка на наличие в хранилище и на право изменять событие
+	stored, err := a.getWritableEvent(ctx, id, userID)
 	if err != nil {
 		return storage.Event{}, err
 	}
+	if event.Version == 0 {
+		event.Version = stored.Version
+	}
+	if event.Version != stored.Version {
+		return storage.Event{}, fmt.Errorf("%w: current version is %d", ErrVersionMismatch, stored.Version)
+	}
 	// допускаем, что пришлют объект с другим ID и userID, и чтобы не проапдейтить не то событие
-	// затрём эти айдишки целевыми значениями
+	// затрём эти айдишки целевыми значениями. Владелец события не меняется, даже если его изменяет
+	// пользователь с доступом на запись к календарю.
 	event.ID = id
-	event.UserID = userID
+	event.UserID = stored.UserID
+	event.DeletedAt = time.Time{}
+	event.Attendees = inviteAttendees(stored.UserID, event.Attendees, stored.Attendees)
+	event.Reminders = normalizeReminders(event.Reminders, stored.Reminders)
+	if event.CalendarID != stored.CalendarID {
+		if err := a.checkCalendarWrite(ctx, event.CalendarID, userID); err != nil {
+			return storage.Event{}, err
+		}
+	}
 
-	err = a.storage.UpdateEvent(event)
+	if !allowOverlap {
+		if err := a.checkOverlap(ctx, event); err != nil {
+			return storage.Event{}, err
+		}
+	}
+
+	err = a.storage.UpdateEvent(ctx, event)
 	if err != nil {
+		return storage.Event{}, convertStorageErr(err)
+	}
+	event.Version++
+	if len(event.Tags) > 0 {
+		// метки без цвета получают цвет уже существующих меток владельца
+		updated, err := a.storage.GetEvent(ctx, id)
+		if err != nil {
+			return storage.Event{}, convertStorageErr(err)
+		}
+		event.Tags = updated.Tags
+	}
+	if err = a.recordHistory(ctx, storage.ActionUpdate, userID, stored, event); err != nil {
 		return storage.Event{}, err
 	}
 
 	return event, nil
 }
 
-func (a *App) DeleteEvent(id uuid.UUID, userID uuid.UUID) error {
-	event, err := a.storage.GetEvent(id)
+// DeleteEvent перемещает событие в корзину, если version совпадает с текущей версией события (0 - без проверки).
+func (a *App) DeleteEvent(ctx context.Context, id uuid.UUID, userID uuid.UUID, version int64) error {
+	return a.storage.WithTx(ctx, func(tx Storage) error {
+		return a.withStorage(tx).trashEvent(ctx, id, userID, version)
+	})
+}
+
+func (a *App) trashEvent(ctx context.Context, id uuid.UUID, userID uuid.UUID, version int64) error {
+	event, err := a.getWritableEvent(ctx, id, userID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, storage.ErrEventNotFound) {
-			err = ErrNotFound
+		return err
+	}
+
+	trashed := event
+	trashed.DeletedAt = time.Now()
+	if err = a.storage.TrashEvent(ctx, id, version, trashed.DeletedAt); err != nil {
+		return convertStorageErr(err)
+	}
+	return a.recordHistory(ctx, storage.ActionDelete, userID, event, trashed)
+}
+
+// RespondToInvitation сохраняет ответ участника на приглашение. Версия события при этом не меняется.
+func (a *App) RespondToInvitation(
+	ctx context.Context,
+	id uuid.UUID,
+	userID uuid.UUID,
+	status storage.RSVPStatus,
+) (res storage.Event, err error) {
+	if !status.IsValid() {
+		return storage.Event{}, fmt.Errorf("%w: unknown RSVP status '%s'", ErrInvalidQuery, status)
+	}
+	err = a.storage.WithTx(ctx, func(tx Storage) error {
+		res, err = a.withStorage(tx).respondToInvitation(ctx, id, userID, status)
+		return err
+	})
+	return res, err
+}
+
+func (a *App) respondToInvitation(
+	ctx context.Context,
+	id uuid.UUID,
+	userID uuid.UUID,
+	status storage.RSVPStatus,
+) (storage.Event, error) {
+	event, err := a.GetEvent(ctx, id, userID)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if !event.Attendees.Contains(userID) {
+		return storage.Event{}, fmt.Errorf("%w: user is not invited", ErrAccessDenied)
+	}
+
+	if err = a.storage.SetAttendeeStatus(ctx, id, userID, status); err != nil {
+		return storage.Event{}, convertStorageErr(err)
+	}
+	responded := event
+	responded.Attendees = make(storage.Attendees, len(event.Attendees))
+	for i, v := range event.Attendees {
+		if v.UserID == userID {
+			v.Status = status
 		}
+		responded.Attendees[i] = v
+	}
+	if err = a.recordHistory(ctx, storage.ActionUpdate, userID, event, responded); err != nil {
+		return storage.Event{}, err
+	}
+
+	return responded, nil
+}
+
+// RestoreEvent возвращает событие из корзины, если version совпадает с текущей версией события (0 - без проверки).
+func (a *App) RestoreEvent(
+	ctx context.Context,
+	id uuid.UUID,
+	userID uuid.UUID,
+	version int64,
+	allowOverlap bool,
+) (res storage.Event, err error) {
+	err = a.storage.WithTx(ctx, func(tx Storage) error {
+		res, err = a.withStorage(tx).restoreEvent(ctx, id, userID, version, allowOverlap)
 		return err
+	})
+	return res, err
+}
+
+func (a *App) restoreEvent(
+	ctx context.Context,
+	id uuid.UUID,
+	userID uuid.UUID,
+	version int64,
+	allowOverlap bool,
+) (storage.Event, error) {
+	event, err := a.storage.GetEvent(ctx, id)
+	if err != nil {
+		return storage.Event{}, convertStorageErr(err)
+	}
+	access, err := a.eventAccess(ctx, event, userID)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if !access.Allows(storage.AccessWrite) {
+		return storage.Event{}, ErrAccessDenied
+	}
+	if !event.IsTrashed() {
+		return storage.Event{}, fmt.Errorf("%w: event is not in trash", ErrNotFound)
+	}
+	if version != 0 && version != event.Version {
+		return storage.Event{}, fmt.Errorf("%w: current version is %d", ErrVersionMismatch, event.Version)
+	}
+
+	restored := event
+	restored.DeletedAt = time.Time{}
+	if !allowOverlap {
+		if err := a.checkOverlap(ctx, restored); err != nil {
+			return storage.Event{}, err
+		}
+	}
+
+	if err = a.storage.RestoreEvent(ctx, id, event.Version); err != nil {
+		return storage.Event{}, convertStorageErr(err)
 	}
-	if event.UserID != userID {
-		return ErrAccessDenied
+	restored.Version++
+	if err = a.recordHistory(ctx, storage.ActionRestore, userID, event, restored); err != nil {
+		return storage.Event{}, err
+	}
+
+	return restored, nil
+}
+
+// GetTrashedEvents возвращает события пользователя из корзины со всеми метками tags, последние удалённые - первыми.
+func (a *App) GetTrashedEvents(ctx context.Context, userID uuid.UUID, tags []string) ([]storage.Event, error) {
+	tagConds, err := tagFilter(tags)
+	if err != nil {
+		return nil, err
+	}
+	filter := append([]storage.EventCondition{
+		{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
+		{Field: storage.EventDeletedAt, Type: storage.TypeMore, Sample: time.Time{}},
+	}, tagConds...)
+	order := []storage.EventSort{
+		{Field: storage.EventDeletedAt, Direction: storage.DirectionDesc},
 	}
 
-	return a.storage.DeleteEvent(id)
+	return a.storage.GetEvents(ctx, filter, order, storage.Page{})
 }
 
-func (a *App) GetEventsForPeriod(userID uuid.UUID, startDate, endDate time.Time) ([]storage.Event, error) {
+// GetUserEvents возвращает все события пользователя (кроме событий в корзине) без разворачивания повторений.
+func (a *App) GetUserEvents(ctx context.Context, userID uuid.UUID) ([]storage.Event, error) {
 	filter := []storage.EventCondition{
 		{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
-		{Field: storage.EventStartDate, Type: storage.TypeMoreOrEq, Sample: startDate},
-		{Field: storage.EventStartDate, Type: storage.TypeLessOrEq, Sample: endDate},
 	}
-	sort := []storage.EventSort{
+	order := []storage.EventSort{
+		{Field: storage.EventStartDate, Direction: storage.DirectionAsc},
+	}
+
+	return a.storage.GetEvents(ctx, filter, order, storage.Page{})
+}
+
+// GetEventHistory возвращает журнал изменений события в хронологическом порядке, в том числе для событий в корзине.
+func (a *App) GetEventHistory(ctx context.Context, id uuid.UUID, userID uuid.UUID) ([]storage.HistoryRecord, error) {
+	event, err := a.storage.GetEvent(ctx, id)
+	if err != nil {
+		return nil, convertStorageErr(err)
+	}
+	access, err := a.eventAccess(ctx, event, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !access.Allows(storage.AccessRead) {
+		return nil, ErrAccessDenied
+	}
+
+	return a.storage.GetHistory(ctx, id)
+}
+
+// getWritableEvent возвращает событие, которое пользователь может изменять: владельцу события и пользователям
+// с доступом на запись к его календарю. Участникам доступно только чтение.
+func (a *App) getWritableEvent(ctx context.Context, id uuid.UUID, userID uuid.UUID) (storage.Event, error) {
+	event, access, err := a.getEventWithAccess(ctx, id, userID)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if !access.Allows(storage.AccessWrite) {
+		return storage.Event{}, fmt.Errorf("%w: no write access to event", ErrAccessDenied)
+	}
+
+	return event, nil
+}
+
+// eventAccess возвращает уровень доступа пользователя к событию: владельцу события - запись, остальным -
+// по доступу к календарю события, участникам - не ниже чтения. Пустой уровень - доступа нет.
+func (a *App) eventAccess(ctx context.Context, event storage.Event, userID uuid.UUID) (storage.Access, error) {
+	if event.UserID == userID {
+		return storage.AccessWrite, nil
+	}
+
+	var access storage.Access
+	if event.CalendarID != (uuid.UUID{}) {
+		calendar, err := a.storage.GetCalendar(ctx, event.CalendarID)
+		if err != nil && !errors.Is(err, storage.ErrCalendarNotFound) {
+			return "", err
+		}
+		access = calendar.AccessFor(userID)
+	}
+	if event.Attendees.Contains(userID) && !access.Allows(storage.AccessRead) {
+		access = storage.AccessRead
+	}
+
+	return access, nil
+}
+
+// recordHistory пишет изменение события в журнал в транзакции изменения: если записать историю не удалось,
+// изменение тоже не сохраняется.
+func (a *App) recordHistory(
+	ctx context.Context,
+	action storage.HistoryAction,
+	userID uuid.UUID,
+	before, after storage.Event,
+) error {
+	record := storage.HistoryRecord{
+		EventID:   after.ID,
+		UserID:    userID,
+		Action:    action,
+		CreatedAt: time.Now(),
+		Changes:   storage.DiffEvents(before, after),
+	}
+	if err := a.storage.AddHistory(ctx, record); err != nil {
+		return fmt.Errorf("failed to write event history: %w", err)
+	}
+	return nil
+}
+
+// GetEventsForPeriod возвращает события пользователя (свои, из доступных ему календарей и те, куда он приглашён)
+// и экземпляры повторяющихся событий, пересекающиеся с периодом [startDate, endDate]. События на целые дни
+// берутся по числам периода в поясе startDate. При доступе free-busy от события остаётся только занятое время.
+// При постраничной выборке события упорядочены по (StartDate, ID), возвращается не больше page.Limit событий
+// после курсора page.After и курсор следующей страницы (пустой, если страница последняя).
+// Непустой tags оставляет только события со всеми этими метками.
+func (a *App) GetEventsForPeriod(
+	ctx context.Context,
+	userID uuid.UUID,
+	startDate, endDate time.Time,
+	page storage.Page,
+	tags []string,
+) ([]storage.Event, storage.Cursor, error) {
+	if page.Limit < 0 {
+		return nil, storage.Cursor{}, fmt.Errorf("%w: negative limit", ErrInvalidQuery)
+	}
+	tagConds, err := tagFilter(tags)
+	if err != nil {
+		return nil, storage.Cursor{}, err
+	}
+
+	calendars, err := a.storage.GetCalendars(ctx, userID)
+	if err != nil {
+		return nil, storage.Cursor{}, err
+	}
+	ownOrInvited := storage.Or(
+		storage.EventCondition{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
+		storage.EventCondition{Field: storage.EventAttendees, Type: storage.TypeEq, Sample: userID},
+	)
+	ids := make([]uuid.UUID, 0, len(calendars))
+	for _, c := range calendars {
+		// по меткам событий календаря с доступом free-busy можно было бы узнать, какие у них метки
+		if len(tags) == 0 || c.AccessFor(userID).Allows(storage.AccessRead) {
+			ids = append(ids, c.ID)
+		}
+	}
+	if len(ids) > 0 {
+		ownOrInvited.Conditions = append(
+			ownOrInvited.Conditions,
+			storage.EventCondition{Field: storage.EventCalendarID, Type: storage.TypeIn, Sample: ids},
+		)
+	}
+	filter := []storage.EventCondition{
+		ownOrInvited,
+		{Field: storage.EventRRule, Type: storage.TypeEq, Sample: ""},
+	}
+	filter = append(filter, periodFilter(startDate, endDate)...)
+	filter = append(filter, tagConds...)
+	order := []storage.EventSort{
 		{Field: storage.EventStartDate, Direction: storage.DirectionAsc},
 		{Field: storage.EventEndDate, Direction: storage.DirectionAsc},
 	}
+	// Берём на одно событие больше, чтобы понять, есть ли следующая страница
+	storagePage := page
+	if page.Limit > 0 {
+		storagePage.Limit = page.Limit + 1
+	}
+
+	events, err := a.storage.GetEvents(ctx, filter, order, storagePage)
+	if err != nil {
+		return nil, storage.Cursor{}, err
+	}
+	hideBusyOnly(events, userID, calendars)
 
-	return a.storage.GetEvents(filter, sort)
+	// Повторяющиеся события, начавшиеся до конца периода, разворачиваем в экземпляры
+	filter = []storage.EventCondition{
+		ownOrInvited,
+		{Field: storage.EventRRule, Type: storage.TypeNotEq, Sample: ""},
+		{Field: storage.EventStartDate, Type: storage.TypeLessOrEq, Sample: latest(endDate, floating(endDate))},
+	}
+	filter = append(filter, tagConds...)
+	recurring, err := a.storage.GetEvents(ctx, filter, []storage.EventSort{}, storage.Page{})
+	if err != nil {
+		return nil, storage.Cursor{}, err
+	}
+	hideBusyOnly(recurring, userID, calendars)
+
+	for _, event := range recurring {
+		from, to := startDate, endDate
+		if event.AllDay {
+			from, to = floating(startDate), floating(endDate)
+		}
+		// экземпляры, начавшиеся раньше периода, но ещё не закончившиеся к его началу
+		occurrences, err := event.Occurrences(from.Add(-1*event.EndDate.Sub(event.StartDate)), to)
+		if err != nil {
+			return nil, storage.Cursor{}, err
+		}
+		for _, o := range occurrences {
+			if (o.EndDate.After(from) || !o.StartDate.Before(from)) && page.After.Before(o) {
+				events = append(events, o)
+			}
+		}
+	}
+
+	if page.IsZero() {
+		sort.SliceStable(events, func(i, j int) bool {
+			if !events[i].StartDate.Equal(events[j].StartDate) {
+				return events[i].StartDate.Before(events[j].StartDate)
+			}
+			return events[i].EndDate.Before(events[j].EndDate)
+		})
+		return events, storage.Cursor{}, nil
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return storage.CursorOf(events[i]).Before(events[j])
+	})
+	var next storage.Cursor
+	if page.Limit > 0 && len(events) > page.Limit {
+		events = events[:page.Limit]
+		next = storage.CursorOf(events[len(events)-1])
+	}
+
+	return events, next, nil
+}
+
+// ExportEvents возвращает события пользователя за период для выгрузки. Повторяющиеся события выгружаются
+// один раз целиком, а не экземплярами.
+func (a *App) ExportEvents(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]storage.Event, error) {
+	events, _, err := a.GetEventsForPeriod(ctx, userID, start, end, storage.Page{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]storage.Event, 0, len(events))
+	seen := make(map[uuid.UUID]struct{})
+	for _, e := range events {
+		if !e.IsRecurring() {
+			res = append(res, e)
+			continue
+		}
+		if _, ok := seen[e.ID]; ok {
+			continue
+		}
+		seen[e.ID] = struct{}{}
+		series, err := a.GetEvent(ctx, e.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, series)
+	}
+
+	return res, nil
+}
+
+// GetFreeBusy возвращает занятое время пользователей в периоде [start, end) без подробностей событий,
+// в порядке запроса без повторов. Занятость видна любому пользователю.
+func (a *App) GetFreeBusy(ctx context.Context, userIDs []uuid.UUID, start, end time.Time) ([]storage.FreeBusy, error) {
+	switch {
+	case len(userIDs) == 0:
+		return nil, fmt.Errorf("%w: no users", ErrInvalidQuery)
+	case len(userIDs) > freeBusyMaxUsers:
+		return nil, fmt.Errorf("%w: too many users, max %d", ErrInvalidQuery, freeBusyMaxUsers)
+	case !end.After(start):
+		return nil, fmt.Errorf("%w: end of period must be after start", ErrInvalidQuery)
+	case end.Sub(start) > freeBusyMaxPeriod:
+		return nil, fmt.Errorf("%w: period is too long, max %s", ErrInvalidQuery, freeBusyMaxPeriod)
+	}
+
+	ids := make([]uuid.UUID, 0, len(userIDs))
+	for _, id := range userIDs {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	busy, err := a.storage.GetBusyIntervals(ctx, ids, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]storage.FreeBusy, len(ids))
+	for i, id := range ids {
+		res[i] = storage.FreeBusy{UserID: id, Busy: busy[id]}
+		if res[i].Busy == nil {
+			res[i].Busy = []storage.Interval{}
+		}
+	}
+	return res, nil
+}
+
+// SearchEvents ищет события пользователя со всеми метками tags, в названии или описании которых есть все слова
+// из query.
+func (a *App) SearchEvents(
+	ctx context.Context,
+	userID uuid.UUID,
+	query string,
+	tags []string,
+) ([]storage.Event, error) {
+	if len(storage.Tokenize(query)) == 0 {
+		return nil, fmt.Errorf("%w: empty search query", ErrInvalidQuery)
+	}
+	tagConds, err := tagFilter(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := append([]storage.EventCondition{
+		{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
+		{Field: storage.EventText, Type: storage.TypeMatch, Sample: query},
+	}, tagConds...)
+	order := []storage.EventSort{
+		{Field: storage.EventStartDate, Direction: storage.DirectionAsc},
+	}
+
+	return a.storage.GetEvents(ctx, filter, order, storage.Page{})
+}
+
+// checkOverlap проверяет, что событие (все его экземпляры в пределах горизонта) не пересекается
+// с другими событиями того же пользователя. События на целые дни время не занимают и не проверяются.
+func (a *App) checkOverlap(ctx context.Context, event storage.Event) error {
+	if event.AllDay {
+		return nil
+	}
+	// без блокировки параллельные транзакции могут обе пройти проверку и добавить пересекающиеся события
+	if err := a.storage.LockUser(ctx, event.UserID); err != nil {
+		return err
+	}
+	to := event.StartDate
+	if event.IsRecurring() {
+		to = event.StartDate.Add(overlapHorizon)
+	}
+	own, err := event.Occurrences(event.StartDate, to)
+	if err != nil {
+		return err
+	}
+	if len(own) == 0 {
+		return nil
+	}
+
+	busy, err := a.busyEvents(ctx, event.UserID, event.ID, own[0].StartDate, own[len(own)-1].EndDate)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range own {
+		for _, b := range busy {
+			if !b.StartDate.Before(o.EndDate) {
+				break
+			}
+			if b.EndDate.After(o.StartDate) {
+				return fmt.Errorf(
+					"%w: overlaps with event %s at %s",
+					ErrDateBusy,
+					b.ID,
+					b.StartDate.Format(time.DateTime),
+				)
+			}
+		}
+	}
+
+	return nil
+}
+
+// busyEvents возвращает экземпляры событий пользователя (кроме excludeID), пересекающиеся с [from, to),
+// отсортированные по дате начала.
+func (a *App) busyEvents(
+	ctx context.Context,
+	userID, excludeID uuid.UUID,
+	from, to time.Time,
+) ([]storage.Event, error) {
+	filter := []storage.EventCondition{
+		{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
+		{Field: storage.EventID, Type: storage.TypeNotEq, Sample: excludeID},
+		{Field: storage.EventRRule, Type: storage.TypeEq, Sample: ""},
+		{Field: storage.EventAllDay, Type: storage.TypeEq, Sample: false},
+		{Field: storage.EventStartDate, Type: storage.TypeLess, Sample: to},
+		{Field: storage.EventEndDate, Type: storage.TypeMore, Sample: from},
+	}
+	order := []storage.EventSort{
+		{Field: storage.EventStartDate, Direction: storage.DirectionAsc},
+	}
+	events, err := a.storage.GetEvents(ctx, filter, order, storage.Page{})
+	if err != nil {
+		return nil, err
+	}
+
+	filter = []storage.EventCondition{
+		{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
+		{Field: storage.EventID, Type: storage.TypeNotEq, Sample: excludeID},
+		{Field: storage.EventRRule, Type: storage.TypeNotEq, Sample: ""},
+		{Field: storage.EventAllDay, Type: storage.TypeEq, Sample: false},
+		{Field: storage.EventStartDate, Type: storage.TypeLess, Sample: to},
+	}
+	recurring, err := a.storage.GetEvents(ctx, filter, []storage.EventSort{}, storage.Page{})
+	if err != nil {
+		return nil, err
+	}
+	if len(recurring) == 0 {
+		return events, nil
+	}
+
+	for _, r := range recurring {
+		occurrences, err := r.Occurrences(from.Add(-1*r.EndDate.Sub(r.StartDate)), to)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range occurrences {
+			if o.StartDate.Before(to) && o.EndDate.After(from) {
+				events = append(events, o)
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].StartDate.Before(events[j].StartDate)
+	})
+
+	return events, nil
+}
+
+// convertStorageErr приводит ошибки хранилища к ошибкам приложения.
+func convertStorageErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows) || errors.Is(err, storage.ErrEventNotFound),
+		errors.Is(err, storage.ErrCalendarNotFound):
+		return ErrNotFound
+	case errors.Is(err, storage.ErrVersionConflict):
+		return fmt.Errorf("%w: %s", ErrVersionMismatch, err)
+	case errors.Is(err, storage.ErrAttendeeNotFound):
+		return fmt.Errorf("%w: %s", ErrAccessDenied, err)
+	case errors.Is(err, storage.ErrEventExists):
+		return fmt.Errorf("%w: %s", ErrEventExists, err)
+	default:
+		return err
+	}
+}
+
+// inviteAttendees составляет список участников: без владельца и повторов, упорядоченный по ID пользователя.
+// Ответы уже приглашённых участников сохраняются, новые участники ещё не ответили.
+func inviteAttendees(ownerID uuid.UUID, requested, existing storage.Attendees) storage.Attendees {
+	if len(requested) == 0 {
+		return nil
+	}
+
+	res := make(storage.Attendees, 0, len(requested))
+	for _, v := range requested {
+		if v.UserID == ownerID || res.Contains(v.UserID) {
+			continue
+		}
+		attendee, ok := existing.Find(v.UserID)
+		if !ok {
+			attendee = storage.Attendee{UserID: v.UserID, Status: storage.RSVPNeedsAction}
+		}
+		res = append(res, attendee)
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return bytes.Compare(res[i].UserID[:], res[j].UserID[:]) < 0
+	})
+
+	return res
+}
+
+// normalizeTags убирает пробелы по краям названий меток и повторы, упорядочивает метки по названию.
+func normalizeTags(tags storage.Tags) storage.Tags {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	res := make(storage.Tags, 0, len(tags))
+	for _, v := range tags {
+		v.Name = strings.TrimSpace(v.Name)
+		v.Color = strings.TrimSpace(v.Color)
+		if !res.Contains(v.Name) {
+			res = append(res, v)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+
+	return res
+}
+
+// normalizeReminders убирает повторы напоминаний и упорядочивает их по Before. Время отправки берётся
+// у такого же напоминания из existing: клиент его не задаёт, а прежние напоминания не должны отправляться повторно.
+func normalizeReminders(reminders, existing storage.Reminders) storage.Reminders {
+	if len(reminders) == 0 {
+		return nil
+	}
+
+	res := make(storage.Reminders, 0, len(reminders))
+	for _, v := range reminders {
+		if _, ok := res.Find(v.Before); ok {
+			continue
+		}
+		old, _ := existing.Find(v.Before)
+		res = append(res, storage.Reminder{Before: v.Before, NotifiedAt: old.NotifiedAt})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Before < res[j].Before
+	})
+
+	return res
+}
+
+// normalizeAllDay приводит даты события на целые дни к полуночи UTC: начало - к числу StartDate в его поясе,
+// окончание - к полуночи после последнего дня (EndDate не в полночь округляется вверх), но не раньше следующего
+// дня после начала.
+func normalizeAllDay(event storage.Event) storage.Event {
+	if !event.AllDay {
+		return event
+	}
+
+	event.StartDate = dateOf(event.StartDate)
+	end := dateOf(event.EndDate)
+	if !end.Equal(floating(event.EndDate)) {
+		end = end.AddDate(0, 0, 1)
+	}
+	if !end.After(event.StartDate) {
+		end = event.StartDate.AddDate(0, 0, 1)
+	}
+	event.EndDate = end
+	if event.ExDates != nil {
+		dates := make(storage.Dates, len(event.ExDates))
+		for i, d := range event.ExDates {
+			dates[i] = dateOf(d)
+		}
+		event.ExDates = dates
+	}
+
+	return event
+}
+
+// withEndDate - событие без даты окончания заканчивается в момент начала, чтобы попадать в выборки за период
+// по дате начала.
+func withEndDate(event storage.Event) storage.Event {
+	if event.EndDate.IsZero() {
+		event.EndDate = event.StartDate
+	}
+	return event
+}
+
+// periodFilter - условия пересечения события с периодом [start, end]: событие начинается не позже конца периода
+// и заканчивается после его начала (событие без длительности - не раньше начала). События на целые дни
+// сравниваются с числами периода, а не с моментами времени.
+func periodFilter(start, end time.Time) []storage.EventCondition {
+	days, daysEnd := floating(start), floating(end)
+	return []storage.EventCondition{
+		// общие границы для обоих видов событий, по ним хранилище выбирает события по индексу
+		{Field: storage.EventStartDate, Type: storage.TypeLessOrEq, Sample: latest(end, daysEnd)},
+		{Field: storage.EventEndDate, Type: storage.TypeMoreOrEq, Sample: earliest(start, days)},
+		storage.Or(
+			storage.And(
+				storage.EventCondition{Field: storage.EventAllDay, Type: storage.TypeEq, Sample: false},
+				storage.EventCondition{Field: storage.EventStartDate, Type: storage.TypeLessOrEq, Sample: end},
+				storage.Or(
+					storage.EventCondition{Field: storage.EventEndDate, Type: storage.TypeMore, Sample: start},
+					storage.EventCondition{Field: storage.EventStartDate, Type: storage.TypeMoreOrEq, Sample: start},
+				),
+			),
+			storage.And(
+				storage.EventCondition{Field: storage.EventAllDay, Type: storage.TypeEq, Sample: true},
+				storage.EventCondition{Field: storage.EventStartDate, Type: storage.TypeLessOrEq, Sample: daysEnd},
+				storage.EventCondition{Field: storage.EventEndDate, Type: storage.TypeMore, Sample: days},
+			),
+		),
+	}
+}
+
+// floating - момент в UTC с теми же числом и временем на часах, что у t. В таком виде хранятся даты
+// событий на целые дни.
+func floating(t time.Time) time.Time {
+	return storage.WallClock(t, time.UTC)
+}
+
+// dateOf - полночь UTC числа t в поясе t.
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// tagFilter - условия на то, что у события есть все метки tags.
+func tagFilter(tags []string) ([]storage.EventCondition, error) {
+	res := make([]storage.EventCondition, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			return nil, fmt.Errorf("%w: empty tag", ErrInvalidQuery)
+		}
+		res = append(res, storage.EventCondition{Field: storage.EventTags, Type: storage.TypeEq, Sample: tag})
+	}
+	return res, nil
+}
+
+func validateEvent(event storage.Event) error {
+	if event.EndDate.Before(event.StartDate) {
+		return fmt.Errorf("%w: end date is before start date", ErrInvalidEvent)
+	}
+	for _, tag := range event.Tags {
+		name := strings.TrimSpace(tag.Name)
+		switch {
+		case name == "":
+			return fmt.Errorf("%w: empty tag name", ErrInvalidEvent)
+		case utf8.RuneCountInString(name) > tagNameMaxLen:
+			return fmt.Errorf("%w: tag name is too long, max %d", ErrInvalidEvent, tagNameMaxLen)
+		case utf8.RuneCountInString(strings.TrimSpace(tag.Color)) > tagColorMaxLen:
+			return fmt.Errorf("%w: tag color is too long, max %d", ErrInvalidEvent, tagColorMaxLen)
+		}
+	}
+	if len(event.Reminders) > remindersMaxCount {
+		return fmt.Errorf("%w: too many reminders, max %d", ErrInvalidEvent, remindersMaxCount)
+	}
+	for _, r := range event.Reminders {
+		if r.Before < 0 {
+			return fmt.Errorf("%w: reminder after event start", ErrInvalidEvent)
+		}
+	}
+	if _, err := event.Location(); err != nil {
+		return fmt.Errorf("%w: unknown time zone %q", ErrInvalidEvent, event.TimeZone)
+	}
+	if event.RRule == "" {
+		return nil
+	}
+	if _, err := rrule.Parse(event.RRule); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidEvent, err)
+	}
+	return nil
 }
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+type BatchAction string
+
+const (
+	BatchCreate BatchAction = "create"
+	BatchUpdate BatchAction = "update"
+	BatchDelete BatchAction = "delete"
+)
+
+// Ограничение размера пакета, чтобы одна транзакция не держала хранилище слишком долго.
+const maxBatchSize = 1000
+
+var (
+	ErrInvalidBatch = errors.New("invalid batch")
+	// ErrBatchAborted - операция не применена, потому что в атомарном пакете не выполнилась другая операция.
+	ErrBatchAborted = errors.New("batch aborted")
+)
+
+// BatchOperation - операция пакета: создание события Event, изменение или удаление события ID.
+// Ожидаемая версия при изменении и удалении берётся из Event.Version (0 - без проверки).
+// Если задана Patch, при изменении событие не заменяется на Event, а Patch применяется к текущему
+// состоянию события (внутри транзакции, поэтому видны изменения предыдущих операций пакета).
+type BatchOperation struct {
+	Action BatchAction
+	ID     uuid.UUID
+	Event  storage.Event
+	Patch  func(event *storage.Event) error
+}
+
+// BatchResult - результат операции пакета: созданное или изменённое событие (при удалении - только ID) или ошибка.
+type BatchResult struct {
+	Event storage.Event
+	Err   error
+}
+
+// BatchEvents применяет операции по порядку, каждая следующая видит результат предыдущих. В атомарном режиме
+// применяются либо все операции, либо ни одной: при первой ошибке изменения откатываются, а остальные
+// операции получают ErrBatchAborted. Иначе каждая операция применяется (или нет) независимо от других.
+func (a *App) BatchEvents(
+	ctx context.Context,
+	userID uuid.UUID,
+	ops []BatchOperation,
+	atomic bool,
+	allowOverlap bool,
+) ([]BatchResult, error) {
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("%w: no operations", ErrInvalidBatch)
+	}
+	if len(ops) > maxBatchSize {
+		return nil, fmt.Errorf("%w: too many operations, max %d", ErrInvalidBatch, maxBatchSize)
+	}
+
+	results := make([]BatchResult, len(ops))
+	if !atomic {
+		for i, op := range ops {
+			err := a.storage.WithTx(ctx, func(tx Storage) error {
+				results[i].Event, results[i].Err = a.withStorage(tx).applyOperation(ctx, userID, op, allowOverlap)
+				return results[i].Err
+			})
+			if err != nil && results[i].Err == nil {
+				results[i] = BatchResult{Err: err}
+			}
+		}
+		return results, nil
+	}
+
+	failed := -1
+	err := a.storage.WithTx(ctx, func(tx Storage) error {
+		txApp := a.withStorage(tx)
+		for i, op := range ops {
+			res, err := txApp.applyOperation(ctx, userID, op, allowOverlap)
+			if err != nil {
+				failed = i
+				return err
+			}
+			results[i].Event = res
+		}
+		return nil
+	})
+	switch {
+	case failed >= 0:
+		for i := range results {
+			results[i] = BatchResult{Err: ErrBatchAborted}
+		}
+		results[failed].Err = err
+	case err != nil:
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func (a *App) applyOperation(
+	ctx context.Context,
+	userID uuid.UUID,
+	op BatchOperation,
+	allowOverlap bool,
+) (storage.Event, error) {
+	switch op.Action {
+	case BatchCreate:
+		return a.CreateEvent(ctx, userID, op.Event, allowOverlap)
+	case BatchUpdate:
+		event := op.Event
+		if op.Patch != nil {
+			stored, err := a.GetEvent(ctx, op.ID, userID)
+			if err != nil {
+				return storage.Event{}, err
+			}
+			event = stored
+			if err = op.Patch(&event); err != nil {
+				return storage.Event{}, fmt.Errorf("%w: %w", ErrInvalidEvent, err)
+			}
+		}
+		return a.UpdateEvent(ctx, op.ID, userID, event, allowOverlap)
+	case BatchDelete:
+		if err := a.DeleteEvent(ctx, op.ID, userID, op.Event.Version); err != nil {
+			return storage.Event{}, err
+		}
+		return storage.Event{ID: op.ID}, nil
+	default:
+		return storage.Event{}, fmt.Errorf("%w: unknown action '%s'", ErrInvalidBatch, op.Action)
+	}
+}
+
+// withStorage возвращает копию приложения, работающую с другим хранилищем (например, с транзакцией).
+func (a *App) withStorage(s Storage) *App {
+	return &App{logger: a.logger, storage: s}
+}
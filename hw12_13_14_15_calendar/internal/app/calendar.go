@@ -0,0 +1,231 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+var (
+	ErrInvalidCalendar = errors.New("invalid calendar")
+	// ErrCalendarNotEmpty - в календаре есть события (в том числе в корзине), удалить его нельзя.
+	ErrCalendarNotEmpty = errors.New("calendar is not empty")
+)
+
+func (a *App) CreateCalendar(
+	ctx context.Context,
+	userID uuid.UUID,
+	calendar storage.Calendar,
+) (storage.Calendar, error) {
+	calendar.OwnerID = userID
+	calendar, err := normalizeCalendar(calendar)
+	if err != nil {
+		return storage.Calendar{}, err
+	}
+
+	return a.storage.AddCalendar(ctx, calendar)
+}
+
+// UpdateCalendar изменяет название, цвет и доступы календаря, изменять календарь может только владелец.
+func (a *App) UpdateCalendar(
+	ctx context.Context,
+	id uuid.UUID,
+	userID uuid.UUID,
+	calendar storage.Calendar,
+) (storage.Calendar, error) {
+	if _, err := a.getOwnCalendar(ctx, id, userID); err != nil {
+		return storage.Calendar{}, err
+	}
+
+	calendar.ID = id
+	calendar.OwnerID = userID
+	calendar, err := normalizeCalendar(calendar)
+	if err != nil {
+		return storage.Calendar{}, err
+	}
+	if err = a.storage.UpdateCalendar(ctx, calendar); err != nil {
+		return storage.Calendar{}, convertStorageErr(err)
+	}
+
+	return calendar, nil
+}
+
+// DeleteCalendar удаляет пустой календарь, удалять календарь может только владелец.
+func (a *App) DeleteCalendar(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	if _, err := a.getOwnCalendar(ctx, id, userID); err != nil {
+		return err
+	}
+
+	// события из корзины тоже считаются, иначе после восстановления они остались бы без календаря
+	filter := []storage.EventCondition{
+		{Field: storage.EventCalendarID, Type: storage.TypeEq, Sample: id},
+		storage.Or(
+			storage.EventCondition{Field: storage.EventDeletedAt, Type: storage.TypeEq, Sample: time.Time{}},
+			storage.EventCondition{Field: storage.EventDeletedAt, Type: storage.TypeMore, Sample: time.Time{}},
+		),
+	}
+	events, err := a.storage.GetEvents(ctx, filter, []storage.EventSort{}, storage.Page{Limit: 1})
+	if err != nil {
+		return err
+	}
+	if len(events) > 0 {
+		return ErrCalendarNotEmpty
+	}
+
+	return convertStorageErr(a.storage.DeleteCalendar(ctx, id))
+}
+
+// GetCalendar возвращает календарь владельцу или пользователю с доступом к нему. Чужие доступы видны
+// только владельцу.
+func (a *App) GetCalendar(ctx context.Context, id uuid.UUID, userID uuid.UUID) (storage.Calendar, error) {
+	calendar, err := a.storage.GetCalendar(ctx, id)
+	if err != nil {
+		return storage.Calendar{}, convertStorageErr(err)
+	}
+	if calendar.AccessFor(userID) == "" {
+		return storage.Calendar{}, ErrAccessDenied
+	}
+
+	return grantsVisibleTo(calendar, userID), nil
+}
+
+// GetCalendars возвращает календари пользователя и календари, к которым ему дан доступ.
+func (a *App) GetCalendars(ctx context.Context, userID uuid.UUID) ([]storage.Calendar, error) {
+	calendars, err := a.storage.GetCalendars(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range calendars {
+		calendars[i] = grantsVisibleTo(c, userID)
+	}
+
+	return calendars, nil
+}
+
+func (a *App) getOwnCalendar(ctx context.Context, id uuid.UUID, userID uuid.UUID) (storage.Calendar, error) {
+	calendar, err := a.storage.GetCalendar(ctx, id)
+	if err != nil {
+		return storage.Calendar{}, convertStorageErr(err)
+	}
+	if calendar.OwnerID != userID {
+		return storage.Calendar{}, ErrAccessDenied
+	}
+
+	return calendar, nil
+}
+
+// checkCalendarWrite проверяет, что пользователь может добавлять события в календарь. В личные события
+// (нулевой calendarID) может добавлять любой пользователь.
+func (a *App) checkCalendarWrite(ctx context.Context, calendarID uuid.UUID, userID uuid.UUID) error {
+	if calendarID == (uuid.UUID{}) {
+		return nil
+	}
+
+	calendar, err := a.storage.GetCalendar(ctx, calendarID)
+	if err != nil {
+		if errors.Is(err, storage.ErrCalendarNotFound) {
+			return fmt.Errorf("%w: calendar not found", ErrInvalidEvent)
+		}
+		return err
+	}
+	if !calendar.AccessFor(userID).Allows(storage.AccessWrite) {
+		return fmt.Errorf("%w: no write access to calendar", ErrAccessDenied)
+	}
+
+	return nil
+}
+
+// normalizeCalendar проверяет календарь и приводит список доступов: без владельца и повторов (действует
+// последний доступ пользователя), упорядоченный по ID пользователя.
+func normalizeCalendar(calendar storage.Calendar) (storage.Calendar, error) {
+	calendar.Name = strings.TrimSpace(calendar.Name)
+	if calendar.Name == "" {
+		return storage.Calendar{}, fmt.Errorf("%w: empty name", ErrInvalidCalendar)
+	}
+
+	grants := make(storage.Grants, 0, len(calendar.Grants))
+	for _, g := range calendar.Grants {
+		if !g.Access.IsValid() {
+			return storage.Calendar{}, fmt.Errorf("%w: unknown access %q", ErrInvalidCalendar, g.Access)
+		}
+		if g.UserID == calendar.OwnerID {
+			continue
+		}
+		if i := grantIndex(grants, g.UserID); i >= 0 {
+			grants[i] = g
+			continue
+		}
+		grants = append(grants, g)
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		return bytes.Compare(grants[i].UserID[:], grants[j].UserID[:]) < 0
+	})
+	calendar.Grants = nil
+	if len(grants) > 0 {
+		calendar.Grants = grants
+	}
+
+	return calendar, nil
+}
+
+func grantIndex(grants storage.Grants, userID uuid.UUID) int {
+	for i, g := range grants {
+		if g.UserID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+func grantsVisibleTo(calendar storage.Calendar, userID uuid.UUID) storage.Calendar {
+	if calendar.OwnerID == userID {
+		return calendar
+	}
+	g, ok := calendar.Grants.Find(userID)
+	calendar.Grants = nil
+	if ok {
+		calendar.Grants = storage.Grants{g}
+	}
+	return calendar
+}
+
+// busyOnly оставляет от события только занятое время - то, что видно при доступе free-busy.
+func busyOnly(event storage.Event) storage.Event {
+	return storage.Event{
+		ID:         event.ID,
+		StartDate:  event.StartDate,
+		EndDate:    event.EndDate,
+		UserID:     event.UserID,
+		RRule:      event.RRule,
+		ExDates:    event.ExDates,
+		Version:    event.Version,
+		DeletedAt:  event.DeletedAt,
+		CalendarID: event.CalendarID,
+		AllDay:     event.AllDay,
+		TimeZone:   event.TimeZone,
+	}
+}
+
+// hideBusyOnly скрывает подробности событий из календарей, к которым у пользователя доступ free-busy.
+// Свои события и события, куда пользователь приглашён, видны полностью.
+func hideBusyOnly(events []storage.Event, userID uuid.UUID, calendars []storage.Calendar) {
+	access := make(map[uuid.UUID]storage.Access, len(calendars))
+	for _, c := range calendars {
+		access[c.ID] = c.AccessFor(userID)
+	}
+	for i, e := range events {
+		if e.UserID == userID || e.Attendees.Contains(userID) {
+			continue
+		}
+		if !access[e.CalendarID].Allows(storage.AccessRead) {
+			events[i] = busyOnly(e)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+var ErrInvalidWorkingHours = errors.New("invalid working hours")
+
+const (
+	// Предлагаемые слоты начинаются с шагом slotStep от начала часа по часам пользователя, который ищет время.
+	slotStep         = 30 * time.Minute
+	defaultSlotLimit = 5
+	maxSlotLimit     = 50
+)
+
+// GetWorkingHours возвращает рабочее время пользователя, если не настроено - рабочее время по умолчанию.
+func (a *App) GetWorkingHours(ctx context.Context, userID uuid.UUID) (storage.WorkingHours, error) {
+	hours, err := a.storage.GetWorkingHours(ctx, []uuid.UUID{userID})
+	if err != nil {
+		return storage.WorkingHours{}, err
+	}
+	if h, ok := hours[userID]; ok {
+		return h, nil
+	}
+	return storage.DefaultWorkingHours(userID), nil
+}
+
+func (a *App) SetWorkingHours(
+	ctx context.Context,
+	userID uuid.UUID,
+	hours storage.WorkingHours,
+) (storage.WorkingHours, error) {
+	hours.UserID = userID
+	if err := validateWorkingHours(hours); err != nil {
+		return storage.WorkingHours{}, err
+	}
+	if err := a.storage.SetWorkingHours(ctx, hours); err != nil {
+		return storage.WorkingHours{}, err
+	}
+	return hours, nil
+}
+
+// SuggestSlots предлагает первые limit слотов длительностью duration в периоде [start, end), когда свободны
+// все участники (и сам пользователь) и у всех рабочее время. Нулевой limit - слотов по умолчанию.
+func (a *App) SuggestSlots(
+	ctx context.Context,
+	userID uuid.UUID,
+	userIDs []uuid.UUID,
+	duration time.Duration,
+	start, end time.Time,
+	limit int,
+) ([]storage.Interval, error) {
+	switch {
+	case duration <= 0 || duration > 24*time.Hour:
+		return nil, fmt.Errorf("%w: duration must be positive and not longer than 24h", ErrInvalidQuery)
+	case limit < 0 || limit > maxSlotLimit:
+		return nil, fmt.Errorf("%w: limit must be from 0 to %d", ErrInvalidQuery, maxSlotLimit)
+	case limit == 0:
+		limit = defaultSlotLimit
+	}
+
+	ids := []uuid.UUID{userID}
+	for _, id := range userIDs {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	freeBusy, err := a.GetFreeBusy(ctx, ids, start, end)
+	if err != nil {
+		return nil, err
+	}
+	hours, err := a.storage.GetWorkingHours(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	free := []storage.Interval{{Start: start, End: end}}
+	busy := make([]storage.Interval, 0)
+	// слоты начинаются от начала часа по часам пользователя, который ищет время
+	loc := time.UTC
+	for _, fb := range freeBusy {
+		h, ok := hours[fb.UserID]
+		if !ok {
+			h = storage.DefaultWorkingHours(fb.UserID)
+		}
+		if fb.UserID == userID {
+			if loc, err = time.LoadLocation(h.TimeZone); err != nil {
+				return nil, err
+			}
+		}
+		work, err := h.Intervals(start, end)
+		if err != nil {
+			return nil, err
+		}
+		free = intersectIntervals(free, work)
+		busy = append(busy, fb.Busy...)
+	}
+	free = subtractIntervals(free, storage.MergeIntervals(busy))
+
+	slots := make([]storage.Interval, 0, limit)
+	for _, f := range free {
+		for s := ceilTime(f.Start, slotStep, loc); !s.Add(duration).After(f.End); s = s.Add(slotStep) {
+			if len(slots) == limit {
+				return slots, nil
+			}
+			slots = append(slots, storage.Interval{Start: s, End: s.Add(duration)})
+		}
+	}
+
+	return slots, nil
+}
+
+func validateWorkingHours(hours storage.WorkingHours) error {
+	if _, err := time.LoadLocation(hours.TimeZone); err != nil || hours.TimeZone == "" {
+		return fmt.Errorf("%w: unknown time zone '%s'", ErrInvalidWorkingHours, hours.TimeZone)
+	}
+	if hours.Start < 0 || hours.End > 24*time.Hour || hours.Start >= hours.End {
+		return fmt.Errorf("%w: start must be before end within a day", ErrInvalidWorkingHours)
+	}
+	if len(hours.Weekdays) == 0 {
+		return fmt.Errorf("%w: no working days", ErrInvalidWorkingHours)
+	}
+	return nil
+}
+
+// intersectIntervals пересекает два упорядоченных списка непересекающихся интервалов.
+func intersectIntervals(a, b []storage.Interval) []storage.Interval {
+	res := make([]storage.Interval, 0)
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		start, end := a[i].Start, a[i].End
+		if b[j].Start.After(start) {
+			start = b[j].Start
+		}
+		if b[j].End.Before(end) {
+			end = b[j].End
+		}
+		if start.Before(end) {
+			res = append(res, storage.Interval{Start: start, End: end})
+		}
+		if a[i].End.Before(b[j].End) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return res
+}
+
+// subtractIntervals вычитает из упорядоченного списка непересекающихся интервалов такой же список busy.
+func subtractIntervals(free, busy []storage.Interval) []storage.Interval {
+	res := make([]storage.Interval, 0, len(free))
+	j := 0
+	for _, f := range free {
+		for j < len(busy) && !busy[j].End.After(f.Start) {
+			j++
+		}
+		start := f.Start
+		for k := j; k < len(busy) && busy[k].Start.Before(f.End); k++ {
+			if busy[k].Start.After(start) {
+				res = append(res, storage.Interval{Start: start, End: busy[k].Start})
+			}
+			if busy[k].End.After(start) {
+				start = busy[k].End
+			}
+		}
+		if start.Before(f.End) {
+			res = append(res, storage.Interval{Start: start, End: f.End})
+		}
+	}
+	return res
+}
+
+// ceilTime округляет время вверх до кратного d (не больше часа) от начала часа по часам пояса loc.
+// time.Truncate считает от нулевого момента, то есть от начала часа UTC, и в поясах со смещением не на целый час
+// (+05:30, +05:45) дал бы слоты не от начала часа.
+func ceilTime(t time.Time, d time.Duration, loc *time.Location) time.Time {
+	local := t.In(loc)
+	hour := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, loc)
+	rounded := hour.Add(local.Sub(hour).Truncate(d))
+	if rounded.Before(t) {
+		rounded = rounded.Add(d)
+	}
+	return rounded.In(t.Location())
+}
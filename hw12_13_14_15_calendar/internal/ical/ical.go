@@ -0,0 +1,442 @@
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+var (
+	ErrInvalidCalendar  = errors.New("invalid iCalendar")
+	ErrInvalidComponent = errors.New("invalid VEVENT")
+)
+
+const (
+	dateTimeLayout = "20060102T150405Z"
+	localLayout    = "20060102T150405"
+	dateLayout     = "20060102"
+	prodID         = "-//hw12_13_14_15_calendar//RU"
+	// RFC 5545 3.1: строки длиннее 75 октетов переносятся
+	maxLineLen  = 75
+	uuidURNPref = "urn:uuid:"
+)
+
+// Component - разобранный VEVENT: событие или ошибка разбора компонента.
+type Component struct {
+	UID   string
+	Event storage.Event
+	Err   error
+}
+
+// MarshallEvents кодирует события в VCALENDAR. Каждое напоминание выгружается отдельным VALARM с TRIGGER
+// относительно начала.
+func MarshallEvents(events []storage.Event, now time.Time) string {
+	b := strings.Builder{}
+	writeLine(&b, "BEGIN:VCALENDAR")
+	writeLine(&b, "VERSION:2.0")
+	writeLine(&b, "PRODID:"+prodID)
+	for _, e := range events {
+		writeLine(&b, "BEGIN:VEVENT")
+		writeLine(&b, "UID:"+e.ID.String())
+		writeLine(&b, "DTSTAMP:"+formatTime(now))
+		if e.AllDay {
+			writeLine(&b, "DTSTART;VALUE=DATE:"+formatDate(e.StartDate))
+			writeLine(&b, "DTEND;VALUE=DATE:"+formatDate(e.EndDate))
+		} else {
+			writeLine(&b, "DTSTART:"+formatTime(e.StartDate))
+			writeLine(&b, "DTEND:"+formatTime(e.EndDate))
+		}
+		writeLine(&b, "SUMMARY:"+escape(e.Title))
+		if e.Description != "" {
+			writeLine(&b, "DESCRIPTION:"+escape(e.Description))
+		}
+		if e.RRule != "" {
+			writeLine(&b, "RRULE:"+e.RRule)
+		}
+		for _, d := range e.ExDates {
+			if e.AllDay {
+				writeLine(&b, "EXDATE;VALUE=DATE:"+formatDate(d))
+				continue
+			}
+			writeLine(&b, "EXDATE:"+formatTime(d))
+		}
+		for _, a := range e.Attendees {
+			status := strings.ToUpper(string(a.Status))
+			writeLine(&b, fmt.Sprintf("ATTENDEE;PARTSTAT=%s:%s%s", status, uuidURNPref, a.UserID))
+		}
+		for _, r := range e.Reminders {
+			writeLine(&b, "BEGIN:VALARM")
+			writeLine(&b, "ACTION:DISPLAY")
+			writeLine(&b, "DESCRIPTION:"+escape(e.Title))
+			writeLine(&b, "TRIGGER:"+formatDuration(-1*r.Before))
+			writeLine(&b, "END:VALARM")
+		}
+		writeLine(&b, "END:VEVENT")
+	}
+	writeLine(&b, "END:VCALENDAR")
+
+	return b.String()
+}
+
+// UnmarshallEvents разбирает VEVENT-ы календаря. Ошибка возвращается, если source - не VCALENDAR, ошибки
+// отдельных компонентов - в Component.Err. Время без пояса считается заданным в loc.
+func UnmarshallEvents(source string, loc *time.Location) ([]Component, error) {
+	lines := unfold(source)
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, fmt.Errorf("%w: BEGIN:VCALENDAR expected", ErrInvalidCalendar)
+	}
+
+	res := make([]Component, 0)
+	var props []property
+	inEvent, inAlarm, closed, hasTrigger := false, false, false, false
+	for _, line := range lines[1:] {
+		p, err := parseProperty(line)
+		if err != nil {
+			if inEvent {
+				props = append(props, property{err: err})
+				continue
+			}
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCalendar, err)
+		}
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VEVENT") && !inEvent:
+			inEvent, props = true, nil
+		case p.name == "END" && strings.EqualFold(p.value, "VEVENT") && inEvent:
+			inEvent = false
+			res = append(res, parseEvent(props, loc))
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VALARM") && inEvent:
+			inAlarm, hasTrigger = true, false
+		case p.name == "END" && strings.EqualFold(p.value, "VALARM") && inEvent:
+			inAlarm = false
+		case p.name == "END" && strings.EqualFold(p.value, "VCALENDAR") && !inEvent:
+			closed = true
+		case inEvent && inAlarm:
+			// из напоминания нужен только TRIGGER, берём первый в каждом VALARM
+			if p.name == "TRIGGER" && !hasTrigger {
+				props, hasTrigger = append(props, p), true
+			}
+		case inEvent:
+			props = append(props, p)
+		}
+	}
+	if inEvent || !closed {
+		return nil, fmt.Errorf("%w: unexpected end of calendar", ErrInvalidCalendar)
+	}
+
+	return res, nil
+}
+
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+	err    error
+}
+
+func parseEvent(props []property, loc *time.Location) Component {
+	c := Component{}
+	for _, p := range props {
+		if p.name == "UID" {
+			c.UID = unescape(p.value)
+		}
+	}
+	fail := func(err error) Component {
+		c.Event = storage.Event{}
+		c.Err = fmt.Errorf("%w: %s", ErrInvalidComponent, err)
+		return c
+	}
+
+	var (
+		duration    time.Duration
+		hasDuration bool
+		triggers    []property
+		allDay      bool
+	)
+	for _, p := range props {
+		if p.err != nil {
+			return fail(p.err)
+		}
+		var err error
+		switch p.name {
+		case "DTSTART":
+			c.Event.StartDate, allDay, err = parseTime(p, loc)
+			// повторения серии считаются в поясе начала
+			c.Event.TimeZone = p.params["TZID"]
+		case "DTEND":
+			c.Event.EndDate, _, err = parseTime(p, loc)
+		case "DURATION":
+			duration, err = parseDuration(p.value)
+			hasDuration = true
+		case "SUMMARY":
+			c.Event.Title = unescape(p.value)
+		case "DESCRIPTION":
+			c.Event.Description = unescape(p.value)
+		case "RRULE":
+			c.Event.RRule = p.value
+		case "EXDATE":
+			for _, v := range strings.Split(p.value, ",") {
+				var t time.Time
+				t, _, err = parseTime(property{params: p.params, value: v}, loc)
+				if err != nil {
+					break
+				}
+				c.Event.ExDates = append(c.Event.ExDates, t)
+			}
+		case "ATTENDEE":
+			// пользователи сервиса передаются как urn:uuid, остальные участники пропускаются
+			if id, ok := strings.CutPrefix(strings.ToLower(p.value), uuidURNPref); ok {
+				var uid uuid.UUID
+				uid, err = uuid.Parse(id)
+				c.Event.Attendees = append(c.Event.Attendees, storage.Attendee{
+					UserID: uid,
+					Status: storage.RSVPStatus(strings.ToLower(p.params["PARTSTAT"])),
+				})
+			}
+		case "TRIGGER":
+			triggers = append(triggers, p)
+		}
+		if err != nil {
+			return fail(fmt.Errorf("%s: %w", p.name, err))
+		}
+	}
+
+	if c.Event.StartDate.IsZero() {
+		return fail(errors.New("DTSTART is required"))
+	}
+	c.Event.AllDay = allDay
+	switch {
+	case hasDuration:
+		c.Event.EndDate = c.Event.StartDate.Add(duration)
+	case c.Event.EndDate.IsZero() && allDay:
+		c.Event.EndDate = c.Event.StartDate.AddDate(0, 0, 1)
+	case c.Event.EndDate.IsZero():
+		c.Event.EndDate = c.Event.StartDate
+	}
+	if c.Event.EndDate.Before(c.Event.StartDate) {
+		return fail(errors.New("DTEND is before DTSTART"))
+	}
+
+	for _, trigger := range triggers {
+		notifyBefore, err := parseTrigger(trigger, c.Event.StartDate, loc)
+		if err != nil {
+			return fail(fmt.Errorf("TRIGGER: %w", err))
+		}
+		c.Event.Reminders = append(c.Event.Reminders, storage.Reminder{Before: notifyBefore})
+	}
+
+	return c
+}
+
+// parseTrigger переводит TRIGGER во время напоминания до начала события. Напоминания после начала
+// и относительно окончания события не поддерживаются.
+func parseTrigger(p property, start time.Time, loc *time.Location) (time.Duration, error) {
+	if strings.EqualFold(p.params["VALUE"], "DATE-TIME") {
+		t, _, err := parseTime(property{value: p.value}, loc)
+		if err != nil {
+			return 0, err
+		}
+		if t.After(start) {
+			return 0, errors.New("alarm after event start")
+		}
+		return start.Sub(t), nil
+	}
+	if strings.EqualFold(p.params["RELATED"], "END") {
+		return 0, errors.New("RELATED=END is not supported")
+	}
+
+	d, err := parseDuration(p.value)
+	if err != nil {
+		return 0, err
+	}
+	if d > 0 {
+		return 0, errors.New("alarm after event start")
+	}
+	return -1 * d, nil
+}
+
+// parseTime разбирает дату или время. Дата без времени (VALUE=DATE) возвращается полночью UTC, как даты
+// событий на целые дни.
+func parseTime(p property, loc *time.Location) (time.Time, bool, error) {
+	if strings.EqualFold(p.params["VALUE"], "DATE") || len(p.value) == len(dateLayout) {
+		t, err := time.Parse(dateLayout, p.value)
+		return t, true, err
+	}
+	if strings.HasSuffix(p.value, "Z") {
+		t, err := time.Parse(dateTimeLayout, p.value)
+		return t.UTC(), false, err
+	}
+	if tzid := p.params["TZID"]; tzid != "" {
+		var err error
+		loc, err = time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+	}
+	t, err := time.ParseInLocation(localLayout, p.value, loc)
+	return t.UTC(), false, err
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(dateTimeLayout)
+}
+
+// formatDate - число даты события на целый день, в любом поясе оно одно и то же.
+func formatDate(t time.Time) string {
+	return t.Format(dateLayout)
+}
+
+// parseDuration разбирает длительность RFC 5545 3.3.6: [+/-]P[nW][nD][T[nH][nM][nS]].
+func parseDuration(s string) (time.Duration, error) {
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign, s = -1, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("invalid duration '%s'", s)
+	}
+
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+	timeUnits := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+	var res time.Duration
+	num := ""
+	for i := 1; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch >= '0' && ch <= '9':
+			num += string(ch)
+		case ch == 'T' && num == "":
+			units = timeUnits
+		default:
+			unit, ok := units[ch]
+			n, err := strconv.Atoi(num)
+			if !ok || err != nil {
+				return 0, fmt.Errorf("invalid duration '%s'", s)
+			}
+			res += time.Duration(n) * unit
+			num = ""
+		}
+	}
+	if num != "" {
+		return 0, fmt.Errorf("invalid duration '%s'", s)
+	}
+
+	return sign * res, nil
+}
+
+func formatDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -1*d
+	}
+	h, m, sec := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+
+	b := strings.Builder{}
+	b.WriteString(sign + "PT")
+	if h > 0 {
+		b.WriteString(strconv.Itoa(h) + "H")
+	}
+	if m > 0 {
+		b.WriteString(strconv.Itoa(m) + "M")
+	}
+	if sec > 0 || h == 0 && m == 0 {
+		b.WriteString(strconv.Itoa(sec) + "S")
+	}
+	return b.String()
+}
+
+// parseProperty разбирает строку вида NAME;PARAM=VALUE;PARAM="VALUE":значение.
+func parseProperty(line string) (property, error) {
+	p := property{params: map[string]string{}}
+	inQuotes := false
+	start, colon := 0, -1
+	var parts []string
+	for i, ch := range line {
+		switch {
+		case ch == '"':
+			inQuotes = !inQuotes
+		case ch == ';' && !inQuotes:
+			parts = append(parts, line[start:i])
+			start = i + 1
+		case ch == ':' && !inQuotes:
+			colon = i
+		}
+		if colon >= 0 {
+			break
+		}
+	}
+	if colon < 0 {
+		return p, fmt.Errorf("invalid content line '%s'", line)
+	}
+	parts = append(parts, line[start:colon])
+
+	p.name = strings.ToUpper(parts[0])
+	p.value = line[colon+1:]
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return p, fmt.Errorf("invalid parameter '%s'", param)
+		}
+		p.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+	}
+	if p.name == "" {
+		return p, fmt.Errorf("invalid content line '%s'", line)
+	}
+
+	return p, nil
+}
+
+// unfold склеивает перенесённые строки (продолжение начинается с пробела или табуляции) и убирает пустые.
+func unfold(source string) []string {
+	raw := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+	res := make([]string, 0, len(raw))
+	for _, line := range raw {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(res) > 0 {
+			res[len(res)-1] += line[1:]
+			continue
+		}
+		if strings.TrimSpace(line) != "" {
+			res = append(res, line)
+		}
+	}
+	return res
+}
+
+// writeLine пишет строку с CRLF, перенося её по maxLineLen октетов без разрыва UTF-8 символов.
+func writeLine(b *strings.Builder, line string) {
+	limit := maxLineLen
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// пробел в начале продолжения тоже занимает октет
+		limit = maxLineLen - 1
+	}
+	b.WriteString(line + "\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+var unescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+func escape(s string) string {
+	return escaper.Replace(strings.ReplaceAll(s, "\r\n", "\n"))
+}
+
+func unescape(s string) string {
+	return unescaper.Replace(s)
+}
@@ -0,0 +1,164 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshallUnmarshall(t *testing.T) {
+	attendeeID := uuid.New()
+	event := storage.Event{
+		ID:          uuid.New(),
+		Title:       "Планёрка; отдел, продаж",
+		Description: strings.Repeat("Длинное описание, которое не влезет в одну строку. ", 3) + "\nВторая строка",
+		StartDate:   time.Date(2023, time.May, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2023, time.May, 10, 11, 30, 0, 0, time.UTC),
+		Reminders:   storage.Reminders{{Before: 15 * time.Minute}, {Before: 90 * time.Minute}},
+		RRule:       "FREQ=WEEKLY;BYDAY=WE",
+		ExDates:     storage.Dates{time.Date(2023, time.May, 17, 10, 0, 0, 0, time.UTC)},
+		Attendees:   storage.Attendees{{UserID: attendeeID, Status: storage.RSVPAccepted}},
+	}
+
+	source := MarshallEvents([]storage.Event{event}, time.Now())
+	for _, line := range strings.Split(source, "\r\n") {
+		require.LessOrEqual(t, len(line), maxLineLen)
+	}
+	// по VALARM на каждое напоминание
+	require.Contains(t, source, "TRIGGER:-PT15M\r\n")
+	require.Contains(t, source, "TRIGGER:-PT1H30M\r\n")
+
+	components, err := UnmarshallEvents(source, time.UTC)
+	require.NoError(t, err)
+	require.Len(t, components, 1)
+	require.NoError(t, components[0].Err)
+	require.Equal(t, event.ID.String(), components[0].UID)
+	expected := event
+	expected.ID = uuid.UUID{}
+	require.Equal(t, expected, components[0].Event)
+}
+
+func TestMarshallAllDay(t *testing.T) {
+	event := storage.Event{
+		Title:     "Выездная встреча",
+		StartDate: time.Date(2023, time.May, 7, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.May, 10, 0, 0, 0, 0, time.UTC),
+		AllDay:    true,
+	}
+
+	source := MarshallEvents([]storage.Event{event.In(time.FixedZone("UTC+3", 3*60*60))}, time.Now())
+	require.Contains(t, source, "DTSTART;VALUE=DATE:20230507\r\n")
+	require.Contains(t, source, "DTEND;VALUE=DATE:20230510\r\n")
+	require.NotContains(t, source, "BEGIN:VALARM")
+
+	components, err := UnmarshallEvents(source, time.FixedZone("UTC-5", -5*60*60))
+	require.NoError(t, err)
+	require.Len(t, components, 1)
+	require.NoError(t, components[0].Err)
+	require.Equal(t, event, components[0].Event)
+}
+
+func TestUnmarshallEvents(t *testing.T) {
+	moscow, _ := time.LoadLocation("Europe/Moscow")
+	source := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"UID:with-tzid",
+		"DTSTART;TZID=Europe/Moscow:20230510T100000",
+		"DURATION:PT45M",
+		"SUMMARY:Созвон",
+		"BEGIN:VALARM",
+		"TRIGGER;VALUE=DATE-TIME:20230510T065000Z",
+		"END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:all-day",
+		"DTSTART;VALUE=DATE:20230511",
+		"SUMMARY:Весь ",
+		" день",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:floating",
+		"DTSTART:20230512T100000",
+		"DTEND:20230512T110000",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:no-start",
+		"SUMMARY:Без начала",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:bad-alarm",
+		"DTSTART:20230512T100000Z",
+		"BEGIN:VALARM",
+		"TRIGGER:PT15M",
+		"END:VALARM",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	components, err := UnmarshallEvents(source, moscow)
+	require.NoError(t, err)
+	require.Len(t, components, 5)
+
+	require.NoError(t, components[0].Err)
+	require.Equal(t, time.Date(2023, time.May, 10, 7, 0, 0, 0, time.UTC), components[0].Event.StartDate)
+	require.Equal(t, time.Date(2023, time.May, 10, 7, 45, 0, 0, time.UTC), components[0].Event.EndDate)
+	require.Equal(t, storage.Reminders{{Before: 10 * time.Minute}}, components[0].Event.Reminders)
+
+	require.NoError(t, components[1].Err)
+	require.Equal(t, "Весь день", components[1].Event.Title)
+	// дата без времени - событие на целый день, число не зависит от пояса
+	require.True(t, components[1].Event.AllDay)
+	require.Equal(t, time.Date(2023, time.May, 11, 0, 0, 0, 0, time.UTC), components[1].Event.StartDate)
+	require.Equal(t, 24*time.Hour, components[1].Event.EndDate.Sub(components[1].Event.StartDate))
+
+	// время без пояса считается заданным в поясе клиента
+	require.NoError(t, components[2].Err)
+	require.Equal(t, time.Date(2023, time.May, 12, 7, 0, 0, 0, time.UTC), components[2].Event.StartDate)
+
+	require.Equal(t, "no-start", components[3].UID)
+	require.ErrorIs(t, components[3].Err, ErrInvalidComponent)
+	require.ErrorIs(t, components[4].Err, ErrInvalidComponent)
+}
+
+func TestUnmarshallInvalidCalendar(t *testing.T) {
+	for _, source := range []string{
+		"",
+		"BEGIN:VEVENT\r\nEND:VEVENT",
+		"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:20230512T100000Z\r\n",
+		"BEGIN:VCALENDAR\r\nno colon\r\nEND:VCALENDAR",
+	} {
+		_, err := UnmarshallEvents(source, time.UTC)
+		require.ErrorIs(t, err, ErrInvalidCalendar, source)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected time.Duration
+	}{
+		{in: "PT15M", expected: 15 * time.Minute},
+		{in: "-PT1H30M", expected: -90 * time.Minute},
+		{in: "+P1DT2H", expected: 26 * time.Hour},
+		{in: "P1W", expected: 7 * 24 * time.Hour},
+		{in: "-PT0S", expected: 0},
+	}
+	for _, tc := range tests {
+		d, err := parseDuration(tc.in)
+		require.NoError(t, err, tc.in)
+		require.Equal(t, tc.expected, d, tc.in)
+	}
+	for _, in := range []string{"P", "PT", "15M", "PT15", "P1H", "PTM"} {
+		_, err := parseDuration(in)
+		require.Error(t, err, in)
+	}
+	require.Equal(t, "-PT1H30M", formatDuration(-90*time.Minute))
+	require.Equal(t, "PT0S", formatDuration(0))
+	require.Equal(t, "PT26H", formatDuration(26*time.Hour))
+}
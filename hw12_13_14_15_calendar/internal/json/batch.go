@@ -0,0 +1,86 @@
+package json
+
+import (
+	stdjson "encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+)
+
+var errNoOperations = errors.New("no operations")
+
+// BatchOperation - операция пакета. Event - исходный JSON события для создания и изменения.
+type BatchOperation struct {
+	Action  string
+	ID      uuid.UUID
+	Event   string
+	Version int64
+}
+
+// BatchResult - результат операции пакета: HTTP-статус и событие или ошибка.
+type BatchResult struct {
+	Status int
+	Event  string
+	Err    error
+}
+
+type batchResult struct {
+	Status int
+	Event  stdjson.RawMessage `json:",omitempty"`
+	Error  string             `json:",omitempty"`
+}
+
+// UnmarshallBatch разбирает пакет операций: {"Atomic":true,"Operations":[{"Action":"create","Event":{...}},
+// {"Action":"update","ID":"...","Event":{...}},{"Action":"delete","ID":"...","Version":3}]}.
+// Если Atomic не указан, пакет атомарный.
+func UnmarshallBatch(source string) (atomic bool, ops []BatchOperation, err error) {
+	atomic = true
+	if v := gjson.Get(source, "Atomic"); v.Exists() {
+		if v.Type != gjson.True && v.Type != gjson.False {
+			return false, nil, errors.New("Atomic: must be boolean")
+		}
+		atomic = v.Bool()
+	}
+
+	items := gjson.Get(source, "Operations")
+	if !items.IsArray() || len(items.Array()) == 0 {
+		return false, nil, errNoOperations
+	}
+	for i, item := range items.Array() {
+		op := BatchOperation{Action: item.Get("Action").String(), Version: item.Get("Version").Int()}
+		if id := item.Get("ID"); id.Exists() {
+			if op.ID, err = uuid.Parse(id.String()); err != nil {
+				return false, nil, fmt.Errorf("Operations[%d].ID: %w", i, err)
+			}
+		}
+		if event := item.Get("Event"); event.Exists() {
+			if !event.IsObject() {
+				return false, nil, fmt.Errorf("Operations[%d].Event: must be object", i)
+			}
+			op.Event = event.Raw
+		}
+		ops = append(ops, op)
+	}
+
+	return atomic, ops, nil
+}
+
+func MarshallBatchResults(results []BatchResult) (string, error) {
+	res := make([]batchResult, len(results))
+	for i, r := range results {
+		res[i] = batchResult{Status: r.Status}
+		if r.Err != nil {
+			res[i].Error = r.Err.Error()
+			continue
+		}
+		res[i].Event = stdjson.RawMessage(r.Event)
+	}
+
+	b, err := stdjson.Marshal(map[string][]batchResult{"Results": res})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
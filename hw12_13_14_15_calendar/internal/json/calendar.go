@@ -0,0 +1,74 @@
+package json
+
+import (
+	stdjson "encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+type calendar struct {
+	ID      string
+	OwnerID string
+	Name    string
+	Color   string
+	Grants  []grant
+}
+
+type grant struct {
+	UserID string
+	Access string
+}
+
+func toCalendar(c storage.Calendar) calendar {
+	res := calendar{
+		ID:      c.ID.String(),
+		OwnerID: c.OwnerID.String(),
+		Name:    c.Name,
+		Color:   c.Color,
+		Grants:  make([]grant, len(c.Grants)),
+	}
+	for i, g := range c.Grants {
+		res.Grants[i] = grant{UserID: g.UserID.String(), Access: string(g.Access)}
+	}
+	return res
+}
+
+func MarshallCalendar(c storage.Calendar) (string, error) {
+	b, err := stdjson.Marshal(toCalendar(c))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func MarshallCalendars(calendars []storage.Calendar) (string, error) {
+	res := make([]calendar, len(calendars))
+	for i, c := range calendars {
+		res[i] = toCalendar(c)
+	}
+
+	b, err := stdjson.Marshal(res)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// UnmarshallCalendar разбирает название, цвет и доступы календаря. ID и владелец задаются приложением.
+func UnmarshallCalendar(source []byte) (storage.Calendar, error) {
+	var c calendar
+	if err := stdjson.Unmarshal(source, &c); err != nil {
+		return storage.Calendar{}, err
+	}
+
+	res := storage.Calendar{Name: c.Name, Color: c.Color}
+	for _, g := range c.Grants {
+		id, err := uuid.Parse(g.UserID)
+		if err != nil {
+			return storage.Calendar{}, err
+		}
+		res.Grants = append(res.Grants, storage.Grant{UserID: id, Access: storage.Access(g.Access)})
+	}
+	return res, nil
+}
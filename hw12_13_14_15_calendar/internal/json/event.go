@@ -1,7 +1,10 @@
 package json
 
 import (
+	stdjson "encoding/json"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,15 +15,30 @@ import (
 
 type EventField string
 
+// DateTimeLayout - формат времени в JSON: с часовым смещением, чтобы момент времени не зависел от пояса клиента.
+const DateTimeLayout = "2006-01-02 15:04:05-07:00"
+
 const (
-	EventID           = EventField(storage.EventID)
-	EventTitle        = EventField(storage.EventTitle)
-	EventStartDate    = EventField(storage.EventStartDate)
-	EventEndDate      = EventField(storage.EventEndDate)
-	EventDescription  = EventField(storage.EventDescription)
-	EventNotifyBefore = EventField(storage.EventNotifyBefore)
+	EventID          = EventField(storage.EventID)
+	EventTitle       = EventField(storage.EventTitle)
+	EventStartDate   = EventField(storage.EventStartDate)
+	EventEndDate     = EventField(storage.EventEndDate)
+	EventDescription = EventField(storage.EventDescription)
+	// NotifyBefore - самое раннее до начала напоминание ("0s" - напоминаний нет), задание NotifyBefore заменяет
+	// все напоминания события одним.
+	EventNotifyBefore = EventField("NotifyBefore")
 	EventUserID       = EventField(storage.EventUserID)
-	EventNotifiedAt   = EventField(storage.EventNotifiedAt)
+	EventRRule        = EventField(storage.EventRRule)
+	EventExDates      = EventField(storage.EventExDates)
+	EventVersion      = EventField(storage.EventVersion)
+	EventDeletedAt    = EventField(storage.EventDeletedAt)
+	EventAttendees    = EventField(storage.EventAttendees)
+	EventCalendarID   = EventField(storage.EventCalendarID)
+	EventTags         = EventField(storage.EventTags)
+	EventAllDay       = EventField(storage.EventAllDay)
+	EventReminders    = EventField(storage.EventReminders)
+	// TimeZone - пояс серии повторений (имя IANA), по умолчанию - пояс клиента, создавшего событие.
+	EventTimeZone = EventField(storage.EventTimeZone)
 )
 
 type handler func(event storage.Event) string
@@ -28,12 +46,25 @@ type handler func(event storage.Event) string
 var marshallMap = map[EventField]handler{
 	EventID:           func(event storage.Event) string { return event.ID.String() },
 	EventTitle:        func(event storage.Event) string { return event.Title },
-	EventStartDate:    func(event storage.Event) string { return event.StartDate.Format(time.DateTime) },
-	EventEndDate:      func(event storage.Event) string { return event.EndDate.Format(time.DateTime) },
+	EventStartDate:    func(event storage.Event) string { return formatEventTime(event, event.StartDate) },
+	EventEndDate:      func(event storage.Event) string { return formatEventTime(event, event.EndDate) },
 	EventDescription:  func(event storage.Event) string { return event.Description },
-	EventNotifyBefore: func(event storage.Event) string { return event.NotifyBefore.String() },
+	EventNotifyBefore: func(event storage.Event) string { return event.Reminders.Earliest().String() },
 	EventUserID:       func(event storage.Event) string { return event.UserID.String() },
-	EventNotifiedAt:   func(event storage.Event) string { return event.NotifiedAt.Format(time.DateTime) },
+	EventRRule:        func(event storage.Event) string { return event.RRule },
+	EventVersion:      func(event storage.Event) string { return strconv.FormatInt(event.Version, 10) },
+	EventDeletedAt:    func(event storage.Event) string { return formatTime(event.DeletedAt) },
+	EventCalendarID:   func(event storage.Event) string { return event.CalendarID.String() },
+	EventTimeZone:     func(event storage.Event) string { return event.TimeZone },
+}
+
+// Поля, значения которых выводятся как есть (массивы и т.п.), а не строкой.
+var rawMarshallMap = map[EventField]handler{
+	EventExDates:   func(event storage.Event) string { return marshallDates(event) },
+	EventAttendees: func(event storage.Event) string { return marshallAttendees(event.Attendees) },
+	EventTags:      func(event storage.Event) string { return marshallTags(event.Tags) },
+	EventAllDay:    func(event storage.Event) string { return strconv.FormatBool(event.AllDay) },
+	EventReminders: func(event storage.Event) string { return marshallReminders(event.Reminders) },
 }
 
 type FieldParseErr struct {
@@ -51,6 +82,10 @@ func MarshallEvent(event storage.Event, fields []EventField) string {
 	}
 	strArr := make([]string, len(fields))
 	for i, field := range fields {
+		if h, ok := rawMarshallMap[field]; ok {
+			strArr[i] = fmt.Sprintf(`"%s":%s`, string(field), h(event))
+			continue
+		}
 		strArr[i] = fmt.Sprintf(`"%s":"%s"`, string(field), marshallMap[field](event))
 	}
 
@@ -77,6 +112,25 @@ func MarshallEvents(events []storage.Event, fields []EventField) string {
 }
 
 func UnmarshallEvent(source string, target *storage.Event, fields []EventField) error {
+	return UnmarshallEventIn(source, target, fields, time.UTC)
+}
+
+// UnmarshallEventIn разбирает событие, время без смещения считается заданным в поясе loc.
+// Все даты приводятся к UTC, у события на целые дни (AllDay в source или уже в target) даты берутся по числу
+// и времени на часах.
+func UnmarshallEventIn(source string, target *storage.Event, fields []EventField, loc *time.Location) error {
+	parse := parseTime
+	if allDay := gjson.Get(source, string(EventAllDay)); slices.Contains(fields, EventAllDay) && allDay.Exists() {
+		if allDay.Type != gjson.True && allDay.Type != gjson.False {
+			return FieldParseErr{fmt.Errorf("boolean expected, got '%s'", allDay.Raw), EventAllDay}
+		}
+		target.AllDay = allDay.Bool()
+	}
+	if target.AllDay {
+		parse = parseDay
+	}
+	// если заданы все напоминания, NotifyBefore не учитывается
+	hasReminders := slices.Contains(fields, EventReminders) && gjson.Get(source, string(EventReminders)).Exists()
 	for _, field := range fields {
 		value := gjson.Get(source, string(field))
 		if !value.Exists() {
@@ -92,23 +146,35 @@ func UnmarshallEvent(source string, target *storage.Event, fields []EventField)
 		case EventTitle:
 			target.Title = value.String()
 		case EventStartDate:
-			tm, err := time.Parse(time.DateTime, value.String())
+			tm, err := parse(value.String(), loc)
 			if err != nil {
 				return FieldParseErr{err, field}
 			}
 			target.StartDate = tm
 		case EventEndDate:
-			tm, err := time.Parse(time.DateTime, value.String())
+			tm, err := parse(value.String(), loc)
 			if err != nil {
 				return FieldParseErr{err, field}
 			}
 			target.EndDate = tm
 		case EventNotifyBefore:
+			if hasReminders {
+				continue
+			}
 			dr, err := time.ParseDuration(value.String())
 			if err != nil {
 				return FieldParseErr{err, field}
 			}
-			target.NotifyBefore = dr
+			target.Reminders = nil
+			if dr != 0 {
+				target.Reminders = storage.Reminders{{Before: dr}}
+			}
+		case EventReminders:
+			reminders, err := unmarshallReminders(value)
+			if err != nil {
+				return FieldParseErr{err, field}
+			}
+			target.Reminders = reminders
 		case EventDescription:
 			target.Description = value.String()
 		case EventUserID:
@@ -117,12 +183,51 @@ func UnmarshallEvent(source string, target *storage.Event, fields []EventField)
 				return FieldParseErr{err, field}
 			}
 			target.UserID = id
-		case EventNotifiedAt:
-			tm, err := time.Parse(time.DateTime, value.String())
+		case EventRRule:
+			target.RRule = value.String()
+		case EventTimeZone:
+			target.TimeZone = value.String()
+		case EventExDates:
+			dates, err := unmarshallDates(value, loc, parse)
+			if err != nil {
+				return FieldParseErr{err, field}
+			}
+			target.ExDates = dates
+		case EventVersion:
+			v, err := strconv.ParseInt(value.String(), 10, 64)
+			if err != nil {
+				return FieldParseErr{err, field}
+			}
+			target.Version = v
+		case EventDeletedAt:
+			tm, err := parseTime(value.String(), loc)
+			if err != nil {
+				return FieldParseErr{err, field}
+			}
+			target.DeletedAt = tm
+		case EventAttendees:
+			attendees, err := unmarshallAttendees(value)
+			if err != nil {
+				return FieldParseErr{err, field}
+			}
+			target.Attendees = attendees
+		case EventTags:
+			tags, err := unmarshallTags(value)
 			if err != nil {
 				return FieldParseErr{err, field}
 			}
-			target.NotifiedAt = tm
+			target.Tags = tags
+		case EventCalendarID:
+			// пустое значение - личное событие без календаря
+			var id uuid.UUID
+			if value.String() != "" {
+				var err error
+				id, err = uuid.Parse(value.String())
+				if err != nil {
+					return FieldParseErr{err, field}
+				}
+			}
+			target.CalendarID = id
 		default:
 			continue
 		}
@@ -130,3 +235,166 @@ func UnmarshallEvent(source string, target *storage.Event, fields []EventField)
 
 	return nil
 }
+
+func marshallDates(event storage.Event) string {
+	strArr := make([]string, len(event.ExDates))
+	for i, d := range event.ExDates {
+		strArr[i] = fmt.Sprintf(`"%s"`, formatEventTime(event, d))
+	}
+
+	return fmt.Sprintf(`[%s]`, strings.Join(strArr, ","))
+}
+
+func unmarshallDates(
+	value gjson.Result,
+	loc *time.Location,
+	parse func(string, *time.Location) (time.Time, error),
+) (storage.Dates, error) {
+	if !value.IsArray() {
+		return nil, fmt.Errorf("array expected, got '%s'", value.Raw)
+	}
+
+	var res storage.Dates
+	for _, v := range value.Array() {
+		tm, err := parse(v.String(), loc)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, tm)
+	}
+
+	return res, nil
+}
+
+func marshallAttendees(attendees storage.Attendees) string {
+	strArr := make([]string, len(attendees))
+	for i, a := range attendees {
+		strArr[i] = fmt.Sprintf(`{"UserID":"%s","Status":"%s"}`, a.UserID, a.Status)
+	}
+
+	return fmt.Sprintf(`[%s]`, strings.Join(strArr, ","))
+}
+
+// unmarshallAttendees разбирает массив участников, статус ответа необязателен.
+func unmarshallAttendees(value gjson.Result) (storage.Attendees, error) {
+	if !value.IsArray() {
+		return nil, fmt.Errorf("array expected, got '%s'", value.Raw)
+	}
+
+	var res storage.Attendees
+	for _, v := range value.Array() {
+		id, err := uuid.Parse(v.Get("UserID").String())
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, storage.Attendee{UserID: id, Status: storage.RSVPStatus(v.Get("Status").String())})
+	}
+
+	return res, nil
+}
+
+func marshallReminders(reminders storage.Reminders) string {
+	strArr := make([]string, len(reminders))
+	for i, r := range reminders {
+		strArr[i] = fmt.Sprintf(`"%s"`, r.Before)
+	}
+
+	return fmt.Sprintf(`[%s]`, strings.Join(strArr, ","))
+}
+
+// unmarshallReminders разбирает массив напоминаний: времени до начала события ("15m", "24h").
+func unmarshallReminders(value gjson.Result) (storage.Reminders, error) {
+	if !value.IsArray() {
+		return nil, fmt.Errorf("array expected, got '%s'", value.Raw)
+	}
+
+	var res storage.Reminders
+	for _, v := range value.Array() {
+		dr, err := time.ParseDuration(v.String())
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, storage.Reminder{Before: dr})
+	}
+
+	return res, nil
+}
+
+type tag struct {
+	Name  string
+	Color string
+}
+
+func marshallTags(tags storage.Tags) string {
+	res := make([]tag, len(tags))
+	for i, t := range tags {
+		res[i] = tag{Name: t.Name, Color: t.Color}
+	}
+	// названия меток задают пользователи, поэтому их надо экранировать
+	b, _ := stdjson.Marshal(res)
+	return string(b)
+}
+
+// unmarshallTags разбирает массив меток: объекты {"Name":"...","Color":"..."} или просто названия меток.
+func unmarshallTags(value gjson.Result) (storage.Tags, error) {
+	if !value.IsArray() {
+		return nil, fmt.Errorf("array expected, got '%s'", value.Raw)
+	}
+
+	var res storage.Tags
+	for _, v := range value.Array() {
+		switch {
+		case v.Type == gjson.String:
+			res = append(res, storage.Tag{Name: v.String()})
+		case v.IsObject():
+			res = append(res, storage.Tag{Name: v.Get("Name").String(), Color: v.Get("Color").String()})
+		default:
+			return nil, fmt.Errorf("tag expected, got '%s'", v.Raw)
+		}
+	}
+
+	return res, nil
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(DateTimeLayout)
+}
+
+// formatEventTime - даты события на целые дни выводятся без времени.
+func formatEventTime(event storage.Event, t time.Time) string {
+	if event.AllDay {
+		return t.Format(time.DateOnly)
+	}
+	return formatTime(t)
+}
+
+func parseTime(s string, loc *time.Location) (time.Time, error) {
+	t, err := parseLocal(s, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return t.UTC(), nil
+}
+
+// parseDay разбирает дату события на целые дни: можно без времени, число и время на часах переносятся в UTC,
+// так что "2023-06-01" в любом поясе остаётся 1 июня.
+func parseDay(s string, loc *time.Location) (time.Time, error) {
+	t, err := parseLocal(s, loc)
+	if err != nil {
+		var dErr error
+		if t, dErr = time.Parse(time.DateOnly, s); dErr != nil {
+			return time.Time{}, err
+		}
+	}
+
+	return storage.WallClock(t, time.UTC), nil
+}
+
+func parseLocal(s string, loc *time.Location) (time.Time, error) {
+	t, err := time.Parse(DateTimeLayout, s)
+	if err != nil {
+		return time.ParseInLocation(time.DateTime, s, loc)
+	}
+	return t, nil
+}
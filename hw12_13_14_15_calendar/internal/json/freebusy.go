@@ -0,0 +1,72 @@
+package json
+
+import (
+	stdjson "encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+// FreeBusyQuery - запрос занятости пользователей за период [From, To).
+type FreeBusyQuery struct {
+	UserIDs []uuid.UUID
+	From    time.Time
+	To      time.Time
+}
+
+type freeBusyQuery struct {
+	Users []string
+	From  string
+	To    string
+}
+
+type freeBusy struct {
+	UserID string
+	Busy   []interval
+}
+
+type interval struct {
+	Start string
+	End   string
+}
+
+// UnmarshallFreeBusyQuery разбирает запрос занятости, время без смещения считается заданным в поясе loc.
+func UnmarshallFreeBusyQuery(source []byte, loc *time.Location) (FreeBusyQuery, error) {
+	var q freeBusyQuery
+	if err := stdjson.Unmarshal(source, &q); err != nil {
+		return FreeBusyQuery{}, err
+	}
+
+	var res FreeBusyQuery
+	for _, u := range q.Users {
+		id, err := uuid.Parse(u)
+		if err != nil {
+			return FreeBusyQuery{}, fmt.Errorf("Users: %w", err)
+		}
+		res.UserIDs = append(res.UserIDs, id)
+	}
+	var err error
+	if res.From, err = parseTime(q.From, loc); err != nil {
+		return FreeBusyQuery{}, fmt.Errorf("From: %w", err)
+	}
+	if res.To, err = parseTime(q.To, loc); err != nil {
+		return FreeBusyQuery{}, fmt.Errorf("To: %w", err)
+	}
+	return res, nil
+}
+
+// MarshallFreeBusy выводит занятость пользователей, время - в поясе loc.
+func MarshallFreeBusy(items []storage.FreeBusy, loc *time.Location) (string, error) {
+	res := make([]freeBusy, len(items))
+	for i, fb := range items {
+		res[i] = freeBusy{UserID: fb.UserID.String(), Busy: toIntervals(fb.Busy, loc)}
+	}
+
+	b, err := stdjson.Marshal(res)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
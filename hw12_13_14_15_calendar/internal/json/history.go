@@ -0,0 +1,39 @@
+package json
+
+import (
+	stdjson "encoding/json"
+
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+type historyRecord struct {
+	ID        int64
+	EventID   string
+	UserID    string
+	Action    string
+	CreatedAt string
+	Changes   storage.FieldChanges
+}
+
+func MarshallHistory(records []storage.HistoryRecord) (string, error) {
+	res := make([]historyRecord, len(records))
+	for i, r := range records {
+		res[i] = historyRecord{
+			ID:        r.ID,
+			EventID:   r.EventID.String(),
+			UserID:    r.UserID.String(),
+			Action:    string(r.Action),
+			CreatedAt: formatTime(r.CreatedAt),
+			Changes:   r.Changes,
+		}
+		if res[i].Changes == nil {
+			res[i].Changes = storage.FieldChanges{}
+		}
+	}
+
+	b, err := stdjson.Marshal(res)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,38 @@
+package json
+
+import (
+	stdjson "encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// ImportResult - результат импорта одного компонента: ID созданного события или ошибка.
+type ImportResult struct {
+	UID string
+	ID  uuid.UUID
+	Err error
+}
+
+type importResult struct {
+	UID   string
+	ID    string `json:",omitempty"`
+	Error string `json:",omitempty"`
+}
+
+func MarshallImportResults(results []ImportResult) (string, error) {
+	res := make([]importResult, len(results))
+	for i, r := range results {
+		res[i] = importResult{UID: r.UID}
+		if r.Err != nil {
+			res[i].Error = r.Err.Error()
+			continue
+		}
+		res[i].ID = r.ID.String()
+	}
+
+	b, err := stdjson.Marshal(res)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
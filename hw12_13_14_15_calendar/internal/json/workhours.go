@@ -0,0 +1,134 @@
+package json
+
+import (
+	stdjson "encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/rrule"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+var errInvalidClock = errors.New("time of day must be in format HH:MM")
+
+type workingHours struct {
+	TimeZone string
+	Start    string
+	End      string
+	Weekdays string
+}
+
+// SlotQuery - запрос свободных слотов длительностью Duration для участников UserIDs в периоде [From, To).
+type SlotQuery struct {
+	UserIDs  []uuid.UUID
+	Duration time.Duration
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+type slotQuery struct {
+	Users    []string
+	Duration string
+	From     string
+	To       string
+	Limit    int
+}
+
+func MarshallWorkingHours(hours storage.WorkingHours) (string, error) {
+	b, err := stdjson.Marshal(workingHours{
+		TimeZone: hours.TimeZone,
+		Start:    formatClock(hours.Start),
+		End:      formatClock(hours.End),
+		Weekdays: hours.Weekdays.String(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// UnmarshallWorkingHours разбирает рабочее время: {"TimeZone":"Europe/Moscow","Start":"09:00","End":"18:00",
+// "Weekdays":"MO,TU,WE,TH,FR"}.
+func UnmarshallWorkingHours(source []byte) (storage.WorkingHours, error) {
+	var h workingHours
+	if err := stdjson.Unmarshal(source, &h); err != nil {
+		return storage.WorkingHours{}, err
+	}
+
+	res := storage.WorkingHours{TimeZone: h.TimeZone}
+	var err error
+	if res.Start, err = parseClock(h.Start); err != nil {
+		return storage.WorkingHours{}, fmt.Errorf("Start: %w", err)
+	}
+	if res.End, err = parseClock(h.End); err != nil {
+		return storage.WorkingHours{}, fmt.Errorf("End: %w", err)
+	}
+	if res.Weekdays, err = rrule.ParseWeekdays(h.Weekdays); err != nil {
+		return storage.WorkingHours{}, fmt.Errorf("Weekdays: %w", err)
+	}
+	return res, nil
+}
+
+// UnmarshallSlotQuery разбирает запрос слотов, время без смещения считается заданным в поясе loc.
+func UnmarshallSlotQuery(source []byte, loc *time.Location) (SlotQuery, error) {
+	var q slotQuery
+	if err := stdjson.Unmarshal(source, &q); err != nil {
+		return SlotQuery{}, err
+	}
+
+	res := SlotQuery{Limit: q.Limit}
+	for _, u := range q.Users {
+		id, err := uuid.Parse(u)
+		if err != nil {
+			return SlotQuery{}, fmt.Errorf("Users: %w", err)
+		}
+		res.UserIDs = append(res.UserIDs, id)
+	}
+	var err error
+	if res.Duration, err = time.ParseDuration(q.Duration); err != nil {
+		return SlotQuery{}, fmt.Errorf("Duration: %w", err)
+	}
+	if res.From, err = parseTime(q.From, loc); err != nil {
+		return SlotQuery{}, fmt.Errorf("From: %w", err)
+	}
+	if res.To, err = parseTime(q.To, loc); err != nil {
+		return SlotQuery{}, fmt.Errorf("To: %w", err)
+	}
+	return res, nil
+}
+
+// MarshallIntervals выводит интервалы времени, время - в поясе loc.
+func MarshallIntervals(intervals []storage.Interval, loc *time.Location) (string, error) {
+	b, err := stdjson.Marshal(toIntervals(intervals, loc))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func toIntervals(intervals []storage.Interval, loc *time.Location) []interval {
+	res := make([]interval, len(intervals))
+	for i, v := range intervals {
+		res[i] = interval{Start: formatTime(v.Start.In(loc)), End: formatTime(v.End.In(loc))}
+	}
+	return res
+}
+
+// formatClock выводит время от полуночи как HH:MM, конец суток - 24:00.
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+func parseClock(s string) (time.Duration, error) {
+	var h, m int
+	if n, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || n != 2 || len(s) != 5 {
+		return 0, errInvalidClock
+	}
+	if h < 0 || h > 24 || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, errInvalidClock
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
@@ -0,0 +1,280 @@
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidRule = errors.New("invalid recurrence rule")
+	ErrUnsupported = errors.New("unsupported recurrence rule")
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+const untilLayout = "20060102T150405Z"
+
+// Ограничение на количество перебираемых периодов, чтобы кривое правило не подвесило сервис.
+const maxPeriods = 100000
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Rule - подмножество RRULE из RFC 5545: FREQ, INTERVAL, BYDAY (без порядковых номеров), COUNT, UNTIL.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	ByDay    []time.Weekday
+	Count    int
+	Until    time.Time
+}
+
+func Parse(s string) (Rule, error) {
+	rule := Rule{Interval: 1}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return rule, fmt.Errorf("%w: empty rule", ErrInvalidRule)
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return rule, fmt.Errorf("%w: '%s'", ErrInvalidRule, part)
+		}
+		key, val := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		switch key {
+		case "FREQ":
+			switch f := Frequency(val); f {
+			case Daily, Weekly, Monthly, Yearly:
+				rule.Freq = f
+			default:
+				return rule, fmt.Errorf("%w: FREQ=%s", ErrUnsupported, val)
+			}
+		case "INTERVAL":
+			i, err := strconv.Atoi(val)
+			if err != nil || i < 1 {
+				return rule, fmt.Errorf("%w: INTERVAL=%s", ErrInvalidRule, val)
+			}
+			rule.Interval = i
+		case "COUNT":
+			c, err := strconv.Atoi(val)
+			if err != nil || c < 1 {
+				return rule, fmt.Errorf("%w: COUNT=%s", ErrInvalidRule, val)
+			}
+			rule.Count = c
+		case "UNTIL":
+			t, err := parseUntil(val)
+			if err != nil {
+				return rule, fmt.Errorf("%w: UNTIL=%s", ErrInvalidRule, val)
+			}
+			rule.Until = t
+		case "BYDAY":
+			days, err := ParseWeekdays(val)
+			if err != nil {
+				return rule, fmt.Errorf("%w: BYDAY=%s", ErrUnsupported, val)
+			}
+			rule.ByDay = days
+		case "WKST":
+			if val != "MO" {
+				return rule, fmt.Errorf("%w: WKST=%s", ErrUnsupported, val)
+			}
+		default:
+			return rule, fmt.Errorf("%w: %s", ErrUnsupported, key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return rule, fmt.Errorf("%w: FREQ is required", ErrInvalidRule)
+	}
+	if rule.Count != 0 && !rule.Until.IsZero() {
+		return rule, fmt.Errorf("%w: COUNT and UNTIL are mutually exclusive", ErrInvalidRule)
+	}
+	if len(rule.ByDay) != 0 && rule.Freq != Daily && rule.Freq != Weekly {
+		return rule, fmt.Errorf("%w: BYDAY with FREQ=%s", ErrUnsupported, rule.Freq)
+	}
+
+	return rule, nil
+}
+
+// ParseWeekdays разбирает дни недели в формате BYDAY ("MO,WE,FR"), дни упорядочены с понедельника.
+func ParseWeekdays(s string) ([]time.Weekday, error) {
+	days := make([]time.Weekday, 0, len(weekdays))
+	for _, d := range strings.Split(strings.ToUpper(s), ",") {
+		wd, ok := weekdays[strings.TrimSpace(d)]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown weekday '%s'", ErrInvalidRule, d)
+		}
+		days = append(days, wd)
+	}
+	sort.Slice(days, func(i, j int) bool { return weekOffset(days[i]) < weekOffset(days[j]) })
+
+	return days, nil
+}
+
+// FormatWeekdays выводит дни недели в формате BYDAY.
+func FormatWeekdays(days []time.Weekday) string {
+	strs := make([]string, len(days))
+	for i, wd := range days {
+		strs[i] = strings.ToUpper(wd.String()[:2])
+	}
+	return strings.Join(strs, ",")
+}
+
+func parseUntil(val string) (time.Time, error) {
+	for _, layout := range []string{untilLayout, "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, val); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, ErrInvalidRule
+}
+
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) != 0 {
+		parts = append(parts, "BYDAY="+FormatWeekdays(r.ByDay))
+	}
+	if r.Count != 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayout))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Between возвращает начала экземпляров, попадающих в [from, to], для серии, начинающейся в dtstart.
+func (r Rule) Between(dtstart, from, to time.Time) []time.Time {
+	res := make([]time.Time, 0)
+	r.iterate(dtstart, func(t time.Time) bool {
+		if t.After(to) {
+			return false
+		}
+		if !t.Before(from) {
+			res = append(res, t)
+		}
+		return true
+	})
+
+	return res
+}
+
+// Ended сообщает, что у серии, начинающейся в dtstart, нет экземпляров, начинающихся не раньше t.
+// Серия без COUNT и UNTIL не заканчивается никогда.
+func (r Rule) Ended(dtstart, t time.Time) bool {
+	if r.Count == 0 && r.Until.IsZero() {
+		return false
+	}
+	if !r.Until.IsZero() && r.Until.Before(t) {
+		return true
+	}
+	found := false
+	finished := r.iterate(dtstart, func(s time.Time) bool {
+		found = !s.Before(t)
+		return !found
+	})
+	// перебор, прерванный по maxPeriods, не доказывает, что экземпляров больше нет
+	return finished && !found
+}
+
+// iterate перебирает начала экземпляров, пока fn возвращает true. Возвращает true, если серия закончилась
+// по COUNT или UNTIL.
+func (r Rule) iterate(dtstart time.Time, fn func(t time.Time) bool) bool {
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	emitted := 0
+	finished := false
+	emit := func(t time.Time) bool {
+		if (!r.Until.IsZero() && t.After(r.Until)) || (r.Count != 0 && emitted >= r.Count) {
+			finished = true
+			return false
+		}
+		emitted++
+		return fn(t)
+	}
+
+	for k := 0; k < maxPeriods; k++ {
+		switch r.Freq {
+		case Daily:
+			t := dtstart.AddDate(0, 0, k*interval)
+			if len(r.ByDay) != 0 && !r.hasDay(t.Weekday()) {
+				continue
+			}
+			if !emit(t) {
+				return finished
+			}
+		case Weekly:
+			if len(r.ByDay) == 0 {
+				if !emit(dtstart.AddDate(0, 0, 7*k*interval)) {
+					return finished
+				}
+				continue
+			}
+			weekStart := dtstart.AddDate(0, 0, 7*k*interval-weekOffset(dtstart.Weekday()))
+			for _, wd := range r.ByDay {
+				t := weekStart.AddDate(0, 0, weekOffset(wd))
+				if t.Before(dtstart) {
+					continue
+				}
+				if !emit(t) {
+					return finished
+				}
+			}
+		case Monthly, Yearly:
+			var t time.Time
+			if r.Freq == Monthly {
+				t = dtstart.AddDate(0, k*interval, 0)
+			} else {
+				t = dtstart.AddDate(k*interval, 0, 0)
+			}
+			// Несуществующие даты (31 число, 29 февраля) по RFC 5545 пропускаются
+			if t.Day() != dtstart.Day() {
+				continue
+			}
+			if !emit(t) {
+				return finished
+			}
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+func (r Rule) hasDay(wd time.Weekday) bool {
+	for _, d := range r.ByDay {
+		if d == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// Неделя по умолчанию начинается с понедельника (WKST=MO).
+func weekOffset(wd time.Weekday) int {
+	return (int(wd) + 6) % 7
+}
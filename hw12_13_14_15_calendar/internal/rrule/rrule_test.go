@@ -0,0 +1,205 @@
+package rrule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rule     string
+		expected Rule
+	}{
+		{
+			rule:     "FREQ=DAILY",
+			expected: Rule{Freq: Daily, Interval: 1},
+		},
+		{
+			rule:     "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=FR,MO;COUNT=10",
+			expected: Rule{Freq: Weekly, Interval: 2, ByDay: []time.Weekday{time.Monday, time.Friday}, Count: 10},
+		},
+		{
+			rule: "freq=monthly;until=20231231T235959Z",
+			expected: Rule{
+				Freq:     Monthly,
+				Interval: 1,
+				Until:    time.Date(2023, time.December, 31, 23, 59, 59, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.rule, func(t *testing.T) {
+			t.Parallel()
+			r, err := Parse(tc.rule)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, r)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		err  error
+	}{
+		{rule: "", err: ErrInvalidRule},
+		{rule: "INTERVAL=2", err: ErrInvalidRule},
+		{rule: "FREQ=DAILY;INTERVAL=0", err: ErrInvalidRule},
+		{rule: "FREQ=DAILY;COUNT=2;UNTIL=20231231", err: ErrInvalidRule},
+		{rule: "FREQ=HOURLY", err: ErrUnsupported},
+		{rule: "FREQ=MONTHLY;BYDAY=1MO", err: ErrUnsupported},
+		{rule: "FREQ=MONTHLY;BYDAY=MO", err: ErrUnsupported},
+		{rule: "FREQ=DAILY;BYMONTH=1", err: ErrUnsupported},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.rule, func(t *testing.T) {
+			t.Parallel()
+			_, err := Parse(tc.rule)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	r, err := Parse("FREQ=WEEKLY;INTERVAL=2;BYDAY=WE,MO;UNTIL=20231231T235959Z")
+	require.NoError(t, err)
+	require.Equal(t, "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;UNTIL=20231231T235959Z", r.String())
+}
+
+func TestBetween(t *testing.T) {
+	// Вторник
+	dtstart := time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC)
+	day := func(m time.Month, d int) time.Time {
+		return time.Date(2023, m, d, 10, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		rule     string
+		from, to time.Time
+		expected []time.Time
+	}{
+		{
+			name:     "daily with count",
+			rule:     "FREQ=DAILY;COUNT=3",
+			from:     dtstart,
+			to:       day(time.December, 31),
+			expected: []time.Time{day(time.January, 10), day(time.January, 11), day(time.January, 12)},
+		},
+		{
+			name:     "daily working days in window",
+			rule:     "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR",
+			from:     day(time.January, 13),
+			to:       day(time.January, 16),
+			expected: []time.Time{day(time.January, 13), day(time.January, 16)},
+		},
+		{
+			name: "weekly by days with interval",
+			rule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH",
+			from: dtstart,
+			to:   day(time.January, 31),
+			expected: []time.Time{
+				day(time.January, 12), day(time.January, 23), day(time.January, 26),
+			},
+		},
+		{
+			name:     "weekly until",
+			rule:     "FREQ=WEEKLY;UNTIL=20230124T100000Z",
+			from:     dtstart,
+			to:       day(time.December, 31),
+			expected: []time.Time{day(time.January, 10), day(time.January, 17), day(time.January, 24)},
+		},
+		{
+			name:     "monthly",
+			rule:     "FREQ=MONTHLY;INTERVAL=5",
+			from:     day(time.February, 1),
+			to:       day(time.December, 31),
+			expected: []time.Time{day(time.June, 10), day(time.November, 10)},
+		},
+		{
+			name:     "count is applied before window",
+			rule:     "FREQ=DAILY;COUNT=3",
+			from:     day(time.January, 12),
+			to:       day(time.January, 20),
+			expected: []time.Time{day(time.January, 12)},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r, err := Parse(tc.rule)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, r.Between(dtstart, tc.from, tc.to))
+		})
+	}
+
+	t.Run("nonexistent dates are skipped", func(t *testing.T) {
+		t.Parallel()
+		r, err := Parse("FREQ=MONTHLY;COUNT=3")
+		require.NoError(t, err)
+		start := time.Date(2023, time.January, 31, 9, 0, 0, 0, time.UTC)
+		expected := []time.Time{
+			start,
+			time.Date(2023, time.March, 31, 9, 0, 0, 0, time.UTC),
+			time.Date(2023, time.May, 31, 9, 0, 0, 0, time.UTC),
+		}
+		require.Equal(t, expected, r.Between(start, start, start.AddDate(1, 0, 0)))
+	})
+}
+
+func TestEnded(t *testing.T) {
+	dtstart := time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC)
+	day := func(m time.Month, d int) time.Time {
+		return time.Date(2023, m, d, 10, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		rule     string
+		t        time.Time
+		expected bool
+	}{
+		{name: "endless", rule: "FREQ=DAILY", t: day(time.December, 31), expected: false},
+		{name: "count in past", rule: "FREQ=DAILY;COUNT=3", t: day(time.January, 13), expected: true},
+		{name: "last by count", rule: "FREQ=DAILY;COUNT=3", t: day(time.January, 12), expected: false},
+		{
+			name:     "until in past",
+			rule:     "FREQ=WEEKLY;UNTIL=20230124T100000Z",
+			t:        day(time.February, 1),
+			expected: true,
+		},
+		{
+			name:     "until in future",
+			rule:     "FREQ=WEEKLY;UNTIL=20231224T100000Z",
+			t:        day(time.February, 1),
+			expected: false,
+		},
+		{
+			// UNTIL позже t, но экземпляров между ними нет
+			name:     "no instance before until",
+			rule:     "FREQ=MONTHLY;UNTIL=20230301T000000Z",
+			t:        day(time.February, 11),
+			expected: true,
+		},
+		// перебор прерывается раньше, чем кончается COUNT
+		{name: "count beyond limit", rule: "FREQ=DAILY;COUNT=1000000", t: time.Date(2400, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r, err := Parse(tc.rule)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, r.Ended(dtstart, tc.t))
+		})
+	}
+}
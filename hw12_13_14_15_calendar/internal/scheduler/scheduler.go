@@ -9,7 +9,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/json"
 	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/queue"
 	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
@@ -21,6 +20,7 @@ var marshalledFields = []json.EventField{
 	json.EventTitle,
 	json.EventStartDate,
 	json.EventEndDate,
+	json.EventAllDay,
 	json.EventDescription,
 	json.EventNotifyBefore,
 	json.EventUserID,
@@ -32,33 +32,42 @@ type Scheduler interface {
 }
 
 type S struct {
-	workCycle  time.Duration
-	expiration time.Duration
-	logger     zap.Logger
-	storage    Storage
-	producer   queue.Producer
-	cancel     context.CancelFunc
+	workCycle      time.Duration
+	expiration     time.Duration
+	trashRetention time.Duration
+	logger         zap.Logger
+	storage        Storage
+	producer       queue.Producer
+	cancel         context.CancelFunc
 }
 
 type Storage interface {
-	SetEventsNotified(ids []uuid.UUID, notified time.Time) error
-	NotificationNeededEvents(t time.Time) ([]storage.Event, error)
-	DeleteEvents(filter []storage.EventCondition) (int64, error)
+	SetRemindersNotified(ctx context.Context, keys []storage.ReminderKey, notified time.Time) error
+	NotificationNeededEvents(ctx context.Context, t time.Time) ([]storage.Notification, error)
+	DeleteEvents(ctx context.Context, filter []storage.EventCondition) (int64, error)
+	GetEvents(
+		ctx context.Context,
+		filter []storage.EventCondition,
+		sort []storage.EventSort,
+		page storage.Page,
+	) ([]storage.Event, error)
 }
 
 func New(
 	workCycle time.Duration,
 	expiration time.Duration,
+	trashRetention time.Duration,
 	logger zap.Logger,
 	storage Storage,
 	producer queue.Producer,
 ) *S {
 	return &S{
-		workCycle:  workCycle,
-		expiration: expiration,
-		logger:     logger,
-		storage:    storage,
-		producer:   producer,
+		workCycle:      workCycle,
+		expiration:     expiration,
+		trashRetention: trashRetention,
+		logger:         logger,
+		storage:        storage,
+		producer:       producer,
 	}
 }
 
@@ -84,7 +93,7 @@ func (s *S) Start(ctx context.Context) error {
 				return
 			case <-t.C:
 				// default:
-				err := s.notify()
+				err := s.notify(ctx)
 				if err != nil {
 					err = fmt.Errorf("notify: %w", err)
 					s.logger.Error(err.Error())
@@ -105,12 +114,18 @@ func (s *S) Start(ctx context.Context) error {
 				s.logger.Debug("done in deleting")
 				return
 			case <-t.C:
-				err := s.deleteOldEvents()
+				err := s.deleteOldEvents(ctx)
 				if err != nil {
 					err = fmt.Errorf("delete events: %w", err)
 					s.logger.Error(err.Error())
 					return
 				}
+				err = s.purgeTrash(ctx)
+				if err != nil {
+					err = fmt.Errorf("purge trash: %w", err)
+					s.logger.Error(err.Error())
+					return
+				}
 				t.Reset(s.workCycle)
 			}
 		}
@@ -132,25 +147,27 @@ func (s *S) Stop() error {
 	return nil
 }
 
-func (s *S) notify() error {
+func (s *S) notify(ctx context.Context) error {
 	s.logger.Debug("notifying...")
 
 	t := time.Now()
-	events, err := s.storage.NotificationNeededEvents(t)
+	notifications, err := s.storage.NotificationNeededEvents(ctx, t)
 	if err != nil {
 		return err
 	}
-	s.logger.Debug(strconv.Itoa(len(events)) + " events")
+	s.logger.Debug(strconv.Itoa(len(notifications)) + " notifications")
 
 	errs := make([]string, 0)
-	for _, event := range events {
-		err = s.producer.Publish(json.MarshallEvent(event, marshalledFields))
-		if err != nil {
+	for _, n := range notifications {
+		// в уведомлении NotifyBefore - время сработавшего напоминания
+		event := n.Event
+		event.Reminders = storage.Reminders{n.Reminder}
+		if err = s.publish(event); err != nil {
 			errs = append(errs, fmt.Sprintf("event %s: %s", event.ID.String(), err.Error()))
 			continue
 		}
-		s.logger.Info("published " + event.ID.String())
-		err = s.storage.SetEventsNotified([]uuid.UUID{event.ID}, t)
+		s.logger.Info("published " + event.ID.String() + " " + n.Reminder.Before.String() + " before")
+		err = s.storage.SetRemindersNotified(ctx, []storage.ReminderKey{n.Key()}, t)
 		if err != nil {
 			errs = append(errs, fmt.Sprintf("event %s: %s", event.ID.String(), err.Error()))
 			continue
@@ -163,17 +180,81 @@ func (s *S) notify() error {
 	return nil
 }
 
-func (s *S) deleteOldEvents() error {
+// publish отправляет уведомление владельцу события и каждому участнику, принявшему приглашение.
+// В уведомлении UserID - получатель.
+func (s *S) publish(event storage.Event) error {
+	for _, userID := range event.Recipients() {
+		notification := event
+		notification.UserID = userID
+		if err := s.producer.Publish(json.MarshallEvent(notification, marshalledFields)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteOldEvents удаляет события, закончившиеся раньше expiration назад. У повторяющегося события EndDate -
+// окончание первого экземпляра, поэтому серия удаляется, только когда закончился её последний экземпляр.
+func (s *S) deleteOldEvents(ctx context.Context) error {
 	s.logger.Debug("deleting...")
+	expired := time.Now().Add(-1 * s.expiration)
 	filter := []storage.EventCondition{
-		{Field: storage.EventEndDate, Type: storage.TypeLess, Sample: time.Now().Add(-1 * s.expiration)},
+		{Field: storage.EventEndDate, Type: storage.TypeLess, Sample: expired},
+		{Field: storage.EventRRule, Type: storage.TypeEq, Sample: ""},
+	}
+
+	cnt, err := s.storage.DeleteEvents(ctx, filter)
+	if err != nil {
+		return err
 	}
 
-	cnt, err := s.storage.DeleteEvents(filter)
+	// COUNT и UNTIL в хранилище не проверить: серии-кандидаты проверяются здесь
+	filter = []storage.EventCondition{
+		{Field: storage.EventEndDate, Type: storage.TypeLess, Sample: expired},
+		{Field: storage.EventRRule, Type: storage.TypeNotEq, Sample: ""},
+	}
+	series, err := s.storage.GetEvents(ctx, filter, nil, storage.Page{})
 	if err != nil {
 		return err
 	}
+	for _, event := range series {
+		ended, err := event.Ended(expired)
+		if err != nil {
+			s.logger.Warn(fmt.Sprintf("event %s: %s", event.ID.String(), err.Error()))
+			continue
+		}
+		if !ended {
+			continue
+		}
+		// с той же версией: если серию успели изменить, она проверится заново в следующий раз
+		n, err := s.storage.DeleteEvents(ctx, []storage.EventCondition{
+			{Field: storage.EventID, Type: storage.TypeEq, Sample: event.ID},
+			{Field: storage.EventVersion, Type: storage.TypeEq, Sample: event.Version},
+		})
+		if err != nil {
+			return err
+		}
+		cnt += n
+	}
 	s.logger.Info(fmt.Sprintf("deleted %d event(s)", cnt))
 
 	return nil
 }
+
+// purgeTrash окончательно удаляет события, пролежавшие в корзине дольше trashRetention.
+func (s *S) purgeTrash(ctx context.Context) error {
+	s.logger.Debug("purging trash...")
+	filter := []storage.EventCondition{
+		{Field: storage.EventDeletedAt, Type: storage.TypeMore, Sample: time.Time{}},
+		{Field: storage.EventDeletedAt, Type: storage.TypeLess, Sample: time.Now().Add(-1 * s.trashRetention)},
+	}
+
+	cnt, err := s.storage.DeleteEvents(ctx, filter)
+	if err != nil {
+		return err
+	}
+	s.logger.Info(fmt.Sprintf("purged %d event(s) from trash", cnt))
+
+	return nil
+}
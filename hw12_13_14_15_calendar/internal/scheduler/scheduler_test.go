@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDeleteOldEvents(t *testing.T) {
+	ctx := context.Background()
+	st := memorystorage.New()
+	s := New(time.Minute, 24*time.Hour, 0, *zap.NewNop(), st, nil)
+
+	userID := uuid.New()
+	start := time.Now().AddDate(-2, 0, 0).Truncate(time.Second)
+	add := func(title, rule string) storage.Event {
+		event, err := st.AddEvent(ctx, storage.Event{
+			Title:     title,
+			UserID:    userID,
+			StartDate: start,
+			EndDate:   start.Add(time.Hour),
+			RRule:     rule,
+		})
+		require.NoError(t, err)
+		return event
+	}
+	single := add("single", "")
+	endless := add("endless", "FREQ=WEEKLY")
+	until := add("until in future", "FREQ=MONTHLY;UNTIL="+time.Now().AddDate(1, 0, 0).UTC().Format("20060102T150405Z"))
+	counted := add("count in past", "FREQ=DAILY;COUNT=10")
+	invalid := add("invalid rule", "FREQ=SECONDLY")
+
+	require.NoError(t, s.deleteOldEvents(ctx))
+
+	// серии, у которых ещё будут экземпляры, и серии с непонятным правилом остаются
+	for _, event := range []storage.Event{endless, until, invalid} {
+		_, err := st.GetEvent(ctx, event.ID)
+		require.NoError(t, err, event.Title)
+	}
+	for _, event := range []storage.Event{single, counted} {
+		_, err := st.GetEvent(ctx, event.ID)
+		require.ErrorIs(t, err, storage.ErrEventNotFound, event.Title)
+	}
+}
@@ -18,6 +18,7 @@ var unmarshalledFields = []json.EventField{
 	json.EventDescription,
 	json.EventStartDate,
 	json.EventEndDate,
+	json.EventAllDay,
 	json.EventNotifyBefore,
 }
 
@@ -113,7 +114,7 @@ func (s *S) send(event storage.Event) error {
 		zap.String("Description", event.Description),
 		zap.String("StartDate", event.StartDate.Format(time.DateTime)),
 		zap.String("EndDate", event.EndDate.Format(time.DateTime)),
-		zap.String("NotifyBefore", event.NotifyBefore.String()),
+		zap.String("NotifyBefore", event.Reminders.Earliest().String()),
 	)
 
 	return nil
@@ -8,6 +8,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/app"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/rrule"
 	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
@@ -17,7 +18,10 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-const UUIDHeader = "x-api-user"
+const (
+	UUIDHeader     = "x-api-user"
+	TimeZoneHeader = "x-time-zone"
+)
 
 type SearchPeriod int
 
@@ -46,14 +50,25 @@ func (s *Service) CreateEvent(ctx context.Context, r *EventRequest) (*Event, err
 
 	event, err := unmarshalEvent(r.GetEvent(), uid)
 	if err != nil {
-		s.logger.Error(err.Error())
-		return nil, status.Errorf(codes.Internal, "%s", err)
+		return nil, invalidArgument(err)
+	}
+	if event.TimeZone, err = s.getTimeZoneFromMeta(ctx); err != nil {
+		return nil, err
 	}
 
-	res, err := s.app.CreateEvent(uid, event)
+	res, err := s.app.CreateEvent(ctx, uid, event, r.GetAllowOverlap())
 	if err != nil {
-		s.logger.Error(err.Error())
-		return nil, status.Errorf(codes.Internal, "%s", err)
+		switch {
+		case errors.Is(err, app.ErrDateBusy):
+			return nil, status.Errorf(codes.FailedPrecondition, "%s", err)
+		case errors.Is(err, app.ErrInvalidEvent):
+			return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+		case errors.Is(err, app.ErrAccessDenied):
+			return nil, status.Errorf(codes.PermissionDenied, "%s", err)
+		default:
+			s.logger.Error(err.Error())
+			return nil, status.Errorf(codes.Internal, "%s", err)
+		}
 	}
 
 	return marshalEvent(res), nil
@@ -67,17 +82,25 @@ func (s *Service) UpdateEvent(ctx context.Context, r *EventRequest) (*Event, err
 
 	event, err := unmarshalEvent(r.GetEvent(), uid)
 	if err != nil {
-		s.logger.Error(err.Error())
-		return nil, status.Errorf(codes.Internal, "%s", err)
+		return nil, invalidArgument(err)
+	}
+	if event.TimeZone, err = s.getTimeZoneFromMeta(ctx); err != nil {
+		return nil, err
 	}
 
-	res, err := s.app.UpdateEvent(event.ID, uid, event)
+	res, err := s.app.UpdateEvent(ctx, event.ID, uid, event, r.GetAllowOverlap())
 	if err != nil {
 		switch {
+		case errors.Is(err, app.ErrDateBusy):
+			return nil, status.Errorf(codes.FailedPrecondition, "%s", err)
+		case errors.Is(err, app.ErrVersionMismatch):
+			return nil, status.Errorf(codes.Aborted, "%s", err)
 		case errors.Is(err, app.ErrNotFound):
 			return nil, status.Errorf(codes.NotFound, "%s", err)
 		case errors.Is(err, app.ErrAccessDenied):
 			return nil, status.Errorf(codes.PermissionDenied, "%s", err)
+		case errors.Is(err, app.ErrInvalidEvent):
+			return nil, status.Errorf(codes.InvalidArgument, "%s", err)
 		default:
 			s.logger.Error(err.Error())
 			return nil, status.Errorf(codes.Internal, "%s", err)
@@ -98,15 +121,131 @@ func (s *Service) DeleteEvent(ctx context.Context, r *EventIdRequest) (*DeleteEv
 		return nil, status.Errorf(codes.InvalidArgument, "%s", err)
 	}
 
-	err = s.app.DeleteEvent(eid, uid)
+	err = s.app.DeleteEvent(ctx, eid, uid, r.GetVersion())
 	if err != nil {
-		s.logger.Error(err.Error())
-		return nil, status.Errorf(codes.Internal, "%s", err)
+		switch {
+		case errors.Is(err, app.ErrNotFound):
+			return nil, status.Errorf(codes.NotFound, "%s", err)
+		case errors.Is(err, app.ErrAccessDenied):
+			return nil, status.Errorf(codes.PermissionDenied, "%s", err)
+		case errors.Is(err, app.ErrVersionMismatch):
+			return nil, status.Errorf(codes.Aborted, "%s", err)
+		default:
+			s.logger.Error(err.Error())
+			return nil, status.Errorf(codes.Internal, "%s", err)
+		}
 	}
 
 	return &DeleteEventResponse{}, nil
 }
 
+func (s *Service) RespondToInvitation(ctx context.Context, r *RSVPRequest) (*Event, error) {
+	uid, err := s.getUserFromMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	eid, err := uuid.Parse(r.GetId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+
+	res, err := s.app.RespondToInvitation(ctx, eid, uid, storage.RSVPStatus(r.GetStatus()))
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrInvalidQuery):
+			return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+		case errors.Is(err, app.ErrNotFound):
+			return nil, status.Errorf(codes.NotFound, "%s", err)
+		case errors.Is(err, app.ErrAccessDenied):
+			return nil, status.Errorf(codes.PermissionDenied, "%s", err)
+		default:
+			s.logger.Error(err.Error())
+			return nil, status.Errorf(codes.Internal, "%s", err)
+		}
+	}
+
+	return marshalEvent(res), nil
+}
+
+func (s *Service) RestoreEvent(ctx context.Context, r *RestoreEventRequest) (*Event, error) {
+	uid, err := s.getUserFromMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	eid, err := uuid.Parse(r.GetId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+
+	res, err := s.app.RestoreEvent(ctx, eid, uid, r.GetVersion(), r.GetAllowOverlap())
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrDateBusy):
+			return nil, status.Errorf(codes.FailedPrecondition, "%s", err)
+		case errors.Is(err, app.ErrVersionMismatch):
+			return nil, status.Errorf(codes.Aborted, "%s", err)
+		case errors.Is(err, app.ErrNotFound):
+			return nil, status.Errorf(codes.NotFound, "%s", err)
+		case errors.Is(err, app.ErrAccessDenied):
+			return nil, status.Errorf(codes.PermissionDenied, "%s", err)
+		default:
+			s.logger.Error(err.Error())
+			return nil, status.Errorf(codes.Internal, "%s", err)
+		}
+	}
+
+	return marshalEvent(res), nil
+}
+
+func (s *Service) GetTrash(ctx context.Context, r *TrashRequest) (*Events, error) {
+	uid, err := s.getUserFromMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.app.GetTrashedEvents(ctx, uid, r.GetTags())
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrInvalidQuery):
+			return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+		default:
+			s.logger.Error(err.Error())
+			return nil, status.Errorf(codes.Internal, "%s", err)
+		}
+	}
+
+	return marshalEvents(events), nil
+}
+
+func (s *Service) GetEventHistory(ctx context.Context, r *EventIdRequest) (*EventHistory, error) {
+	uid, err := s.getUserFromMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	eid, err := uuid.Parse(r.GetId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+
+	records, err := s.app.GetEventHistory(ctx, eid, uid)
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrNotFound):
+			return nil, status.Errorf(codes.NotFound, "%s", err)
+		case errors.Is(err, app.ErrAccessDenied):
+			return nil, status.Errorf(codes.PermissionDenied, "%s", err)
+		default:
+			s.logger.Error(err.Error())
+			return nil, status.Errorf(codes.Internal, "%s", err)
+		}
+	}
+
+	return marshalHistory(records), nil
+}
+
 func (s *Service) GetEvent(ctx context.Context, r *EventIdRequest) (*Event, error) {
 	uid, err := s.getUserFromMeta(ctx)
 	if err != nil {
@@ -118,7 +257,7 @@ func (s *Service) GetEvent(ctx context.Context, r *EventIdRequest) (*Event, erro
 		return nil, status.Errorf(codes.InvalidArgument, "%s", err)
 	}
 
-	event, err := s.app.GetEvent(eid, uid)
+	event, err := s.app.GetEvent(ctx, eid, uid)
 	if err != nil {
 		switch {
 		case errors.Is(err, app.ErrNotFound):
@@ -140,8 +279,14 @@ func (s *Service) getForPeriod(ctx context.Context, r *StartDateRequest, period
 		return nil, err
 	}
 
-	start := r.GetStart().AsTime()
-	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	loc, err := s.getLocationFromMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Границы периода считаются в поясе клиента
+	start := r.GetStart().AsTime().In(loc)
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
 
 	var end time.Time
 	switch period {
@@ -153,13 +298,34 @@ func (s *Service) getForPeriod(ctx context.Context, r *StartDateRequest, period
 		end = start.AddDate(0, 1, 0).Add(-1 * time.Nanosecond)
 	}
 
-	events, err := s.app.GetEventsForPeriod(uid, start, end)
+	if r.GetPageSize() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "negative page_size")
+	}
+	cursor, err := storage.ParseCursor(r.GetPageToken())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+
+	events, next, err := s.app.GetEventsForPeriod(
+		ctx, uid,
+		start,
+		end,
+		storage.Page{Limit: int(r.GetPageSize()), After: cursor},
+		r.GetTags(),
+	)
 	if err != nil {
-		s.logger.Error(err.Error())
-		return nil, status.Errorf(codes.Internal, "%s", err)
+		switch {
+		case errors.Is(err, app.ErrInvalidQuery):
+			return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+		default:
+			s.logger.Error(err.Error())
+			return nil, status.Errorf(codes.Internal, "%s", err)
+		}
 	}
 
-	return marshalEvents(events), nil
+	res := marshalEvents(events)
+	res.NextPageToken = next.String()
+	return res, nil
 }
 
 func (s *Service) GetForDay(ctx context.Context, r *StartDateRequest) (*Events, error) {
@@ -174,6 +340,50 @@ func (s *Service) GetForMonth(ctx context.Context, r *StartDateRequest) (*Events
 	return s.getForPeriod(ctx, r, Month)
 }
 
+func (s *Service) SearchEvents(ctx context.Context, r *SearchRequest) (*Events, error) {
+	uid, err := s.getUserFromMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.app.SearchEvents(ctx, uid, r.GetQuery(), r.GetTags())
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrInvalidQuery):
+			return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+		default:
+			s.logger.Error(err.Error())
+			return nil, status.Errorf(codes.Internal, "%s", err)
+		}
+	}
+
+	return marshalEvents(events), nil
+}
+
+// getLocationFromMeta возвращает часовой пояс клиента из метаданных запроса, по умолчанию UTC.
+func (s *Service) getLocationFromMeta(ctx context.Context) (*time.Location, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(TimeZoneHeader)) == 0 {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(md.Get(TimeZoneHeader)[0])
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown time zone: %s", err)
+	}
+
+	return loc, nil
+}
+
+// getTimeZoneFromMeta возвращает пояс серии повторений для событий запроса: в сообщении Event его нет,
+// повторения считаются в поясе клиента.
+func (s *Service) getTimeZoneFromMeta(ctx context.Context) (string, error) {
+	loc, err := s.getLocationFromMeta(ctx)
+	if err != nil {
+		return "", err
+	}
+	return storage.TimeZone(loc), nil
+}
+
 func (s *Service) getUserFromMeta(ctx context.Context) (uuid.UUID, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
@@ -197,14 +407,77 @@ func (s *Service) getUserFromMeta(ctx context.Context) (uuid.UUID, error) {
 }
 
 func marshalEvent(e storage.Event) *Event {
+	var deletedAt *timestamppb.Timestamp
+	if e.IsTrashed() {
+		deletedAt = timestamppb.New(e.DeletedAt)
+	}
 	return &Event{
 		Id:           e.ID.String(),
 		Title:        e.Title,
 		Description:  e.Description,
 		StartDate:    timestamppb.New(e.StartDate),
 		EndDate:      timestamppb.New(e.EndDate),
-		NotifyBefore: durationpb.New(e.NotifyBefore),
+		NotifyBefore: durationpb.New(e.Reminders.Earliest()),
+		Rrule:        e.RRule,
+		Exdates:      marshalTimestamps(e.ExDates),
+		Version:      e.Version,
+		DeletedAt:    deletedAt,
+		Attendees:    marshalAttendees(e.Attendees),
+		CalendarId:   marshalCalendarID(e.CalendarID),
+		Tags:         marshalTags(e.Tags),
+		AllDay:       e.AllDay,
+		Reminders:    marshalReminders(e.Reminders),
+	}
+}
+
+func marshalReminders(reminders storage.Reminders) []*durationpb.Duration {
+	res := make([]*durationpb.Duration, len(reminders))
+	for i, r := range reminders {
+		res[i] = durationpb.New(r.Before)
+	}
+	return res
+}
+
+// unmarshalReminders - если список напоминаний пуст, берётся notify_before.
+func unmarshalReminders(e *Event) storage.Reminders {
+	if len(e.Reminders) == 0 {
+		if d := e.NotifyBefore.AsDuration(); d != 0 {
+			return storage.Reminders{{Before: d}}
+		}
+		return nil
 	}
+	res := make(storage.Reminders, len(e.Reminders))
+	for i, r := range e.Reminders {
+		res[i] = storage.Reminder{Before: r.AsDuration()}
+	}
+	return res
+}
+
+func marshalTimestamps(dates []time.Time) []*timestamppb.Timestamp {
+	res := make([]*timestamppb.Timestamp, len(dates))
+	for i, d := range dates {
+		res[i] = timestamppb.New(d)
+	}
+	return res
+}
+
+// unmarshalTime - незаданная дата остаётся нулевой, а не началом эпохи Unix.
+func unmarshalTime(t *timestamppb.Timestamp) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.AsTime()
+}
+
+func unmarshalTimestamps(dates []*timestamppb.Timestamp) storage.Dates {
+	if len(dates) == 0 {
+		return nil
+	}
+	res := make(storage.Dates, len(dates))
+	for i, d := range dates {
+		res[i] = d.AsTime()
+	}
+	return res
 }
 
 func unmarshalEvent(e *Event, uid uuid.UUID) (storage.Event, error) {
@@ -216,17 +489,107 @@ func unmarshalEvent(e *Event, uid uuid.UUID) (storage.Event, error) {
 		}
 		eid = id
 	}
+	attendees, err := unmarshalAttendees(e.Attendees)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	calendarID, err := unmarshalCalendarID(e.CalendarId)
+	if err != nil {
+		return storage.Event{}, err
+	}
 	return storage.Event{
-		ID:           eid,
-		Title:        e.Title,
-		Description:  e.Description,
-		StartDate:    e.StartDate.AsTime(),
-		EndDate:      e.EndDate.AsTime(),
-		NotifyBefore: e.NotifyBefore.AsDuration(),
-		UserID:       uid,
+		ID:          eid,
+		Title:       e.Title,
+		Description: e.Description,
+		StartDate:   e.StartDate.AsTime(),
+		EndDate:     unmarshalTime(e.EndDate),
+		Reminders:   unmarshalReminders(e),
+		UserID:      uid,
+		RRule:       e.Rrule,
+		ExDates:     unmarshalTimestamps(e.Exdates),
+		Version:     e.Version,
+		Attendees:   attendees,
+		CalendarID:  calendarID,
+		Tags:        unmarshalTags(e.Tags),
+		AllDay:      e.GetAllDay(),
 	}, nil
 }
 
+// invalidArgument - ошибка разбора запроса: статус, если он уже есть у ошибки, иначе InvalidArgument.
+func invalidArgument(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Errorf(codes.InvalidArgument, "%s", err)
+}
+
+// marshalCalendarID - у личных событий календаря нет, передаём пустую строку.
+func marshalCalendarID(id uuid.UUID) string {
+	if id == (uuid.UUID{}) {
+		return ""
+	}
+	return id.String()
+}
+
+func unmarshalCalendarID(id string) (uuid.UUID, error) {
+	if id == "" {
+		return uuid.UUID{}, nil
+	}
+	res, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.UUID{}, status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	return res, nil
+}
+
+func marshalAttendees(attendees storage.Attendees) []*Attendee {
+	if len(attendees) == 0 {
+		return nil
+	}
+	res := make([]*Attendee, len(attendees))
+	for i, a := range attendees {
+		res[i] = &Attendee{UserId: a.UserID.String(), Status: string(a.Status)}
+	}
+	return res
+}
+
+func unmarshalAttendees(attendees []*Attendee) (storage.Attendees, error) {
+	if len(attendees) == 0 {
+		return nil, nil
+	}
+	res := make(storage.Attendees, len(attendees))
+	for i, a := range attendees {
+		id, err := uuid.Parse(a.GetUserId())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+		}
+		res[i] = storage.Attendee{UserID: id, Status: storage.RSVPStatus(a.GetStatus())}
+	}
+	return res, nil
+}
+
+func marshalTags(tags storage.Tags) []*Tag {
+	if len(tags) == 0 {
+		return nil
+	}
+	res := make([]*Tag, len(tags))
+	for i, t := range tags {
+		res[i] = &Tag{Name: t.Name, Color: t.Color}
+	}
+	return res
+}
+
+func unmarshalTags(tags []*Tag) storage.Tags {
+	if len(tags) == 0 {
+		return nil
+	}
+	res := make(storage.Tags, len(tags))
+	for i, t := range tags {
+		res[i] = storage.Tag{Name: t.GetName(), Color: t.GetColor()}
+	}
+	return res
+}
+
 func marshalEvents(events []storage.Event) *Events {
 	count := len(events)
 	res := Events{
@@ -237,3 +600,363 @@ func marshalEvents(events []storage.Event) *Events {
 	}
 	return &res
 }
+
+func marshalHistory(records []storage.HistoryRecord) *EventHistory {
+	res := EventHistory{
+		Records: make([]*HistoryRecord, len(records)),
+	}
+	for i, r := range records {
+		changes := make([]*FieldChange, len(r.Changes))
+		for j, c := range r.Changes {
+			changes[j] = &FieldChange{Field: string(c.Field), OldValue: c.Old, NewValue: c.New}
+		}
+		res.Records[i] = &HistoryRecord{
+			Id:        r.ID,
+			EventId:   r.EventID.String(),
+			UserId:    r.UserID.String(),
+			Action:    string(r.Action),
+			CreatedAt: timestamppb.New(r.CreatedAt),
+			Changes:   changes,
+		}
+	}
+	return &res
+}
+
+func (s *Service) CreateCalendar(ctx context.Context, r *CalendarRequest) (*UserCalendar, error) {
+	uid, err := s.getUserFromMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	calendar, err := unmarshalCalendar(r.GetCalendar())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.app.CreateCalendar(ctx, uid, calendar)
+	if err != nil {
+		return nil, s.calendarError(err)
+	}
+
+	return marshalCalendar(res), nil
+}
+
+func (s *Service) UpdateCalendar(ctx context.Context, r *CalendarRequest) (*UserCalendar, error) {
+	uid, err := s.getUserFromMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	calendar, err := unmarshalCalendar(r.GetCalendar())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.app.UpdateCalendar(ctx, calendar.ID, uid, calendar)
+	if err != nil {
+		return nil, s.calendarError(err)
+	}
+
+	return marshalCalendar(res), nil
+}
+
+func (s *Service) DeleteCalendar(ctx context.Context, r *CalendarIdRequest) (*DeleteCalendarResponse, error) {
+	uid, err := s.getUserFromMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cid, err := uuid.Parse(r.GetId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+
+	if err = s.app.DeleteCalendar(ctx, cid, uid); err != nil {
+		return nil, s.calendarError(err)
+	}
+
+	return &DeleteCalendarResponse{}, nil
+}
+
+func (s *Service) GetCalendar(ctx context.Context, r *CalendarIdRequest) (*UserCalendar, error) {
+	uid, err := s.getUserFromMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cid, err := uuid.Parse(r.GetId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+
+	res, err := s.app.GetCalendar(ctx, cid, uid)
+	if err != nil {
+		return nil, s.calendarError(err)
+	}
+
+	return marshalCalendar(res), nil
+}
+
+func (s *Service) GetCalendars(ctx context.Context, _ *CalendarsRequest) (*UserCalendars, error) {
+	uid, err := s.getUserFromMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	calendars, err := s.app.GetCalendars(ctx, uid)
+	if err != nil {
+		return nil, s.calendarError(err)
+	}
+
+	res := UserCalendars{Calendars: make([]*UserCalendar, len(calendars))}
+	for i, c := range calendars {
+		res.Calendars[i] = marshalCalendar(c)
+	}
+	return &res, nil
+}
+
+func (s *Service) calendarError(err error) error {
+	switch {
+	case errors.Is(err, app.ErrInvalidCalendar):
+		return status.Errorf(codes.InvalidArgument, "%s", err)
+	case errors.Is(err, app.ErrNotFound):
+		return status.Errorf(codes.NotFound, "%s", err)
+	case errors.Is(err, app.ErrAccessDenied):
+		return status.Errorf(codes.PermissionDenied, "%s", err)
+	case errors.Is(err, app.ErrCalendarNotEmpty):
+		return status.Errorf(codes.FailedPrecondition, "%s", err)
+	default:
+		s.logger.Error(err.Error())
+		return status.Errorf(codes.Internal, "%s", err)
+	}
+}
+
+func marshalCalendar(c storage.Calendar) *UserCalendar {
+	grants := make([]*CalendarGrant, len(c.Grants))
+	for i, g := range c.Grants {
+		grants[i] = &CalendarGrant{UserId: g.UserID.String(), Access: string(g.Access)}
+	}
+	return &UserCalendar{
+		Id:      c.ID.String(),
+		OwnerId: c.OwnerID.String(),
+		Name:    c.Name,
+		Color:   c.Color,
+		Grants:  grants,
+	}
+}
+
+func unmarshalCalendar(c *UserCalendar) (storage.Calendar, error) {
+	id, err := unmarshalCalendarID(c.GetId())
+	if err != nil {
+		return storage.Calendar{}, err
+	}
+	res := storage.Calendar{ID: id, Name: c.GetName(), Color: c.GetColor()}
+	for _, g := range c.GetGrants() {
+		uid, err := uuid.Parse(g.GetUserId())
+		if err != nil {
+			return storage.Calendar{}, status.Errorf(codes.InvalidArgument, "%s", err)
+		}
+		res.Grants = append(res.Grants, storage.Grant{UserID: uid, Access: storage.Access(g.GetAccess())})
+	}
+	return res, nil
+}
+
+func (s *Service) GetFreeBusy(ctx context.Context, r *FreeBusyRequest) (*FreeBusyResponse, error) {
+	if _, err := s.getUserFromMeta(ctx); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(r.GetUserIds()))
+	for i, v := range r.GetUserIds() {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+		}
+		ids[i] = id
+	}
+	if r.GetStart() == nil || r.GetEnd() == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "start and end are required")
+	}
+
+	items, err := s.app.GetFreeBusy(ctx, ids, r.GetStart().AsTime(), r.GetEnd().AsTime())
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrInvalidQuery):
+			return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+		default:
+			s.logger.Error(err.Error())
+			return nil, status.Errorf(codes.Internal, "%s", err)
+		}
+	}
+
+	res := FreeBusyResponse{Users: make([]*UserFreeBusy, len(items))}
+	for i, fb := range items {
+		busy := make([]*BusyInterval, len(fb.Busy))
+		for j, v := range fb.Busy {
+			busy[j] = &BusyInterval{Start: timestamppb.New(v.Start), End: timestamppb.New(v.End)}
+		}
+		res.Users[i] = &UserFreeBusy{UserId: fb.UserID.String(), Busy: busy}
+	}
+	return &res, nil
+}
+
+func (s *Service) GetWorkingHours(ctx context.Context, _ *WorkingHoursRequest) (*WorkingHours, error) {
+	uid, err := s.getUserFromMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.app.GetWorkingHours(ctx, uid)
+	if err != nil {
+		return nil, s.workingHoursError(err)
+	}
+	return marshalWorkingHours(res), nil
+}
+
+func (s *Service) SetWorkingHours(ctx context.Context, r *WorkingHours) (*WorkingHours, error) {
+	uid, err := s.getUserFromMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+	weekdays, err := rrule.ParseWeekdays(r.GetWeekdays())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+
+	res, err := s.app.SetWorkingHours(ctx, uid, storage.WorkingHours{
+		TimeZone: r.GetTimeZone(),
+		Start:    r.GetStart().AsDuration(),
+		End:      r.GetEnd().AsDuration(),
+		Weekdays: weekdays,
+	})
+	if err != nil {
+		return nil, s.workingHoursError(err)
+	}
+	return marshalWorkingHours(res), nil
+}
+
+func (s *Service) SuggestSlots(ctx context.Context, r *SuggestSlotsRequest) (*Slots, error) {
+	uid, err := s.getUserFromMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, len(r.GetUserIds()))
+	for i, v := range r.GetUserIds() {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+		}
+		ids[i] = id
+	}
+	if r.GetStart() == nil || r.GetEnd() == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "start and end are required")
+	}
+
+	slots, err := s.app.SuggestSlots(
+		ctx, uid, ids, r.GetDuration().AsDuration(), r.GetStart().AsTime(), r.GetEnd().AsTime(), int(r.GetLimit()),
+	)
+	if err != nil {
+		return nil, s.workingHoursError(err)
+	}
+
+	res := Slots{Slots: make([]*Slot, len(slots))}
+	for i, v := range slots {
+		res.Slots[i] = &Slot{Start: timestamppb.New(v.Start), End: timestamppb.New(v.End)}
+	}
+	return &res, nil
+}
+
+func (s *Service) workingHoursError(err error) error {
+	switch {
+	case errors.Is(err, app.ErrInvalidWorkingHours), errors.Is(err, app.ErrInvalidQuery):
+		return status.Errorf(codes.InvalidArgument, "%s", err)
+	default:
+		s.logger.Error(err.Error())
+		return status.Errorf(codes.Internal, "%s", err)
+	}
+}
+
+func marshalWorkingHours(h storage.WorkingHours) *WorkingHours {
+	return &WorkingHours{
+		TimeZone: h.TimeZone,
+		Start:    durationpb.New(h.Start),
+		End:      durationpb.New(h.End),
+		Weekdays: h.Weekdays.String(),
+	}
+}
+
+func (s *Service) BatchEvents(ctx context.Context, r *BatchRequest) (*BatchResponse, error) {
+	uid, err := s.getUserFromMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	timeZone, err := s.getTimeZoneFromMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]app.BatchOperation, len(r.GetOperations()))
+	for i, v := range r.GetOperations() {
+		op := app.BatchOperation{Action: app.BatchAction(v.GetAction())}
+		if v.GetEvent() != nil {
+			if op.Event, err = unmarshalEvent(v.GetEvent(), uid); err != nil {
+				return nil, invalidArgument(err)
+			}
+			op.Event.TimeZone = timeZone
+		}
+		op.ID = op.Event.ID
+		if v.GetId() != "" {
+			if op.ID, err = uuid.Parse(v.GetId()); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+			}
+		}
+		if op.Action == app.BatchDelete {
+			op.Event.Version = v.GetVersion()
+		}
+		ops[i] = op
+	}
+
+	results, err := s.app.BatchEvents(ctx, uid, ops, r.GetAtomic(), r.GetAllowOverlap())
+	if err != nil {
+		if errors.Is(err, app.ErrInvalidBatch) {
+			return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+		}
+		s.logger.Error(err.Error())
+		return nil, status.Errorf(codes.Internal, "%s", err)
+	}
+
+	res := BatchResponse{Results: make([]*BatchResult, len(results))}
+	for i, v := range results {
+		code := s.batchCode(v.Err)
+		res.Results[i] = &BatchResult{Code: int32(code)}
+		switch {
+		case v.Err != nil:
+			res.Results[i].Error = v.Err.Error()
+		case ops[i].Action != app.BatchDelete:
+			res.Results[i].Event = marshalEvent(v.Event)
+		}
+	}
+	return &res, nil
+}
+
+// batchCode возвращает код операции пакета, такой же, как у одиночных вызовов.
+func (s *Service) batchCode(err error) codes.Code {
+	switch {
+	case err == nil:
+		return codes.OK
+	case errors.Is(err, app.ErrBatchAborted), errors.Is(err, app.ErrVersionMismatch):
+		return codes.Aborted
+	case errors.Is(err, app.ErrDateBusy):
+		return codes.FailedPrecondition
+	case errors.Is(err, app.ErrNotFound):
+		return codes.NotFound
+	case errors.Is(err, app.ErrAccessDenied):
+		return codes.PermissionDenied
+	case errors.Is(err, app.ErrInvalidEvent), errors.Is(err, app.ErrInvalidBatch):
+		return codes.InvalidArgument
+	default:
+		s.logger.Error(err.Error())
+		return codes.Internal
+	}
+}
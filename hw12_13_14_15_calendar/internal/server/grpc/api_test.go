@@ -23,6 +23,7 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -108,17 +109,18 @@ func errCode(t *testing.T, err error) codes.Code {
 }
 
 func TestGetEvent(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 	event := storage.Event{
-		ID:           uuid.UUID{},
-		Title:        fake.Sentence(),
-		StartDate:    time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
-		EndDate:      time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
-		Description:  fake.Paragraph(),
-		UserID:       userID,
-		NotifyBefore: 24 * time.Hour,
+		ID:          uuid.UUID{},
+		Title:       fake.Sentence(),
+		StartDate:   time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
+		Description: fake.Paragraph(),
+		UserID:      userID,
+		Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 	}
-	event, _ = testStorage.AddEvent(event)
+	event, _ = testStorage.AddEvent(ctx, event)
 
 	req := EventIdRequest{Id: event.ID.String()}
 	res, err := testClient.GetEvent(requestContext(userID), &req)
@@ -128,45 +130,48 @@ func TestGetEvent(t *testing.T) {
 }
 
 func TestUpdateEvent(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 	event := storage.Event{
-		ID:           uuid.UUID{},
-		Title:        fake.Sentence(),
-		StartDate:    time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
-		EndDate:      time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
-		Description:  fake.Paragraph(),
-		UserID:       userID,
-		NotifyBefore: 24 * time.Hour,
+		ID:          uuid.UUID{},
+		Title:       fake.Sentence(),
+		StartDate:   time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
+		Description: fake.Paragraph(),
+		UserID:      userID,
+		Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 	}
-	event, _ = testStorage.AddEvent(event)
+	event, _ = testStorage.AddEvent(ctx, event)
 
 	updatedEvent := event
 	updatedEvent.Title = fake.Sentence()
 	updatedEvent.StartDate = time.Date(2023, time.February, 21, 12, 0, 0, 0, time.UTC)
 	updatedEvent.EndDate = time.Date(2023, time.February, 21, 12, 30, 0, 0, time.UTC)
 	updatedEvent.Description = fake.Paragraph()
-	updatedEvent.NotifyBefore = 15 * time.Minute
+	updatedEvent.Reminders = storage.Reminders{{Before: 15 * time.Minute}}
 
 	req := EventRequest{Event: marshalEvent(updatedEvent)}
 	res, err := testClient.UpdateEvent(requestContext(userID), &req)
 	require.Equal(t, codes.OK, errCode(t, err))
 	result, _ := unmarshalEvent(res, userID)
+	updatedEvent.Version++
 	require.Equal(t, updatedEvent, result)
 
-	storedEvent, _ := testStorage.GetEvent(updatedEvent.ID)
+	storedEvent, _ := testStorage.GetEvent(ctx, updatedEvent.ID)
 	require.Equal(t, storedEvent, result)
 }
 
 func TestCreateEvent(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 	event := storage.Event{
-		ID:           uuid.UUID{},
-		Title:        fake.Sentence(),
-		StartDate:    time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
-		EndDate:      time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
-		Description:  fake.Paragraph(),
-		UserID:       userID,
-		NotifyBefore: 24 * time.Hour,
+		ID:          uuid.UUID{},
+		Title:       fake.Sentence(),
+		StartDate:   time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
+		Description: fake.Paragraph(),
+		UserID:      userID,
+		Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 	}
 
 	req := EventRequest{Event: marshalEvent(event)}
@@ -174,67 +179,75 @@ func TestCreateEvent(t *testing.T) {
 	require.Equal(t, codes.OK, errCode(t, err))
 	result, _ := unmarshalEvent(res, userID)
 	event.ID = result.ID
+	event.Version = 1
 	require.Equal(t, event, result)
 
-	storedEvent, _ := testStorage.GetEvent(result.ID)
+	storedEvent, _ := testStorage.GetEvent(ctx, result.ID)
 	require.Equal(t, storedEvent, result)
 }
 
 func TestDeleteEvent(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 	event := storage.Event{
-		ID:           uuid.UUID{},
-		Title:        fake.Sentence(),
-		StartDate:    time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
-		EndDate:      time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
-		Description:  fake.Paragraph(),
-		UserID:       userID,
-		NotifyBefore: 24 * time.Hour,
+		ID:          uuid.UUID{},
+		Title:       fake.Sentence(),
+		StartDate:   time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
+		Description: fake.Paragraph(),
+		UserID:      userID,
+		Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 	}
-	event, _ = testStorage.AddEvent(event)
+	event, _ = testStorage.AddEvent(ctx, event)
 
 	req := EventIdRequest{Id: event.ID.String()}
 	res, err := testClient.DeleteEvent(requestContext(userID), &req)
 	require.Equal(t, codes.OK, errCode(t, err))
 	require.IsType(t, &DeleteEventResponse{}, res)
 
-	_, err = testStorage.GetEvent(event.ID)
-	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	// Событие попадает в корзину
+	stored, err := testStorage.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.True(t, stored.IsTrashed())
+
+	_, err = testClient.GetEvent(requestContext(userID), &req)
+	require.Equal(t, codes.NotFound, errCode(t, err))
 }
 
 func TestGetForDay(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 	events := []storage.Event{
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.January, 10, 13, 0, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.January, 10, 14, 0, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.January, 10, 13, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 10, 14, 0, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.January, 10, 10, 30, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.January, 10, 11, 30, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.January, 10, 10, 30, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 10, 11, 30, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.January, 11, 10, 0, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.January, 11, 11, 0, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.January, 11, 10, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 11, 11, 0, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 	}
 	for i, event := range events {
-		event, _ = testStorage.AddEvent(event)
+		event, _ = testStorage.AddEvent(ctx, event)
 		events[i] = event
 	}
 
@@ -253,48 +266,49 @@ func TestGetForDay(t *testing.T) {
 }
 
 func TestGetForWeek(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 
 	events := []storage.Event{
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.January, 16, 10, 0, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.January, 16, 11, 0, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.January, 16, 10, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 16, 11, 0, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.January, 20, 10, 30, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.January, 20, 11, 30, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.January, 20, 10, 30, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 20, 11, 30, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.January, 11, 10, 0, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.January, 11, 11, 0, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.January, 11, 10, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 11, 11, 0, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 	}
 	for i, event := range events {
-		event, _ = testStorage.AddEvent(event)
+		event, _ = testStorage.AddEvent(ctx, event)
 		events[i] = event
 	}
 
@@ -313,48 +327,49 @@ func TestGetForWeek(t *testing.T) {
 }
 
 func TestGetForMonth(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 
 	events := []storage.Event{
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.January, 16, 10, 0, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.January, 16, 11, 0, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.January, 16, 10, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 16, 11, 0, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.February, 20, 10, 30, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.February, 20, 11, 30, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.February, 20, 10, 30, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.February, 20, 11, 30, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.March, 10, 10, 0, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.March, 10, 11, 0, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.March, 10, 10, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.March, 10, 11, 0, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.February, 15, 10, 0, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.February, 15, 11, 0, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.February, 15, 10, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.February, 15, 11, 0, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 	}
 	for i, event := range events {
-		event, _ = testStorage.AddEvent(event)
+		event, _ = testStorage.AddEvent(ctx, event)
 		events[i] = event
 	}
 
@@ -373,26 +388,693 @@ func TestGetForMonth(t *testing.T) {
 }
 
 func TestGetEventAccessDenied(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 
 	event := storage.Event{
-		ID:           uuid.UUID{},
-		Title:        fake.Sentence(),
-		StartDate:    time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
-		EndDate:      time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
-		Description:  fake.Paragraph(),
-		UserID:       userID,
-		NotifyBefore: 24 * time.Hour,
+		ID:          uuid.UUID{},
+		Title:       fake.Sentence(),
+		StartDate:   time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
+		Description: fake.Paragraph(),
+		UserID:      userID,
+		Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 	}
-	event, _ = testStorage.AddEvent(event)
+	event, _ = testStorage.AddEvent(ctx, event)
 
 	req := EventIdRequest{Id: event.ID.String()}
 	res, err := testClient.GetEvent(requestContext(uuid.New()), &req)
 	require.Equal(t, codes.PermissionDenied, errCode(t, err))
 	require.Nil(t, res)
 
-	ctx := metadata.NewOutgoingContext(context.Background(), nil)
-	res, err = testClient.GetEvent(ctx, &req)
+	res, err = testClient.GetEvent(metadata.NewOutgoingContext(context.Background(), nil), &req)
 	require.Equal(t, codes.Unauthenticated, errCode(t, err))
 	require.Nil(t, res)
 }
+
+func TestGetForWeekRecurring(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	event := storage.Event{
+		ID:          uuid.UUID{},
+		Title:       fake.Sentence(),
+		StartDate:   time.Date(2023, time.January, 2, 10, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2023, time.January, 2, 10, 15, 0, 0, time.UTC),
+		Description: fake.Paragraph(),
+		UserID:      userID,
+		Reminders:   storage.Reminders{{Before: 15 * time.Minute}},
+		RRule:       "FREQ=WEEKLY;BYDAY=MO,WE",
+		ExDates:     storage.Dates{time.Date(2023, time.January, 18, 10, 0, 0, 0, time.UTC)},
+	}
+	event, _ = testStorage.AddEvent(ctx, event)
+
+	req := StartDateRequest{Start: timestamppb.New(time.Date(2023, time.January, 16, 0, 0, 0, 0, time.UTC))}
+	res, err := testClient.GetForWeek(requestContext(userID), &req)
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, res.Events, 1)
+
+	result, _ := unmarshalEvent(res.Events[0], userID)
+	expected := event
+	expected.StartDate = time.Date(2023, time.January, 16, 10, 0, 0, 0, time.UTC)
+	expected.EndDate = time.Date(2023, time.January, 16, 10, 15, 0, 0, time.UTC)
+	require.Equal(t, expected, result)
+}
+
+func TestCreateEventDateBusy(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	event := storage.Event{
+		Title:     fake.Sentence(),
+		StartDate: time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
+		UserID:    userID,
+	}
+	_, _ = testStorage.AddEvent(ctx, event)
+
+	overlapping := event
+	overlapping.StartDate = time.Date(2023, time.January, 10, 9, 30, 0, 0, time.UTC)
+	overlapping.EndDate = time.Date(2023, time.January, 10, 10, 30, 0, 0, time.UTC)
+
+	req := EventRequest{Event: marshalEvent(overlapping)}
+	res, err := testClient.CreateEvent(requestContext(userID), &req)
+	require.Equal(t, codes.FailedPrecondition, errCode(t, err))
+	require.Nil(t, res)
+
+	req.AllowOverlap = true
+	_, err = testClient.CreateEvent(requestContext(userID), &req)
+	require.Equal(t, codes.OK, errCode(t, err))
+}
+
+func TestCreateEventInvalidArgument(t *testing.T) {
+	userID := uuid.New()
+	event := marshalEvent(storage.Event{
+		Title:     fake.Sentence(),
+		StartDate: time.Date(2023, time.January, 11, 10, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.January, 11, 11, 0, 0, 0, time.UTC),
+	})
+
+	event.Attendees = []*Attendee{{UserId: "not-a-uuid"}}
+	_, err := testClient.CreateEvent(requestContext(userID), &EventRequest{Event: event})
+	require.Equal(t, codes.InvalidArgument, errCode(t, err))
+
+	event.Attendees = nil
+	event.CalendarId = "not-a-uuid"
+	_, err = testClient.UpdateEvent(requestContext(userID), &EventRequest{Event: event})
+	require.Equal(t, codes.InvalidArgument, errCode(t, err))
+}
+
+func TestUpdateEventVersionConflict(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	event := storage.Event{
+		Title:     fake.Sentence(),
+		StartDate: time.Date(2023, time.March, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.March, 10, 11, 0, 0, 0, time.UTC),
+		UserID:    userID,
+	}
+	event, _ = testStorage.AddEvent(ctx, event)
+
+	updated := event
+	updated.Title = fake.Sentence()
+	req := EventRequest{Event: marshalEvent(updated)}
+
+	res, err := testClient.UpdateEvent(requestContext(userID), &req)
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Equal(t, int64(2), res.Version)
+
+	// Повторное изменение с той же версией
+	_, err = testClient.UpdateEvent(requestContext(userID), &req)
+	require.Equal(t, codes.Aborted, errCode(t, err))
+
+	_, err = testClient.DeleteEvent(requestContext(userID), &EventIdRequest{Id: event.ID.String(), Version: 1})
+	require.Equal(t, codes.Aborted, errCode(t, err))
+}
+
+func TestTrashAndRestore(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	event := storage.Event{
+		Title:     fake.Sentence(),
+		StartDate: time.Date(2023, time.April, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.April, 10, 11, 0, 0, 0, time.UTC),
+		UserID:    userID,
+	}
+	event, _ = testStorage.AddEvent(ctx, event)
+
+	_, err := testClient.DeleteEvent(requestContext(userID), &EventIdRequest{Id: event.ID.String()})
+	require.Equal(t, codes.OK, errCode(t, err))
+
+	trash, err := testClient.GetTrash(requestContext(userID), &TrashRequest{})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, trash.Events, 1)
+	require.Equal(t, event.ID.String(), trash.Events[0].Id)
+	require.NotNil(t, trash.Events[0].DeletedAt)
+
+	_, err = testClient.RestoreEvent(requestContext(uuid.New()), &RestoreEventRequest{Id: event.ID.String()})
+	require.Equal(t, codes.PermissionDenied, errCode(t, err))
+
+	_, err = testClient.RestoreEvent(requestContext(userID), &RestoreEventRequest{Id: event.ID.String(), Version: 1})
+	require.Equal(t, codes.Aborted, errCode(t, err))
+
+	res, err := testClient.RestoreEvent(requestContext(userID), &RestoreEventRequest{Id: event.ID.String()})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Equal(t, int64(3), res.Version)
+	require.Nil(t, res.DeletedAt)
+
+	// Восстановить можно только событие из корзины
+	_, err = testClient.RestoreEvent(requestContext(userID), &RestoreEventRequest{Id: event.ID.String()})
+	require.Equal(t, codes.NotFound, errCode(t, err))
+
+	trash, err = testClient.GetTrash(requestContext(userID), &TrashRequest{})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, trash.Events, 0)
+}
+
+func TestGetEventHistory(t *testing.T) {
+	userID := uuid.New()
+	event := storage.Event{
+		Title:     "Before",
+		StartDate: time.Date(2023, time.May, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.May, 10, 11, 0, 0, 0, time.UTC),
+	}
+	created, err := testClient.CreateEvent(requestContext(userID), &EventRequest{Event: marshalEvent(event)})
+	require.Equal(t, codes.OK, errCode(t, err))
+
+	created.Title = "After"
+	_, err = testClient.UpdateEvent(requestContext(userID), &EventRequest{Event: created})
+	require.Equal(t, codes.OK, errCode(t, err))
+
+	res, err := testClient.GetEventHistory(requestContext(userID), &EventIdRequest{Id: created.Id})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, res.Records, 2)
+	require.Equal(t, "create", res.Records[0].Action)
+	require.Equal(t, "update", res.Records[1].Action)
+	require.Equal(t, userID.String(), res.Records[1].UserId)
+	require.Len(t, res.Records[1].Changes, 1)
+	require.Equal(t, "Title", res.Records[1].Changes[0].Field)
+	require.Equal(t, "Before", res.Records[1].Changes[0].OldValue)
+	require.Equal(t, "After", res.Records[1].Changes[0].NewValue)
+
+	_, err = testClient.GetEventHistory(requestContext(uuid.New()), &EventIdRequest{Id: created.Id})
+	require.Equal(t, codes.PermissionDenied, errCode(t, err))
+}
+
+func TestGetForDayMultiDay(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	offsite, _ := testStorage.AddEvent(ctx, storage.Event{
+		Title:     "Offsite",
+		StartDate: time.Date(2023, time.January, 8, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.January, 10, 0, 0, 0, 0, time.UTC),
+		UserID:    userID,
+		AllDay:    true,
+	})
+	trip, _ := testStorage.AddEvent(ctx, storage.Event{
+		Title:     "Trip",
+		StartDate: time.Date(2023, time.January, 8, 20, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.January, 10, 12, 0, 0, 0, time.UTC),
+		UserID:    userID,
+	})
+
+	req := StartDateRequest{Start: timestamppb.New(time.Date(2023, time.January, 9, 0, 0, 0, 0, time.UTC))}
+	res, err := testClient.GetForDay(requestContext(userID), &req)
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, res.Events, 2)
+	require.Equal(t, offsite.ID.String(), res.Events[0].Id)
+	require.True(t, res.Events[0].AllDay)
+	require.Equal(t, trip.ID.String(), res.Events[1].Id)
+	require.False(t, res.Events[1].AllDay)
+
+	// день окончания в событие на целые дни не входит
+	req.Start = timestamppb.New(time.Date(2023, time.January, 10, 0, 0, 0, 0, time.UTC))
+	res, err = testClient.GetForDay(requestContext(userID), &req)
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, res.Events, 1)
+	require.Equal(t, trip.ID.String(), res.Events[0].Id)
+}
+
+func TestCreateEventReminders(t *testing.T) {
+	userID := uuid.New()
+	event := &Event{
+		Title:     "Review",
+		StartDate: timestamppb.New(time.Date(2023, time.March, 1, 10, 0, 0, 0, time.UTC)),
+		EndDate:   timestamppb.New(time.Date(2023, time.March, 1, 11, 0, 0, 0, time.UTC)),
+		Reminders: []*durationpb.Duration{durationpb.New(24 * time.Hour), durationpb.New(15 * time.Minute)},
+	}
+	res, err := testClient.CreateEvent(requestContext(userID), &EventRequest{Event: event})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, res.Reminders, 2)
+	require.Equal(t, 15*time.Minute, res.Reminders[0].AsDuration())
+	require.Equal(t, 24*time.Hour, res.Reminders[1].AsDuration())
+	require.Equal(t, 24*time.Hour, res.NotifyBefore.AsDuration())
+
+	// без списка напоминаний notify_before заменяет их одним
+	res.Reminders = nil
+	res.NotifyBefore = durationpb.New(time.Hour)
+	res, err = testClient.UpdateEvent(requestContext(userID), &EventRequest{Event: res})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, res.Reminders, 1)
+	require.Equal(t, time.Hour, res.Reminders[0].AsDuration())
+
+	res.Reminders = []*durationpb.Duration{durationpb.New(-time.Minute)}
+	_, err = testClient.UpdateEvent(requestContext(userID), &EventRequest{Event: res})
+	require.Equal(t, codes.InvalidArgument, errCode(t, err))
+}
+
+func TestSearchEvents(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	event := storage.Event{
+		Title:       "Planning",
+		Description: "Discuss the DB migration",
+		StartDate:   time.Date(2023, time.June, 1, 10, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2023, time.June, 1, 11, 0, 0, 0, time.UTC),
+		UserID:      userID,
+		Tags:        storage.Tags{{Name: "ops", Color: "red"}},
+	}
+	event, _ = testStorage.AddEvent(ctx, event)
+	_, _ = testStorage.AddEvent(ctx, storage.Event{Title: "Migration", UserID: uuid.New()})
+
+	res, err := testClient.SearchEvents(requestContext(userID), &SearchRequest{Query: "db Migration"})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, res.Events, 1)
+	require.Equal(t, event.ID.String(), res.Events[0].Id)
+	require.Len(t, res.Events[0].Tags, 1)
+	require.Equal(t, "ops", res.Events[0].Tags[0].Name)
+	require.Equal(t, "red", res.Events[0].Tags[0].Color)
+
+	req := &SearchRequest{Query: "migration", Tags: []string{"ops"}}
+	res, err = testClient.SearchEvents(requestContext(userID), req)
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, res.Events, 1)
+	req.Tags = []string{"dev"}
+	res, err = testClient.SearchEvents(requestContext(userID), req)
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Empty(t, res.Events)
+
+	_, err = testClient.SearchEvents(requestContext(userID), &SearchRequest{Query: " , "})
+	require.Equal(t, codes.InvalidArgument, errCode(t, err))
+}
+
+func TestGetForWeekPaginated(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	events := []storage.Event{
+		{
+			Title:     fake.Sentence(),
+			StartDate: time.Date(2023, time.August, 7, 10, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2023, time.August, 7, 11, 0, 0, 0, time.UTC),
+			UserID:    userID,
+		},
+		{
+			Title:     fake.Sentence(),
+			StartDate: time.Date(2023, time.August, 6, 12, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2023, time.August, 6, 12, 30, 0, 0, time.UTC),
+			UserID:    userID,
+			RRule:     "FREQ=DAILY;INTERVAL=2",
+		},
+	}
+	for i := range events {
+		events[i], _ = testStorage.AddEvent(ctx, events[i])
+	}
+
+	req := StartDateRequest{Start: timestamppb.New(events[0].StartDate), PageSize: 3}
+	res, err := testClient.GetForWeek(requestContext(userID), &req)
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, res.Events, 3)
+	require.NotEmpty(t, res.NextPageToken)
+	require.Equal(t, events[0].ID.String(), res.Events[0].Id)
+	require.Equal(t, time.Date(2023, time.August, 10, 12, 0, 0, 0, time.UTC), res.Events[2].StartDate.AsTime())
+
+	req.PageToken = res.NextPageToken
+	res, err = testClient.GetForWeek(requestContext(userID), &req)
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, res.Events, 1)
+	require.Empty(t, res.NextPageToken)
+	require.Equal(t, time.Date(2023, time.August, 12, 12, 0, 0, 0, time.UTC), res.Events[0].StartDate.AsTime())
+
+	req.PageToken = "invalid"
+	_, err = testClient.GetForWeek(requestContext(userID), &req)
+	require.Equal(t, codes.InvalidArgument, errCode(t, err))
+}
+
+func TestGetForDayInTimeZone(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	events := []storage.Event{
+		{
+			Title:     fake.Sentence(),
+			StartDate: time.Date(2023, time.January, 10, 22, 30, 0, 0, time.UTC),
+			EndDate:   time.Date(2023, time.January, 10, 23, 0, 0, 0, time.UTC),
+			UserID:    userID,
+		},
+		{
+			Title:     fake.Sentence(),
+			StartDate: time.Date(2023, time.January, 11, 10, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2023, time.January, 11, 11, 0, 0, 0, time.UTC),
+			UserID:    userID,
+		},
+		{
+			Title:     fake.Sentence(),
+			StartDate: time.Date(2023, time.January, 11, 21, 30, 0, 0, time.UTC),
+			EndDate:   time.Date(2023, time.January, 11, 22, 0, 0, 0, time.UTC),
+			UserID:    userID,
+		},
+	}
+	for i, event := range events {
+		event, _ = testStorage.AddEvent(ctx, event)
+		events[i] = event
+	}
+
+	// В Москве (UTC+3) первое событие уже 11 января, а последнее - 12-го
+	reqCtx := metadata.AppendToOutgoingContext(requestContext(userID), TimeZoneHeader, "Europe/Moscow")
+	req := StartDateRequest{Start: timestamppb.New(time.Date(2023, time.January, 11, 12, 0, 0, 0, time.UTC))}
+	res, err := testClient.GetForDay(reqCtx, &req)
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, res.Events, 2)
+	require.Equal(t, events[0].ID.String(), res.Events[0].Id)
+	require.Equal(t, events[1].ID.String(), res.Events[1].Id)
+
+	reqCtx = metadata.AppendToOutgoingContext(requestContext(userID), TimeZoneHeader, "Mars/Olympus")
+	_, err = testClient.GetForDay(reqCtx, &req)
+	require.Equal(t, codes.InvalidArgument, errCode(t, err))
+}
+
+func TestInvitationAndRSVP(t *testing.T) {
+	ownerID := uuid.New()
+	attendeeID := uuid.New()
+	strangerID := uuid.New()
+	event := storage.Event{
+		Title:     fake.Sentence(),
+		StartDate: time.Date(2023, time.May, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.May, 10, 11, 0, 0, 0, time.UTC),
+		Attendees: storage.Attendees{{UserID: attendeeID}, {UserID: ownerID}, {UserID: attendeeID}},
+	}
+
+	// Владелец и повторы в списке участников отбрасываются, приглашённый ещё не ответил
+	created, err := testClient.CreateEvent(requestContext(ownerID), &EventRequest{Event: marshalEvent(event)})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Equal(t, []*Attendee{{UserId: attendeeID.String(), Status: string(storage.RSVPNeedsAction)}},
+		created.Attendees)
+
+	// Участник видит событие, но не может его менять
+	_, err = testClient.GetEvent(requestContext(attendeeID), &EventIdRequest{Id: created.Id})
+	require.Equal(t, codes.OK, errCode(t, err))
+	_, err = testClient.UpdateEvent(requestContext(attendeeID), &EventRequest{Event: created})
+	require.Equal(t, codes.PermissionDenied, errCode(t, err))
+	_, err = testClient.DeleteEvent(requestContext(attendeeID), &EventIdRequest{Id: created.Id})
+	require.Equal(t, codes.PermissionDenied, errCode(t, err))
+	_, err = testClient.GetEvent(requestContext(strangerID), &EventIdRequest{Id: created.Id})
+	require.Equal(t, codes.PermissionDenied, errCode(t, err))
+
+	day, err := testClient.GetForDay(requestContext(attendeeID), &StartDateRequest{Start: created.StartDate})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, day.Events, 1)
+	require.Equal(t, created.Id, day.Events[0].Id)
+
+	res, err := testClient.RespondToInvitation(
+		requestContext(attendeeID),
+		&RSVPRequest{Id: created.Id, Status: string(storage.RSVPAccepted)},
+	)
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Equal(t, string(storage.RSVPAccepted), res.Attendees[0].Status)
+	// Ответ на приглашение не меняет версию события
+	require.Equal(t, int64(1), res.Version)
+
+	_, err = testClient.RespondToInvitation(requestContext(attendeeID), &RSVPRequest{Id: created.Id, Status: "maybe"})
+	require.Equal(t, codes.InvalidArgument, errCode(t, err))
+	_, err = testClient.RespondToInvitation(
+		requestContext(ownerID),
+		&RSVPRequest{Id: created.Id, Status: string(storage.RSVPDeclined)},
+	)
+	require.Equal(t, codes.PermissionDenied, errCode(t, err))
+	_, err = testClient.RespondToInvitation(
+		requestContext(strangerID),
+		&RSVPRequest{Id: created.Id, Status: string(storage.RSVPDeclined)},
+	)
+	require.Equal(t, codes.PermissionDenied, errCode(t, err))
+
+	// При изменении события владельцем ответы участников сохраняются
+	created.Title = fake.Sentence()
+	updated, err := testClient.UpdateEvent(requestContext(ownerID), &EventRequest{Event: created})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Equal(t, string(storage.RSVPAccepted), updated.Attendees[0].Status)
+}
+
+func TestCalendarSharing(t *testing.T) {
+	ctx := context.Background()
+	ownerID := uuid.New()
+	readerID := uuid.New()
+	busyID := uuid.New()
+	writerID := uuid.New()
+	strangerID := uuid.New()
+
+	_, err := testClient.CreateCalendar(requestContext(ownerID), &CalendarRequest{Calendar: &UserCalendar{Name: " "}})
+	require.Equal(t, codes.InvalidArgument, errCode(t, err))
+
+	calendar, err := testClient.CreateCalendar(requestContext(ownerID), &CalendarRequest{Calendar: &UserCalendar{
+		Name: "Команда",
+		Grants: []*CalendarGrant{
+			{UserId: readerID.String(), Access: string(storage.AccessRead)},
+			{UserId: busyID.String(), Access: string(storage.AccessFreeBusy)},
+			{UserId: writerID.String(), Access: string(storage.AccessWrite)},
+		},
+	}})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Equal(t, ownerID.String(), calendar.OwnerId)
+	require.Len(t, calendar.Grants, 3)
+
+	// Пользователь с доступом видит календарь и только свой доступ
+	shared, err := testClient.GetCalendar(requestContext(readerID), &CalendarIdRequest{Id: calendar.Id})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, shared.Grants, 1)
+	require.Equal(t, readerID.String(), shared.Grants[0].UserId)
+	calendars, err := testClient.GetCalendars(requestContext(readerID), &CalendarsRequest{})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, calendars.Calendars, 1)
+	_, err = testClient.GetCalendar(requestContext(strangerID), &CalendarIdRequest{Id: calendar.Id})
+	require.Equal(t, codes.PermissionDenied, errCode(t, err))
+	_, err = testClient.UpdateCalendar(
+		requestContext(writerID),
+		&CalendarRequest{Calendar: &UserCalendar{Id: calendar.Id, Name: "Чужой"}},
+	)
+	require.Equal(t, codes.PermissionDenied, errCode(t, err))
+
+	event := &Event{
+		Title:      fake.Sentence(),
+		StartDate:  timestamppb.New(time.Date(2023, time.May, 12, 10, 0, 0, 0, time.UTC)),
+		EndDate:    timestamppb.New(time.Date(2023, time.May, 12, 11, 0, 0, 0, time.UTC)),
+		CalendarId: calendar.Id,
+	}
+	_, err = testClient.CreateEvent(requestContext(readerID), &EventRequest{Event: event})
+	require.Equal(t, codes.PermissionDenied, errCode(t, err))
+	created, err := testClient.CreateEvent(requestContext(ownerID), &EventRequest{Event: event})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Equal(t, calendar.Id, created.CalendarId)
+
+	res, err := testClient.GetEvent(requestContext(readerID), &EventIdRequest{Id: created.Id})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Equal(t, created.Title, res.Title)
+	// При доступе free-busy видно только занятое время
+	res, err = testClient.GetEvent(requestContext(busyID), &EventIdRequest{Id: created.Id})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Equal(t, "", res.Title)
+	require.Equal(t, created.StartDate.AsTime(), res.StartDate.AsTime())
+	day, err := testClient.GetForDay(requestContext(busyID), &StartDateRequest{Start: created.StartDate})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, day.Events, 1)
+	require.Equal(t, "", day.Events[0].Title)
+	_, err = testClient.GetEvent(requestContext(strangerID), &EventIdRequest{Id: created.Id})
+	require.Equal(t, codes.PermissionDenied, errCode(t, err))
+
+	// Изменять событие могут пользователи с доступом на запись, владелец события не меняется
+	created.Title = fake.Sentence()
+	_, err = testClient.UpdateEvent(requestContext(readerID), &EventRequest{Event: created})
+	require.Equal(t, codes.PermissionDenied, errCode(t, err))
+	updated, err := testClient.UpdateEvent(requestContext(writerID), &EventRequest{Event: created})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Equal(t, created.Title, updated.Title)
+	eid, _ := uuid.Parse(created.Id)
+	stored, _ := testStorage.GetEvent(ctx, eid)
+	require.Equal(t, ownerID, stored.UserID)
+
+	// Календарь с событиями (в том числе в корзине) удалить нельзя
+	_, err = testClient.DeleteCalendar(requestContext(writerID), &CalendarIdRequest{Id: calendar.Id})
+	require.Equal(t, codes.PermissionDenied, errCode(t, err))
+	_, err = testClient.DeleteCalendar(requestContext(ownerID), &CalendarIdRequest{Id: calendar.Id})
+	require.Equal(t, codes.FailedPrecondition, errCode(t, err))
+	_, err = testClient.DeleteEvent(requestContext(writerID), &EventIdRequest{Id: created.Id})
+	require.Equal(t, codes.OK, errCode(t, err))
+	_, err = testClient.DeleteCalendar(requestContext(ownerID), &CalendarIdRequest{Id: calendar.Id})
+	require.Equal(t, codes.FailedPrecondition, errCode(t, err))
+
+	// Отзыв доступа
+	revoked, err := testClient.UpdateCalendar(
+		requestContext(ownerID),
+		&CalendarRequest{Calendar: &UserCalendar{Id: calendar.Id, Name: "Команда"}},
+	)
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, revoked.Grants, 0)
+	_, err = testClient.GetCalendar(requestContext(readerID), &CalendarIdRequest{Id: calendar.Id})
+	require.Equal(t, codes.PermissionDenied, errCode(t, err))
+}
+
+func TestGetFreeBusy(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	attendeeID := uuid.New()
+	day := func(h, m int) time.Time {
+		return time.Date(2023, time.July, 10, h, m, 0, 0, time.UTC)
+	}
+	events := []storage.Event{
+		{Title: "Планёрка", StartDate: day(10, 0), EndDate: day(11, 0), UserID: userID},
+		{Title: "Созвон", StartDate: day(11, 0), EndDate: day(12, 0), UserID: userID},
+		{Title: "Обед", StartDate: day(13, 0).AddDate(0, 0, -7), EndDate: day(14, 0).AddDate(0, 0, -7),
+			UserID: userID, RRule: "FREQ=DAILY"},
+		{
+			Title: "Встреча", StartDate: day(15, 0), EndDate: day(16, 0), UserID: uuid.New(),
+			Attendees: storage.Attendees{{UserID: attendeeID, Status: storage.RSVPNeedsAction}},
+		},
+	}
+	for _, e := range events {
+		_, err := testStorage.AddEvent(ctx, e)
+		require.NoError(t, err)
+	}
+
+	res, err := testClient.GetFreeBusy(requestContext(uuid.New()), &FreeBusyRequest{
+		UserIds: []string{attendeeID.String(), userID.String()},
+		Start:   timestamppb.New(day(0, 0)),
+		End:     timestamppb.New(day(24, 0)),
+	})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, res.Users, 2)
+	require.Equal(t, attendeeID.String(), res.Users[0].UserId)
+	require.Len(t, res.Users[0].Busy, 1)
+	require.Equal(t, day(15, 0), res.Users[0].Busy[0].Start.AsTime())
+	require.Equal(t, userID.String(), res.Users[1].UserId)
+	require.Len(t, res.Users[1].Busy, 2)
+	require.Equal(t, day(10, 0), res.Users[1].Busy[0].Start.AsTime())
+	require.Equal(t, day(12, 0), res.Users[1].Busy[0].End.AsTime())
+	require.Equal(t, day(13, 0), res.Users[1].Busy[1].Start.AsTime())
+
+	_, err = testClient.GetFreeBusy(requestContext(userID), &FreeBusyRequest{
+		UserIds: []string{userID.String()},
+		Start:   timestamppb.New(day(24, 0)),
+		End:     timestamppb.New(day(0, 0)),
+	})
+	require.Equal(t, codes.InvalidArgument, errCode(t, err))
+	_, err = testClient.GetFreeBusy(requestContext(userID), &FreeBusyRequest{UserIds: []string{"not uuid"}})
+	require.Equal(t, codes.InvalidArgument, errCode(t, err))
+}
+
+func TestSuggestSlots(t *testing.T) {
+	ctx := context.Background()
+	organizerID := uuid.New()
+	colleagueID := uuid.New()
+	hours, err := testClient.GetWorkingHours(requestContext(organizerID), &WorkingHoursRequest{})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Equal(t, "UTC", hours.TimeZone)
+
+	_, err = testClient.SetWorkingHours(requestContext(organizerID), &WorkingHours{
+		TimeZone: "Europe/Moscow", Start: durationpb.New(18 * time.Hour), End: durationpb.New(9 * time.Hour),
+		Weekdays: "MO",
+	})
+	require.Equal(t, codes.InvalidArgument, errCode(t, err))
+	hours, err = testClient.SetWorkingHours(requestContext(organizerID), &WorkingHours{
+		TimeZone: "Europe/Moscow", Start: durationpb.New(9 * time.Hour), End: durationpb.New(18 * time.Hour),
+		Weekdays: "MO,TU,WE,TH,FR",
+	})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Equal(t, "Europe/Moscow", hours.TimeZone)
+
+	// 10 июля 2023 - понедельник, общее рабочее время - с 09:00 до 15:00 UTC
+	day := func(h, m int) time.Time {
+		return time.Date(2023, time.July, 10, h, m, 0, 0, time.UTC)
+	}
+	_, err = testStorage.AddEvent(ctx, storage.Event{StartDate: day(9, 0), EndDate: day(14, 0), UserID: colleagueID})
+	require.NoError(t, err)
+
+	res, err := testClient.SuggestSlots(requestContext(organizerID), &SuggestSlotsRequest{
+		UserIds:  []string{colleagueID.String()},
+		Duration: durationpb.New(45 * time.Minute),
+		Start:    timestamppb.New(day(0, 0)),
+		End:      timestamppb.New(day(24, 0)),
+	})
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Len(t, res.Slots, 1)
+	require.Equal(t, day(14, 0), res.Slots[0].Start.AsTime())
+	require.Equal(t, day(14, 45), res.Slots[0].End.AsTime())
+
+	_, err = testClient.SuggestSlots(requestContext(organizerID), &SuggestSlotsRequest{
+		Duration: durationpb.New(0), Start: timestamppb.New(day(0, 0)), End: timestamppb.New(day(24, 0)),
+	})
+	require.Equal(t, codes.InvalidArgument, errCode(t, err))
+}
+
+func TestBatchEvents(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	event, err := testStorage.AddEvent(ctx, storage.Event{
+		Title:     fake.Sentence(),
+		StartDate: time.Date(2023, time.August, 14, 10, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.August, 14, 11, 0, 0, 0, time.UTC),
+		UserID:    userID,
+	})
+	require.NoError(t, err)
+
+	created := storage.Event{
+		Title:     fake.Sentence(),
+		StartDate: time.Date(2023, time.August, 14, 12, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.August, 14, 13, 0, 0, 0, time.UTC),
+	}
+	updated := event
+	updated.Title = fake.Sentence()
+	busy := created
+	busy.StartDate = time.Date(2023, time.August, 14, 10, 30, 0, 0, time.UTC)
+	// последняя операция пересекается с существующим событием
+	req := BatchRequest{Atomic: true, Operations: []*BatchOperation{
+		{Action: string(app.BatchCreate), Event: marshalEvent(created)},
+		{Action: string(app.BatchUpdate), Event: marshalEvent(updated)},
+		{Action: string(app.BatchCreate), Event: marshalEvent(busy)},
+	}}
+	codesOf := func(res *BatchResponse) []codes.Code {
+		items := make([]codes.Code, len(res.GetResults()))
+		for i, v := range res.GetResults() {
+			items[i] = codes.Code(v.GetCode())
+		}
+		return items
+	}
+
+	res, err := testClient.BatchEvents(requestContext(userID), &req)
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Equal(t, []codes.Code{codes.Aborted, codes.Aborted, codes.FailedPrecondition}, codesOf(res))
+	stored, err := testStorage.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, event, stored)
+	events, err := testApp.GetUserEvents(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	req.Atomic = false
+	res, err = testClient.BatchEvents(requestContext(userID), &req)
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Equal(t, []codes.Code{codes.OK, codes.OK, codes.FailedPrecondition}, codesOf(res))
+	require.Equal(t, created.Title, res.GetResults()[0].GetEvent().GetTitle())
+	require.Equal(t, int64(2), res.GetResults()[1].GetEvent().GetVersion())
+	events, err = testApp.GetUserEvents(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	req = BatchRequest{Operations: []*BatchOperation{
+		{Action: string(app.BatchDelete), Id: event.ID.String(), Version: 1},
+		{Action: string(app.BatchDelete), Id: event.ID.String(), Version: 2},
+		{Action: "move", Id: event.ID.String()},
+	}}
+	res, err = testClient.BatchEvents(requestContext(userID), &req)
+	require.Equal(t, codes.OK, errCode(t, err))
+	require.Equal(t, []codes.Code{codes.Aborted, codes.OK, codes.InvalidArgument}, codesOf(res))
+
+	_, err = testClient.BatchEvents(requestContext(userID), &BatchRequest{})
+	require.Equal(t, codes.InvalidArgument, errCode(t, err))
+}
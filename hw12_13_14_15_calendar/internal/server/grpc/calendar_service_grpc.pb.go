@@ -19,13 +19,28 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	Calendar_CreateEvent_FullMethodName = "/calendar.Calendar/CreateEvent"
-	Calendar_UpdateEvent_FullMethodName = "/calendar.Calendar/UpdateEvent"
-	Calendar_DeleteEvent_FullMethodName = "/calendar.Calendar/DeleteEvent"
-	Calendar_GetEvent_FullMethodName    = "/calendar.Calendar/GetEvent"
-	Calendar_GetForDay_FullMethodName   = "/calendar.Calendar/GetForDay"
-	Calendar_GetForWeek_FullMethodName  = "/calendar.Calendar/GetForWeek"
-	Calendar_GetForMonth_FullMethodName = "/calendar.Calendar/GetForMonth"
+	Calendar_CreateEvent_FullMethodName         = "/calendar.Calendar/CreateEvent"
+	Calendar_UpdateEvent_FullMethodName         = "/calendar.Calendar/UpdateEvent"
+	Calendar_DeleteEvent_FullMethodName         = "/calendar.Calendar/DeleteEvent"
+	Calendar_RestoreEvent_FullMethodName        = "/calendar.Calendar/RestoreEvent"
+	Calendar_GetTrash_FullMethodName            = "/calendar.Calendar/GetTrash"
+	Calendar_GetEventHistory_FullMethodName     = "/calendar.Calendar/GetEventHistory"
+	Calendar_GetEvent_FullMethodName            = "/calendar.Calendar/GetEvent"
+	Calendar_GetForDay_FullMethodName           = "/calendar.Calendar/GetForDay"
+	Calendar_GetForWeek_FullMethodName          = "/calendar.Calendar/GetForWeek"
+	Calendar_GetForMonth_FullMethodName         = "/calendar.Calendar/GetForMonth"
+	Calendar_SearchEvents_FullMethodName        = "/calendar.Calendar/SearchEvents"
+	Calendar_RespondToInvitation_FullMethodName = "/calendar.Calendar/RespondToInvitation"
+	Calendar_CreateCalendar_FullMethodName      = "/calendar.Calendar/CreateCalendar"
+	Calendar_UpdateCalendar_FullMethodName      = "/calendar.Calendar/UpdateCalendar"
+	Calendar_DeleteCalendar_FullMethodName      = "/calendar.Calendar/DeleteCalendar"
+	Calendar_GetCalendar_FullMethodName         = "/calendar.Calendar/GetCalendar"
+	Calendar_GetCalendars_FullMethodName        = "/calendar.Calendar/GetCalendars"
+	Calendar_GetFreeBusy_FullMethodName         = "/calendar.Calendar/GetFreeBusy"
+	Calendar_GetWorkingHours_FullMethodName     = "/calendar.Calendar/GetWorkingHours"
+	Calendar_SetWorkingHours_FullMethodName     = "/calendar.Calendar/SetWorkingHours"
+	Calendar_SuggestSlots_FullMethodName        = "/calendar.Calendar/SuggestSlots"
+	Calendar_BatchEvents_FullMethodName         = "/calendar.Calendar/BatchEvents"
 )
 
 // CalendarClient is the client API for Calendar service.
@@ -35,10 +50,25 @@ type CalendarClient interface {
 	CreateEvent(ctx context.Context, in *EventRequest, opts ...grpc.CallOption) (*Event, error)
 	UpdateEvent(ctx context.Context, in *EventRequest, opts ...grpc.CallOption) (*Event, error)
 	DeleteEvent(ctx context.Context, in *EventIdRequest, opts ...grpc.CallOption) (*DeleteEventResponse, error)
+	RestoreEvent(ctx context.Context, in *RestoreEventRequest, opts ...grpc.CallOption) (*Event, error)
+	GetTrash(ctx context.Context, in *TrashRequest, opts ...grpc.CallOption) (*Events, error)
+	GetEventHistory(ctx context.Context, in *EventIdRequest, opts ...grpc.CallOption) (*EventHistory, error)
 	GetEvent(ctx context.Context, in *EventIdRequest, opts ...grpc.CallOption) (*Event, error)
 	GetForDay(ctx context.Context, in *StartDateRequest, opts ...grpc.CallOption) (*Events, error)
 	GetForWeek(ctx context.Context, in *StartDateRequest, opts ...grpc.CallOption) (*Events, error)
 	GetForMonth(ctx context.Context, in *StartDateRequest, opts ...grpc.CallOption) (*Events, error)
+	SearchEvents(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*Events, error)
+	RespondToInvitation(ctx context.Context, in *RSVPRequest, opts ...grpc.CallOption) (*Event, error)
+	CreateCalendar(ctx context.Context, in *CalendarRequest, opts ...grpc.CallOption) (*UserCalendar, error)
+	UpdateCalendar(ctx context.Context, in *CalendarRequest, opts ...grpc.CallOption) (*UserCalendar, error)
+	DeleteCalendar(ctx context.Context, in *CalendarIdRequest, opts ...grpc.CallOption) (*DeleteCalendarResponse, error)
+	GetCalendar(ctx context.Context, in *CalendarIdRequest, opts ...grpc.CallOption) (*UserCalendar, error)
+	GetCalendars(ctx context.Context, in *CalendarsRequest, opts ...grpc.CallOption) (*UserCalendars, error)
+	GetFreeBusy(ctx context.Context, in *FreeBusyRequest, opts ...grpc.CallOption) (*FreeBusyResponse, error)
+	GetWorkingHours(ctx context.Context, in *WorkingHoursRequest, opts ...grpc.CallOption) (*WorkingHours, error)
+	SetWorkingHours(ctx context.Context, in *WorkingHours, opts ...grpc.CallOption) (*WorkingHours, error)
+	SuggestSlots(ctx context.Context, in *SuggestSlotsRequest, opts ...grpc.CallOption) (*Slots, error)
+	BatchEvents(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error)
 }
 
 type calendarClient struct {
@@ -76,6 +106,33 @@ func (c *calendarClient) DeleteEvent(ctx context.Context, in *EventIdRequest, op
 	return out, nil
 }
 
+func (c *calendarClient) RestoreEvent(ctx context.Context, in *RestoreEventRequest, opts ...grpc.CallOption) (*Event, error) {
+	out := new(Event)
+	err := c.cc.Invoke(ctx, Calendar_RestoreEvent_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) GetTrash(ctx context.Context, in *TrashRequest, opts ...grpc.CallOption) (*Events, error) {
+	out := new(Events)
+	err := c.cc.Invoke(ctx, Calendar_GetTrash_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) GetEventHistory(ctx context.Context, in *EventIdRequest, opts ...grpc.CallOption) (*EventHistory, error) {
+	out := new(EventHistory)
+	err := c.cc.Invoke(ctx, Calendar_GetEventHistory_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *calendarClient) GetEvent(ctx context.Context, in *EventIdRequest, opts ...grpc.CallOption) (*Event, error) {
 	out := new(Event)
 	err := c.cc.Invoke(ctx, Calendar_GetEvent_FullMethodName, in, out, opts...)
@@ -112,6 +169,114 @@ func (c *calendarClient) GetForMonth(ctx context.Context, in *StartDateRequest,
 	return out, nil
 }
 
+func (c *calendarClient) SearchEvents(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*Events, error) {
+	out := new(Events)
+	err := c.cc.Invoke(ctx, Calendar_SearchEvents_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) RespondToInvitation(ctx context.Context, in *RSVPRequest, opts ...grpc.CallOption) (*Event, error) {
+	out := new(Event)
+	err := c.cc.Invoke(ctx, Calendar_RespondToInvitation_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) CreateCalendar(ctx context.Context, in *CalendarRequest, opts ...grpc.CallOption) (*UserCalendar, error) {
+	out := new(UserCalendar)
+	err := c.cc.Invoke(ctx, Calendar_CreateCalendar_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) UpdateCalendar(ctx context.Context, in *CalendarRequest, opts ...grpc.CallOption) (*UserCalendar, error) {
+	out := new(UserCalendar)
+	err := c.cc.Invoke(ctx, Calendar_UpdateCalendar_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) DeleteCalendar(ctx context.Context, in *CalendarIdRequest, opts ...grpc.CallOption) (*DeleteCalendarResponse, error) {
+	out := new(DeleteCalendarResponse)
+	err := c.cc.Invoke(ctx, Calendar_DeleteCalendar_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) GetCalendar(ctx context.Context, in *CalendarIdRequest, opts ...grpc.CallOption) (*UserCalendar, error) {
+	out := new(UserCalendar)
+	err := c.cc.Invoke(ctx, Calendar_GetCalendar_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) GetCalendars(ctx context.Context, in *CalendarsRequest, opts ...grpc.CallOption) (*UserCalendars, error) {
+	out := new(UserCalendars)
+	err := c.cc.Invoke(ctx, Calendar_GetCalendars_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) GetFreeBusy(ctx context.Context, in *FreeBusyRequest, opts ...grpc.CallOption) (*FreeBusyResponse, error) {
+	out := new(FreeBusyResponse)
+	err := c.cc.Invoke(ctx, Calendar_GetFreeBusy_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) GetWorkingHours(ctx context.Context, in *WorkingHoursRequest, opts ...grpc.CallOption) (*WorkingHours, error) {
+	out := new(WorkingHours)
+	err := c.cc.Invoke(ctx, Calendar_GetWorkingHours_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) SetWorkingHours(ctx context.Context, in *WorkingHours, opts ...grpc.CallOption) (*WorkingHours, error) {
+	out := new(WorkingHours)
+	err := c.cc.Invoke(ctx, Calendar_SetWorkingHours_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) SuggestSlots(ctx context.Context, in *SuggestSlotsRequest, opts ...grpc.CallOption) (*Slots, error) {
+	out := new(Slots)
+	err := c.cc.Invoke(ctx, Calendar_SuggestSlots_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) BatchEvents(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, Calendar_BatchEvents_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // CalendarServer is the server API for Calendar service.
 // All implementations must embed UnimplementedCalendarServer
 // for forward compatibility
@@ -119,10 +284,25 @@ type CalendarServer interface {
 	CreateEvent(context.Context, *EventRequest) (*Event, error)
 	UpdateEvent(context.Context, *EventRequest) (*Event, error)
 	DeleteEvent(context.Context, *EventIdRequest) (*DeleteEventResponse, error)
+	RestoreEvent(context.Context, *RestoreEventRequest) (*Event, error)
+	GetTrash(context.Context, *TrashRequest) (*Events, error)
+	GetEventHistory(context.Context, *EventIdRequest) (*EventHistory, error)
 	GetEvent(context.Context, *EventIdRequest) (*Event, error)
 	GetForDay(context.Context, *StartDateRequest) (*Events, error)
 	GetForWeek(context.Context, *StartDateRequest) (*Events, error)
 	GetForMonth(context.Context, *StartDateRequest) (*Events, error)
+	SearchEvents(context.Context, *SearchRequest) (*Events, error)
+	RespondToInvitation(context.Context, *RSVPRequest) (*Event, error)
+	CreateCalendar(context.Context, *CalendarRequest) (*UserCalendar, error)
+	UpdateCalendar(context.Context, *CalendarRequest) (*UserCalendar, error)
+	DeleteCalendar(context.Context, *CalendarIdRequest) (*DeleteCalendarResponse, error)
+	GetCalendar(context.Context, *CalendarIdRequest) (*UserCalendar, error)
+	GetCalendars(context.Context, *CalendarsRequest) (*UserCalendars, error)
+	GetFreeBusy(context.Context, *FreeBusyRequest) (*FreeBusyResponse, error)
+	GetWorkingHours(context.Context, *WorkingHoursRequest) (*WorkingHours, error)
+	SetWorkingHours(context.Context, *WorkingHours) (*WorkingHours, error)
+	SuggestSlots(context.Context, *SuggestSlotsRequest) (*Slots, error)
+	BatchEvents(context.Context, *BatchRequest) (*BatchResponse, error)
 	mustEmbedUnimplementedCalendarServer()
 }
 
@@ -139,6 +319,15 @@ func (UnimplementedCalendarServer) UpdateEvent(context.Context, *EventRequest) (
 func (UnimplementedCalendarServer) DeleteEvent(context.Context, *EventIdRequest) (*DeleteEventResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteEvent not implemented")
 }
+func (UnimplementedCalendarServer) RestoreEvent(context.Context, *RestoreEventRequest) (*Event, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreEvent not implemented")
+}
+func (UnimplementedCalendarServer) GetTrash(context.Context, *TrashRequest) (*Events, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTrash not implemented")
+}
+func (UnimplementedCalendarServer) GetEventHistory(context.Context, *EventIdRequest) (*EventHistory, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetEventHistory not implemented")
+}
 func (UnimplementedCalendarServer) GetEvent(context.Context, *EventIdRequest) (*Event, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetEvent not implemented")
 }
@@ -151,6 +340,42 @@ func (UnimplementedCalendarServer) GetForWeek(context.Context, *StartDateRequest
 func (UnimplementedCalendarServer) GetForMonth(context.Context, *StartDateRequest) (*Events, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetForMonth not implemented")
 }
+func (UnimplementedCalendarServer) SearchEvents(context.Context, *SearchRequest) (*Events, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchEvents not implemented")
+}
+func (UnimplementedCalendarServer) RespondToInvitation(context.Context, *RSVPRequest) (*Event, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RespondToInvitation not implemented")
+}
+func (UnimplementedCalendarServer) CreateCalendar(context.Context, *CalendarRequest) (*UserCalendar, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateCalendar not implemented")
+}
+func (UnimplementedCalendarServer) UpdateCalendar(context.Context, *CalendarRequest) (*UserCalendar, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateCalendar not implemented")
+}
+func (UnimplementedCalendarServer) DeleteCalendar(context.Context, *CalendarIdRequest) (*DeleteCalendarResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteCalendar not implemented")
+}
+func (UnimplementedCalendarServer) GetCalendar(context.Context, *CalendarIdRequest) (*UserCalendar, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCalendar not implemented")
+}
+func (UnimplementedCalendarServer) GetCalendars(context.Context, *CalendarsRequest) (*UserCalendars, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCalendars not implemented")
+}
+func (UnimplementedCalendarServer) GetFreeBusy(context.Context, *FreeBusyRequest) (*FreeBusyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFreeBusy not implemented")
+}
+func (UnimplementedCalendarServer) GetWorkingHours(context.Context, *WorkingHoursRequest) (*WorkingHours, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetWorkingHours not implemented")
+}
+func (UnimplementedCalendarServer) SetWorkingHours(context.Context, *WorkingHours) (*WorkingHours, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetWorkingHours not implemented")
+}
+func (UnimplementedCalendarServer) SuggestSlots(context.Context, *SuggestSlotsRequest) (*Slots, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SuggestSlots not implemented")
+}
+func (UnimplementedCalendarServer) BatchEvents(context.Context, *BatchRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchEvents not implemented")
+}
 func (UnimplementedCalendarServer) mustEmbedUnimplementedCalendarServer() {}
 
 // UnsafeCalendarServer may be embedded to opt out of forward compatibility for this service.
@@ -218,6 +443,60 @@ func _Calendar_DeleteEvent_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Calendar_RestoreEvent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreEventRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).RestoreEvent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_RestoreEvent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).RestoreEvent(ctx, req.(*RestoreEventRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_GetTrash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TrashRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).GetTrash(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_GetTrash_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).GetTrash(ctx, req.(*TrashRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_GetEventHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EventIdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).GetEventHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_GetEventHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).GetEventHistory(ctx, req.(*EventIdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Calendar_GetEvent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(EventIdRequest)
 	if err := dec(in); err != nil {
@@ -290,6 +569,222 @@ func _Calendar_GetForMonth_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Calendar_SearchEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).SearchEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_SearchEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).SearchEvents(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_RespondToInvitation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RSVPRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).RespondToInvitation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_RespondToInvitation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).RespondToInvitation(ctx, req.(*RSVPRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_CreateCalendar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CalendarRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).CreateCalendar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_CreateCalendar_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).CreateCalendar(ctx, req.(*CalendarRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_UpdateCalendar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CalendarRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).UpdateCalendar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_UpdateCalendar_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).UpdateCalendar(ctx, req.(*CalendarRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_DeleteCalendar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CalendarIdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).DeleteCalendar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_DeleteCalendar_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).DeleteCalendar(ctx, req.(*CalendarIdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_GetCalendar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CalendarIdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).GetCalendar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_GetCalendar_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).GetCalendar(ctx, req.(*CalendarIdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_GetCalendars_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CalendarsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).GetCalendars(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_GetCalendars_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).GetCalendars(ctx, req.(*CalendarsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_GetFreeBusy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FreeBusyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).GetFreeBusy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_GetFreeBusy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).GetFreeBusy(ctx, req.(*FreeBusyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_GetWorkingHours_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WorkingHoursRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).GetWorkingHours(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_GetWorkingHours_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).GetWorkingHours(ctx, req.(*WorkingHoursRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_SetWorkingHours_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WorkingHours)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).SetWorkingHours(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_SetWorkingHours_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).SetWorkingHours(ctx, req.(*WorkingHours))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_SuggestSlots_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SuggestSlotsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).SuggestSlots(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_SuggestSlots_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).SuggestSlots(ctx, req.(*SuggestSlotsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_BatchEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).BatchEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_BatchEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).BatchEvents(ctx, req.(*BatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Calendar_ServiceDesc is the grpc.ServiceDesc for Calendar service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -309,6 +804,18 @@ var Calendar_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteEvent",
 			Handler:    _Calendar_DeleteEvent_Handler,
 		},
+		{
+			MethodName: "RestoreEvent",
+			Handler:    _Calendar_RestoreEvent_Handler,
+		},
+		{
+			MethodName: "GetTrash",
+			Handler:    _Calendar_GetTrash_Handler,
+		},
+		{
+			MethodName: "GetEventHistory",
+			Handler:    _Calendar_GetEventHistory_Handler,
+		},
 		{
 			MethodName: "GetEvent",
 			Handler:    _Calendar_GetEvent_Handler,
@@ -325,6 +832,54 @@ var Calendar_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetForMonth",
 			Handler:    _Calendar_GetForMonth_Handler,
 		},
+		{
+			MethodName: "SearchEvents",
+			Handler:    _Calendar_SearchEvents_Handler,
+		},
+		{
+			MethodName: "RespondToInvitation",
+			Handler:    _Calendar_RespondToInvitation_Handler,
+		},
+		{
+			MethodName: "CreateCalendar",
+			Handler:    _Calendar_CreateCalendar_Handler,
+		},
+		{
+			MethodName: "UpdateCalendar",
+			Handler:    _Calendar_UpdateCalendar_Handler,
+		},
+		{
+			MethodName: "DeleteCalendar",
+			Handler:    _Calendar_DeleteCalendar_Handler,
+		},
+		{
+			MethodName: "GetCalendar",
+			Handler:    _Calendar_GetCalendar_Handler,
+		},
+		{
+			MethodName: "GetCalendars",
+			Handler:    _Calendar_GetCalendars_Handler,
+		},
+		{
+			MethodName: "GetFreeBusy",
+			Handler:    _Calendar_GetFreeBusy_Handler,
+		},
+		{
+			MethodName: "GetWorkingHours",
+			Handler:    _Calendar_GetWorkingHours_Handler,
+		},
+		{
+			MethodName: "SetWorkingHours",
+			Handler:    _Calendar_SetWorkingHours_Handler,
+		},
+		{
+			MethodName: "SuggestSlots",
+			Handler:    _Calendar_SuggestSlots_Handler,
+		},
+		{
+			MethodName: "BatchEvents",
+			Handler:    _Calendar_BatchEvents_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "calendar_service.proto",
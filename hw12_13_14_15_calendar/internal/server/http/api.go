@@ -4,13 +4,16 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/app"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/ical"
 	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/json"
 	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
 	"github.com/tidwall/gjson"
@@ -24,8 +27,36 @@ var marshalledFields = []json.EventField{
 	json.EventTitle,
 	json.EventStartDate,
 	json.EventEndDate,
+	json.EventAllDay,
 	json.EventDescription,
 	json.EventNotifyBefore,
+	json.EventReminders,
+	json.EventRRule,
+	json.EventTimeZone,
+	json.EventExDates,
+	json.EventVersion,
+	json.EventAttendees,
+	json.EventCalendarID,
+	json.EventTags,
+}
+
+var trashMarshalledFields = []json.EventField{
+	json.EventID,
+	json.EventTitle,
+	json.EventStartDate,
+	json.EventEndDate,
+	json.EventAllDay,
+	json.EventDescription,
+	json.EventNotifyBefore,
+	json.EventReminders,
+	json.EventRRule,
+	json.EventTimeZone,
+	json.EventExDates,
+	json.EventVersion,
+	json.EventAttendees,
+	json.EventCalendarID,
+	json.EventTags,
+	json.EventDeletedAt,
 }
 
 var unmarshalledFields = []json.EventField{
@@ -33,9 +64,32 @@ var unmarshalledFields = []json.EventField{
 	json.EventDescription,
 	json.EventStartDate,
 	json.EventEndDate,
+	json.EventAllDay,
 	json.EventNotifyBefore,
+	json.EventReminders,
+	json.EventRRule,
+	json.EventTimeZone,
+	json.EventExDates,
+	json.EventVersion,
+	json.EventAttendees,
+	json.EventCalendarID,
+	json.EventTags,
 }
 
+const (
+	AllowOverlapParam = "allowOverlap"
+	SearchQueryParam  = "q"
+	TagParam          = "tag"
+	LimitParam        = "limit"
+	CursorParam       = "cursor"
+	NextCursorHeader  = "X-Next-Cursor"
+	ETagHeader        = "ETag"
+	IfMatchHeader     = "If-Match"
+	FromParam         = "from"
+	ToParam           = "to"
+	ICalContentType   = "text/calendar; charset=utf-8"
+)
+
 type SearchPeriod int
 
 const (
@@ -67,18 +121,45 @@ func (s Server) getUserIDFromRequest(w http.ResponseWriter, r *http.Request) (uu
 	return uid.(uuid.UUID), true
 }
 
-func (s Server) getEventByRequest(w http.ResponseWriter, r *http.Request) (storage.Event, bool) {
+func getLocationFromRequest(r *http.Request) *time.Location {
+	loc, ok := r.Context().Value(TimeZoneKey).(*time.Location)
+	if !ok {
+		return time.UTC
+	}
+
+	return loc
+}
+
+func inLocation(events []storage.Event, loc *time.Location) []storage.Event {
+	res := make([]storage.Event, len(events))
+	for i, e := range events {
+		res[i] = e.In(loc)
+	}
+
+	return res
+}
+
+func (s Server) getEventIDFromRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
 	eventID := mux.Vars(r)["eventId"]
 	if eventID == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		s.writeError(w, "eventId is not set")
-		return storage.Event{}, false
+		return uuid.UUID{}, false
 	}
 
 	eid, err := uuid.Parse(eventID)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		s.writeError(w, err.Error())
+		return uuid.UUID{}, false
+	}
+
+	return eid, true
+}
+
+func (s Server) getEventByRequest(w http.ResponseWriter, r *http.Request) (storage.Event, bool) {
+	eid, ok := s.getEventIDFromRequest(w, r)
+	if !ok {
 		return storage.Event{}, false
 	}
 
@@ -87,7 +168,7 @@ func (s Server) getEventByRequest(w http.ResponseWriter, r *http.Request) (stora
 		return storage.Event{}, false
 	}
 
-	event, err := s.app.GetEvent(eid, uid)
+	event, err := s.app.GetEvent(r.Context(), eid, uid)
 	if err != nil {
 		switch {
 		case errors.Is(err, app.ErrNotFound):
@@ -128,7 +209,7 @@ func (s Server) getValidJSONFromReq(w http.ResponseWriter, r *http.Request) (str
 }
 
 func (s Server) getDateFromRequest(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
-	t, err := time.Parse(time.DateOnly, mux.Vars(r)["date"])
+	t, err := time.ParseInLocation(time.DateOnly, mux.Vars(r)["date"], getLocationFromRequest(r))
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		s.writeError(w, err.Error())
@@ -138,48 +219,134 @@ func (s Server) getDateFromRequest(w http.ResponseWriter, r *http.Request) (time
 	return t, true
 }
 
+// getAllowOverlapFromRequest читает необязательный параметр allowOverlap, разрешающий пересечение событий.
+func (s Server) getAllowOverlapFromRequest(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	val := r.URL.Query().Get(AllowOverlapParam)
+	if val == "" {
+		return false, true
+	}
+
+	allow, err := strconv.ParseBool(val)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, "invalid value in "+AllowOverlapParam)
+		return false, false
+	}
+
+	return allow, true
+}
+
+// getPageFromRequest читает необязательные параметры постраничной выборки limit и cursor.
+func (s Server) getPageFromRequest(w http.ResponseWriter, r *http.Request) (storage.Page, bool) {
+	page := storage.Page{}
+	if val := r.URL.Query().Get(LimitParam); val != "" {
+		limit, err := strconv.Atoi(val)
+		if err != nil || limit <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			s.writeError(w, "invalid value in "+LimitParam)
+			return page, false
+		}
+		page.Limit = limit
+	}
+
+	cursor, err := storage.ParseCursor(r.URL.Query().Get(CursorParam))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, "invalid value in "+CursorParam)
+		return page, false
+	}
+	page.After = cursor
+
+	return page, true
+}
+
+func setETag(w http.ResponseWriter, event storage.Event) {
+	w.Header().Set(ETagHeader, strconv.Quote(strconv.FormatInt(event.Version, 10)))
+}
+
+// getIfMatchVersion возвращает версию события из заголовка If-Match. Если заголовка нет или он равен "*",
+// возвращается 0 - изменение без проверки версии.
+func (s Server) getIfMatchVersion(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	val := strings.TrimSpace(r.Header.Get(IfMatchHeader))
+	if val == "" || val == "*" {
+		return 0, true
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(val, "W/"), `"`), 10, 64)
+	if err != nil || version <= 0 {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		s.writeError(w, "invalid "+IfMatchHeader+" header")
+		return 0, false
+	}
+
+	return version, true
+}
+
 func (s Server) getEvent(w http.ResponseWriter, r *http.Request) {
 	event, ok := s.getEventByRequest(w, r)
 	if !ok {
 		return
 	}
 
+	setETag(w, event)
 	w.WriteHeader(http.StatusOK)
-	s.write(w, json.MarshallEvent(event, marshalledFields))
+	s.write(w, json.MarshallEvent(event.In(getLocationFromRequest(r)), marshalledFields))
 }
 
 func (s Server) updateEvent(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	allowOverlap, ok := s.getAllowOverlapFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := s.getIfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
 	jsn, ok := s.getValidJSONFromReq(w, r)
 	if !ok {
 		return
 	}
 
-	target, ok := s.getEventByRequest(w, r)
+	eid, ok := s.getEventIDFromRequest(w, r)
 	if !ok {
 		return
 	}
 
-	err := json.UnmarshallEvent(jsn, &target, unmarshalledFields)
-	if err != nil {
-		var ie json.FieldParseErr
-		if errors.As(err, &ie) {
-			w.WriteHeader(http.StatusBadRequest)
-			s.writeError(w, "invalid value in "+string(ie.Field))
-		} else {
-			s.logger.Error(err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
-			s.writeError(w, err.Error())
+	// тело запроса накладывается на текущее событие в транзакции изменения
+	res, err := s.app.PatchEvent(r.Context(), eid, uid, func(target *storage.Event) error {
+		if err := json.UnmarshallEventIn(jsn, target, unmarshalledFields, getLocationFromRequest(r)); err != nil {
+			return err
 		}
+		if version != 0 {
+			target.Version = version
+		}
+		return nil
+	}, allowOverlap)
+	var ie json.FieldParseErr
+	if errors.As(err, &ie) {
+		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, "invalid value in "+string(ie.Field))
 		return
 	}
-
-	res, err := s.app.UpdateEvent(target.ID, target.UserID, target)
 	if err != nil {
 		switch {
+		case errors.Is(err, app.ErrVersionMismatch):
+			w.WriteHeader(http.StatusPreconditionFailed)
+		case errors.Is(err, app.ErrDateBusy):
+			w.WriteHeader(http.StatusConflict)
 		case errors.Is(err, app.ErrNotFound):
 			w.WriteHeader(http.StatusNotFound)
 		case errors.Is(err, app.ErrAccessDenied):
 			w.WriteHeader(http.StatusForbidden)
+		case errors.Is(err, app.ErrInvalidEvent):
+			w.WriteHeader(http.StatusBadRequest)
 		default:
 			s.logger.Error(err.Error(), zap.Error(err))
 			w.WriteHeader(http.StatusInternalServerError)
@@ -188,8 +355,9 @@ func (s Server) updateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, res)
 	w.WriteHeader(http.StatusOK)
-	s.write(w, json.MarshallEvent(res, marshalledFields))
+	s.write(w, json.MarshallEvent(res.In(getLocationFromRequest(r)), marshalledFields))
 }
 
 func (s Server) createEvent(w http.ResponseWriter, r *http.Request) {
@@ -198,14 +366,20 @@ func (s Server) createEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	allowOverlap, ok := s.getAllowOverlapFromRequest(w, r)
+	if !ok {
+		return
+	}
+
 	jsn, ok := s.getValidJSONFromReq(w, r)
 	if !ok {
 		return
 	}
 
-	target := storage.Event{}
+	// пояс серии повторений по умолчанию - пояс клиента
+	target := storage.Event{TimeZone: storage.TimeZone(getLocationFromRequest(r))}
 
-	err := json.UnmarshallEvent(jsn, &target, unmarshalledFields)
+	err := json.UnmarshallEventIn(jsn, &target, unmarshalledFields, getLocationFromRequest(r))
 	if err != nil {
 		var ie json.FieldParseErr
 		if errors.As(err, &ie) {
@@ -219,16 +393,26 @@ func (s Server) createEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := s.app.CreateEvent(uid, target)
+	res, err := s.app.CreateEvent(r.Context(), uid, target, allowOverlap)
 	if err != nil {
-		s.logger.Error(err.Error(), zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, app.ErrDateBusy):
+			w.WriteHeader(http.StatusConflict)
+		case errors.Is(err, app.ErrInvalidEvent):
+			w.WriteHeader(http.StatusBadRequest)
+		case errors.Is(err, app.ErrAccessDenied):
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			s.logger.Error(err.Error(), zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 		s.writeError(w, err.Error())
 		return
 	}
 
+	setETag(w, res)
 	w.WriteHeader(http.StatusOK)
-	s.write(w, json.MarshallEvent(res, marshalledFields))
+	s.write(w, json.MarshallEvent(res.In(getLocationFromRequest(r)), marshalledFields))
 }
 
 func (s Server) deleteEvent(w http.ResponseWriter, r *http.Request) {
@@ -237,12 +421,177 @@ func (s Server) deleteEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := s.getIfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
 	event, ok := s.getEventByRequest(w, r)
 	if !ok {
 		return
 	}
 
-	if err := s.app.DeleteEvent(event.ID, uid); err != nil {
+	if err := s.app.DeleteEvent(r.Context(), event.ID, uid, version); err != nil {
+		switch {
+		case errors.Is(err, app.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, app.ErrAccessDenied):
+			w.WriteHeader(http.StatusForbidden)
+		case errors.Is(err, app.ErrVersionMismatch):
+			w.WriteHeader(http.StatusPreconditionFailed)
+		default:
+			s.logger.Error(err.Error(), zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		s.writeError(w, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	s.write(w, `{"status":"ok"}`)
+}
+
+func (s Server) restoreEvent(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	eid, ok := s.getEventIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	allowOverlap, ok := s.getAllowOverlapFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := s.getIfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := s.app.RestoreEvent(r.Context(), eid, uid, version, allowOverlap)
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrVersionMismatch):
+			w.WriteHeader(http.StatusPreconditionFailed)
+		case errors.Is(err, app.ErrDateBusy):
+			w.WriteHeader(http.StatusConflict)
+		case errors.Is(err, app.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, app.ErrAccessDenied):
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			s.logger.Error(err.Error(), zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		s.writeError(w, err.Error())
+		return
+	}
+
+	setETag(w, res)
+	w.WriteHeader(http.StatusOK)
+	s.write(w, json.MarshallEvent(res.In(getLocationFromRequest(r)), marshalledFields))
+}
+
+// respondToInvitation принимает ответ участника на приглашение: {"Status":"accepted"}.
+func (s Server) respondToInvitation(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	eid, ok := s.getEventIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	jsn, ok := s.getValidJSONFromReq(w, r)
+	if !ok {
+		return
+	}
+	status := storage.RSVPStatus(gjson.Get(jsn, "Status").String())
+
+	res, err := s.app.RespondToInvitation(r.Context(), eid, uid, status)
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrInvalidQuery):
+			w.WriteHeader(http.StatusBadRequest)
+		case errors.Is(err, app.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, app.ErrAccessDenied):
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			s.logger.Error(err.Error(), zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		s.writeError(w, err.Error())
+		return
+	}
+
+	setETag(w, res)
+	w.WriteHeader(http.StatusOK)
+	s.write(w, json.MarshallEvent(res.In(getLocationFromRequest(r)), marshalledFields))
+}
+
+func (s Server) searchEvents(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	events, err := s.app.SearchEvents(r.Context(), uid, query.Get(SearchQueryParam), query[TagParam])
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrInvalidQuery):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			s.logger.Error(err.Error(), zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		s.writeError(w, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	s.write(w, json.MarshallEvents(inLocation(events, getLocationFromRequest(r)), marshalledFields))
+}
+
+func (s Server) getEventHistory(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	eid, ok := s.getEventIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	records, err := s.app.GetEventHistory(r.Context(), eid, uid)
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, app.ErrAccessDenied):
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			s.logger.Error(err.Error(), zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		s.writeError(w, err.Error())
+		return
+	}
+
+	loc := getLocationFromRequest(r)
+	for i := range records {
+		records[i].CreatedAt = records[i].CreatedAt.In(loc)
+	}
+	resp, err := json.MarshallHistory(records)
+	if err != nil {
 		s.logger.Error(err.Error(), zap.Error(err))
 		w.WriteHeader(http.StatusInternalServerError)
 		s.writeError(w, err.Error())
@@ -250,7 +599,30 @@ func (s Server) deleteEvent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.WriteHeader(http.StatusOK)
-	s.write(w, `{"status":"ok"}`)
+	s.write(w, resp)
+}
+
+func (s Server) getTrash(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	events, err := s.app.GetTrashedEvents(r.Context(), uid, r.URL.Query()[TagParam])
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrInvalidQuery):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			s.logger.Error(err.Error(), zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		s.writeError(w, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	s.write(w, json.MarshallEvents(inLocation(events, getLocationFromRequest(r)), trashMarshalledFields))
 }
 
 func (s Server) getForPeriod(w http.ResponseWriter, r *http.Request, period SearchPeriod) {
@@ -273,19 +645,32 @@ func (s Server) getForPeriod(w http.ResponseWriter, r *http.Request, period Sear
 		end = start.AddDate(0, 1, 0).Add(-1 * time.Nanosecond)
 	}
 
-	events, err := s.app.GetEventsForPeriod(uid, start, end)
-	if err != nil {
-		s.logger.Error(err.Error(), zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
-		s.writeError(w, err.Error())
+	page, ok := s.getPageFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	s.write(w, json.MarshallEvents(events, marshalledFields))
-}
-
-func (s Server) getForDay(w http.ResponseWriter, r *http.Request) {
+	events, next, err := s.app.GetEventsForPeriod(r.Context(), uid, start, end, page, r.URL.Query()[TagParam])
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrInvalidQuery):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			s.logger.Error(err.Error(), zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		s.writeError(w, err.Error())
+		return
+	}
+
+	if !next.IsZero() {
+		w.Header().Set(NextCursorHeader, next.String())
+	}
+	w.WriteHeader(http.StatusOK)
+	s.write(w, json.MarshallEvents(inLocation(events, getLocationFromRequest(r)), marshalledFields))
+}
+
+func (s Server) getForDay(w http.ResponseWriter, r *http.Request) {
 	s.getForPeriod(w, r, Day)
 }
 
@@ -296,3 +681,524 @@ func (s Server) getForWeek(w http.ResponseWriter, r *http.Request) {
 func (s Server) getForMonth(w http.ResponseWriter, r *http.Request) {
 	s.getForPeriod(w, r, Month)
 }
+
+// exportEvents выгружает события за период from - to (даты включительно, в поясе клиента) в формате iCalendar.
+func (s Server) exportEvents(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	loc := getLocationFromRequest(r)
+	from, err := time.ParseInLocation(time.DateOnly, r.URL.Query().Get(FromParam), loc)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, "invalid "+FromParam)
+		return
+	}
+	to, err := time.ParseInLocation(time.DateOnly, r.URL.Query().Get(ToParam), loc)
+	if err != nil || to.Before(from) {
+		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, "invalid "+ToParam)
+		return
+	}
+
+	events, err := s.app.ExportEvents(r.Context(), uid, from, to.AddDate(0, 0, 1).Add(-1*time.Nanosecond))
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrInvalidQuery):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			s.logger.Error(err.Error(), zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		s.writeError(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", ICalContentType)
+	w.WriteHeader(http.StatusOK)
+	s.write(w, ical.MarshallEvents(events, time.Now()))
+}
+
+// importEvents создаёт события из VEVENT-ов календаря в формате iCalendar. Ошибки возвращаются
+// для каждого компонента отдельно, остальные события при этом создаются.
+func (s Server) importEvents(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	allowOverlap, ok := s.getAllowOverlapFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.writeError(w, err.Error())
+		return
+	}
+
+	components, err := ical.UnmarshallEvents(string(body), getLocationFromRequest(r))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, err.Error())
+		return
+	}
+
+	results := make([]json.ImportResult, len(components))
+	for i, c := range components {
+		results[i] = json.ImportResult{UID: c.UID, Err: c.Err}
+		if c.Err != nil {
+			continue
+		}
+		if c.Event.TimeZone == "" {
+			c.Event.TimeZone = storage.TimeZone(getLocationFromRequest(r))
+		}
+		event, err := s.app.CreateEvent(r.Context(), uid, c.Event, allowOverlap)
+		if err != nil {
+			if !errors.Is(err, app.ErrDateBusy) && !errors.Is(err, app.ErrInvalidEvent) &&
+				!errors.Is(err, app.ErrAccessDenied) {
+				s.logger.Error(err.Error(), zap.Error(err))
+			}
+			results[i].Err = err
+			continue
+		}
+		results[i].ID = event.ID
+	}
+
+	resp, err := json.MarshallImportResults(results)
+	if err != nil {
+		s.logger.Error(err.Error(), zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		s.writeError(w, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	s.write(w, resp)
+}
+
+// batchEvents применяет пакет операций создания, изменения и удаления событий. Результат возвращается
+// для каждой операции отдельно, со статусом, который вернул бы соответствующий одиночный запрос.
+func (s Server) batchEvents(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	allowOverlap, ok := s.getAllowOverlapFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	jsn, ok := s.getValidJSONFromReq(w, r)
+	if !ok {
+		return
+	}
+
+	atomic, items, err := json.UnmarshallBatch(jsn)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, "invalid batch: "+err.Error())
+		return
+	}
+
+	loc := getLocationFromRequest(r)
+	ops := make([]app.BatchOperation, len(items))
+	for i, item := range items {
+		op, err := unmarshallBatchOperation(item, loc)
+		if err != nil {
+			var ie json.FieldParseErr
+			if !errors.As(err, &ie) {
+				s.logger.Error(err.Error())
+				w.WriteHeader(http.StatusInternalServerError)
+				s.writeError(w, err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			s.writeError(w, fmt.Sprintf("invalid value in Operations[%d].Event.%s", i, ie.Field))
+			return
+		}
+		ops[i] = op
+	}
+
+	res, err := s.app.BatchEvents(r.Context(), uid, ops, atomic, allowOverlap)
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrInvalidBatch):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			s.logger.Error(err.Error(), zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		s.writeError(w, err.Error())
+		return
+	}
+
+	results := make([]json.BatchResult, len(res))
+	for i, v := range res {
+		results[i] = json.BatchResult{Status: s.batchStatus(v.Err), Err: v.Err}
+		if v.Err == nil && ops[i].Action != app.BatchDelete {
+			results[i].Event = json.MarshallEvent(v.Event.In(loc), marshalledFields)
+		}
+	}
+
+	resp, err := json.MarshallBatchResults(results)
+	if err != nil {
+		s.logger.Error(err.Error(), zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		s.writeError(w, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	s.write(w, resp)
+}
+
+// batchStatus возвращает статус операции пакета, такой же, как у одиночных запросов.
+func (s Server) batchStatus(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, app.ErrBatchAborted):
+		return http.StatusFailedDependency
+	case errors.Is(err, app.ErrVersionMismatch):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, app.ErrDateBusy):
+		return http.StatusConflict
+	case errors.Is(err, app.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, app.ErrAccessDenied):
+		return http.StatusForbidden
+	case errors.Is(err, app.ErrInvalidEvent), errors.Is(err, app.ErrInvalidBatch):
+		return http.StatusBadRequest
+	default:
+		s.logger.Error(err.Error(), zap.Error(err))
+		return http.StatusInternalServerError
+	}
+}
+
+// unmarshallBatchOperation разбирает операцию пакета. При изменении, как и в updateEvent, переданные поля
+// накладываются на текущее состояние события.
+func unmarshallBatchOperation(item json.BatchOperation, loc *time.Location) (app.BatchOperation, error) {
+	op := app.BatchOperation{Action: app.BatchAction(item.Action), ID: item.ID}
+	op.Event.Version = item.Version
+	if item.Action == string(app.BatchDelete) {
+		return op, nil
+	}
+	op.Event.TimeZone = storage.TimeZone(loc)
+
+	if err := json.UnmarshallEventIn(item.Event, &op.Event, unmarshalledFields, loc); err != nil {
+		return app.BatchOperation{}, err
+	}
+	if item.Action == string(app.BatchUpdate) {
+		op.Patch = func(event *storage.Event) error {
+			if err := json.UnmarshallEventIn(item.Event, event, unmarshalledFields, loc); err != nil {
+				return err
+			}
+			if op.Event.Version != 0 {
+				event.Version = op.Event.Version
+			}
+			return nil
+		}
+	}
+	return op, nil
+}
+
+func (s Server) getCalendarIDFromRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	cid, err := uuid.Parse(mux.Vars(r)["calendarId"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, err.Error())
+		return uuid.UUID{}, false
+	}
+
+	return cid, true
+}
+
+func (s Server) getCalendarFromReq(w http.ResponseWriter, r *http.Request) (storage.Calendar, bool) {
+	jsn, ok := s.getValidJSONFromReq(w, r)
+	if !ok {
+		return storage.Calendar{}, false
+	}
+
+	calendar, err := json.UnmarshallCalendar([]byte(jsn))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, "invalid calendar")
+		return storage.Calendar{}, false
+	}
+
+	return calendar, true
+}
+
+func (s Server) writeCalendarError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, app.ErrInvalidCalendar):
+		w.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, app.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, app.ErrAccessDenied):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, app.ErrCalendarNotEmpty):
+		w.WriteHeader(http.StatusConflict)
+	default:
+		s.logger.Error(err.Error(), zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	s.writeError(w, err.Error())
+}
+
+func (s Server) writeCalendar(w http.ResponseWriter, calendar storage.Calendar) {
+	resp, err := json.MarshallCalendar(calendar)
+	if err != nil {
+		s.writeCalendarError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	s.write(w, resp)
+}
+
+func (s Server) createCalendar(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	target, ok := s.getCalendarFromReq(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := s.app.CreateCalendar(r.Context(), uid, target)
+	if err != nil {
+		s.writeCalendarError(w, err)
+		return
+	}
+
+	s.writeCalendar(w, res)
+}
+
+func (s Server) updateCalendar(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	cid, ok := s.getCalendarIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	target, ok := s.getCalendarFromReq(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := s.app.UpdateCalendar(r.Context(), cid, uid, target)
+	if err != nil {
+		s.writeCalendarError(w, err)
+		return
+	}
+
+	s.writeCalendar(w, res)
+}
+
+func (s Server) deleteCalendar(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	cid, ok := s.getCalendarIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.app.DeleteCalendar(r.Context(), cid, uid); err != nil {
+		s.writeCalendarError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	s.write(w, `{"status":"ok"}`)
+}
+
+func (s Server) getCalendar(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	cid, ok := s.getCalendarIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := s.app.GetCalendar(r.Context(), cid, uid)
+	if err != nil {
+		s.writeCalendarError(w, err)
+		return
+	}
+
+	s.writeCalendar(w, res)
+}
+
+func (s Server) getCalendars(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	calendars, err := s.app.GetCalendars(r.Context(), uid)
+	if err != nil {
+		s.writeCalendarError(w, err)
+		return
+	}
+
+	resp, err := json.MarshallCalendars(calendars)
+	if err != nil {
+		s.writeCalendarError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	s.write(w, resp)
+}
+
+func (s Server) getFreeBusy(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.getUserIDFromRequest(w, r); !ok {
+		return
+	}
+	jsn, ok := s.getValidJSONFromReq(w, r)
+	if !ok {
+		return
+	}
+	loc := getLocationFromRequest(r)
+	query, err := json.UnmarshallFreeBusyQuery([]byte(jsn), loc)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, "invalid query: "+err.Error())
+		return
+	}
+
+	res, err := s.app.GetFreeBusy(r.Context(), query.UserIDs, query.From, query.To)
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrInvalidQuery):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			s.logger.Error(err.Error(), zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		s.writeError(w, err.Error())
+		return
+	}
+
+	resp, err := json.MarshallFreeBusy(res, loc)
+	if err != nil {
+		s.logger.Error(err.Error(), zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		s.writeError(w, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	s.write(w, resp)
+}
+
+func (s Server) getWorkingHours(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := s.app.GetWorkingHours(r.Context(), uid)
+	if err != nil {
+		s.writeWorkingHoursError(w, err)
+		return
+	}
+	s.writeWorkingHours(w, res)
+}
+
+func (s Server) setWorkingHours(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	jsn, ok := s.getValidJSONFromReq(w, r)
+	if !ok {
+		return
+	}
+	hours, err := json.UnmarshallWorkingHours([]byte(jsn))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, "invalid working hours: "+err.Error())
+		return
+	}
+
+	res, err := s.app.SetWorkingHours(r.Context(), uid, hours)
+	if err != nil {
+		s.writeWorkingHoursError(w, err)
+		return
+	}
+	s.writeWorkingHours(w, res)
+}
+
+func (s Server) writeWorkingHoursError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, app.ErrInvalidWorkingHours), errors.Is(err, app.ErrInvalidQuery):
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		s.logger.Error(err.Error(), zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	s.writeError(w, err.Error())
+}
+
+func (s Server) writeWorkingHours(w http.ResponseWriter, hours storage.WorkingHours) {
+	resp, err := json.MarshallWorkingHours(hours)
+	if err != nil {
+		s.writeWorkingHoursError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	s.write(w, resp)
+}
+
+func (s Server) suggestSlots(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	jsn, ok := s.getValidJSONFromReq(w, r)
+	if !ok {
+		return
+	}
+	loc := getLocationFromRequest(r)
+	query, err := json.UnmarshallSlotQuery([]byte(jsn), loc)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, "invalid query: "+err.Error())
+		return
+	}
+
+	slots, err := s.app.SuggestSlots(r.Context(), uid, query.UserIDs, query.Duration, query.From, query.To, query.Limit)
+	if err != nil {
+		s.writeWorkingHoursError(w, err)
+		return
+	}
+	resp, err := json.MarshallIntervals(slots, loc)
+	if err != nil {
+		s.writeWorkingHoursError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	s.write(w, resp)
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"testing"
@@ -47,17 +48,45 @@ const (
 	testMethodGetForDay
 	testMethodGetForWeek
 	testMethodGetForMonth
+	testMethodRestoreEvent
+	testMethodGetTrash
+	testMethodGetHistory
+	testMethodSearch
+	testMethodRSVP
+	testMethodCreateCalendar
+	testMethodCalendar
+	testMethodGetCalendars
+	testMethodExport
+	testMethodImport
+	testMethodFreeBusy
+	testMethodSuggestSlots
+	testMethodWorkingHours
+	testMethodBatch
 )
 
 var testUris = map[testAPIMethod]string{
-	testMethodUndefined:   testURI + "/hello",
-	testMethodGetEvent:    testURI + "/event/%s",
-	testMethodCreateEvent: testURI + "/event",
-	testMethodUpdateEvent: testURI + "/event/%s",
-	testMethodDeleteEvent: testURI + "/event/%s",
-	testMethodGetForDay:   testURI + "/events/day/%s",
-	testMethodGetForWeek:  testURI + "/events/week/%s",
-	testMethodGetForMonth: testURI + "/events/month/%s",
+	testMethodUndefined:      testURI + "/hello",
+	testMethodGetEvent:       testURI + "/event/%s",
+	testMethodCreateEvent:    testURI + "/event",
+	testMethodUpdateEvent:    testURI + "/event/%s",
+	testMethodDeleteEvent:    testURI + "/event/%s",
+	testMethodGetForDay:      testURI + "/events/day/%s",
+	testMethodGetForWeek:     testURI + "/events/week/%s",
+	testMethodGetForMonth:    testURI + "/events/month/%s",
+	testMethodRestoreEvent:   testURI + "/event/%s/restore",
+	testMethodGetTrash:       testURI + "/events/trash",
+	testMethodGetHistory:     testURI + "/event/%s/history",
+	testMethodSearch:         testURI + "/events/search?q=%s",
+	testMethodRSVP:           testURI + "/event/%s/rsvp",
+	testMethodCreateCalendar: testURI + "/calendar",
+	testMethodCalendar:       testURI + "/calendar/%s",
+	testMethodGetCalendars:   testURI + "/calendars",
+	testMethodExport:         testURI + "/events/export.ics?from=%s&to=%s",
+	testMethodImport:         testURI + "/events/import",
+	testMethodFreeBusy:       testURI + "/freebusy",
+	testMethodSuggestSlots:   testURI + "/slots/suggest",
+	testMethodWorkingHours:   testURI + "/working-hours",
+	testMethodBatch:          testURI + "/events/batch",
 }
 
 func TestMain(m *testing.M) {
@@ -88,23 +117,22 @@ func TestMain(m *testing.M) {
 	}()
 
 	testClient = &http.Client{Timeout: 3 * time.Second}
-	req, err := http.NewRequestWithContext(contextTimeout(), http.MethodGet, testUris[testMethodUndefined], nil)
+	reqCtx, reqCancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer reqCancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, testUris[testMethodUndefined], nil)
 	if err != nil {
 		os.Exit(2)
 	}
 	tm := time.NewTimer(10 * time.Second)
 	var res *http.Response
-	for res, err = testClient.Do(req); err != nil; {
+	for res, err = testClient.Do(req); err != nil; res, err = testClient.Do(req) {
 		select {
 		case <-tm.C:
-			break
+			os.Exit(3)
 		default:
-			time.Sleep(time.Second)
+			time.Sleep(100 * time.Millisecond)
 		}
 	}
-	if err != nil {
-		os.Exit(3)
-	}
 	if err = res.Body.Close(); err != nil {
 		os.Exit(4)
 	}
@@ -115,27 +143,30 @@ func TestMain(m *testing.M) {
 	wg.Wait()
 }
 
-func contextTimeout() context.Context {
-	ctx, _ := context.WithTimeout(context.Background(), 3*time.Second) //nolint: govet
+func contextTimeout(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	t.Cleanup(cancel)
 	return ctx
 }
 
 func TestGetEvent(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 
 	event := storage.Event{
-		ID:           uuid.UUID{},
-		Title:        fake.Sentence(),
-		StartDate:    time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
-		EndDate:      time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
-		Description:  fake.Paragraph(),
-		UserID:       userID,
-		NotifyBefore: 24 * time.Hour,
+		ID:          uuid.UUID{},
+		Title:       fake.Sentence(),
+		StartDate:   time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
+		Description: fake.Paragraph(),
+		UserID:      userID,
+		Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 	}
-	event, _ = testStorage.AddEvent(event)
+	event, _ = testStorage.AddEvent(ctx, event)
 
 	uri := fmt.Sprintf(testUris[testMethodGetEvent], event.ID.String())
-	req, _ := http.NewRequestWithContext(contextTimeout(), http.MethodGet, uri, nil)
+	req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
 	req.Header.Add(UserIDHeader, userID.String())
 
 	res, err := testClient.Do(req)
@@ -154,28 +185,29 @@ func TestGetEvent(t *testing.T) {
 }
 
 func TestUpdateEvent(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 	event := storage.Event{
-		ID:           uuid.UUID{},
-		Title:        fake.Sentence(),
-		StartDate:    time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
-		EndDate:      time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
-		Description:  fake.Paragraph(),
-		UserID:       userID,
-		NotifyBefore: 24 * time.Hour,
+		ID:          uuid.UUID{},
+		Title:       fake.Sentence(),
+		StartDate:   time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
+		Description: fake.Paragraph(),
+		UserID:      userID,
+		Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 	}
-	event, _ = testStorage.AddEvent(event)
+	event, _ = testStorage.AddEvent(ctx, event)
 
 	updatedEvent := event
 	updatedEvent.Title = fake.Sentence()
 	updatedEvent.StartDate = time.Date(2023, time.February, 21, 12, 0, 0, 0, time.UTC)
 	updatedEvent.EndDate = time.Date(2023, time.February, 21, 12, 30, 0, 0, time.UTC)
 	updatedEvent.Description = fake.Paragraph()
-	updatedEvent.NotifyBefore = 15 * time.Minute
+	updatedEvent.Reminders = storage.Reminders{{Before: 15 * time.Minute}}
 
 	reqBody := bytes.NewReader([]byte(json.MarshallEvent(updatedEvent, marshalledFields)))
 	uri := fmt.Sprintf(testUris[testMethodUpdateEvent], event.ID.String())
-	req, _ := http.NewRequestWithContext(contextTimeout(), http.MethodPost, uri, reqBody)
+	req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodPost, uri, reqBody)
 	req.Header.Add(UserIDHeader, userID.String())
 
 	res, err := testClient.Do(req)
@@ -190,27 +222,29 @@ func TestUpdateEvent(t *testing.T) {
 	result.ID = event.ID
 	result.UserID = userID
 
+	updatedEvent.Version++
 	require.Equal(t, updatedEvent, result)
 
-	storedEvent, _ := testStorage.GetEvent(updatedEvent.ID)
+	storedEvent, _ := testStorage.GetEvent(ctx, updatedEvent.ID)
 	require.Equal(t, storedEvent, result)
 }
 
 func TestCreateEvent(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 	event := storage.Event{
-		ID:           uuid.UUID{},
-		Title:        fake.Sentence(),
-		StartDate:    time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
-		EndDate:      time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
-		Description:  fake.Paragraph(),
-		UserID:       userID,
-		NotifyBefore: 24 * time.Hour,
+		ID:          uuid.UUID{},
+		Title:       fake.Sentence(),
+		StartDate:   time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
+		Description: fake.Paragraph(),
+		UserID:      userID,
+		Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 	}
 
 	reqBody := bytes.NewReader([]byte(json.MarshallEvent(event, marshalledFields)))
 	uri := testUris[testMethodCreateEvent]
-	req, _ := http.NewRequestWithContext(contextTimeout(), http.MethodPost, uri, reqBody)
+	req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodPost, uri, reqBody)
 	req.Header.Add(UserIDHeader, userID.String())
 
 	res, err := testClient.Do(req)
@@ -220,6 +254,7 @@ func TestCreateEvent(t *testing.T) {
 	body, _ := io.ReadAll(res.Body)
 	eventID, _ := uuid.Parse(gjson.Get(string(body), string(json.EventID)).String())
 	event.ID = eventID
+	event.Version = 1
 
 	var result storage.Event
 	err = json.UnmarshallEvent(string(body), &result, unmarshalledFields)
@@ -229,25 +264,26 @@ func TestCreateEvent(t *testing.T) {
 
 	require.Equal(t, event, result)
 
-	storedEvent, _ := testStorage.GetEvent(eventID)
+	storedEvent, _ := testStorage.GetEvent(ctx, eventID)
 	require.Equal(t, storedEvent, result)
 }
 
 func TestDeleteEvent(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 	event := storage.Event{
-		ID:           uuid.UUID{},
-		Title:        fake.Sentence(),
-		StartDate:    time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
-		EndDate:      time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
-		Description:  fake.Paragraph(),
-		UserID:       userID,
-		NotifyBefore: 24 * time.Hour,
+		ID:          uuid.UUID{},
+		Title:       fake.Sentence(),
+		StartDate:   time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
+		Description: fake.Paragraph(),
+		UserID:      userID,
+		Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 	}
-	event, _ = testStorage.AddEvent(event)
+	event, _ = testStorage.AddEvent(ctx, event)
 
 	uri := fmt.Sprintf(testUris[testMethodDeleteEvent], event.ID.String())
-	req, _ := http.NewRequestWithContext(contextTimeout(), http.MethodDelete, uri, nil)
+	req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodDelete, uri, nil)
 	req.Header.Add(UserIDHeader, userID.String())
 
 	res, err := testClient.Do(req)
@@ -257,49 +293,52 @@ func TestDeleteEvent(t *testing.T) {
 	body, _ := io.ReadAll(res.Body)
 	require.Equal(t, `{"status":"ok"}`, string(body))
 
-	_, err = testStorage.GetEvent(event.ID)
-	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	// Событие попадает в корзину
+	stored, err := testStorage.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.True(t, stored.IsTrashed())
 }
 
 func TestGetForDay(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 
 	events := []storage.Event{
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.January, 10, 13, 0, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.January, 10, 14, 0, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.January, 10, 13, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 10, 14, 0, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.January, 10, 10, 30, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.January, 10, 11, 30, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.January, 10, 10, 30, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 10, 11, 30, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.January, 11, 10, 0, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.January, 11, 11, 0, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.January, 11, 10, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 11, 11, 0, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 	}
 	for i, event := range events {
-		event, _ = testStorage.AddEvent(event)
+		event, _ = testStorage.AddEvent(ctx, event)
 		events[i] = event
 	}
 
 	uri := fmt.Sprintf(testUris[testMethodGetForDay], events[0].StartDate.Format(time.DateOnly))
-	req, _ := http.NewRequestWithContext(contextTimeout(), http.MethodGet, uri, nil)
+	req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
 	req.Header.Add(UserIDHeader, userID.String())
 
 	res, err := testClient.Do(req)
@@ -321,53 +360,54 @@ func TestGetForDay(t *testing.T) {
 }
 
 func TestGetForWeek(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 
 	events := []storage.Event{
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.January, 16, 10, 0, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.January, 16, 11, 0, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.January, 16, 10, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 16, 11, 0, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.January, 20, 10, 30, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.January, 20, 11, 30, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.January, 20, 10, 30, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 20, 11, 30, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.January, 11, 10, 0, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.January, 11, 11, 0, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.January, 11, 10, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 11, 11, 0, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 	}
 	for i, event := range events {
-		event, _ = testStorage.AddEvent(event)
+		event, _ = testStorage.AddEvent(ctx, event)
 		events[i] = event
 	}
 
 	uri := fmt.Sprintf(testUris[testMethodGetForWeek], events[2].StartDate.Format(time.DateOnly))
-	req, _ := http.NewRequestWithContext(contextTimeout(), http.MethodGet, uri, nil)
+	req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
 	req.Header.Add(UserIDHeader, userID.String())
 
 	res, err := testClient.Do(req)
@@ -389,53 +429,54 @@ func TestGetForWeek(t *testing.T) {
 }
 
 func TestGetForMonth(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 
 	events := []storage.Event{
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.January, 16, 10, 0, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.January, 16, 11, 0, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.January, 16, 10, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 16, 11, 0, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.February, 20, 10, 30, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.February, 20, 11, 30, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.February, 20, 10, 30, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.February, 20, 11, 30, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.March, 10, 10, 0, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.March, 10, 11, 0, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.March, 10, 10, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.March, 10, 11, 0, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.UUID{},
-			Title:        fake.Sentence(),
-			StartDate:    time.Date(2023, time.February, 15, 10, 0, 0, 0, time.UTC),
-			EndDate:      time.Date(2023, time.February, 15, 11, 0, 0, 0, time.UTC),
-			Description:  fake.Paragraph(),
-			UserID:       userID,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.UUID{},
+			Title:       fake.Sentence(),
+			StartDate:   time.Date(2023, time.February, 15, 10, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.February, 15, 11, 0, 0, 0, time.UTC),
+			Description: fake.Paragraph(),
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 	}
 	for i, event := range events {
-		event, _ = testStorage.AddEvent(event)
+		event, _ = testStorage.AddEvent(ctx, event)
 		events[i] = event
 	}
 
 	uri := fmt.Sprintf(testUris[testMethodGetForMonth], events[0].StartDate.Format(time.DateOnly))
-	req, _ := http.NewRequestWithContext(contextTimeout(), http.MethodGet, uri, nil)
+	req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
 	req.Header.Add(UserIDHeader, userID.String())
 
 	res, err := testClient.Do(req)
@@ -457,21 +498,22 @@ func TestGetForMonth(t *testing.T) {
 }
 
 func TestGetEventUnauthorized(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 
 	event := storage.Event{
-		ID:           uuid.UUID{},
-		Title:        fake.Sentence(),
-		StartDate:    time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
-		EndDate:      time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
-		Description:  fake.Paragraph(),
-		UserID:       userID,
-		NotifyBefore: 24 * time.Hour,
+		ID:          uuid.UUID{},
+		Title:       fake.Sentence(),
+		StartDate:   time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
+		Description: fake.Paragraph(),
+		UserID:      userID,
+		Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 	}
-	event, _ = testStorage.AddEvent(event)
+	event, _ = testStorage.AddEvent(ctx, event)
 
 	uri := fmt.Sprintf(testUris[testMethodGetEvent], event.ID.String())
-	req, _ := http.NewRequestWithContext(contextTimeout(), http.MethodGet, uri, nil)
+	req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
 
 	res, err := testClient.Do(req)
 	require.NoError(t, err)
@@ -479,26 +521,1263 @@ func TestGetEventUnauthorized(t *testing.T) {
 	require.Equal(t, http.StatusUnauthorized, res.StatusCode)
 }
 
+func TestDebugVarsNotPublic(t *testing.T) {
+	// Счётчики отдаёт только отладочный сервер на локальном адресе
+	req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, testURI+"/debug/vars", nil)
+
+	res, err := testClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
 func TestGetEventForbidden(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 
 	event := storage.Event{
-		ID:           uuid.UUID{},
-		Title:        fake.Sentence(),
-		StartDate:    time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
-		EndDate:      time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
-		Description:  fake.Paragraph(),
-		UserID:       userID,
-		NotifyBefore: 24 * time.Hour,
+		ID:          uuid.UUID{},
+		Title:       fake.Sentence(),
+		StartDate:   time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
+		Description: fake.Paragraph(),
+		UserID:      userID,
+		Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 	}
-	event, _ = testStorage.AddEvent(event)
+	event, _ = testStorage.AddEvent(ctx, event)
 
 	uri := fmt.Sprintf(testUris[testMethodGetEvent], event.ID.String())
-	req, _ := http.NewRequestWithContext(contextTimeout(), http.MethodGet, uri, nil)
+	req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
+	req.Header.Add(UserIDHeader, uuid.New().String())
+
+	res, err := testClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+}
+
+func TestGetForWeekRecurring(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	event := storage.Event{
+		ID:          uuid.UUID{},
+		Title:       fake.Sentence(),
+		StartDate:   time.Date(2023, time.January, 2, 10, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2023, time.January, 2, 10, 15, 0, 0, time.UTC),
+		Description: fake.Paragraph(),
+		UserID:      userID,
+		Reminders:   storage.Reminders{{Before: 15 * time.Minute}},
+		RRule:       "FREQ=WEEKLY;BYDAY=MO,WE",
+		ExDates:     storage.Dates{time.Date(2023, time.January, 18, 10, 0, 0, 0, time.UTC)},
+	}
+	event, _ = testStorage.AddEvent(ctx, event)
+
+	uri := fmt.Sprintf(testUris[testMethodGetForWeek], "2023-01-16")
+	req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
+	req.Header.Add(UserIDHeader, userID.String())
+
+	res, err := testClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+
+	items := gjson.Parse(string(body)).Array()
+	require.Len(t, items, 1)
+	var result storage.Event
+	err = json.UnmarshallEvent(items[0].Raw, &result, unmarshalledFields)
+	require.NoError(t, err)
+	result.ID, _ = uuid.Parse(items[0].Get("ID").String())
+	result.UserID = userID
+
+	expected := event
+	expected.StartDate = time.Date(2023, time.January, 16, 10, 0, 0, 0, time.UTC)
+	expected.EndDate = time.Date(2023, time.January, 16, 10, 15, 0, 0, time.UTC)
+	require.Equal(t, expected, result)
+}
+
+func TestGetForWeekRecurringInTimeZone(t *testing.T) {
+	userID := uuid.New()
+
+	// понедельник 01:00 по Москве - в UTC ещё воскресенье
+	reqBody := bytes.NewReader([]byte(`{"Title":"Stand-up", "StartDate":"2023-01-02 01:00:00",
+		"EndDate":"2023-01-02 01:15:00", "RRule":"FREQ=WEEKLY;BYDAY=MO"}`))
+	req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodPost, testUris[testMethodCreateEvent], reqBody)
+	req.Header.Add(UserIDHeader, userID.String())
+	req.Header.Add(TimeZoneHeader, "Europe/Moscow")
+	res, err := testClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	require.Equal(t, "Europe/Moscow", gjson.Get(string(body), string(json.EventTimeZone)).String())
+
+	// экземпляры остаются понедельниками и в поясе UTC
+	uri := fmt.Sprintf(testUris[testMethodGetForWeek], "2023-01-09")
+	req, _ = http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
+	req.Header.Add(UserIDHeader, userID.String())
+	res, err = testClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	defer res.Body.Close()
+	body, _ = io.ReadAll(res.Body)
+
+	items := gjson.Parse(string(body)).Array()
+	require.Len(t, items, 1)
+	require.Equal(t, "2023-01-15 22:00:00+00:00", items[0].Get("StartDate").String())
+}
+
+// Событие без даты окончания попадает в выборку за день по дате начала, окончание раньше начала - ошибка.
+func TestCreateEventWithoutEndDate(t *testing.T) {
+	userID := uuid.New()
+	create := func(jsn string) *http.Response {
+		t.Helper()
+		uri := testUris[testMethodCreateEvent]
+		req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodPost, uri, bytes.NewReader([]byte(jsn)))
+		req.Header.Add(UserIDHeader, userID.String())
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	res := create(`{"Title":"Call", "StartDate":"2023-03-10 10:00:00"}`)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	body, _ := io.ReadAll(res.Body)
+	require.Equal(t, "2023-03-10 10:00:00+00:00", gjson.Get(string(body), string(json.EventEndDate)).String())
+
+	res = create(`{"Title":"Call", "StartDate":"2023-03-10 12:00:00", "EndDate":"2023-03-10 11:00:00"}`)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	uri := fmt.Sprintf(testUris[testMethodGetForDay], "2023-03-10")
+	req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
+	req.Header.Add(UserIDHeader, userID.String())
+	res, err := testClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	body, _ = io.ReadAll(res.Body)
+	items := gjson.Parse(string(body)).Array()
+	require.Len(t, items, 1)
+	require.Equal(t, "Call", items[0].Get("Title").String())
+}
+
+func TestCreateEventInvalidRRule(t *testing.T) {
+	userID := uuid.New()
+	event := storage.Event{
+		Title:     fake.Sentence(),
+		StartDate: time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
+		RRule:     "FREQ=SOMETIMES",
+	}
+
+	reqBody := bytes.NewReader([]byte(json.MarshallEvent(event, marshalledFields)))
+	req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodPost, testUris[testMethodCreateEvent], reqBody)
+	req.Header.Add(UserIDHeader, userID.String())
+
+	res, err := testClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestCreateEventDateBusy(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	event := storage.Event{
+		Title:     fake.Sentence(),
+		StartDate: time.Date(2023, time.January, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.January, 10, 11, 0, 0, 0, time.UTC),
+		UserID:    userID,
+	}
+	_, _ = testStorage.AddEvent(ctx, event)
+
+	overlapping := event
+	overlapping.StartDate = time.Date(2023, time.January, 10, 10, 30, 0, 0, time.UTC)
+	overlapping.EndDate = time.Date(2023, time.January, 10, 11, 30, 0, 0, time.UTC)
+
+	t.Run("conflict", func(t *testing.T) {
+		reqBody := bytes.NewReader([]byte(json.MarshallEvent(overlapping, marshalledFields)))
+		uri := testUris[testMethodCreateEvent]
+		req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodPost, uri, reqBody)
+		req.Header.Add(UserIDHeader, userID.String())
+
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusConflict, res.StatusCode)
+	})
+
+	t.Run("overlap allowed", func(t *testing.T) {
+		reqBody := bytes.NewReader([]byte(json.MarshallEvent(overlapping, marshalledFields)))
+		uri := testUris[testMethodCreateEvent] + "?" + AllowOverlapParam + "=true"
+		req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodPost, uri, reqBody)
+		req.Header.Add(UserIDHeader, userID.String())
+
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("recurring conflict", func(t *testing.T) {
+		recurring := event
+		recurring.StartDate = time.Date(2023, time.January, 3, 10, 45, 0, 0, time.UTC)
+		recurring.EndDate = time.Date(2023, time.January, 3, 11, 15, 0, 0, time.UTC)
+		recurring.RRule = "FREQ=WEEKLY"
+
+		reqBody := bytes.NewReader([]byte(json.MarshallEvent(recurring, marshalledFields)))
+		uri := testUris[testMethodCreateEvent]
+		req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodPost, uri, reqBody)
+		req.Header.Add(UserIDHeader, userID.String())
+
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusConflict, res.StatusCode)
+	})
+}
+
+func TestUpdateEventVersionConflict(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	event := storage.Event{
+		Title:     fake.Sentence(),
+		StartDate: time.Date(2023, time.March, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.March, 10, 11, 0, 0, 0, time.UTC),
+		UserID:    userID,
+	}
+	event, _ = testStorage.AddEvent(ctx, event)
+	uri := fmt.Sprintf(testUris[testMethodUpdateEvent], event.ID.String())
+
+	updated := event
+	updated.Title = fake.Sentence()
+
+	t.Run("actual version", func(t *testing.T) {
+		reqBody := bytes.NewReader([]byte(json.MarshallEvent(updated, marshalledFields)))
+		req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodPost, uri, reqBody)
+		req.Header.Add(UserIDHeader, userID.String())
+		req.Header.Add(IfMatchHeader, `"1"`)
+
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, `"2"`, res.Header.Get(ETagHeader))
+	})
+
+	t.Run("stale version", func(t *testing.T) {
+		reqBody := bytes.NewReader([]byte(json.MarshallEvent(updated, marshalledFields)))
+		req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodPost, uri, reqBody)
+		req.Header.Add(UserIDHeader, userID.String())
+		req.Header.Add(IfMatchHeader, `"1"`)
+
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+	})
+
+	t.Run("stale version in body", func(t *testing.T) {
+		reqBody := bytes.NewReader([]byte(`{"Title":"stale","Version":1}`))
+		req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodPost, uri, reqBody)
+		req.Header.Add(UserIDHeader, userID.String())
+
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+	})
+
+	t.Run("without version", func(t *testing.T) {
+		// без If-Match и версии в теле событие изменяется без проверки, остальные поля остаются прежними
+		reqBody := bytes.NewReader([]byte(`{"Title":"no version"}`))
+		req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodPost, uri, reqBody)
+		req.Header.Add(UserIDHeader, userID.String())
+
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, `"3"`, res.Header.Get(ETagHeader))
+
+		stored, err := testStorage.GetEvent(ctx, event.ID)
+		require.NoError(t, err)
+		require.Equal(t, "no version", stored.Title)
+		require.True(t, event.StartDate.Equal(stored.StartDate))
+	})
+
+	t.Run("stale delete", func(t *testing.T) {
+		uri := fmt.Sprintf(testUris[testMethodDeleteEvent], event.ID.String())
+		req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodDelete, uri, nil)
+		req.Header.Add(UserIDHeader, userID.String())
+		req.Header.Add(IfMatchHeader, `"1"`)
+
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+
+		_, err = testStorage.GetEvent(ctx, event.ID)
+		require.NoError(t, err)
+	})
+}
+
+func TestTrashAndRestore(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	event := storage.Event{
+		Title:     fake.Sentence(),
+		StartDate: time.Date(2023, time.April, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.April, 10, 11, 0, 0, 0, time.UTC),
+		UserID:    userID,
+	}
+	event, _ = testStorage.AddEvent(ctx, event)
+	restoreURI := fmt.Sprintf(testUris[testMethodRestoreEvent], event.ID.String())
+
+	doRequest := func(method, uri string, headers map[string]string) (*http.Response, string) {
+		req, _ := http.NewRequestWithContext(contextTimeout(t), method, uri, nil)
+		req.Header.Add(UserIDHeader, userID.String())
+		for k, v := range headers {
+			req.Header.Add(k, v)
+		}
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res, string(body)
+	}
+
+	res, _ := doRequest(http.MethodDelete, fmt.Sprintf(testUris[testMethodDeleteEvent], event.ID.String()), nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	res, _ = doRequest(http.MethodGet, fmt.Sprintf(testUris[testMethodGetEvent], event.ID.String()), nil)
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res, body := doRequest(http.MethodGet, testUris[testMethodGetTrash], nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	trashed, _ := testStorage.GetEvent(ctx, event.ID)
+	require.Equal(t, "["+json.MarshallEvent(trashed, trashMarshalledFields)+"]", body)
+
+	res, _ = doRequest(http.MethodPost, restoreURI, map[string]string{IfMatchHeader: `"1"`})
+	require.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+
+	res, _ = doRequest(http.MethodPost, restoreURI, map[string]string{IfMatchHeader: `"2"`})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, `"3"`, res.Header.Get(ETagHeader))
+
+	// Восстановить можно только событие из корзины
+	res, _ = doRequest(http.MethodPost, restoreURI, nil)
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res, body = doRequest(http.MethodGet, testUris[testMethodGetTrash], nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "[]", body)
+}
+
+func TestGetEventHistory(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	event := storage.Event{
+		Title:     "Before",
+		StartDate: time.Date(2023, time.May, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.May, 10, 11, 0, 0, 0, time.UTC),
+	}
+	event, err := testApp.CreateEvent(ctx, userID, event, false)
+	require.NoError(t, err)
+
+	updated := event
+	updated.Title = "After"
+	_, err = testApp.UpdateEvent(ctx, event.ID, userID, updated, false)
+	require.NoError(t, err)
+	require.NoError(t, testApp.DeleteEvent(ctx, event.ID, userID, 0))
+
+	uri := fmt.Sprintf(testUris[testMethodGetHistory], event.ID.String())
+	req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
+	req.Header.Add(UserIDHeader, userID.String())
+
+	res, err := testClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	body, _ := io.ReadAll(res.Body)
+
+	records := gjson.ParseBytes(body).Array()
+	require.Len(t, records, 3)
+	require.Equal(t, "create", records[0].Get("Action").String())
+	require.Equal(t, userID.String(), records[0].Get("UserID").String())
+	require.Equal(t, "update", records[1].Get("Action").String())
+	require.Equal(
+		t,
+		`[{"Field":"Title","Old":"Before","New":"After"}]`,
+		records[1].Get("Changes").Raw,
+	)
+	require.Equal(t, "delete", records[2].Get("Action").String())
+	require.Equal(t, "DeletedAt", records[2].Get("Changes.0.Field").String())
+
+	req, _ = http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
 	req.Header.Add(UserIDHeader, uuid.New().String())
+	res, err = testClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+}
+
+func TestSearchEvents(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	events := []storage.Event{
+		{
+			Title:     "Migration meeting",
+			StartDate: time.Date(2023, time.June, 10, 10, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2023, time.June, 10, 11, 0, 0, 0, time.UTC),
+			UserID:    userID,
+		},
+		{
+			Title:       "Planning",
+			Description: "Discuss the DB migration",
+			StartDate:   time.Date(2023, time.June, 1, 10, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.June, 1, 11, 0, 0, 0, time.UTC),
+			UserID:      userID,
+			Tags:        storage.Tags{{Name: "ops", Color: "#ff0000"}},
+		},
+		{
+			Title:     "Migration meeting",
+			StartDate: time.Date(2023, time.June, 10, 10, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2023, time.June, 10, 11, 0, 0, 0, time.UTC),
+			UserID:    uuid.New(),
+		},
+	}
+	for i := range events {
+		events[i], _ = testStorage.AddEvent(ctx, events[i])
+	}
+
+	t.Run("found", func(t *testing.T) {
+		uri := fmt.Sprintf(testUris[testMethodSearch], "migration")
+		req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
+		req.Header.Add(UserIDHeader, userID.String())
+
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		body, _ := io.ReadAll(res.Body)
+		require.Equal(t, json.MarshallEvents([]storage.Event{events[1], events[0]}, marshalledFields), string(body))
+	})
+
+	t.Run("by tag", func(t *testing.T) {
+		uri := fmt.Sprintf(testUris[testMethodSearch], "migration") + "&" + TagParam + "=ops"
+		req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
+		req.Header.Add(UserIDHeader, userID.String())
+
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		body, _ := io.ReadAll(res.Body)
+		require.Equal(t, json.MarshallEvents([]storage.Event{events[1]}, marshalledFields), string(body))
+		require.Contains(t, string(body), `"Tags":[{"Name":"ops","Color":"#ff0000"}]`)
+	})
+
+	t.Run("empty tag", func(t *testing.T) {
+		uri := fmt.Sprintf(testUris[testMethodSearch], "migration") + "&" + TagParam + "="
+		req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
+		req.Header.Add(UserIDHeader, userID.String())
+
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("empty query", func(t *testing.T) {
+		uri := fmt.Sprintf(testUris[testMethodSearch], "")
+		req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
+		req.Header.Add(UserIDHeader, userID.String())
+
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
+
+func TestGetForWeekPaginated(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	events := []storage.Event{
+		{
+			Title:     fake.Sentence(),
+			StartDate: time.Date(2023, time.August, 7, 10, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2023, time.August, 7, 11, 0, 0, 0, time.UTC),
+			UserID:    userID,
+		},
+		{
+			Title:     fake.Sentence(),
+			StartDate: time.Date(2023, time.August, 9, 10, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2023, time.August, 9, 11, 0, 0, 0, time.UTC),
+			UserID:    userID,
+		},
+		{
+			Title:     fake.Sentence(),
+			StartDate: time.Date(2023, time.August, 6, 12, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2023, time.August, 6, 12, 30, 0, 0, time.UTC),
+			UserID:    userID,
+			RRule:     "FREQ=DAILY;INTERVAL=2",
+		},
+	}
+	for i := range events {
+		events[i], _ = testStorage.AddEvent(ctx, events[i])
+	}
+
+	getPage := func(query string) (*http.Response, []string) {
+		uri := fmt.Sprintf(testUris[testMethodGetForWeek], "2023-08-07") + "?" + query
+		req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
+		req.Header.Add(UserIDHeader, userID.String())
+
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+
+		starts := make([]string, 0)
+		for _, val := range gjson.ParseBytes(body).Array() {
+			starts = append(starts, val.Get("StartDate").String())
+		}
+		return res, starts
+	}
+
+	// 7.08 10:00, 8.08 12:00 (повтор), 9.08 10:00, 10.08 12:00 (повтор), 12.08 12:00 (повтор)
+	res, starts := getPage(LimitParam + "=2")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, []string{"2023-08-07 10:00:00+00:00", "2023-08-08 12:00:00+00:00"}, starts)
+	cursor := res.Header.Get(NextCursorHeader)
+	require.NotEmpty(t, cursor)
+
+	res, starts = getPage(LimitParam + "=2&" + CursorParam + "=" + cursor)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, []string{"2023-08-09 10:00:00+00:00", "2023-08-10 12:00:00+00:00"}, starts)
+	cursor = res.Header.Get(NextCursorHeader)
+	require.NotEmpty(t, cursor)
+
+	res, starts = getPage(LimitParam + "=2&" + CursorParam + "=" + cursor)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, []string{"2023-08-12 12:00:00+00:00"}, starts)
+	require.Empty(t, res.Header.Get(NextCursorHeader))
+
+	res, _ = getPage(CursorParam + "=invalid")
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, _ = getPage(LimitParam + "=-1")
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestGetForDayInTimeZone(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	events := []storage.Event{
+		{
+			Title:     fake.Sentence(),
+			StartDate: time.Date(2023, time.January, 10, 22, 30, 0, 0, time.UTC),
+			EndDate:   time.Date(2023, time.January, 10, 23, 0, 0, 0, time.UTC),
+			UserID:    userID,
+		},
+		{
+			Title:     fake.Sentence(),
+			StartDate: time.Date(2023, time.January, 11, 10, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2023, time.January, 11, 11, 0, 0, 0, time.UTC),
+			UserID:    userID,
+		},
+		{
+			Title:     fake.Sentence(),
+			StartDate: time.Date(2023, time.January, 11, 21, 30, 0, 0, time.UTC),
+			EndDate:   time.Date(2023, time.January, 11, 22, 0, 0, 0, time.UTC),
+			UserID:    userID,
+		},
+	}
+	for i, event := range events {
+		event, _ = testStorage.AddEvent(ctx, event)
+		events[i] = event
+	}
+
+	// В Москве (UTC+3) первое событие уже 11 января, а последнее - 12-го
+	uri := fmt.Sprintf(testUris[testMethodGetForDay], "2023-01-11")
+	req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
+	req.Header.Add(UserIDHeader, userID.String())
+	req.Header.Add(TimeZoneHeader, "Europe/Moscow")
 
 	res, err := testClient.Do(req)
 	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+
+	items := gjson.Parse(string(body)).Array()
+	require.Len(t, items, 2)
+	require.Equal(t, events[0].ID.String(), items[0].Get("ID").String())
+	require.Equal(t, "2023-01-11 01:30:00+03:00", items[0].Get("StartDate").String())
+	require.Equal(t, events[1].ID.String(), items[1].Get("ID").String())
+
+	var result storage.Event
+	err = json.UnmarshallEvent(items[0].Raw, &result, unmarshalledFields)
+	require.NoError(t, err)
+	require.Equal(t, events[0].StartDate, result.StartDate)
+
+	req, _ = http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
+	req.Header.Add(UserIDHeader, userID.String())
+	req.Header.Add(TimeZoneHeader, "Mars/Olympus")
+	res, err = testClient.Do(req)
+	require.NoError(t, err)
 	defer res.Body.Close()
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestAllDayAndMultiDayEvents(t *testing.T) {
+	userID := uuid.New()
+	create := func(body string) string {
+		req, _ := http.NewRequestWithContext(
+			contextTimeout(t),
+			http.MethodPost,
+			testUris[testMethodCreateEvent],
+			bytes.NewReader([]byte(body)),
+		)
+		req.Header.Add(UserIDHeader, userID.String())
+		req.Header.Add(TimeZoneHeader, "Europe/Moscow")
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		b, _ := io.ReadAll(res.Body)
+		return string(b)
+	}
+	get := func(uri string) []gjson.Result {
+		req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodGet, uri, nil)
+		req.Header.Add(UserIDHeader, userID.String())
+		req.Header.Add(TimeZoneHeader, "Europe/Moscow")
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		b, _ := io.ReadAll(res.Body)
+		return gjson.Parse(string(b)).Array()
+	}
+
+	// воскресенье и понедельник, окончание не входит в событие
+	body := create(`{"Title":"Offsite","StartDate":"2023-01-08","EndDate":"2023-01-10","AllDay":true}`)
+	require.Equal(t, "2023-01-08", gjson.Get(body, "StartDate").String())
+	require.Equal(t, "2023-01-10", gjson.Get(body, "EndDate").String())
+	require.True(t, gjson.Get(body, "AllDay").Bool())
+	offsite, _ := uuid.Parse(gjson.Get(body, "ID").String())
+	stored, err := testStorage.GetEvent(context.Background(), offsite)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2023, time.January, 8, 0, 0, 0, 0, time.UTC), stored.StartDate)
+
+	// событие на целый день время не занимает, пересечения с ним нет
+	body = create(`{"Title":"Trip","StartDate":"2023-01-08 20:00:00","EndDate":"2023-01-10 12:00:00"}`)
+	trip := gjson.Get(body, "ID").String()
+
+	// оба события начались в воскресенье, но идут и на следующей неделе
+	items := get(fmt.Sprintf(testUris[testMethodGetForWeek], "2023-01-09"))
+	require.Len(t, items, 2)
+	require.ElementsMatch(
+		t,
+		[]string{offsite.String(), trip},
+		[]string{items[0].Get("ID").String(), items[1].Get("ID").String()},
+	)
+
+	items = get(fmt.Sprintf(testUris[testMethodGetForDay], "2023-01-10"))
+	require.Len(t, items, 1)
+	require.Equal(t, trip, items[0].Get("ID").String())
+
+	require.Empty(t, get(fmt.Sprintf(testUris[testMethodGetForDay], "2023-01-11")))
+}
+
+func TestMultipleReminders(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	doRequest := func(method, uri, body string) (*http.Response, string) {
+		req, _ := http.NewRequestWithContext(contextTimeout(t), method, uri, bytes.NewReader([]byte(body)))
+		req.Header.Add(UserIDHeader, userID.String())
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		resBody, _ := io.ReadAll(res.Body)
+		return res, string(resBody)
+	}
+
+	// повторы убираются, напоминания упорядочиваются по времени до начала
+	res, body := doRequest(
+		http.MethodPost,
+		testUris[testMethodCreateEvent],
+		`{"Title":"Review","StartDate":"2023-03-01 10:00:00","EndDate":"2023-03-01 11:00:00",`+
+			`"Reminders":["24h","15m","24h"]}`,
+	)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, `["15m0s","24h0m0s"]`, gjson.Get(body, "Reminders").Raw)
+	require.Equal(t, "24h0m0s", gjson.Get(body, "NotifyBefore").String())
+	id, err := uuid.Parse(gjson.Get(body, "ID").String())
+	require.NoError(t, err)
+
+	// отметка об отправке сохраняется у напоминаний, которые остались после изменения события
+	notified := time.Date(2023, time.February, 28, 10, 0, 0, 0, time.UTC)
+	stored, err := testStorage.GetEvent(ctx, id)
+	require.NoError(t, err)
+	stored.Reminders[1].NotifiedAt = notified
+	require.NoError(t, testStorage.UpdateEvent(ctx, stored))
+	uri := fmt.Sprintf(testUris[testMethodUpdateEvent], id.String())
+	res, body = doRequest(
+		http.MethodPost,
+		uri,
+		`{"Title":"Review","StartDate":"2023-03-01 10:00:00","EndDate":"2023-03-01 11:00:00",`+
+			`"Reminders":["24h","1h"]}`,
+	)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, `["1h0m0s","24h0m0s"]`, gjson.Get(body, "Reminders").Raw)
+	stored, err = testStorage.GetEvent(ctx, id)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		storage.Reminders{{Before: time.Hour}, {Before: 24 * time.Hour, NotifiedAt: notified}},
+		stored.Reminders,
+	)
+
+	// NotifyBefore заменяет все напоминания одним, "0s" - без напоминаний
+	res, body = doRequest(
+		http.MethodPost,
+		uri,
+		`{"Title":"Review","StartDate":"2023-03-01 10:00:00","EndDate":"2023-03-01 11:00:00","NotifyBefore":"30m"}`,
+	)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, `["30m0s"]`, gjson.Get(body, "Reminders").Raw)
+	res, body = doRequest(
+		http.MethodPost,
+		uri,
+		`{"Title":"Review","StartDate":"2023-03-01 10:00:00","EndDate":"2023-03-01 11:00:00","NotifyBefore":"0s"}`,
+	)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, `[]`, gjson.Get(body, "Reminders").Raw)
+	require.Equal(t, "0s", gjson.Get(body, "NotifyBefore").String())
+
+	res, _ = doRequest(
+		http.MethodPost,
+		uri,
+		`{"Title":"Review","StartDate":"2023-03-01 10:00:00","EndDate":"2023-03-01 11:00:00","Reminders":["-5m"]}`,
+	)
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestInvitationAndRSVP(t *testing.T) {
+	ctx := context.Background()
+	ownerID := uuid.New()
+	attendeeID := uuid.New()
+	strangerID := uuid.New()
+	event := storage.Event{
+		Title:     fake.Sentence(),
+		StartDate: time.Date(2023, time.May, 10, 10, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.May, 10, 11, 0, 0, 0, time.UTC),
+		Attendees: storage.Attendees{{UserID: attendeeID}, {UserID: ownerID}, {UserID: attendeeID}},
+	}
+
+	doRequest := func(userID uuid.UUID, method, uri, body string) (*http.Response, string) {
+		req, _ := http.NewRequestWithContext(contextTimeout(t), method, uri, bytes.NewReader([]byte(body)))
+		req.Header.Add(UserIDHeader, userID.String())
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		resBody, _ := io.ReadAll(res.Body)
+		return res, string(resBody)
+	}
+
+	// Владелец и повторы в списке участников отбрасываются, приглашённый ещё не ответил
+	res, body := doRequest(
+		ownerID, http.MethodPost, testUris[testMethodCreateEvent], json.MarshallEvent(event, marshalledFields),
+	)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	event.ID, _ = uuid.Parse(gjson.Get(body, string(json.EventID)).String())
+	stored, _ := testStorage.GetEvent(ctx, event.ID)
+	require.Equal(t, storage.Attendees{{UserID: attendeeID, Status: storage.RSVPNeedsAction}}, stored.Attendees)
+
+	// Участник видит событие, но не может его менять
+	eventURI := fmt.Sprintf(testUris[testMethodGetEvent], event.ID.String())
+	res, _ = doRequest(attendeeID, http.MethodGet, eventURI, "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	res, _ = doRequest(attendeeID, http.MethodPost, eventURI, json.MarshallEvent(event, marshalledFields))
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, _ = doRequest(attendeeID, http.MethodDelete, eventURI, "")
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, _ = doRequest(strangerID, http.MethodGet, eventURI, "")
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	res, body = doRequest(attendeeID, http.MethodGet, fmt.Sprintf(testUris[testMethodGetForDay], "2023-05-10"), "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, event.ID.String(), gjson.Get(body, "0.ID").String())
+
+	rsvpURI := fmt.Sprintf(testUris[testMethodRSVP], event.ID.String())
+	res, body = doRequest(attendeeID, http.MethodPost, rsvpURI, `{"Status":"accepted"}`)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, string(storage.RSVPAccepted), gjson.Get(body, "Attendees.0.Status").String())
+	// Ответ на приглашение не меняет версию события
+	require.Equal(t, `"1"`, res.Header.Get(ETagHeader))
+
+	res, _ = doRequest(attendeeID, http.MethodPost, rsvpURI, `{"Status":"maybe"}`)
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res, _ = doRequest(ownerID, http.MethodPost, rsvpURI, `{"Status":"declined"}`)
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, _ = doRequest(strangerID, http.MethodPost, rsvpURI, `{"Status":"declined"}`)
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	// При изменении события владельцем ответы участников сохраняются
+	event.Title = fake.Sentence()
+	res, body = doRequest(ownerID, http.MethodPost, eventURI, json.MarshallEvent(event, marshalledFields))
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, string(storage.RSVPAccepted), gjson.Get(body, "Attendees.0.Status").String())
+}
+
+func TestCalendarSharing(t *testing.T) {
+	ctx := context.Background()
+	ownerID := uuid.New()
+	readerID := uuid.New()
+	busyID := uuid.New()
+	writerID := uuid.New()
+	strangerID := uuid.New()
+
+	doRequest := func(userID uuid.UUID, method, uri, body string) (*http.Response, string) {
+		req, _ := http.NewRequestWithContext(contextTimeout(t), method, uri, bytes.NewReader([]byte(body)))
+		req.Header.Add(UserIDHeader, userID.String())
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		resBody, _ := io.ReadAll(res.Body)
+		return res, string(resBody)
+	}
+
+	res, _ := doRequest(ownerID, http.MethodPost, testUris[testMethodCreateCalendar], `{"Name":" "}`)
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	grants := fmt.Sprintf(
+		`[{"UserID":"%s","Access":"read"},{"UserID":"%s","Access":"free-busy"},{"UserID":"%s","Access":"write"}]`,
+		readerID, busyID, writerID,
+	)
+	res, body := doRequest(
+		ownerID, http.MethodPost, testUris[testMethodCreateCalendar],
+		`{"Name":"Команда","Color":"#00ff00","Grants":`+grants+`}`,
+	)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	calendarID := gjson.Get(body, "ID").String()
+	require.Equal(t, ownerID.String(), gjson.Get(body, "OwnerID").String())
+	require.Equal(t, int64(3), gjson.Get(body, "Grants.#").Int())
+
+	// Пользователь с доступом видит календарь и только свой доступ
+	calendarURI := fmt.Sprintf(testUris[testMethodCalendar], calendarID)
+	res, body = doRequest(readerID, http.MethodGet, calendarURI, "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, fmt.Sprintf(`[{"UserID":"%s","Access":"read"}]`, readerID), gjson.Get(body, "Grants").Raw)
+	res, body = doRequest(readerID, http.MethodGet, testUris[testMethodGetCalendars], "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, calendarID, gjson.Get(body, "0.ID").String())
+	res, _ = doRequest(strangerID, http.MethodGet, calendarURI, "")
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, _ = doRequest(writerID, http.MethodPost, calendarURI, `{"Name":"Чужой"}`)
 	require.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	event := storage.Event{
+		Title:      fake.Sentence(),
+		StartDate:  time.Date(2023, time.May, 12, 10, 0, 0, 0, time.UTC),
+		EndDate:    time.Date(2023, time.May, 12, 11, 0, 0, 0, time.UTC),
+		CalendarID: uuid.MustParse(calendarID),
+	}
+	eventJSON := json.MarshallEvent(event, marshalledFields)
+	res, _ = doRequest(readerID, http.MethodPost, testUris[testMethodCreateEvent], eventJSON)
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, body = doRequest(ownerID, http.MethodPost, testUris[testMethodCreateEvent], eventJSON)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, calendarID, gjson.Get(body, string(json.EventCalendarID)).String())
+	event.ID, _ = uuid.Parse(gjson.Get(body, string(json.EventID)).String())
+
+	eventURI := fmt.Sprintf(testUris[testMethodGetEvent], event.ID.String())
+	res, body = doRequest(readerID, http.MethodGet, eventURI, "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, event.Title, gjson.Get(body, string(json.EventTitle)).String())
+	// При доступе free-busy видно только занятое время
+	res, body = doRequest(busyID, http.MethodGet, eventURI, "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "", gjson.Get(body, string(json.EventTitle)).String())
+	require.Equal(t, "2023-05-12 10:00:00+00:00", gjson.Get(body, string(json.EventStartDate)).String())
+	res, body = doRequest(busyID, http.MethodGet, fmt.Sprintf(testUris[testMethodGetForDay], "2023-05-12"), "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, event.ID.String(), gjson.Get(body, "0.ID").String())
+	require.Equal(t, "", gjson.Get(body, "0.Title").String())
+	res, _ = doRequest(strangerID, http.MethodGet, eventURI, "")
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	// Изменять событие могут пользователи с доступом на запись, владелец события не меняется
+	event.Title = fake.Sentence()
+	res, _ = doRequest(readerID, http.MethodPost, eventURI, json.MarshallEvent(event, marshalledFields))
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, body = doRequest(writerID, http.MethodPost, eventURI, json.MarshallEvent(event, marshalledFields))
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, event.Title, gjson.Get(body, string(json.EventTitle)).String())
+	stored, _ := testStorage.GetEvent(ctx, event.ID)
+	require.Equal(t, ownerID, stored.UserID)
+
+	// Календарь с событиями (в том числе в корзине) удалить нельзя
+	res, _ = doRequest(writerID, http.MethodDelete, calendarURI, "")
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, _ = doRequest(ownerID, http.MethodDelete, calendarURI, "")
+	require.Equal(t, http.StatusConflict, res.StatusCode)
+	res, _ = doRequest(writerID, http.MethodDelete, eventURI, "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	res, _ = doRequest(ownerID, http.MethodDelete, calendarURI, "")
+	require.Equal(t, http.StatusConflict, res.StatusCode)
+
+	// Отзыв доступа
+	res, body = doRequest(ownerID, http.MethodPost, calendarURI, `{"Name":"Команда"}`)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, int64(0), gjson.Get(body, "Grants.#").Int())
+	res, _ = doRequest(readerID, http.MethodGet, calendarURI, "")
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+}
+
+func TestExportImportICal(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	otherID := uuid.New()
+	doRequest := func(userID uuid.UUID, method, uri, body string) (*http.Response, string) {
+		req, _ := http.NewRequestWithContext(contextTimeout(t), method, uri, bytes.NewReader([]byte(body)))
+		req.Header.Add(UserIDHeader, userID.String())
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		resBody, _ := io.ReadAll(res.Body)
+		return res, string(resBody)
+	}
+
+	source := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"DTSTART:20230515T090000Z",
+		"DTEND:20230515T091500Z",
+		"SUMMARY:Стендап",
+		"RRULE:FREQ=DAILY;COUNT=5",
+		"BEGIN:VALARM",
+		"TRIGGER:-PT10M",
+		"END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:broken",
+		"SUMMARY:Без начала",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:busy",
+		"DTSTART:20230515T090500Z",
+		"DTEND:20230515T093000Z",
+		"SUMMARY:Пересекается со стендапом",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	res, _ := doRequest(userID, http.MethodPost, testUris[testMethodImport], "not a calendar")
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, body := doRequest(userID, http.MethodPost, testUris[testMethodImport], source)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, int64(3), gjson.Get(body, "#").Int())
+	require.Equal(t, "standup", gjson.Get(body, "0.UID").String())
+	require.False(t, gjson.Get(body, "0.Error").Exists())
+	require.Contains(t, gjson.Get(body, "1.Error").String(), "DTSTART is required")
+	require.Contains(t, gjson.Get(body, "2.Error").String(), app.ErrDateBusy.Error())
+
+	id, err := uuid.Parse(gjson.Get(body, "0.ID").String())
+	require.NoError(t, err)
+	stored, err := testStorage.GetEvent(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, userID, stored.UserID)
+	require.Equal(t, "Стендап", stored.Title)
+	require.Equal(t, storage.Reminders{{Before: 10 * time.Minute}}, stored.Reminders)
+
+	// Повторяющееся событие выгружается один раз, с правилом повторения
+	exportURI := fmt.Sprintf(testUris[testMethodExport], "2023-05-15", "2023-05-19")
+	res, body = doRequest(userID, http.MethodGet, exportURI, "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, ICalContentType, res.Header.Get("Content-Type"))
+	require.Equal(t, 1, strings.Count(body, "BEGIN:VEVENT"))
+	require.Contains(t, body, "UID:"+id.String()+"\r\n")
+	require.Contains(t, body, "RRULE:FREQ=DAILY;COUNT=5\r\n")
+	require.Contains(t, body, "TRIGGER:-PT10M\r\n")
+
+	res, body = doRequest(otherID, http.MethodGet, exportURI, "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, 0, strings.Count(body, "BEGIN:VEVENT"))
+
+	res, _ = doRequest(userID, http.MethodGet, fmt.Sprintf(testUris[testMethodExport], "2023-05-19", "2023-05-15"), "")
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestFreeBusy(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	attendeeID := uuid.New()
+	day := func(h, m int) time.Time {
+		return time.Date(2023, time.July, 10, h, m, 0, 0, time.UTC)
+	}
+	events := []storage.Event{
+		{Title: "Планёрка", StartDate: day(10, 0), EndDate: day(11, 0), UserID: userID},
+		{Title: "Созвон", StartDate: day(10, 30), EndDate: day(12, 0), UserID: userID},
+		{Title: "Обед", StartDate: day(13, 0).AddDate(0, 0, -7), EndDate: day(14, 0).AddDate(0, 0, -7),
+			UserID: userID, RRule: "FREQ=DAILY"},
+		{Title: "Ночная смена", StartDate: day(22, 0), EndDate: day(26, 0), UserID: userID},
+		{
+			Title: "Встреча", StartDate: day(15, 0), EndDate: day(16, 0), UserID: uuid.New(),
+			Attendees: storage.Attendees{{UserID: attendeeID, Status: storage.RSVPAccepted}},
+		},
+		{
+			Title: "Отказ", StartDate: day(17, 0), EndDate: day(18, 0), UserID: uuid.New(),
+			Attendees: storage.Attendees{{UserID: attendeeID, Status: storage.RSVPDeclined}},
+		},
+	}
+	for _, e := range events {
+		_, err := testStorage.AddEvent(ctx, e)
+		require.NoError(t, err)
+	}
+
+	doRequest := func(body string) (*http.Response, string) {
+		req, _ := http.NewRequestWithContext(
+			contextTimeout(t), http.MethodPost, testUris[testMethodFreeBusy], bytes.NewReader([]byte(body)),
+		)
+		req.Header.Add(UserIDHeader, uuid.New().String())
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		resBody, _ := io.ReadAll(res.Body)
+		return res, string(resBody)
+	}
+
+	res, body := doRequest(fmt.Sprintf(
+		`{"Users":["%s","%s","%s"],"From":"2023-07-10 00:00:00","To":"2023-07-11 00:00:00"}`,
+		userID, attendeeID, userID,
+	))
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	expected := fmt.Sprintf(`[{"UserID":"%s","Busy":[`+
+		`{"Start":"2023-07-10 10:00:00+00:00","End":"2023-07-10 12:00:00+00:00"},`+
+		`{"Start":"2023-07-10 13:00:00+00:00","End":"2023-07-10 14:00:00+00:00"},`+
+		`{"Start":"2023-07-10 22:00:00+00:00","End":"2023-07-11 00:00:00+00:00"}]},`+
+		`{"UserID":"%s","Busy":[{"Start":"2023-07-10 15:00:00+00:00","End":"2023-07-10 16:00:00+00:00"}]}]`,
+		userID, attendeeID,
+	)
+	require.JSONEq(t, expected, body)
+	require.NotContains(t, body, "Планёрка")
+
+	for _, body := range []string{
+		`{"Users":[],"From":"2023-07-10 00:00:00","To":"2023-07-11 00:00:00"}`,
+		fmt.Sprintf(`{"Users":["%s"],"From":"2023-07-11 00:00:00","To":"2023-07-10 00:00:00"}`, userID),
+		fmt.Sprintf(`{"Users":["%s"],"From":"2023-07-10","To":"2023-07-11 00:00:00"}`, userID),
+		`{"Users":["not uuid"],"From":"2023-07-10 00:00:00","To":"2023-07-11 00:00:00"}`,
+	} {
+		res, _ = doRequest(body)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode, body)
+	}
+}
+
+func TestSuggestSlots(t *testing.T) {
+	ctx := context.Background()
+	organizerID := uuid.New()
+	colleagueID := uuid.New()
+	doRequest := func(method, uri, body string) (*http.Response, string) {
+		req, _ := http.NewRequestWithContext(contextTimeout(t), method, uri, bytes.NewReader([]byte(body)))
+		req.Header.Add(UserIDHeader, organizerID.String())
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		resBody, _ := io.ReadAll(res.Body)
+		return res, string(resBody)
+	}
+
+	res, body := doRequest(http.MethodGet, testUris[testMethodWorkingHours], "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.JSONEq(t, `{"TimeZone":"UTC","Start":"09:00","End":"18:00","Weekdays":"MO,TU,WE,TH,FR"}`, body)
+	for _, body := range []string{
+		`{"TimeZone":"Mars/Olympus","Start":"09:00","End":"18:00","Weekdays":"MO"}`,
+		`{"TimeZone":"UTC","Start":"18:00","End":"09:00","Weekdays":"MO"}`,
+		`{"TimeZone":"UTC","Start":"9:00","End":"18:00","Weekdays":"MO"}`,
+		`{"TimeZone":"UTC","Start":"09:00","End":"18:00","Weekdays":"XX"}`,
+	} {
+		res, _ = doRequest(http.MethodPost, testUris[testMethodWorkingHours], body)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode, body)
+	}
+	hours := `{"TimeZone":"Europe/Moscow","Start":"09:00","End":"18:00","Weekdays":"FR,MO,TU,WE,TH"}`
+	res, body = doRequest(http.MethodPost, testUris[testMethodWorkingHours], hours)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.JSONEq(t, `{"TimeZone":"Europe/Moscow","Start":"09:00","End":"18:00","Weekdays":"MO,TU,WE,TH,FR"}`, body)
+
+	// 10 июля 2023 - понедельник. Общее рабочее время - с 09:00 до 15:00 UTC (18:00 по Москве)
+	day := func(h, m int) time.Time {
+		return time.Date(2023, time.July, 10, h, m, 0, 0, time.UTC)
+	}
+	for _, e := range []storage.Event{
+		{Title: fake.Sentence(), StartDate: day(9, 0), EndDate: day(10, 15), UserID: colleagueID},
+		{Title: fake.Sentence(), StartDate: day(11, 0), EndDate: day(12, 0), UserID: organizerID},
+	} {
+		_, err := testStorage.AddEvent(ctx, e)
+		require.NoError(t, err)
+	}
+
+	query := fmt.Sprintf(
+		`{"Users":["%s"],"Duration":"1h","From":"2023-07-08 00:00:00","To":"2023-07-15 00:00:00","Limit":4}`,
+		colleagueID,
+	)
+	res, body = doRequest(http.MethodPost, testUris[testMethodSuggestSlots], query)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.JSONEq(t, `[`+
+		`{"Start":"2023-07-10 12:00:00+00:00","End":"2023-07-10 13:00:00+00:00"},`+
+		`{"Start":"2023-07-10 12:30:00+00:00","End":"2023-07-10 13:30:00+00:00"},`+
+		`{"Start":"2023-07-10 13:00:00+00:00","End":"2023-07-10 14:00:00+00:00"},`+
+		`{"Start":"2023-07-10 13:30:00+00:00","End":"2023-07-10 14:30:00+00:00"}]`, body)
+
+	// Встречу на 7 часов не вместить ни в один день
+	query = fmt.Sprintf(
+		`{"Users":["%s"],"Duration":"7h","From":"2023-07-08 00:00:00","To":"2023-07-15 00:00:00"}`,
+		colleagueID,
+	)
+	res, body = doRequest(http.MethodPost, testUris[testMethodSuggestSlots], query)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "[]", body)
+
+	for _, body := range []string{
+		`{"Users":[],"Duration":"1h","From":"2023-07-10 00:00:00","To":"2023-07-10 00:00:00"}`,
+		`{"Users":[],"Duration":"0s","From":"2023-07-10 00:00:00","To":"2023-07-11 00:00:00"}`,
+		`{"Users":[],"Duration":"1h","From":"2023-07-10 00:00:00","To":"2023-07-11 00:00:00","Limit":-1}`,
+		`{"Users":[],"Duration":"час","From":"2023-07-10 00:00:00","To":"2023-07-11 00:00:00"}`,
+	} {
+		res, _ = doRequest(http.MethodPost, testUris[testMethodSuggestSlots], body)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode, body)
+	}
+}
+
+// В поясе со смещением не на целый час слоты начинаются от начала часа по местному времени.
+func TestSuggestSlotsInTimeZone(t *testing.T) {
+	userID := uuid.New()
+	doRequest := func(uri, body string) (*http.Response, string) {
+		req, _ := http.NewRequestWithContext(contextTimeout(t), http.MethodPost, uri, bytes.NewReader([]byte(body)))
+		req.Header.Add(UserIDHeader, userID.String())
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		resBody, _ := io.ReadAll(res.Body)
+		return res, string(resBody)
+	}
+
+	// Катманду - UTC+05:45, рабочий день начинается в 03:15 UTC
+	hours := `{"TimeZone":"Asia/Kathmandu","Start":"09:00","End":"18:00","Weekdays":"MO"}`
+	res, _ := doRequest(testUris[testMethodWorkingHours], hours)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	query := `{"Users":[],"Duration":"1h","From":"2023-07-10 00:00:00","To":"2023-07-11 00:00:00","Limit":2}`
+	res, body := doRequest(testUris[testMethodSuggestSlots], query)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.JSONEq(t, `[`+
+		`{"Start":"2023-07-10 03:15:00+00:00","End":"2023-07-10 04:15:00+00:00"},`+
+		`{"Start":"2023-07-10 03:45:00+00:00","End":"2023-07-10 04:45:00+00:00"}]`, body)
+}
+
+func TestBatchEvents(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	doRequest := func(body string) (*http.Response, string) {
+		req, _ := http.NewRequestWithContext(
+			contextTimeout(t), http.MethodPost, testUris[testMethodBatch], bytes.NewReader([]byte(body)),
+		)
+		req.Header.Add(UserIDHeader, userID.String())
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		resBody, _ := io.ReadAll(res.Body)
+		return res, string(resBody)
+	}
+	statuses := func(body string) []int64 {
+		res := make([]int64, 0)
+		for _, v := range gjson.Get(body, "Results.#.Status").Array() {
+			res = append(res, v.Int())
+		}
+		return res
+	}
+
+	event, err := testStorage.AddEvent(ctx, storage.Event{
+		Title:     fake.Sentence(),
+		StartDate: time.Date(2023, time.August, 14, 10, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.August, 14, 11, 0, 0, 0, time.UTC),
+		UserID:    userID,
+	})
+	require.NoError(t, err)
+	// последняя операция пересекается с существующим событием
+	ops := func(atomic bool) string {
+		return fmt.Sprintf(`{"Atomic":%t,"Operations":[`+
+			`{"Action":"create","Event":{"Title":"new","StartDate":"%[2]s 12:00:00","EndDate":"%[2]s 13:00:00"}},`+
+			`{"Action":"update","ID":"%[3]s","Event":{"Title":"updated"}},`+
+			`{"Action":"create","Event":{"Title":"busy","StartDate":"%[2]s 10:30:00","EndDate":"%[2]s 11:30:00"}}`+
+			`]}`, atomic, "2023-08-14", event.ID)
+	}
+
+	t.Run("atomic rollback", func(t *testing.T) {
+		res, body := doRequest(ops(true))
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, []int64{http.StatusFailedDependency, http.StatusFailedDependency, http.StatusConflict},
+			statuses(body))
+
+		stored, err := testStorage.GetEvent(ctx, event.ID)
+		require.NoError(t, err)
+		require.Equal(t, event.Title, stored.Title)
+		require.Equal(t, int64(1), stored.Version)
+		events, err := testApp.GetUserEvents(ctx, userID)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+	})
+
+	t.Run("per item", func(t *testing.T) {
+		res, body := doRequest(ops(false))
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, []int64{http.StatusOK, http.StatusOK, http.StatusConflict}, statuses(body))
+		require.Equal(t, "new", gjson.Get(body, "Results.0.Event.Title").String())
+		require.Equal(t, "updated", gjson.Get(body, "Results.1.Event.Title").String())
+		require.Equal(t, int64(2), gjson.Get(body, "Results.1.Event.Version").Int())
+
+		stored, err := testStorage.GetEvent(ctx, event.ID)
+		require.NoError(t, err)
+		require.Equal(t, "updated", stored.Title)
+		require.Equal(t, event.StartDate, stored.StartDate)
+		events, err := testApp.GetUserEvents(ctx, userID)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		body := fmt.Sprintf(`{"Atomic":false,"Operations":[`+
+			`{"Action":"delete","ID":"%[1]s","Version":1},{"Action":"delete","ID":"%[1]s","Version":2},`+
+			`{"Action":"delete","ID":"%[2]s"},{"Action":"move","ID":"%[1]s"}]}`, event.ID, uuid.New())
+		res, body := doRequest(body)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, []int64{
+			http.StatusPreconditionFailed, http.StatusOK, http.StatusNotFound, http.StatusBadRequest,
+		}, statuses(body))
+
+		stored, err := testStorage.GetEvent(ctx, event.ID)
+		require.NoError(t, err)
+		require.False(t, stored.DeletedAt.IsZero())
+	})
+
+	t.Run("invalid batch", func(t *testing.T) {
+		for _, body := range []string{
+			`{"Operations":[]}`,
+			`{"Atomic":"yes","Operations":[{"Action":"delete","ID":"` + event.ID.String() + `"}]}`,
+			`{"Operations":[{"Action":"create","Event":{"StartDate":"tomorrow"}}]}`,
+			`{"Operations":[{"Action":"delete","ID":"42"}]}`,
+		} {
+			res, _ := doRequest(body)
+			require.Equal(t, http.StatusBadRequest, res.StatusCode, body)
+		}
+	})
 }
@@ -0,0 +1,651 @@
+package internalhttp
+
+import (
+	"crypto/sha1" //nolint: gosec
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/app"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/ical"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Поддерживается подмножество CalDAV (RFC 4791): у пользователя одна коллекция с его событиями,
+// ресурс коллекции - событие {eventId}.ics.
+const (
+	CalDAVPrefix     = "/caldav"
+	calDAVCollection = CalDAVPrefix + "/events/"
+	calDAVExt        = ".ics"
+
+	nsDAV       = "DAV:"
+	nsCalDAV    = "urn:ietf:params:xml:ns:caldav"
+	nsCalServer = "http://calendarserver.org/ns/"
+
+	DepthHeader       = "Depth"
+	IfNoneMatchHeader = "If-None-Match"
+	davContentType    = "application/xml; charset=utf-8"
+	davEventType      = "text/calendar; charset=utf-8; component=vevent"
+	statusOK          = "HTTP/1.1 200 OK"
+	statusNotFound    = "HTTP/1.1 404 Not Found"
+)
+
+var davPrefixes = map[string]string{
+	nsDAV:       "D",
+	nsCalDAV:    "C",
+	nsCalServer: "CS",
+}
+
+type davProp struct {
+	XMLName xml.Name
+}
+
+type davPropList struct {
+	Props []davProp `xml:",any"`
+}
+
+type davPropfind struct {
+	XMLName xml.Name     `xml:"DAV: propfind"`
+	AllProp *struct{}    `xml:"DAV: allprop"`
+	Prop    *davPropList `xml:"DAV: prop"`
+}
+
+type davTimeRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+type davCompFilter struct {
+	Name        string          `xml:"name,attr"`
+	TimeRange   *davTimeRange   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	CompFilters []davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+// davReport - calendar-query или calendar-multiget.
+type davReport struct {
+	XMLName xml.Name
+	Prop    *davPropList `xml:"DAV: prop"`
+	Hrefs   []string     `xml:"DAV: href"`
+	Filter  *struct {
+		CompFilter davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+type davInnerXML struct {
+	Inner string `xml:",innerxml"`
+}
+
+type davPropstat struct {
+	Prop   davInnerXML `xml:"D:prop"`
+	Status string      `xml:"D:status"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"D:href"`
+	Status    string        `xml:"D:status,omitempty"`
+	Propstats []davPropstat `xml:"D:propstat"`
+}
+
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"D:multistatus"`
+	NsDAV     string        `xml:"xmlns:D,attr"`
+	NsCalDAV  string        `xml:"xmlns:C,attr"`
+	NsServer  string        `xml:"xmlns:CS,attr"`
+	Responses []davResponse `xml:"D:response"`
+}
+
+// davResource - свойства ресурса: имя свойства -> содержимое элемента.
+type davResource struct {
+	href  string
+	props map[xml.Name]string
+}
+
+func davName(space, local string) xml.Name {
+	return xml.Name{Space: space, Local: local}
+}
+
+func davHref(href string) string {
+	return "<D:href>" + xmlEscape(href) + "</D:href>"
+}
+
+func xmlEscape(s string) string {
+	b := strings.Builder{}
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// davWrapProp оборачивает содержимое свойства в элемент с префиксом пространства имён.
+func davWrapProp(name xml.Name, inner string) string {
+	prefix, ok := davPrefixes[name.Space]
+	if !ok {
+		return fmt.Sprintf(`<X:%s xmlns:X="%s">%s</X:%s>`, name.Local, xmlEscape(name.Space), inner, name.Local)
+	}
+	return fmt.Sprintf("<%s:%s>%s</%s:%s>", prefix, name.Local, inner, prefix, name.Local)
+}
+
+// response отдаёт запрошенные свойства ресурса, неизвестные свойства - с 404. Пустой список - все свойства.
+func (res davResource) response(requested []davProp) davResponse {
+	found, missing := strings.Builder{}, strings.Builder{}
+	if len(requested) == 0 {
+		for name, inner := range res.props {
+			found.WriteString(davWrapProp(name, inner))
+		}
+	}
+	for _, p := range requested {
+		if inner, ok := res.props[p.XMLName]; ok {
+			found.WriteString(davWrapProp(p.XMLName, inner))
+			continue
+		}
+		missing.WriteString(davWrapProp(p.XMLName, ""))
+	}
+
+	resp := davResponse{Href: res.href}
+	if found.Len() > 0 {
+		resp.Propstats = append(resp.Propstats, davPropstat{davInnerXML{found.String()}, statusOK})
+	}
+	if missing.Len() > 0 {
+		resp.Propstats = append(resp.Propstats, davPropstat{davInnerXML{missing.String()}, statusNotFound})
+	}
+	return resp
+}
+
+func (s Server) writeMultistatus(w http.ResponseWriter, responses []davResponse) {
+	body, err := xml.Marshal(davMultistatus{
+		NsDAV:     nsDAV,
+		NsCalDAV:  nsCalDAV,
+		NsServer:  nsCalServer,
+		Responses: responses,
+	})
+	if err != nil {
+		s.logger.Error(err.Error(), zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", davContentType)
+	w.WriteHeader(http.StatusMultiStatus)
+	s.write(w, xml.Header+string(body))
+}
+
+func (s Server) writeDAVError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, app.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, app.ErrAccessDenied):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, app.ErrVersionMismatch):
+		w.WriteHeader(http.StatusPreconditionFailed)
+	case errors.Is(err, app.ErrEventExists):
+		w.WriteHeader(http.StatusConflict)
+	case errors.Is(err, app.ErrInvalidEvent), errors.Is(err, app.ErrDateBusy):
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		s.logger.Error(err.Error(), zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	s.write(w, err.Error())
+}
+
+// davOptions сообщает клиенту о поддержке CalDAV.
+func (s Server) davOptions(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("DAV", "1, calendar-access")
+	w.Header().Set("Allow", "OPTIONS, GET, PUT, DELETE, PROPFIND, REPORT")
+	w.WriteHeader(http.StatusOK)
+}
+
+// readPropfind возвращает запрошенные свойства, nil - все свойства (allprop или пустое тело).
+func (s Server) readPropfind(w http.ResponseWriter, r *http.Request) ([]davProp, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+	if strings.TrimSpace(string(body)) == "" {
+		return nil, true
+	}
+
+	var req davPropfind
+	if err = xml.Unmarshal(body, &req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.write(w, err.Error())
+		return nil, false
+	}
+	if req.Prop == nil {
+		return nil, true
+	}
+	return req.Prop.Props, true
+}
+
+func davDepth(r *http.Request) int {
+	if r.Header.Get(DepthHeader) == "0" {
+		return 0
+	}
+	return 1
+}
+
+func davRootResource() davResource {
+	return davResource{
+		href: CalDAVPrefix + "/",
+		props: map[xml.Name]string{
+			davName(nsDAV, "resourcetype"):           "<D:collection/>",
+			davName(nsDAV, "displayname"):            "Calendar",
+			davName(nsDAV, "current-user-principal"): davHref(CalDAVPrefix + "/"),
+			davName(nsDAV, "principal-URL"):          davHref(CalDAVPrefix + "/"),
+			davName(nsCalDAV, "calendar-home-set"):   davHref(CalDAVPrefix + "/"),
+		},
+	}
+}
+
+func davCollectionResource(events []storage.Event) davResource {
+	return davResource{
+		href: calDAVCollection,
+		props: map[xml.Name]string{
+			davName(nsDAV, "resourcetype"):                        "<D:collection/><C:calendar/>",
+			davName(nsDAV, "displayname"):                         "Events",
+			davName(nsDAV, "current-user-principal"):              davHref(CalDAVPrefix + "/"),
+			davName(nsCalServer, "getctag"):                       xmlEscape(davCTag(events)),
+			davName(nsCalDAV, "supported-calendar-component-set"): `<C:comp name="VEVENT"/>`,
+		},
+	}
+}
+
+func davEventResource(event storage.Event) davResource {
+	return davResource{
+		href: calDAVCollection + event.ID.String() + calDAVExt,
+		props: map[xml.Name]string{
+			davName(nsDAV, "resourcetype"):     "",
+			davName(nsDAV, "getetag"):          xmlEscape(davETag(event)),
+			davName(nsDAV, "getcontenttype"):   davEventType,
+			davName(nsCalDAV, "calendar-data"): xmlEscape(ical.MarshallEvents([]storage.Event{event}, time.Now())),
+		},
+	}
+}
+
+func davETag(event storage.Event) string {
+	return strconv.Quote(strconv.FormatInt(event.Version, 10))
+}
+
+// davCTag меняется при любом изменении коллекции: добавлении, изменении или удалении события.
+func davCTag(events []storage.Event) string {
+	h := sha1.New() //nolint: gosec
+	for _, e := range events {
+		fmt.Fprintf(h, "%s:%d;", e.ID, e.Version)
+	}
+	return strconv.Quote(hex.EncodeToString(h.Sum(nil)))
+}
+
+func (s Server) davRootPropfind(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	requested, ok := s.readPropfind(w, r)
+	if !ok {
+		return
+	}
+
+	responses := []davResponse{davRootResource().response(requested)}
+	if davDepth(r) > 0 {
+		events, err := s.app.GetUserEvents(r.Context(), uid)
+		if err != nil {
+			s.writeDAVError(w, err)
+			return
+		}
+		responses = append(responses, davCollectionResource(events).response(requested))
+	}
+
+	s.writeMultistatus(w, responses)
+}
+
+func (s Server) davCollectionPropfind(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	requested, ok := s.readPropfind(w, r)
+	if !ok {
+		return
+	}
+
+	events, err := s.app.GetUserEvents(r.Context(), uid)
+	if err != nil {
+		s.writeDAVError(w, err)
+		return
+	}
+
+	responses := []davResponse{davCollectionResource(events).response(requested)}
+	if davDepth(r) > 0 {
+		for _, e := range events {
+			responses = append(responses, davEventResource(e).response(requested))
+		}
+	}
+
+	s.writeMultistatus(w, responses)
+}
+
+// davReport выполняет calendar-query (с фильтром по времени) и calendar-multiget.
+func (s Server) davReport(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var req davReport
+	if err = xml.Unmarshal(body, &req); err != nil || req.XMLName.Space != nsCalDAV {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var requested []davProp
+	if req.Prop != nil {
+		requested = req.Prop.Props
+	}
+
+	switch req.XMLName.Local {
+	case "calendar-query":
+		s.davCalendarQuery(w, r, uid, req, requested)
+	case "calendar-multiget":
+		s.davMultiget(w, r, uid, req.Hrefs, requested)
+	default:
+		w.WriteHeader(http.StatusForbidden)
+		s.write(w, "unsupported report "+req.XMLName.Local)
+	}
+}
+
+func (s Server) davCalendarQuery(
+	w http.ResponseWriter,
+	r *http.Request,
+	uid uuid.UUID,
+	req davReport,
+	requested []davProp,
+) {
+	var start, end time.Time
+	if req.Filter != nil {
+		// фильтр вида VCALENDAR > VEVENT > time-range
+		for _, f := range req.Filter.CompFilter.CompFilters {
+			if f.Name != "VEVENT" || f.TimeRange == nil {
+				continue
+			}
+			var err error
+			if start, err = parseDAVTime(f.TimeRange.Start); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if end, err = parseDAVTime(f.TimeRange.End); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	events, err := s.app.GetUserEvents(r.Context(), uid)
+	if err != nil {
+		s.writeDAVError(w, err)
+		return
+	}
+
+	responses := make([]davResponse, 0, len(events))
+	for _, e := range events {
+		match, err := overlaps(e, start, end)
+		if err != nil {
+			s.writeDAVError(w, err)
+			return
+		}
+		if match {
+			responses = append(responses, davEventResource(e).response(requested))
+		}
+	}
+
+	s.writeMultistatus(w, responses)
+}
+
+func (s Server) davMultiget(
+	w http.ResponseWriter,
+	r *http.Request,
+	uid uuid.UUID,
+	hrefs []string,
+	requested []davProp,
+) {
+	responses := make([]davResponse, 0, len(hrefs))
+	for _, href := range hrefs {
+		href = strings.TrimSpace(href)
+		id, ok := davEventID(href)
+		if !ok {
+			responses = append(responses, davResponse{Href: href, Status: statusNotFound})
+			continue
+		}
+		event, err := s.app.GetEvent(r.Context(), id, uid)
+		if err != nil {
+			if !errors.Is(err, app.ErrNotFound) && !errors.Is(err, app.ErrAccessDenied) {
+				s.writeDAVError(w, err)
+				return
+			}
+			responses = append(responses, davResponse{Href: href, Status: statusNotFound})
+			continue
+		}
+		// в коллекции только свои события пользователя
+		if event.UserID != uid {
+			responses = append(responses, davResponse{Href: href, Status: statusNotFound})
+			continue
+		}
+		responses = append(responses, davEventResource(event).response(requested))
+	}
+
+	s.writeMultistatus(w, responses)
+}
+
+// davEventID достаёт ID события из пути ресурса .../{eventId}.ics.
+func davEventID(href string) (uuid.UUID, bool) {
+	name, ok := strings.CutSuffix(href[strings.LastIndex(href, "/")+1:], calDAVExt)
+	if !ok {
+		return uuid.UUID{}, false
+	}
+	id, err := uuid.Parse(name)
+	return id, err == nil
+}
+
+func parseDAVTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("20060102T150405Z", s)
+}
+
+// overlaps сообщает, пересекается ли событие (любой его экземпляр) с интервалом [start, end).
+// Нулевые границы не ограничивают интервал.
+func overlaps(event storage.Event, start, end time.Time) (bool, error) {
+	if start.IsZero() && end.IsZero() {
+		return true, nil
+	}
+	duration := event.EndDate.Sub(event.StartDate)
+	from := event.StartDate
+	if !start.IsZero() {
+		from = start.Add(-1 * duration)
+	}
+	to := end
+	if end.IsZero() {
+		to = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+	}
+
+	occurrences, err := event.Occurrences(from, to)
+	if err != nil {
+		return false, err
+	}
+	for _, o := range occurrences {
+		if (end.IsZero() || o.StartDate.Before(end)) && (start.IsZero() || o.EndDate.After(start)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s Server) getDAVEventID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["resource"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return uuid.UUID{}, false
+	}
+	return id, true
+}
+
+// getDAVEvent возвращает событие пользователя, ресурсы коллекции - только свои события.
+func (s Server) getDAVEvent(w http.ResponseWriter, r *http.Request, uid uuid.UUID) (storage.Event, bool) {
+	id, ok := s.getDAVEventID(w, r)
+	if !ok {
+		return storage.Event{}, false
+	}
+	event, err := s.app.GetEvent(r.Context(), id, uid)
+	if err == nil && event.UserID != uid {
+		err = app.ErrNotFound
+	}
+	if err != nil {
+		s.writeDAVError(w, err)
+		return storage.Event{}, false
+	}
+	return event, true
+}
+
+func (s Server) davEventPropfind(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	requested, ok := s.readPropfind(w, r)
+	if !ok {
+		return
+	}
+	event, ok := s.getDAVEvent(w, r, uid)
+	if !ok {
+		return
+	}
+
+	s.writeMultistatus(w, []davResponse{davEventResource(event).response(requested)})
+}
+
+func (s Server) davGetEvent(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	event, ok := s.getDAVEvent(w, r, uid)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", davEventType)
+	w.Header().Set(ETagHeader, davETag(event))
+	w.WriteHeader(http.StatusOK)
+	s.write(w, ical.MarshallEvents([]storage.Event{event}, time.Now()))
+}
+
+// davPutEvent создаёт или изменяет событие. Новое событие получает ID из имени ресурса, если это UUID,
+// иначе сервер назначает ID сам и возвращает адрес ресурса в Location. Пересечения событий не проверяются:
+// CalDAV-клиенты не умеют показывать такую ошибку.
+func (s Server) davPutEvent(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	version, ok := s.getIfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	components, err := ical.UnmarshallEvents(string(body), time.UTC)
+	if err == nil && len(components) != 1 {
+		err = fmt.Errorf("%w: exactly one VEVENT expected", ical.ErrInvalidCalendar)
+	}
+	if err == nil {
+		err = components[0].Err
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.write(w, err.Error())
+		return
+	}
+	target := components[0].Event
+
+	id, idErr := uuid.Parse(mux.Vars(r)["resource"])
+	if idErr == nil {
+		_, err := s.app.GetEvent(r.Context(), id, uid)
+		switch {
+		case err == nil:
+			if r.Header.Get(IfNoneMatchHeader) == "*" {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			target.Version = version
+			res, err := s.app.UpdateEvent(r.Context(), id, uid, target, true)
+			if err != nil {
+				s.writeDAVError(w, err)
+				return
+			}
+			w.Header().Set(ETagHeader, davETag(res))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case !errors.Is(err, app.ErrNotFound):
+			s.writeDAVError(w, err)
+			return
+		}
+	}
+	if version != 0 {
+		// If-Match для несуществующего ресурса
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+
+	var res storage.Event
+	if idErr == nil {
+		res, err = s.app.CreateEventWithID(r.Context(), id, uid, target, true)
+	} else {
+		res, err = s.app.CreateEvent(r.Context(), uid, target, true)
+	}
+	if err != nil {
+		s.writeDAVError(w, err)
+		return
+	}
+	if idErr != nil {
+		w.Header().Set("Location", calDAVCollection+res.ID.String()+calDAVExt)
+	}
+	w.Header().Set(ETagHeader, davETag(res))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s Server) davDeleteEvent(w http.ResponseWriter, r *http.Request) {
+	uid, ok := s.getUserIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	version, ok := s.getIfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	event, ok := s.getDAVEvent(w, r, uid)
+	if !ok {
+		return
+	}
+
+	if err := s.app.DeleteEvent(r.Context(), event.ID, uid, version); err != nil {
+		s.writeDAVError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
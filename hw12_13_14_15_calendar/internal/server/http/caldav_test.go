@@ -0,0 +1,151 @@
+package internalhttp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const davEventSource = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\nUID:%s\r\n" +
+	"DTSTART:20230601T100000Z\r\nDTEND:20230601T110000Z\r\nSUMMARY:%s\r\n" +
+	"BEGIN:VALARM\r\nTRIGGER:-PT15M\r\nEND:VALARM\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+func TestCalDAV(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	otherID := uuid.New()
+	doRequest := func(userID uuid.UUID, method, uri, body string, headers map[string]string) (*http.Response, string) {
+		req, _ := http.NewRequestWithContext(contextTimeout(t), method, testURI+uri, bytes.NewReader([]byte(body)))
+		if userID != (uuid.UUID{}) {
+			req.SetBasicAuth(userID.String(), "")
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res, err := testClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		resBody, _ := io.ReadAll(res.Body)
+		return res, string(resBody)
+	}
+	getCTag := func() string {
+		body := `<?xml version="1.0"?><D:propfind xmlns:D="DAV:" xmlns:CS="http://calendarserver.org/ns/">` +
+			`<D:prop><CS:getctag/></D:prop></D:propfind>`
+		res, resBody := doRequest(userID, "PROPFIND", calDAVCollection, body, map[string]string{DepthHeader: "0"})
+		require.Equal(t, http.StatusMultiStatus, res.StatusCode)
+		start := strings.Index(resBody, "<CS:getctag>")
+		end := strings.Index(resBody, "</CS:getctag>")
+		require.True(t, start >= 0 && end > start, resBody)
+		return resBody[start:end]
+	}
+
+	res, _ := doRequest(userID, http.MethodOptions, calDAVCollection, "", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Contains(t, res.Header.Get("DAV"), "calendar-access")
+	res, _ = doRequest(uuid.UUID{}, "PROPFIND", CalDAVPrefix+"/", "", nil)
+	require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	require.NotEmpty(t, res.Header.Get("WWW-Authenticate"))
+
+	res, body := doRequest(userID, "PROPFIND", CalDAVPrefix+"/", "", nil)
+	require.Equal(t, http.StatusMultiStatus, res.StatusCode)
+	require.Contains(t, body, "<D:href>"+calDAVCollection+"</D:href>")
+	require.Contains(t, body, "<C:calendar-home-set><D:href>/caldav/</D:href></C:calendar-home-set>")
+
+	// Новое событие получает ID из имени ресурса
+	emptyCTag := getCTag()
+	eventID := uuid.New()
+	eventURI := calDAVCollection + eventID.String() + calDAVExt
+	res, _ = doRequest(userID, http.MethodPut, eventURI, fmt.Sprintf(davEventSource, "client-uid", "Встреча"), nil)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	require.Equal(t, `"1"`, res.Header.Get(ETagHeader))
+	stored, err := testStorage.GetEvent(ctx, eventID)
+	require.NoError(t, err)
+	require.Equal(t, "Встреча", stored.Title)
+	require.Equal(t, userID, stored.UserID)
+	require.NotEqual(t, emptyCTag, getCTag())
+
+	res, _ = doRequest(
+		userID, http.MethodPut, eventURI, fmt.Sprintf(davEventSource, "client-uid", "Встреча"),
+		map[string]string{IfNoneMatchHeader: "*"},
+	)
+	require.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+
+	propfind := `<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:prop><D:getetag/><D:unknown/></D:prop></D:propfind>`
+	res, body = doRequest(userID, "PROPFIND", calDAVCollection, propfind, map[string]string{DepthHeader: "1"})
+	require.Equal(t, http.StatusMultiStatus, res.StatusCode)
+	require.Contains(t, body, "<D:href>"+eventURI+"</D:href>")
+	require.Contains(t, body, "<D:getetag>&#34;1&#34;</D:getetag>")
+	require.Contains(t, body, "<D:unknown></D:unknown></D:prop><D:status>HTTP/1.1 404 Not Found</D:status>")
+
+	// Изменение с проверкой версии
+	ctag := getCTag()
+	res, _ = doRequest(
+		userID, http.MethodPut, eventURI, fmt.Sprintf(davEventSource, "client-uid", "Перенесённая встреча"),
+		map[string]string{IfMatchHeader: `"1"`},
+	)
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	require.Equal(t, `"2"`, res.Header.Get(ETagHeader))
+	require.NotEqual(t, ctag, getCTag())
+	res, _ = doRequest(
+		userID, http.MethodPut, eventURI, fmt.Sprintf(davEventSource, "client-uid", "Устаревшая версия"),
+		map[string]string{IfMatchHeader: `"1"`},
+	)
+	require.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+
+	query := func(start, end string) string {
+		return `<?xml version="1.0"?><C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">` +
+			`<D:prop><D:getetag/><C:calendar-data/></D:prop><C:filter><C:comp-filter name="VCALENDAR">` +
+			`<C:comp-filter name="VEVENT"><C:time-range start="` + start + `" end="` + end + `"/>` +
+			`</C:comp-filter></C:comp-filter></C:filter></C:calendar-query>`
+	}
+	res, body = doRequest(userID, "REPORT", calDAVCollection, query("20230601T103000Z", "20230602T000000Z"), nil)
+	require.Equal(t, http.StatusMultiStatus, res.StatusCode)
+	require.Equal(t, 1, strings.Count(body, "<D:response>"))
+	require.Contains(t, body, "SUMMARY:Перенесённая встреча")
+	res, body = doRequest(userID, "REPORT", calDAVCollection, query("20230601T110000Z", "20230602T000000Z"), nil)
+	require.Equal(t, http.StatusMultiStatus, res.StatusCode)
+	require.Equal(t, 0, strings.Count(body, "<D:response>"))
+
+	missingURI := calDAVCollection + uuid.New().String() + calDAVExt
+	multiget := `<?xml version="1.0"?><C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">` +
+		`<D:prop><D:getetag/></D:prop><D:href>` + eventURI + `</D:href><D:href>` + missingURI + `</D:href>` +
+		`</C:calendar-multiget>`
+	res, body = doRequest(userID, "REPORT", calDAVCollection, multiget, nil)
+	require.Equal(t, http.StatusMultiStatus, res.StatusCode)
+	require.Contains(t, body, "<D:getetag>&#34;2&#34;</D:getetag>")
+	require.Contains(t, body, "<D:href>"+missingURI+"</D:href><D:status>HTTP/1.1 404 Not Found</D:status>")
+
+	res, body = doRequest(userID, http.MethodGet, eventURI, "", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, `"2"`, res.Header.Get(ETagHeader))
+	require.Contains(t, body, "UID:"+eventID.String()+"\r\n")
+	require.Contains(t, body, "TRIGGER:-PT15M\r\n")
+	res, _ = doRequest(otherID, http.MethodGet, eventURI, "", nil)
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	// Имя ресурса не UUID - сервер назначает ID сам
+	res, _ = doRequest(
+		userID, http.MethodPut, calDAVCollection+"client-name"+calDAVExt,
+		fmt.Sprintf(davEventSource, "client-name", "Без UUID"), nil,
+	)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	location := res.Header.Get("Location")
+	require.True(t, strings.HasPrefix(location, calDAVCollection))
+	res, _ = doRequest(userID, http.MethodGet, location, "", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	res, _ = doRequest(userID, http.MethodPut, eventURI, "not a calendar", nil)
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, _ = doRequest(userID, http.MethodDelete, eventURI, "", map[string]string{IfMatchHeader: `"2"`})
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	res, _ = doRequest(userID, http.MethodGet, eventURI, "", nil)
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+}
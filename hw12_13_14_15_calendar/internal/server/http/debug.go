@@ -0,0 +1,58 @@
+package internalhttp
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DebugServer - служебный HTTP-сервер со счётчиками сервиса в формате expvar (/debug/vars).
+// Авторизации у него нет, поэтому он слушает отдельный адрес, доступный только локально.
+type DebugServer struct {
+	host   string
+	port   int
+	logger zap.Logger
+	server *http.Server
+}
+
+func NewDebugServer(host string, port int, logger zap.Logger) *DebugServer {
+	return &DebugServer{
+		host:   host,
+		port:   port,
+		logger: logger,
+	}
+}
+
+func (s *DebugServer) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	timeout := 10 * time.Second
+	server := &http.Server{
+		Addr:         net.JoinHostPort(s.host, fmt.Sprint(s.port)),
+		Handler:      mux,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+		BaseContext: func(listener net.Listener) context.Context {
+			return ctx
+		},
+	}
+	s.server = server
+
+	s.logger.Debug(fmt.Sprintf("starting debug http server on %s", server.Addr))
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+func (s *DebugServer) Stop(ctx context.Context) error {
+	s.logger.Debug("debug HTTP shutdown")
+	return s.server.Shutdown(ctx)
+}
@@ -13,8 +13,10 @@ import (
 type ContextKey string
 
 const (
-	UserIDKey    ContextKey = "currentUserId"
-	UserIDHeader string     = "X-API-User"
+	UserIDKey      ContextKey = "currentUserId"
+	TimeZoneKey    ContextKey = "timeZone"
+	UserIDHeader   string     = "X-API-User"
+	TimeZoneHeader string     = "X-Time-Zone"
 )
 
 func (s Server) loggingMiddleware(next http.Handler) http.Handler {
@@ -65,3 +67,46 @@ func (s Server) userMiddleware(next http.Handler) http.Handler {
 		},
 	)
 }
+
+// timeZoneMiddleware читает часовой пояс клиента (имя из базы IANA, например Europe/Moscow), по умолчанию UTC.
+func (s Server) timeZoneMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			loc := time.UTC
+			if name := r.Header.Get(TimeZoneHeader); name != "" {
+				var err error
+				loc, err = time.LoadLocation(name)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					s.writeError(w, "unknown time zone")
+					return
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), TimeZoneKey, loc)
+			r = r.WithContext(ctx)
+
+			next.ServeHTTP(w, r)
+		},
+	)
+}
+
+// davAuthMiddleware передаёт пользователя из Basic-авторизации (логин - ID пользователя) в userMiddleware:
+// CalDAV-клиенты не умеют отправлать произвольные заголовки.
+func (s Server) davAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(UserIDHeader) == "" {
+				username, _, ok := r.BasicAuth()
+				if !ok {
+					w.Header().Set("WWW-Authenticate", `Basic realm="calendar"`)
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				r.Header.Set(UserIDHeader, username)
+			}
+
+			next.ServeHTTP(w, r)
+		},
+	)
+}
@@ -60,16 +60,48 @@ func (s *Server) router() *mux.Router {
 	// Оставлю как открытую часть API
 	rtr.HandleFunc("/hello", s.hello)
 
+	// CalDAV: клиенты ищут сервер по /.well-known/caldav, пользователь передаётся через Basic-авторизацию
+	rtr.Handle("/.well-known/caldav", http.RedirectHandler(CalDAVPrefix+"/", http.StatusMovedPermanently))
+	dav := rtr.PathPrefix(CalDAVPrefix).Subrouter()
+	dav.Use(s.davAuthMiddleware)
+	dav.Use(s.userMiddleware)
+	dav.HandleFunc("/", s.davRootPropfind).Methods("PROPFIND")
+	dav.HandleFunc("/events/", s.davCollectionPropfind).Methods("PROPFIND")
+	dav.HandleFunc("/events/", s.davReport).Methods("REPORT")
+	dav.HandleFunc("/events/{resource}"+calDAVExt, s.davEventPropfind).Methods("PROPFIND")
+	dav.HandleFunc("/events/{resource}"+calDAVExt, s.davGetEvent).Methods("GET")
+	dav.HandleFunc("/events/{resource}"+calDAVExt, s.davPutEvent).Methods("PUT")
+	dav.HandleFunc("/events/{resource}"+calDAVExt, s.davDeleteEvent).Methods("DELETE")
+	dav.PathPrefix("/").HandlerFunc(s.davOptions).Methods("OPTIONS")
+
 	// Делаем саброутер для закрытой части апи (требующей передачи id юзера в заголовке)
 	restricted := rtr.NewRoute().Subrouter()
 	restricted.Use(s.userMiddleware)
+	restricted.Use(s.timeZoneMiddleware)
 	restricted.HandleFunc("/event/{eventId}", s.getEvent).Methods("GET")
 	restricted.HandleFunc("/event/{eventId}", s.updateEvent).Methods("POST")
 	restricted.HandleFunc("/event/{eventId}", s.deleteEvent).Methods("DELETE")
+	restricted.HandleFunc("/event/{eventId}/restore", s.restoreEvent).Methods("POST")
+	restricted.HandleFunc("/event/{eventId}/history", s.getEventHistory).Methods("GET")
+	restricted.HandleFunc("/event/{eventId}/rsvp", s.respondToInvitation).Methods("POST")
 	restricted.HandleFunc("/event", s.createEvent).Methods("POST")
+	restricted.HandleFunc("/events/trash", s.getTrash).Methods("GET")
+	restricted.HandleFunc("/events/search", s.searchEvents).Methods("GET")
 	restricted.HandleFunc("/events/day/{date}", s.getForDay).Methods("GET")
 	restricted.HandleFunc("/events/week/{date}", s.getForWeek).Methods("GET")
 	restricted.HandleFunc("/events/month/{date}", s.getForMonth).Methods("GET")
+	restricted.HandleFunc("/events/export.ics", s.exportEvents).Methods("GET")
+	restricted.HandleFunc("/events/import", s.importEvents).Methods("POST")
+	restricted.HandleFunc("/events/batch", s.batchEvents).Methods("POST")
+	restricted.HandleFunc("/freebusy", s.getFreeBusy).Methods("POST")
+	restricted.HandleFunc("/slots/suggest", s.suggestSlots).Methods("POST")
+	restricted.HandleFunc("/working-hours", s.getWorkingHours).Methods("GET")
+	restricted.HandleFunc("/working-hours", s.setWorkingHours).Methods("POST")
+	restricted.HandleFunc("/calendar", s.createCalendar).Methods("POST")
+	restricted.HandleFunc("/calendars", s.getCalendars).Methods("GET")
+	restricted.HandleFunc("/calendar/{calendarId}", s.getCalendar).Methods("GET")
+	restricted.HandleFunc("/calendar/{calendarId}", s.updateCalendar).Methods("POST")
+	restricted.HandleFunc("/calendar/{calendarId}", s.deleteCalendar).Methods("DELETE")
 
 	return rtr
 }
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var ErrAttendeeNotFound = errors.New("attendee not found")
+
+// RSVPStatus - ответ участника на приглашение.
+type RSVPStatus string
+
+const (
+	RSVPNeedsAction RSVPStatus = "needs-action"
+	RSVPAccepted    RSVPStatus = "accepted"
+	RSVPDeclined    RSVPStatus = "declined"
+	RSVPTentative   RSVPStatus = "tentative"
+)
+
+func (s RSVPStatus) IsValid() bool {
+	switch s {
+	case RSVPNeedsAction, RSVPAccepted, RSVPDeclined, RSVPTentative:
+		return true
+	}
+	return false
+}
+
+// Attendee - приглашённый на событие пользователь. Владелец события в список участников не входит.
+type Attendee struct {
+	UserID uuid.UUID  `db:"user_id"`
+	Status RSVPStatus `db:"status"`
+}
+
+type Attendees []Attendee
+
+func (a Attendees) Find(userID uuid.UUID) (Attendee, bool) {
+	for _, v := range a {
+		if v.UserID == userID {
+			return v, true
+		}
+	}
+	return Attendee{}, false
+}
+
+func (a Attendees) Contains(userID uuid.UUID) bool {
+	_, ok := a.Find(userID)
+	return ok
+}
+
+func (a Attendees) String() string {
+	strs := make([]string, len(a))
+	for i, v := range a {
+		strs[i] = v.UserID.String() + ":" + string(v.Status)
+	}
+	return strings.Join(strs, ",")
+}
+
+// Recipients возвращает пользователей, которых нужно уведомить о событии: владельца и принявших приглашение.
+func (e Event) Recipients() []uuid.UUID {
+	res := []uuid.UUID{e.UserID}
+	for _, v := range e.Attendees {
+		if v.Status == RSVPAccepted {
+			res = append(res, v.UserID)
+		}
+	}
+	return res
+}
@@ -0,0 +1,17 @@
+package cachestorage
+
+import (
+	"testing"
+	"time"
+
+	memorystorage "github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage/storagetest"
+)
+
+// С кэшем хранилище должно вести себя так же, как без него.
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		t.Helper()
+		return New(memorystorage.New(), 100, time.Minute)
+	})
+}
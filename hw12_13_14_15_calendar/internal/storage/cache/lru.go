@@ -0,0 +1,166 @@
+package cachestorage
+
+import (
+	"container/list"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+// Stats - счётчики кэша с момента создания.
+type Stats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	// Сколько событий сейчас лежит в кэше (отдельно и в результатах выборок).
+	Events int
+}
+
+// lru - кэш событий и результатов выборок, ограниченный общим числом событий в нём. Каждая запись зависит от
+// набора ID (события, пользователей, календарей), при изменении события сбрасываются записи, зависящие от его ID,
+// владельца, участников и календаря.
+type lru struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+	used    int
+	order   *list.List // *entry, в начале - недавно использованные
+	entries map[string]*list.Element
+	deps    map[uuid.UUID]map[string]struct{}
+	// увеличивается при каждом сбросе: результат, прочитанный из хранилища до сброса, в кэш не попадает
+	gen   uint64
+	stats Stats
+}
+
+type entry struct {
+	key      string
+	events   []storage.Event
+	deps     []uuid.UUID
+	storedAt time.Time
+}
+
+func newLRU(size int, ttl time.Duration) *lru {
+	return &lru{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		deps:    make(map[uuid.UUID]map[string]struct{}),
+	}
+}
+
+func cost(events []storage.Event) int {
+	return max(len(events), 1)
+}
+
+// clone копирует события вместе со слайсами внутри, чтобы изменения у вызывающего не попали в кэш.
+func clone(events []storage.Event) []storage.Event {
+	res := slices.Clone(events)
+	for i := range res {
+		res[i].Attendees = slices.Clone(res[i].Attendees)
+		res[i].ExDates = slices.Clone(res[i].ExDates)
+		res[i].Tags = slices.Clone(res[i].Tags)
+		res[i].Reminders = slices.Clone(res[i].Reminders)
+	}
+	return res
+}
+
+func (c *lru) get(key string) ([]storage.Event, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if ok && c.ttl > 0 && c.now().Sub(el.Value.(*entry).storedAt) > c.ttl {
+		c.remove(el)
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(el)
+	return clone(el.Value.(*entry).events), true
+}
+
+// generation возвращается перед чтением из хранилища и передаётся в put.
+func (c *lru) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// put сохраняет результат, если с момента gen ничего не сбрасывалось.
+func (c *lru) put(key string, events []storage.Event, deps []uuid.UUID, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen || cost(events) > c.size {
+		return
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	e := &entry{key: key, events: clone(events), deps: deps, storedAt: c.now()}
+	c.entries[key] = c.order.PushFront(e)
+	c.used += cost(events)
+	for _, id := range deps {
+		keys, ok := c.deps[id]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.deps[id] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	for c.used > c.size {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// invalidate сбрасывает записи, зависящие от ids.
+func (c *lru) invalidate(ids map[uuid.UUID]struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for id := range ids {
+		for key := range c.deps[id] {
+			c.remove(c.entries[key])
+		}
+	}
+}
+
+func (c *lru) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.deps = make(map[uuid.UUID]map[string]struct{})
+	c.used = 0
+}
+
+func (c *lru) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	c.order.Remove(el)
+	delete(c.entries, e.key)
+	c.used -= cost(e.events)
+	for _, id := range e.deps {
+		keys := c.deps[id]
+		delete(keys, e.key)
+		if len(keys) == 0 {
+			delete(c.deps, id)
+		}
+	}
+}
+
+func (c *lru) getStats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := c.stats
+	res.Events = c.used
+	return res
+}
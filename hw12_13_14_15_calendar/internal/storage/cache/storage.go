@@ -0,0 +1,433 @@
+package cachestorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/app"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+// Storage кэширует события и выборки событий пользователя поверх другого хранилища. Запись сначала выполняется
+// в хранилище, затем сбрасываются записи кэша, которые она могла изменить. Изменения в обход кэша (например,
+// планировщиком в другом процессе) становятся видны не позже чем через ttl.
+type Storage struct {
+	backend app.Storage
+	cache   *lru
+	// изменения транзакции, по которым надо сбросить кэш после её завершения; nil вне WithTx
+	changes *changes
+}
+
+type changes struct {
+	ids map[uuid.UUID]struct{}
+	// сбросить весь кэш
+	all bool
+}
+
+var ErrNoScheduler = errors.New("storage does not support scheduler methods")
+
+// schedulerStorage - методы хранилища, которыми пользуется планировщик (scheduler.Storage).
+type schedulerStorage interface {
+	SetRemindersNotified(ctx context.Context, keys []storage.ReminderKey, notified time.Time) error
+	NotificationNeededEvents(ctx context.Context, t time.Time) ([]storage.Notification, error)
+	DeleteEvents(ctx context.Context, filter []storage.EventCondition) (int64, error)
+}
+
+// New оборачивает backend кэшем не больше чем на size событий. Нулевой ttl - записи не устаревают.
+func New(backend app.Storage, size int, ttl time.Duration) *Storage {
+	return &Storage{backend: backend, cache: newLRU(size, ttl)}
+}
+
+func (s *Storage) Stats() Stats {
+	return s.cache.getStats()
+}
+
+// WithTx выполняет fn в транзакции хранилища. Внутри транзакции кэш не используется: в ней видны
+// неподтверждённые изменения. Записи кэша сбрасываются после завершения транзакции.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx app.Storage) error) error {
+	if s.changes != nil {
+		return fn(s)
+	}
+	c := &changes{ids: make(map[uuid.UUID]struct{})}
+	err := s.backend.WithTx(ctx, func(tx app.Storage) error {
+		return fn(&Storage{backend: tx, cache: s.cache, changes: c})
+	})
+	if c.all {
+		s.cache.clear()
+	} else {
+		s.cache.invalidate(c.ids)
+	}
+	return err
+}
+
+func (s *Storage) LockUser(ctx context.Context, userID uuid.UUID) error {
+	return s.backend.LockUser(ctx, userID)
+}
+
+// touched добавляет ID, от которых могут зависеть записи кэша с событием.
+func touched(ids map[uuid.UUID]struct{}, event storage.Event) {
+	ids[event.ID] = struct{}{}
+	ids[event.UserID] = struct{}{}
+	ids[event.CalendarID] = struct{}{}
+	for _, a := range event.Attendees {
+		ids[a.UserID] = struct{}{}
+	}
+}
+
+func (s *Storage) invalidate(ids map[uuid.UUID]struct{}) {
+	if s.changes != nil {
+		for id := range ids {
+			s.changes.ids[id] = struct{}{}
+		}
+		return
+	}
+	s.cache.invalidate(ids)
+}
+
+// write выполняет изменение события id и сбрасывает записи кэша, зависящие от события до изменения
+// и от updated, если оно задано.
+func (s *Storage) write(ctx context.Context, id uuid.UUID, updated *storage.Event, fn func() error) error {
+	old, err := s.GetEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+	ids := make(map[uuid.UUID]struct{})
+	touched(ids, old)
+	if updated != nil {
+		touched(ids, *updated)
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	s.invalidate(ids)
+	return nil
+}
+
+// AddEvent кэширует добавленное событие: обычно его сразу же читают.
+func (s *Storage) AddEvent(ctx context.Context, event storage.Event) (storage.Event, error) {
+	res, err := s.backend.AddEvent(ctx, event)
+	if err != nil {
+		return res, err
+	}
+	ids := make(map[uuid.UUID]struct{})
+	touched(ids, res)
+	s.invalidate(ids)
+	if s.changes == nil {
+		deps := withTagOwners([]uuid.UUID{res.ID}, res)
+		s.cache.put(eventKey(res.ID), []storage.Event{res}, deps, s.cache.generation())
+	}
+	return res, nil
+}
+
+func (s *Storage) UpdateEvent(ctx context.Context, event storage.Event) error {
+	return s.write(ctx, event.ID, &event, func() error {
+		return s.backend.UpdateEvent(ctx, event)
+	})
+}
+
+func (s *Storage) TrashEvent(ctx context.Context, id uuid.UUID, version int64, deletedAt time.Time) error {
+	return s.write(ctx, id, nil, func() error {
+		return s.backend.TrashEvent(ctx, id, version, deletedAt)
+	})
+}
+
+func (s *Storage) RestoreEvent(ctx context.Context, id uuid.UUID, version int64) error {
+	return s.write(ctx, id, nil, func() error {
+		return s.backend.RestoreEvent(ctx, id, version)
+	})
+}
+
+func (s *Storage) SetAttendeeStatus(
+	ctx context.Context,
+	eventID uuid.UUID,
+	userID uuid.UUID,
+	status storage.RSVPStatus,
+) error {
+	return s.write(ctx, eventID, nil, func() error {
+		return s.backend.SetAttendeeStatus(ctx, eventID, userID, status)
+	})
+}
+
+func (s *Storage) scheduler() (schedulerStorage, error) {
+	sch, ok := s.backend.(schedulerStorage)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrNoScheduler, s.backend)
+	}
+	return sch, nil
+}
+
+// affected возвращает ID, от которых зависят записи кэша с событиями, подходящими под filter.
+func (s *Storage) affected(ctx context.Context, filter []storage.EventCondition) (map[uuid.UUID]struct{}, int, error) {
+	events, err := s.backend.GetEvents(ctx, filter, nil, storage.Page{})
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make(map[uuid.UUID]struct{})
+	for _, e := range events {
+		touched(ids, e)
+	}
+	return ids, len(events), nil
+}
+
+// SetRemindersNotified сбрасывает записи кэша с событиями, напоминания которых отмечены.
+func (s *Storage) SetRemindersNotified(ctx context.Context, keys []storage.ReminderKey, notified time.Time) error {
+	sch, err := s.scheduler()
+	if err != nil {
+		return err
+	}
+	eventIDs := make([]uuid.UUID, 0, len(keys))
+	for _, k := range keys {
+		eventIDs = append(eventIDs, k.EventID)
+	}
+	ids, _, err := s.affected(ctx, []storage.EventCondition{
+		{Field: storage.EventID, Type: storage.TypeIn, Sample: eventIDs},
+	})
+	if err != nil {
+		return err
+	}
+	if err := sch.SetRemindersNotified(ctx, keys, notified); err != nil {
+		return err
+	}
+	s.invalidate(ids)
+	return nil
+}
+
+func (s *Storage) NotificationNeededEvents(ctx context.Context, t time.Time) ([]storage.Notification, error) {
+	sch, err := s.scheduler()
+	if err != nil {
+		return nil, err
+	}
+	return sch.NotificationNeededEvents(ctx, t)
+}
+
+// DeleteEvents сбрасывает записи кэша с удаляемыми событиями. Если удалено не столько событий, сколько было
+// найдено перед удалением (между ними кто-то изменил хранилище), сбрасывается весь кэш.
+func (s *Storage) DeleteEvents(ctx context.Context, filter []storage.EventCondition) (int64, error) {
+	sch, err := s.scheduler()
+	if err != nil {
+		return 0, err
+	}
+	ids, found, err := s.affected(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	n, err := sch.DeleteEvents(ctx, filter)
+	if err != nil {
+		return n, err
+	}
+	switch {
+	case n == 0:
+	case int(n) != found && s.changes != nil:
+		s.changes.all = true
+	case int(n) != found:
+		s.cache.clear()
+	default:
+		s.invalidate(ids)
+	}
+	return n, nil
+}
+
+func eventKey(id uuid.UUID) string {
+	return "event:" + id.String()
+}
+
+func (s *Storage) GetEvent(ctx context.Context, id uuid.UUID) (storage.Event, error) {
+	if s.changes != nil {
+		return s.backend.GetEvent(ctx, id)
+	}
+	key := eventKey(id)
+	if events, ok := s.cache.get(key); ok {
+		return events[0], nil
+	}
+	gen := s.cache.generation()
+	event, err := s.backend.GetEvent(ctx, id)
+	if err != nil {
+		return event, err
+	}
+	s.cache.put(key, []storage.Event{event}, withTagOwners([]uuid.UUID{id}, event), gen)
+	return event, nil
+}
+
+// withTagOwners добавляет к зависимостям владельцев событий с метками: цвет метки меняется изменением любого
+// события владельца с этой меткой.
+func withTagOwners(deps []uuid.UUID, events ...storage.Event) []uuid.UUID {
+	seen := make(map[uuid.UUID]struct{}, len(deps))
+	for _, id := range deps {
+		seen[id] = struct{}{}
+	}
+	for _, e := range events {
+		if _, ok := seen[e.UserID]; ok || len(e.Tags) == 0 {
+			continue
+		}
+		seen[e.UserID] = struct{}{}
+		deps = append(deps, e.UserID)
+	}
+	return deps
+}
+
+// GetEvents кэширует выборки, ограниченные пользователем: с условием UserID = X или с группой Or, в которой
+// все условия - UserID = X, участник X, календарь X или календарь из списка. Любое событие в такой выборке
+// связано с одним из этих ID, поэтому при изменении события достаточно сбросить выборки по его ID.
+func (s *Storage) GetEvents(
+	ctx context.Context,
+	filter []storage.EventCondition,
+	order []storage.EventSort,
+	page storage.Page,
+) ([]storage.Event, error) {
+	deps, ok := dependencies(filter)
+	if s.changes != nil || !ok {
+		return s.backend.GetEvents(ctx, filter, order, page)
+	}
+	key := queryKey(filter, order, page)
+	if events, ok := s.cache.get(key); ok {
+		return events, nil
+	}
+	gen := s.cache.generation()
+	events, err := s.backend.GetEvents(ctx, filter, order, page)
+	if err != nil {
+		return events, err
+	}
+	s.cache.put(key, events, withTagOwners(deps, events...), gen)
+	return events, nil
+}
+
+func dependencies(filter []storage.EventCondition) ([]uuid.UUID, bool) {
+	for _, cond := range filter {
+		if id, ok := userCondition(cond); ok {
+			return []uuid.UUID{id}, true
+		}
+	}
+	for _, cond := range filter {
+		if cond.Type != storage.TypeOr || len(cond.Conditions) == 0 {
+			continue
+		}
+		var deps []uuid.UUID
+		for _, c := range cond.Conditions {
+			ids, ok := branchIDs(c)
+			if !ok {
+				deps = nil
+				break
+			}
+			deps = append(deps, ids...)
+		}
+		if deps != nil {
+			return deps, true
+		}
+	}
+	return nil, false
+}
+
+func userCondition(cond storage.EventCondition) (uuid.UUID, bool) {
+	if cond.Field != storage.EventUserID || cond.Type != storage.TypeEq {
+		return uuid.UUID{}, false
+	}
+	id, ok := cond.Sample.(uuid.UUID)
+	return id, ok
+}
+
+func branchIDs(cond storage.EventCondition) ([]uuid.UUID, bool) {
+	switch {
+	case cond.Field == storage.EventAttendees && cond.Type == storage.TypeEq,
+		cond.Field == storage.EventCalendarID && cond.Type == storage.TypeEq:
+		if id, ok := cond.Sample.(uuid.UUID); ok {
+			return []uuid.UUID{id}, true
+		}
+	case cond.Field == storage.EventCalendarID && cond.Type == storage.TypeIn:
+		if ids, ok := cond.Sample.([]uuid.UUID); ok && len(ids) > 0 {
+			return ids, true
+		}
+	default:
+		if id, ok := userCondition(cond); ok {
+			return []uuid.UUID{id}, true
+		}
+	}
+	return nil, false
+}
+
+// queryKey - ключ выборки. Даты приводятся к UTC без монотонных часов, чтобы одинаковые периоды давали один ключ.
+func queryKey(filter []storage.EventCondition, order []storage.EventSort, page storage.Page) string {
+	b := &strings.Builder{}
+	b.WriteString("events:")
+	writeConditions(b, filter)
+	for _, o := range order {
+		fmt.Fprintf(b, "|%s %s", o.Field, o.Direction)
+	}
+	fmt.Fprintf(b, "|%d %s", page.Limit, page.After)
+	return b.String()
+}
+
+func writeConditions(b *strings.Builder, conds []storage.EventCondition) {
+	for _, c := range conds {
+		fmt.Fprintf(b, "(%s %s ", c.Field, c.Type)
+		switch v := c.Sample.(type) {
+		case time.Time:
+			b.WriteString(v.UTC().Format(time.RFC3339Nano))
+		case string, []string:
+			fmt.Fprintf(b, "%q", v)
+		default:
+			fmt.Fprintf(b, "%v", v)
+		}
+		writeConditions(b, c.Conditions)
+		b.WriteString(")")
+	}
+}
+
+func (s *Storage) AddHistory(ctx context.Context, record storage.HistoryRecord) error {
+	return s.backend.AddHistory(ctx, record)
+}
+
+func (s *Storage) GetHistory(ctx context.Context, eventID uuid.UUID) ([]storage.HistoryRecord, error) {
+	return s.backend.GetHistory(ctx, eventID)
+}
+
+func (s *Storage) AddCalendar(ctx context.Context, calendar storage.Calendar) (storage.Calendar, error) {
+	return s.backend.AddCalendar(ctx, calendar)
+}
+
+func (s *Storage) UpdateCalendar(ctx context.Context, calendar storage.Calendar) error {
+	return s.backend.UpdateCalendar(ctx, calendar)
+}
+
+// DeleteCalendar сбрасывает весь кэш: хранилище может менять события удалённого календаря.
+func (s *Storage) DeleteCalendar(ctx context.Context, id uuid.UUID) error {
+	if err := s.backend.DeleteCalendar(ctx, id); err != nil {
+		return err
+	}
+	if s.changes != nil {
+		s.changes.all = true
+		return nil
+	}
+	s.cache.clear()
+	return nil
+}
+
+func (s *Storage) GetCalendar(ctx context.Context, id uuid.UUID) (storage.Calendar, error) {
+	return s.backend.GetCalendar(ctx, id)
+}
+
+func (s *Storage) GetCalendars(ctx context.Context, userID uuid.UUID) ([]storage.Calendar, error) {
+	return s.backend.GetCalendars(ctx, userID)
+}
+
+func (s *Storage) GetBusyIntervals(
+	ctx context.Context,
+	userIDs []uuid.UUID,
+	from, to time.Time,
+) (map[uuid.UUID][]storage.Interval, error) {
+	return s.backend.GetBusyIntervals(ctx, userIDs, from, to)
+}
+
+func (s *Storage) SetWorkingHours(ctx context.Context, hours storage.WorkingHours) error {
+	return s.backend.SetWorkingHours(ctx, hours)
+}
+
+func (s *Storage) GetWorkingHours(
+	ctx context.Context,
+	userIDs []uuid.UUID,
+) (map[uuid.UUID]storage.WorkingHours, error) {
+	return s.backend.GetWorkingHours(ctx, userIDs)
+}
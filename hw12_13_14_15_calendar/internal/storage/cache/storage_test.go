@@ -0,0 +1,287 @@
+package cachestorage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/app"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+// counting считает чтения событий из хранилища.
+type counting struct {
+	*memorystorage.Storage
+	reads int
+}
+
+func (c *counting) GetEvent(ctx context.Context, id uuid.UUID) (storage.Event, error) {
+	c.reads++
+	return c.Storage.GetEvent(ctx, id)
+}
+
+func (c *counting) GetEvents(
+	ctx context.Context,
+	filter []storage.EventCondition,
+	order []storage.EventSort,
+	page storage.Page,
+) ([]storage.Event, error) {
+	c.reads++
+	return c.Storage.GetEvents(ctx, filter, order, page)
+}
+
+var start = time.Date(2030, time.January, 10, 10, 0, 0, 0, time.UTC)
+
+func newEvent(userID uuid.UUID, title string) storage.Event {
+	return storage.Event{Title: title, UserID: userID, StartDate: start, EndDate: start.Add(time.Hour)}
+}
+
+func byUser(userID uuid.UUID) []storage.EventCondition {
+	return []storage.EventCondition{
+		{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
+		{Field: storage.EventStartDate, Type: storage.TypeMoreOrEq, Sample: start},
+	}
+}
+
+func TestGetEvent(t *testing.T) {
+	ctx := context.Background()
+	backend := &counting{Storage: memorystorage.New()}
+	s := New(backend, 10, 0)
+
+	event, err := s.AddEvent(ctx, newEvent(uuid.New(), "event"))
+	require.NoError(t, err)
+	// добавленное событие уже в кэше
+	res, err := s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, event, res)
+	require.Equal(t, 0, backend.reads)
+
+	// изменения у вызывающего не попадают в кэш
+	res.Title = "changed"
+	res, err = s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, "event", res.Title)
+
+	event.Title = "updated"
+	require.NoError(t, s.UpdateEvent(ctx, event))
+	res, err = s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, "updated", res.Title)
+	require.Equal(t, int64(2), res.Version)
+
+	_, err = s.GetEvent(ctx, uuid.New())
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	// UpdateEvent читает прежнюю версию события из кэша
+	require.Equal(t, Stats{Hits: 3, Misses: 2, Events: 1}, s.Stats())
+}
+
+func TestGetEventsInvalidation(t *testing.T) {
+	ctx := context.Background()
+	backend := &counting{Storage: memorystorage.New()}
+	s := New(backend, 10, 0)
+	userID := uuid.New()
+	otherID := uuid.New()
+	guestID := uuid.New()
+
+	event, err := s.AddEvent(ctx, newEvent(userID, "own"))
+	require.NoError(t, err)
+	_, err = s.AddEvent(ctx, newEvent(otherID, "other"))
+	require.NoError(t, err)
+
+	get := func(userID uuid.UUID) []string {
+		events, err := s.GetEvents(ctx, byUser(userID), nil, storage.Page{})
+		require.NoError(t, err)
+		titles := make([]string, len(events))
+		for i, e := range events {
+			titles[i] = e.Title
+		}
+		return titles
+	}
+	require.Equal(t, []string{"own"}, get(userID))
+	require.Equal(t, []string{"other"}, get(otherID))
+	require.Equal(t, 2, backend.reads)
+
+	// изменение события сбрасывает только выборки его владельца
+	event.Title = "own updated"
+	require.NoError(t, s.UpdateEvent(ctx, event))
+	event.Version++
+	require.Equal(t, []string{"other"}, get(otherID))
+	require.Equal(t, 2, backend.reads)
+	require.Equal(t, []string{"own updated"}, get(userID))
+	require.Equal(t, 3, backend.reads)
+
+	// приглашённый участник тоже видит изменения
+	invited := []storage.EventCondition{storage.Or(
+		storage.EventCondition{Field: storage.EventUserID, Type: storage.TypeEq, Sample: guestID},
+		storage.EventCondition{Field: storage.EventAttendees, Type: storage.TypeEq, Sample: guestID},
+	)}
+	events, err := s.GetEvents(ctx, invited, nil, storage.Page{})
+	require.NoError(t, err)
+	require.Len(t, events, 0)
+	event.Attendees = storage.Attendees{{UserID: guestID, Status: storage.RSVPNeedsAction}}
+	require.NoError(t, s.UpdateEvent(ctx, event))
+	events, err = s.GetEvents(ctx, invited, nil, storage.Page{})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	// при смене владельца сбрасываются выборки и прежнего, и нового
+	event.Version++
+	event.UserID = otherID
+	require.NoError(t, s.UpdateEvent(ctx, event))
+	require.Len(t, get(userID), 0)
+	require.ElementsMatch(t, []string{"other", "own updated"}, get(otherID))
+
+	require.NoError(t, s.TrashEvent(ctx, event.ID, 0, start))
+	require.Equal(t, []string{"other"}, get(otherID))
+
+	// выборки без пользователя не кэшируются
+	reads := backend.reads
+	for i := 0; i < 2; i++ {
+		_, err = s.GetEvents(ctx, nil, nil, storage.Page{})
+		require.NoError(t, err)
+	}
+	require.Equal(t, reads+2, backend.reads)
+}
+
+func TestBoundedSize(t *testing.T) {
+	ctx := context.Background()
+	s := New(memorystorage.New(), 3, 0)
+	userID := uuid.New()
+	for i := 0; i < 2; i++ {
+		_, err := s.AddEvent(ctx, newEvent(userID, "event"))
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, s.Stats().Events)
+
+	// выборка из двух событий вытесняет самое старое событие
+	_, err := s.GetEvents(ctx, byUser(userID), nil, storage.Page{})
+	require.NoError(t, err)
+	require.Equal(t, 3, s.Stats().Events)
+	require.Equal(t, int64(1), s.Stats().Evictions)
+
+	// выборка больше всего кэша в него не попадает
+	for i := 0; i < 2; i++ {
+		_, err := s.AddEvent(ctx, newEvent(userID, "event"))
+		require.NoError(t, err)
+	}
+	_, err = s.GetEvents(ctx, byUser(userID), nil, storage.Page{})
+	require.NoError(t, err)
+	require.LessOrEqual(t, s.Stats().Events, 3)
+}
+
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+	backend := &counting{Storage: memorystorage.New()}
+	s := New(backend, 10, time.Minute)
+	now := start
+	s.cache.now = func() time.Time { return now }
+
+	event, err := s.AddEvent(ctx, newEvent(uuid.New(), "event"))
+	require.NoError(t, err)
+	// изменение в обход кэша, как у планировщика в другом процессе
+	_, err = backend.DeleteEvents(ctx, []storage.EventCondition{
+		{Field: storage.EventID, Type: storage.TypeEq, Sample: event.ID},
+	})
+	require.NoError(t, err)
+
+	_, err = s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	now = now.Add(2 * time.Minute)
+	_, err = s.GetEvent(ctx, event.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+}
+
+func TestSchedulerWrites(t *testing.T) {
+	ctx := context.Background()
+	s := New(memorystorage.New(), 10, 0)
+	userID := uuid.New()
+	event := newEvent(userID, "event")
+	event.Reminders = storage.Reminders{{Before: time.Hour}}
+	event, err := s.AddEvent(ctx, event)
+	require.NoError(t, err)
+	old, err := s.AddEvent(ctx, newEvent(userID, "old"))
+	require.NoError(t, err)
+	_, err = s.GetEvents(ctx, byUser(userID), nil, storage.Page{})
+	require.NoError(t, err)
+
+	// отметка напоминания видна сразу, без ожидания ttl
+	notified := start.Add(-time.Hour)
+	err = s.SetRemindersNotified(ctx, []storage.ReminderKey{{EventID: event.ID, Before: time.Hour}}, notified)
+	require.NoError(t, err)
+	got, err := s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.True(t, got.Reminders[0].NotifiedAt.Equal(notified))
+
+	// удалённое событие пропадает и из события, и из выборки
+	n, err := s.DeleteEvents(ctx, []storage.EventCondition{
+		{Field: storage.EventID, Type: storage.TypeEq, Sample: old.ID},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	_, err = s.GetEvent(ctx, old.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	events, err := s.GetEvents(ctx, byUser(userID), nil, storage.Page{})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, event.ID, events[0].ID)
+}
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	backend := &counting{Storage: memorystorage.New()}
+	s := New(backend, 10, 0)
+	userID := uuid.New()
+	event, err := s.AddEvent(ctx, newEvent(userID, "event"))
+	require.NoError(t, err)
+	_, err = s.GetEvents(ctx, byUser(userID), nil, storage.Page{})
+	require.NoError(t, err)
+
+	errFailed := errors.New("failed")
+	err = s.WithTx(ctx, func(tx app.Storage) error {
+		changed := event
+		changed.Title = "changed"
+		require.NoError(t, tx.UpdateEvent(ctx, changed))
+		// в транзакции видны её изменения, а не кэш
+		res, err := tx.GetEvent(ctx, event.ID)
+		require.NoError(t, err)
+		require.Equal(t, "changed", res.Title)
+		return errFailed
+	})
+	require.ErrorIs(t, err, errFailed)
+	res, err := s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, "event", res.Title)
+
+	err = s.WithTx(ctx, func(tx app.Storage) error {
+		changed := event
+		changed.Title = "committed"
+		return tx.UpdateEvent(ctx, changed)
+	})
+	require.NoError(t, err)
+	events, err := s.GetEvents(ctx, byUser(userID), nil, storage.Page{})
+	require.NoError(t, err)
+	require.Equal(t, "committed", events[0].Title)
+}
+
+func TestTagColors(t *testing.T) {
+	ctx := context.Background()
+	s := New(memorystorage.New(), 10, 0)
+	userID := uuid.New()
+	tagged := newEvent(userID, "first")
+	tagged.Tags = storage.Tags{{Name: "release", Color: "red"}}
+	first, err := s.AddEvent(ctx, tagged)
+	require.NoError(t, err)
+	second, err := s.AddEvent(ctx, newEvent(userID, "second"))
+	require.NoError(t, err)
+
+	// цвет метки меняется через другое событие владельца, закэшированное событие тоже должно сброситься
+	second.Tags = storage.Tags{{Name: "release", Color: "green"}}
+	require.NoError(t, s.UpdateEvent(ctx, second))
+	res, err := s.GetEvent(ctx, first.ID)
+	require.NoError(t, err)
+	require.Equal(t, storage.Tags{{Name: "release", Color: "green"}}, res.Tags)
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var ErrCalendarNotFound = errors.New("calendar not found")
+
+// Access - уровень доступа к чужому календарю.
+type Access string
+
+const (
+	// AccessFreeBusy - видно только занятое время, без названия, описания и участников.
+	AccessFreeBusy Access = "free-busy"
+	AccessRead     Access = "read"
+	AccessWrite    Access = "write"
+)
+
+var accessRank = map[Access]int{
+	AccessFreeBusy: 1,
+	AccessRead:     2,
+	AccessWrite:    3,
+}
+
+func (a Access) IsValid() bool {
+	_, ok := accessRank[a]
+	return ok
+}
+
+// Allows сообщает, что уровень доступа не ниже required. Пустой уровень - доступа нет.
+func (a Access) Allows(required Access) bool {
+	return accessRank[a] >= accessRank[required] && a != ""
+}
+
+type Grant struct {
+	UserID uuid.UUID `db:"user_id"`
+	Access Access    `db:"access"`
+}
+
+type Grants []Grant
+
+func (g Grants) Find(userID uuid.UUID) (Grant, bool) {
+	for _, v := range g {
+		if v.UserID == userID {
+			return v, true
+		}
+	}
+	return Grant{}, false
+}
+
+// Calendar - именованный календарь пользователя. События без календаря (нулевой CalendarID) - личные
+// события владельца.
+type Calendar struct {
+	ID      uuid.UUID `db:"id"`
+	OwnerID uuid.UUID `db:"owner_id"`
+	Name    string    `db:"name"`
+	Color   string    `db:"color"`
+	// Доступ других пользователей, хранится отдельно от календаря.
+	Grants Grants `db:"-"`
+}
+
+// AccessFor возвращает уровень доступа пользователя к календарю, владелец может всё.
+func (c Calendar) AccessFor(userID uuid.UUID) Access {
+	if c.OwnerID == userID {
+		return AccessWrite
+	}
+	if g, ok := c.Grants.Find(userID); ok {
+		return g.Access
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package filestorage
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+func (s *Storage) AddCalendar(ctx context.Context, calendar storage.Calendar) (storage.Calendar, error) {
+	var res storage.Calendar
+	err := s.write(ctx, func(tx *Storage) error {
+		var err error
+		res, err = tx.mem.AddCalendar(ctx, calendar)
+		if err != nil {
+			return err
+		}
+		return tx.logCalendar(ctx, res.ID)
+	})
+	return res, err
+}
+
+func (s *Storage) UpdateCalendar(ctx context.Context, calendar storage.Calendar) error {
+	return s.write(ctx, func(tx *Storage) error {
+		if err := tx.mem.UpdateCalendar(ctx, calendar); err != nil {
+			return err
+		}
+		return tx.logCalendar(ctx, calendar.ID)
+	})
+}
+
+func (s *Storage) DeleteCalendar(ctx context.Context, id uuid.UUID) error {
+	return s.write(ctx, func(tx *Storage) error {
+		if err := tx.mem.DeleteCalendar(ctx, id); err != nil {
+			return err
+		}
+		*tx.pending = append(*tx.pending, record{Op: opDeleteCalendar, ID: &id})
+		return nil
+	})
+}
+
+func (s *Storage) GetCalendar(ctx context.Context, id uuid.UUID) (storage.Calendar, error) {
+	return s.mem.GetCalendar(ctx, id)
+}
+
+func (s *Storage) GetCalendars(ctx context.Context, userID uuid.UUID) ([]storage.Calendar, error) {
+	return s.mem.GetCalendars(ctx, userID)
+}
+
+func (s *Storage) logCalendar(ctx context.Context, id uuid.UUID) error {
+	calendar, err := s.mem.GetCalendar(ctx, id)
+	if err != nil {
+		return err
+	}
+	*s.pending = append(*s.pending, record{Op: opCalendar, Calendar: &calendar})
+	return nil
+}
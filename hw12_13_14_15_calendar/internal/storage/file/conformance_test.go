@@ -0,0 +1,19 @@
+package filestorage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		t.Helper()
+		s, err := New(filepath.Join(t.TempDir(), "calendar.db"), 0)
+		require.NoError(t, err)
+		t.Cleanup(func() { require.NoError(t, s.Close()) })
+		return s
+	})
+}
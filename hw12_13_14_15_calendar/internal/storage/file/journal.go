@@ -0,0 +1,331 @@
+package filestorage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage/memory"
+)
+
+var (
+	ErrCorrupted = errors.New("storage file corrupted")
+	ErrBroken    = errors.New("storage file is broken")
+)
+
+type op string
+
+const (
+	opEvent          op = "event"
+	opDeleteEvent    op = "delete-event"
+	opHistory        op = "history"
+	opCalendar       op = "calendar"
+	opDeleteCalendar op = "delete-calendar"
+	opWorkingHours   op = "working-hours"
+	opTag            op = "tag"
+	// отметка о подтверждении: предыдущие Count записей - одна транзакция
+	opCommit op = "commit"
+)
+
+// record - строка журнала. Для событий, календарей и рабочего времени хранится состояние после изменения,
+// поэтому повторное применение записи ничего не меняет.
+type record struct {
+	Op           op                     `json:"op"`
+	ID           *uuid.UUID             `json:"id,omitempty"`
+	Event        *storage.Event         `json:"event,omitempty"`
+	History      *storage.HistoryRecord `json:"history,omitempty"`
+	Calendar     *storage.Calendar      `json:"calendar,omitempty"`
+	WorkingHours *storage.WorkingHours  `json:"workingHours,omitempty"`
+	Tag          *memorystorage.UserTag `json:"tag,omitempty"`
+	Count        int                    `json:"count,omitempty"`
+}
+
+// journal - файл с записями в формате JSON, по одной на строку. Записи транзакции дописываются в конец
+// вместе с отметкой о подтверждении, при сжатии файл целиком заменяется записями о текущем состоянии.
+type journal struct {
+	path string
+	file *os.File
+	size int64
+	// ошибка, после которой в конце файла может остаться часть транзакции; дописывать в такой файл нельзя
+	// до сжатия
+	broken error
+	// записей дописано с последнего сжатия
+	appended     int
+	compactAfter int
+}
+
+// load читает журнал и собирает из него снимок данных. Записи применяются, только когда дочитана отметка
+// о подтверждении их транзакции: неподтверждённые записи в конце файла (сбой во время записи) и недописанная
+// последняя строка отбрасываются, любая другая нечитаемая строка - ошибка.
+func load(path string) (memorystorage.Snapshot, error) {
+	state := newState()
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state.snapshot(), nil
+	}
+	if err != nil {
+		return memorystorage.Snapshot{}, err
+	}
+	defer f.Close()
+
+	var pending []record
+	// номера строк записей из pending, для сообщений об ошибках
+	var nums []int
+	apply := func() error {
+		for i, rec := range pending {
+			if err := state.apply(rec); err != nil {
+				return fmt.Errorf("%w: line %d: %s", ErrCorrupted, nums[i], err)
+			}
+		}
+		pending, nums = pending[:0], nums[:0]
+		return nil
+	}
+
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return memorystorage.Snapshot{}, err
+		}
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return memorystorage.Snapshot{}, fmt.Errorf("%w: line %d: %s", ErrCorrupted, n, err)
+		}
+		if rec.Op == opCommit {
+			if rec.Count != len(pending) {
+				return memorystorage.Snapshot{}, fmt.Errorf(
+					"%w: line %d: commit of %d records after %d", ErrCorrupted, n, rec.Count, len(pending))
+			}
+			if err := apply(); err != nil {
+				return memorystorage.Snapshot{}, err
+			}
+			continue
+		}
+		pending = append(pending, rec)
+		nums = append(nums, n)
+	}
+	return state.snapshot(), nil
+}
+
+// append дописывает записи транзакции с отметкой о подтверждении и сбрасывает их на диск. Если записать
+// не удалось, файл обрезается до прежнего размера, чтобы в нём не осталось части транзакции.
+func (j *journal) append(records []record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if j.broken != nil {
+		return fmt.Errorf("%w: %w", ErrBroken, j.broken)
+	}
+	buf, err := encode(records)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(buf); err != nil {
+		return j.truncate(err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return j.truncate(err)
+	}
+	j.size += int64(len(buf))
+	j.appended += len(records)
+	return nil
+}
+
+// truncate обрезает файл после неудачной записи. Если и это не удалось, журнал считается сломанным: следующая
+// транзакция оказалась бы после неподтверждённых записей этой.
+func (j *journal) truncate(cause error) error {
+	if err := j.file.Truncate(j.size); err != nil {
+		j.broken = errors.Join(cause, err)
+		return j.broken
+	}
+	return cause
+}
+
+func (j *journal) needCompact() bool {
+	return j.compactAfter > 0 && j.appended >= j.compactAfter
+}
+
+// compact записывает текущее состояние во временный файл и атомарно подменяет им журнал. Дописывать
+// дальше можно только в новый файл, поэтому он не открывается заново после переименования: если бы открыть
+// не удалось, записи уходили бы в уже удалённый старый файл.
+func (j *journal) compact(snap memorystorage.Snapshot) error {
+	buf, err := encode(snapshotRecords(snap))
+	if err != nil {
+		return err
+	}
+
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	discard := func(cause error) error {
+		f.Close()
+		os.Remove(tmp)
+		return cause
+	}
+	if _, err := f.Write(buf); err != nil {
+		return discard(err)
+	}
+	if err := f.Sync(); err != nil {
+		return discard(err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return discard(err)
+	}
+
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file = f
+	j.size = int64(len(buf))
+	j.appended = 0
+	j.broken = nil
+	// переименование сохранится на диске только после синхронизации каталога
+	return syncDir(filepath.Dir(j.path))
+}
+
+func (j *journal) close() error {
+	return j.file.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// encode записывает записи одной транзакцией: после них идёт отметка о подтверждении (и для пустого
+// снимка - по ней журнал отличается от записанного до появления отметок).
+func encode(records []record) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Encode(record{Op: opCommit, Count: len(records)}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func snapshotRecords(snap memorystorage.Snapshot) []record {
+	res := make(
+		[]record,
+		0,
+		len(snap.Events)+len(snap.History)+len(snap.Calendars)+len(snap.WorkingHours)+len(snap.Tags),
+	)
+	for i := range snap.Events {
+		res = append(res, record{Op: opEvent, Event: &snap.Events[i]})
+	}
+	for i := range snap.History {
+		res = append(res, record{Op: opHistory, History: &snap.History[i]})
+	}
+	for i := range snap.Calendars {
+		res = append(res, record{Op: opCalendar, Calendar: &snap.Calendars[i]})
+	}
+	for i := range snap.WorkingHours {
+		res = append(res, record{Op: opWorkingHours, WorkingHours: &snap.WorkingHours[i]})
+	}
+	for i := range snap.Tags {
+		res = append(res, record{Op: opTag, Tag: &snap.Tags[i]})
+	}
+	return res
+}
+
+// state - данные, собранные из журнала при загрузке.
+type state struct {
+	events       map[uuid.UUID]storage.Event
+	history      map[int64]storage.HistoryRecord
+	calendars    map[uuid.UUID]storage.Calendar
+	workingHours map[uuid.UUID]storage.WorkingHours
+	// цвета меток по владельцу и названию: из записей меток и из меток в записях событий, в порядке журнала
+	tagColors map[uuid.UUID]map[string]string
+}
+
+func newState() *state {
+	return &state{
+		events:       make(map[uuid.UUID]storage.Event),
+		history:      make(map[int64]storage.HistoryRecord),
+		calendars:    make(map[uuid.UUID]storage.Calendar),
+		workingHours: make(map[uuid.UUID]storage.WorkingHours),
+		tagColors:    make(map[uuid.UUID]map[string]string),
+	}
+}
+
+func (s *state) apply(rec record) error {
+	switch {
+	case rec.Op == opEvent && rec.Event != nil:
+		s.events[rec.Event.ID] = *rec.Event
+		for _, t := range rec.Event.Tags {
+			s.setTagColor(rec.Event.UserID, t.Name, t.Color)
+		}
+	case rec.Op == opDeleteEvent && rec.ID != nil:
+		delete(s.events, *rec.ID)
+	case rec.Op == opHistory && rec.History != nil:
+		s.history[rec.History.ID] = *rec.History
+	case rec.Op == opCalendar && rec.Calendar != nil:
+		s.calendars[rec.Calendar.ID] = *rec.Calendar
+	case rec.Op == opDeleteCalendar && rec.ID != nil:
+		delete(s.calendars, *rec.ID)
+	case rec.Op == opWorkingHours && rec.WorkingHours != nil:
+		s.workingHours[rec.WorkingHours.UserID] = *rec.WorkingHours
+	case rec.Op == opTag && rec.Tag != nil:
+		s.setTagColor(rec.Tag.UserID, rec.Tag.Name, rec.Tag.Color)
+	default:
+		return fmt.Errorf("unknown record %q", rec.Op)
+	}
+	return nil
+}
+
+func (s *state) setTagColor(userID uuid.UUID, name, color string) {
+	if color == "" {
+		return
+	}
+	colors, ok := s.tagColors[userID]
+	if !ok {
+		colors = make(map[string]string)
+		s.tagColors[userID] = colors
+	}
+	colors[name] = color
+}
+
+func (s *state) snapshot() memorystorage.Snapshot {
+	snap := memorystorage.Snapshot{}
+	for _, e := range s.events {
+		snap.Events = append(snap.Events, e)
+	}
+	for _, h := range s.history {
+		snap.History = append(snap.History, h)
+	}
+	sort.Slice(snap.History, func(i, j int) bool { return snap.History[i].ID < snap.History[j].ID })
+	for _, c := range s.calendars {
+		snap.Calendars = append(snap.Calendars, c)
+	}
+	for _, h := range s.workingHours {
+		snap.WorkingHours = append(snap.WorkingHours, h)
+	}
+	for userID, colors := range s.tagColors {
+		for name, color := range colors {
+			tag := storage.Tag{Name: name, Color: color}
+			snap.Tags = append(snap.Tags, memorystorage.UserTag{UserID: userID, Tag: tag})
+		}
+	}
+	return snap
+}
@@ -0,0 +1,251 @@
+package filestorage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/app"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage/memory"
+)
+
+// Storage хранит данные в памяти (запросы выполняет memorystorage), а каждое изменение перед подтверждением
+// дописывает в журнал на диске. Файлом может пользоваться только один процесс.
+type Storage struct {
+	mem *memorystorage.Storage
+	log *journal
+	// записи транзакции, которые будут дописаны в журнал при её подтверждении; nil вне WithTx
+	pending *[]record
+}
+
+// New загружает данные из файла path (если его нет, он будет создан) и сразу сжимает журнал.
+// После compactAfter дописанных записей журнал сжимается снова, 0 - только при открытии и закрытии.
+func New(path string, compactAfter int) (*Storage, error) {
+	snap, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Storage{
+		mem: memorystorage.Restore(snap),
+		log: &journal{path: path, compactAfter: compactAfter},
+	}
+	if err := s.log.compact(s.mem.Snapshot()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close сжимает журнал и закрывает файл.
+func (s *Storage) Close() error {
+	return s.mem.WithTx(context.Background(), func(tx app.Storage) error {
+		if err := s.log.compact(tx.(*memorystorage.Storage).Snapshot()); err != nil {
+			s.log.close()
+			return err
+		}
+		return s.log.close()
+	})
+}
+
+// WithTx выполняет fn в транзакции хранилища в памяти. Записи транзакции дописываются в журнал одним куском
+// перед подтверждением, если записать их не удалось, изменения в памяти откатываются.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx app.Storage) error) error {
+	return s.write(ctx, func(tx *Storage) error {
+		return fn(tx)
+	})
+}
+
+func (s *Storage) LockUser(ctx context.Context, userID uuid.UUID) error {
+	return s.mem.LockUser(ctx, userID)
+}
+
+func (s *Storage) write(ctx context.Context, fn func(tx *Storage) error) error {
+	if s.pending != nil {
+		return fn(s)
+	}
+
+	return s.mem.WithTx(ctx, func(memTx app.Storage) error {
+		tx := &Storage{mem: memTx.(*memorystorage.Storage), log: s.log, pending: &[]record{}}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if err := s.log.append(*tx.pending); err != nil {
+			return err
+		}
+		if s.log.needCompact() {
+			// изменения уже на диске, если сжать не удалось - журнал просто растёт до следующей попытки
+			_ = s.log.compact(tx.mem.Snapshot())
+		}
+		return nil
+	})
+}
+
+func (s *Storage) logEvent(ctx context.Context, id uuid.UUID) error {
+	event, err := s.mem.GetEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+	*s.pending = append(*s.pending, record{Op: opEvent, Event: &event})
+	return nil
+}
+
+func (s *Storage) logDeleteEvent(id uuid.UUID) {
+	*s.pending = append(*s.pending, record{Op: opDeleteEvent, ID: &id})
+}
+
+func (s *Storage) AddEvent(ctx context.Context, event storage.Event) (storage.Event, error) {
+	var res storage.Event
+	err := s.write(ctx, func(tx *Storage) error {
+		var err error
+		res, err = tx.mem.AddEvent(ctx, event)
+		if err != nil {
+			return err
+		}
+		return tx.logEvent(ctx, res.ID)
+	})
+	return res, err
+}
+
+func (s *Storage) UpdateEvent(ctx context.Context, event storage.Event) error {
+	return s.write(ctx, func(tx *Storage) error {
+		if err := tx.mem.UpdateEvent(ctx, event); err != nil {
+			return err
+		}
+		return tx.logEvent(ctx, event.ID)
+	})
+}
+
+func (s *Storage) DeleteEvent(ctx context.Context, id uuid.UUID, version int64) error {
+	return s.write(ctx, func(tx *Storage) error {
+		if err := tx.mem.DeleteEvent(ctx, id, version); err != nil {
+			return err
+		}
+		tx.logDeleteEvent(id)
+		return nil
+	})
+}
+
+func (s *Storage) TrashEvent(ctx context.Context, id uuid.UUID, version int64, deletedAt time.Time) error {
+	return s.write(ctx, func(tx *Storage) error {
+		if err := tx.mem.TrashEvent(ctx, id, version, deletedAt); err != nil {
+			return err
+		}
+		return tx.logEvent(ctx, id)
+	})
+}
+
+func (s *Storage) RestoreEvent(ctx context.Context, id uuid.UUID, version int64) error {
+	return s.write(ctx, func(tx *Storage) error {
+		if err := tx.mem.RestoreEvent(ctx, id, version); err != nil {
+			return err
+		}
+		return tx.logEvent(ctx, id)
+	})
+}
+
+func (s *Storage) SetAttendeeStatus(
+	ctx context.Context,
+	eventID uuid.UUID,
+	userID uuid.UUID,
+	status storage.RSVPStatus,
+) error {
+	return s.write(ctx, func(tx *Storage) error {
+		if err := tx.mem.SetAttendeeStatus(ctx, eventID, userID, status); err != nil {
+			return err
+		}
+		return tx.logEvent(ctx, eventID)
+	})
+}
+
+func (s *Storage) GetEvent(ctx context.Context, id uuid.UUID) (storage.Event, error) {
+	return s.mem.GetEvent(ctx, id)
+}
+
+func (s *Storage) GetEvents(
+	ctx context.Context,
+	filter []storage.EventCondition,
+	order []storage.EventSort,
+	page storage.Page,
+) ([]storage.Event, error) {
+	return s.mem.GetEvents(ctx, filter, order, page)
+}
+
+// DeleteEvents удаляет события по условиям, включая события в корзине, как и остальные хранилища.
+func (s *Storage) DeleteEvents(ctx context.Context, filter []storage.EventCondition) (int64, error) {
+	var count int64
+	err := s.write(ctx, func(tx *Storage) error {
+		anyDeletedAt := storage.Or(
+			storage.EventCondition{Field: storage.EventDeletedAt, Type: storage.TypeEq, Sample: time.Time{}},
+			storage.EventCondition{Field: storage.EventDeletedAt, Type: storage.TypeNotEq, Sample: time.Time{}},
+		)
+		search := append(filter[:len(filter):len(filter)], anyDeletedAt)
+		events, err := tx.mem.GetEvents(ctx, search, nil, storage.Page{})
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			if err := tx.mem.DeleteEvent(ctx, e.ID, 0); err != nil {
+				return err
+			}
+			tx.logDeleteEvent(e.ID)
+		}
+		count = int64(len(events))
+		return nil
+	})
+	return count, err
+}
+
+func (s *Storage) SetRemindersNotified(ctx context.Context, keys []storage.ReminderKey, notified time.Time) error {
+	return s.write(ctx, func(tx *Storage) error {
+		if err := tx.mem.SetRemindersNotified(ctx, keys, notified); err != nil {
+			return err
+		}
+		logged := make(map[uuid.UUID]struct{}, len(keys))
+		for _, key := range keys {
+			if _, ok := logged[key.EventID]; ok {
+				continue
+			}
+			logged[key.EventID] = struct{}{}
+			if _, err := tx.mem.GetEvent(ctx, key.EventID); err != nil {
+				continue
+			}
+			if err := tx.logEvent(ctx, key.EventID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Storage) NotificationNeededEvents(ctx context.Context, t time.Time) ([]storage.Notification, error) {
+	return s.mem.NotificationNeededEvents(ctx, t)
+}
+
+func (s *Storage) GetBusyIntervals(
+	ctx context.Context,
+	userIDs []uuid.UUID,
+	from, to time.Time,
+) (map[uuid.UUID][]storage.Interval, error) {
+	return s.mem.GetBusyIntervals(ctx, userIDs, from, to)
+}
+
+func (s *Storage) AddHistory(ctx context.Context, rec storage.HistoryRecord) error {
+	return s.write(ctx, func(tx *Storage) error {
+		if err := tx.mem.AddHistory(ctx, rec); err != nil {
+			return err
+		}
+		// ID записи назначает хранилище, добавленная запись - последняя в истории события
+		history, err := tx.mem.GetHistory(ctx, rec.EventID)
+		if err != nil {
+			return err
+		}
+		added := history[len(history)-1]
+		*tx.pending = append(*tx.pending, record{Op: opHistory, History: &added})
+		return nil
+	})
+}
+
+func (s *Storage) GetHistory(ctx context.Context, eventID uuid.UUID) ([]storage.HistoryRecord, error) {
+	return s.mem.GetHistory(ctx, eventID)
+}
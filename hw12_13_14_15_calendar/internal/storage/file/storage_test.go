@@ -0,0 +1,353 @@
+package filestorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/app"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func newEvent(userID uuid.UUID, title string) storage.Event {
+	start := time.Date(2030, 1, 10, 10, 0, 0, 0, time.UTC)
+	return storage.Event{
+		Title:     title,
+		StartDate: start,
+		EndDate:   start.Add(time.Hour),
+		UserID:    userID,
+		Reminders: storage.Reminders{{Before: time.Hour}},
+	}
+}
+
+// records - количество записей в журнале без отметок о подтверждении транзакций.
+func records(t *testing.T, path string) int {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return bytes.Count(b, []byte("\n")) - bytes.Count(b, []byte(`{"op":"commit"`))
+}
+
+func TestReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "calendar.db")
+	userID := uuid.New()
+	guestID := uuid.New()
+
+	s, err := New(path, 0)
+	require.NoError(t, err)
+
+	event := newEvent(userID, "first")
+	event.Attendees = storage.Attendees{{UserID: guestID, Status: storage.RSVPNeedsAction}}
+	event, err = s.AddEvent(ctx, event)
+	require.NoError(t, err)
+	event.Title = "first updated"
+	require.NoError(t, s.UpdateEvent(ctx, event))
+	require.NoError(t, s.SetAttendeeStatus(ctx, event.ID, guestID, storage.RSVPAccepted))
+	require.NoError(t, s.AddHistory(ctx, storage.HistoryRecord{EventID: event.ID, Action: storage.ActionCreate}))
+	require.NoError(t, s.AddHistory(ctx, storage.HistoryRecord{EventID: event.ID, Action: storage.ActionUpdate}))
+	notified := time.Date(2030, 1, 10, 9, 0, 0, 0, time.UTC)
+	keys := []storage.ReminderKey{{EventID: event.ID, Before: time.Hour}, {EventID: uuid.New(), Before: time.Hour}}
+	require.NoError(t, s.SetRemindersNotified(ctx, keys, notified))
+
+	trashed, err := s.AddEvent(ctx, newEvent(userID, "trashed"))
+	require.NoError(t, err)
+	require.NoError(t, s.TrashEvent(ctx, trashed.ID, 0, notified))
+	deleted, err := s.AddEvent(ctx, newEvent(userID, "deleted"))
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteEvent(ctx, deleted.ID, 0))
+
+	calendar, err := s.AddCalendar(ctx, storage.Calendar{OwnerID: userID, Name: "work"})
+	require.NoError(t, err)
+	calendar.Grants = storage.Grants{{UserID: guestID, Access: storage.AccessRead}}
+	require.NoError(t, s.UpdateCalendar(ctx, calendar))
+	removed, err := s.AddCalendar(ctx, storage.Calendar{OwnerID: userID, Name: "removed"})
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteCalendar(ctx, removed.ID))
+
+	hours := storage.WorkingHours{
+		UserID:   userID,
+		Start:    9 * time.Hour,
+		End:      18 * time.Hour,
+		Weekdays: storage.Weekdays{time.Monday, time.Tuesday},
+		TimeZone: "UTC",
+	}
+	require.NoError(t, s.SetWorkingHours(ctx, hours))
+
+	wantEvent, err := s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	wantTrashed, err := s.GetEvent(ctx, trashed.ID)
+	require.NoError(t, err)
+	wantHistory, err := s.GetHistory(ctx, event.ID)
+	require.NoError(t, err)
+
+	// файл не закрыт - как после падения процесса
+	s, err = New(path, 0)
+	require.NoError(t, err)
+
+	ev, err := s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, wantEvent, ev)
+	require.Equal(t, "first updated", ev.Title)
+	require.Equal(t, notified, ev.Reminders[0].NotifiedAt)
+	require.Equal(t, storage.RSVPAccepted, ev.Attendees[0].Status)
+
+	ev, err = s.GetEvent(ctx, trashed.ID)
+	require.NoError(t, err)
+	require.Equal(t, wantTrashed, ev)
+
+	_, err = s.GetEvent(ctx, deleted.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+
+	history, err := s.GetHistory(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, wantHistory, history)
+
+	calendars, err := s.GetCalendars(ctx, userID)
+	require.NoError(t, err)
+	require.Equal(t, []storage.Calendar{calendar}, calendars)
+
+	stored, err := s.GetWorkingHours(ctx, []uuid.UUID{userID})
+	require.NoError(t, err)
+	require.Equal(t, hours, stored[userID])
+
+	// нумерация истории продолжается
+	require.NoError(t, s.AddHistory(ctx, storage.HistoryRecord{EventID: event.ID, Action: storage.ActionUpdate}))
+	history, err = s.GetHistory(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, wantHistory[1].ID+1, history[2].ID)
+	require.NoError(t, s.Close())
+}
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "calendar.db")
+	userID := uuid.New()
+
+	s, err := New(path, 0)
+	require.NoError(t, err)
+	event, err := s.AddEvent(ctx, newEvent(userID, "kept"))
+	require.NoError(t, err)
+
+	errFail := errors.New("fail")
+	err = s.WithTx(ctx, func(tx app.Storage) error {
+		if _, err := tx.AddEvent(ctx, newEvent(userID, "rolled back")); err != nil {
+			return err
+		}
+		event.Title = "changed"
+		if err := tx.UpdateEvent(ctx, event); err != nil {
+			return err
+		}
+		return errFail
+	})
+	require.ErrorIs(t, err, errFail)
+
+	err = s.WithTx(ctx, func(tx app.Storage) error {
+		_, err := tx.AddEvent(ctx, newEvent(userID, "committed"))
+		return err
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	s, err = New(path, 0)
+	require.NoError(t, err)
+	order := []storage.EventSort{{Field: storage.EventTitle, Direction: storage.DirectionAsc}}
+	events, err := s.GetEvents(ctx, nil, order, storage.Page{})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, "committed", events[0].Title)
+	require.Equal(t, "kept", events[1].Title)
+	require.NoError(t, s.Close())
+}
+
+func TestDeleteEvents(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "calendar.db")
+	userID := uuid.New()
+	otherID := uuid.New()
+
+	s, err := New(path, 0)
+	require.NoError(t, err)
+	active, err := s.AddEvent(ctx, newEvent(userID, "active"))
+	require.NoError(t, err)
+	trashed, err := s.AddEvent(ctx, newEvent(userID, "trashed"))
+	require.NoError(t, err)
+	require.NoError(t, s.TrashEvent(ctx, trashed.ID, 0, time.Now()))
+	other, err := s.AddEvent(ctx, newEvent(otherID, "other"))
+	require.NoError(t, err)
+
+	count, err := s.DeleteEvents(ctx, []storage.EventCondition{
+		{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+
+	s, err = New(path, 0)
+	require.NoError(t, err)
+	_, err = s.GetEvent(ctx, active.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	_, err = s.GetEvent(ctx, trashed.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	_, err = s.GetEvent(ctx, other.ID)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+}
+
+func TestCompaction(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "calendar.db")
+
+	s, err := New(path, 5)
+	require.NoError(t, err)
+	event, err := s.AddEvent(ctx, newEvent(uuid.New(), "compacted"))
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		require.NoError(t, s.UpdateEvent(ctx, event))
+		event.Version++
+	}
+	// после сжатия в журнале одна запись о событии и не больше пяти новых
+	require.LessOrEqual(t, records(t, path), 5)
+	_, err = os.Stat(path + ".tmp")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, s.Close())
+	require.Equal(t, 1, records(t, path))
+
+	s, err = New(path, 5)
+	require.NoError(t, err)
+	ev, err := s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, event.Version, ev.Version)
+	require.NoError(t, s.Close())
+}
+
+func TestTagColors(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "calendar.db")
+	userID := uuid.New()
+
+	s, err := New(path, 0)
+	require.NoError(t, err)
+	event := newEvent(userID, "tagged")
+	event.Tags = storage.Tags{{Name: "release", Color: "red"}}
+	event, err = s.AddEvent(ctx, event)
+	require.NoError(t, err)
+	// цвет меняется через другое событие, которое потом удаляется
+	other := newEvent(userID, "other")
+	other.Tags = storage.Tags{{Name: "release", Color: "green"}}
+	other, err = s.AddEvent(ctx, other)
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteEvent(ctx, other.ID, 0))
+
+	want := storage.Tags{{Name: "release", Color: "green"}}
+	// и после чтения журнала, и после сжатия при закрытии
+	for i := 0; i < 2; i++ {
+		s, err = New(path, 0)
+		require.NoError(t, err)
+		ev, err := s.GetEvent(ctx, event.ID)
+		require.NoError(t, err)
+		require.Equal(t, want, ev.Tags)
+		require.NoError(t, s.Close())
+	}
+}
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "calendar.db")
+
+	s, err := New(path, 0)
+	require.NoError(t, err)
+	event, err := s.AddEvent(ctx, newEvent(uuid.New(), "event"))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	t.Run("torn last line", func(t *testing.T) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+		require.NoError(t, err)
+		_, err = f.WriteString(`{"op":"event","event":{"ID":`)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		s, err := New(path, 0)
+		require.NoError(t, err)
+		_, err = s.GetEvent(ctx, event.ID)
+		require.NoError(t, err)
+		require.NoError(t, s.Close())
+		require.Equal(t, 1, records(t, path))
+	})
+
+	t.Run("uncommitted transaction", func(t *testing.T) {
+		// сбой после записи части транзакции: записи есть, отметки о подтверждении нет
+		other := newEvent(uuid.New(), "uncommitted")
+		other.ID = uuid.New()
+		b, err := json.Marshal(record{Op: opEvent, Event: &other})
+		require.NoError(t, err)
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+		require.NoError(t, err)
+		_, err = f.Write(append(b, '\n'))
+		require.NoError(t, err)
+		_, err = f.WriteString(`{"op":"delete-event","id":"` + event.ID.String() + `"}` + "\n")
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		s, err := New(path, 0)
+		require.NoError(t, err)
+		_, err = s.GetEvent(ctx, event.ID)
+		require.NoError(t, err)
+		_, err = s.GetEvent(ctx, other.ID)
+		require.ErrorIs(t, err, storage.ErrEventNotFound)
+		require.NoError(t, s.Close())
+		require.Equal(t, 1, records(t, path))
+	})
+
+	t.Run("commit count mismatch", func(t *testing.T) {
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		b = append(b, []byte(`{"op":"commit","count":2}`+"\n")...)
+		require.NoError(t, os.WriteFile(path, b, 0o600))
+
+		_, err = New(path, 0)
+		require.ErrorIs(t, err, ErrCorrupted)
+		require.NoError(t, os.WriteFile(path, b[:len(b)-len(`{"op":"commit","count":2}`+"\n")], 0o600))
+	})
+
+	t.Run("corrupted line", func(t *testing.T) {
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, append([]byte("garbage\n"), b...), 0o600))
+
+		_, err = New(path, 0)
+		require.ErrorIs(t, err, ErrCorrupted)
+	})
+}
+
+// Не удавшееся сжатие не мешает дописывать в журнал.
+func TestCompactionFailure(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "calendar.db")
+
+	s, err := New(path, 1)
+	require.NoError(t, err)
+	// временный файл сжатия не создать: на его месте каталог
+	require.NoError(t, os.Mkdir(path+".tmp", 0o700))
+	event, err := s.AddEvent(ctx, newEvent(uuid.New(), "event"))
+	require.NoError(t, err)
+	event.Title = "changed"
+	require.NoError(t, s.UpdateEvent(ctx, event))
+	require.Error(t, s.Close())
+
+	require.NoError(t, os.Remove(path+".tmp"))
+	s, err = New(path, 0)
+	require.NoError(t, err)
+	ev, err := s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, "changed", ev.Title)
+	require.NoError(t, s.Close())
+}
@@ -0,0 +1,25 @@
+package filestorage
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+func (s *Storage) SetWorkingHours(ctx context.Context, hours storage.WorkingHours) error {
+	return s.write(ctx, func(tx *Storage) error {
+		if err := tx.mem.SetWorkingHours(ctx, hours); err != nil {
+			return err
+		}
+		*tx.pending = append(*tx.pending, record{Op: opWorkingHours, WorkingHours: &hours})
+		return nil
+	})
+}
+
+func (s *Storage) GetWorkingHours(
+	ctx context.Context,
+	userIDs []uuid.UUID,
+) (map[uuid.UUID]storage.WorkingHours, error) {
+	return s.mem.GetWorkingHours(ctx, userIDs)
+}
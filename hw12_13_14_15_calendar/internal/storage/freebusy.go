@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Interval - промежуток времени [Start, End).
+type Interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+// FreeBusy - занятое время пользователя: непересекающиеся интервалы по возрастанию.
+type FreeBusy struct {
+	UserID uuid.UUID
+	Busy   []Interval
+}
+
+// BusyOf возвращает, кого событие делает занятым: владельца и участников, которые не отклонили приглашение.
+func (e Event) BusyOf() []uuid.UUID {
+	res := []uuid.UUID{e.UserID}
+	for _, v := range e.Attendees {
+		if v.Status != RSVPDeclined {
+			res = append(res, v.UserID)
+		}
+	}
+	return res
+}
+
+// BusyIntervals возвращает интервалы экземпляров события, пересекающиеся с [from, to), обрезанные по границам периода.
+// События на целые дни время не занимают.
+func (e Event) BusyIntervals(from, to time.Time) ([]Interval, error) {
+	if e.AllDay {
+		return nil, nil
+	}
+	occurrences, err := e.Occurrences(from.Add(-1*e.EndDate.Sub(e.StartDate)), to)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Interval, 0, len(occurrences))
+	for _, o := range occurrences {
+		if !o.StartDate.Before(to) || !o.EndDate.After(from) {
+			continue
+		}
+		res = append(res, Interval{Start: maxTime(o.StartDate, from), End: minTime(o.EndDate, to)})
+	}
+	return res, nil
+}
+
+// MergeIntervals упорядочивает интервалы и объединяет пересекающиеся и смежные. Исходный срез меняется.
+func MergeIntervals(intervals []Interval) []Interval {
+	if len(intervals) == 0 {
+		return []Interval{}
+	}
+
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].Start.Before(intervals[j].Start)
+	})
+	res := []Interval{intervals[0]}
+	for _, v := range intervals[1:] {
+		last := &res[len(res)-1]
+		if v.Start.After(last.End) {
+			res = append(res, v)
+			continue
+		}
+		last.End = maxTime(last.End, v.End)
+	}
+	return res
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
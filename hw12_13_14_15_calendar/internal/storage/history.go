@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type HistoryAction string
+
+const (
+	ActionCreate  HistoryAction = "create"
+	ActionUpdate  HistoryAction = "update"
+	ActionDelete  HistoryAction = "delete"
+	ActionRestore HistoryAction = "restore"
+)
+
+// Поля события, изменения которых попадают в историю.
+var historyFields = []EventField{
+	EventTitle,
+	EventStartDate,
+	EventEndDate,
+	EventAllDay,
+	EventTimeZone,
+	EventDescription,
+	EventReminders,
+	EventRRule,
+	EventExDates,
+	EventDeletedAt,
+	EventCalendarID,
+	EventAttendees,
+	EventTags,
+}
+
+// HistoryRecord - запись журнала изменений события. Журнал только пополняется, записи не меняются и не удаляются.
+type HistoryRecord struct {
+	ID        int64         `db:"id"`
+	EventID   uuid.UUID     `db:"event_id"`
+	UserID    uuid.UUID     `db:"user_id"`
+	Action    HistoryAction `db:"action"`
+	CreatedAt time.Time     `db:"created_at"`
+	Changes   FieldChanges  `db:"changes"`
+}
+
+type FieldChange struct {
+	Field EventField
+	Old   string
+	New   string
+}
+
+// FieldChanges хранится в БД одной строкой в JSON.
+type FieldChanges []FieldChange
+
+func (c FieldChanges) Value() (driver.Value, error) {
+	if c == nil {
+		c = FieldChanges{}
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (c *FieldChanges) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("%w: %T", ErrIncomparableType, src)
+	}
+
+	return json.Unmarshal(b, c)
+}
+
+// DiffEvents возвращает изменившиеся поля события. Для создания события before - пустое событие,
+// нулевые значения полей записываются пустой строкой.
+func DiffEvents(before, after Event) FieldChanges {
+	res := make(FieldChanges, 0)
+	for _, field := range historyFields {
+		o, n := historyValue(before, field), historyValue(after, field)
+		if o != n {
+			res = append(res, FieldChange{Field: field, Old: o, New: n})
+		}
+	}
+
+	return res
+}
+
+func historyValue(e Event, field EventField) string {
+	switch field {
+	case EventExDates:
+		if len(e.ExDates) == 0 {
+			return ""
+		}
+		v, _ := e.ExDates.Value()
+		return v.(string)
+	case EventAttendees:
+		return e.Attendees.String()
+	case EventTags:
+		return e.Tags.String()
+	case EventReminders:
+		return e.Reminders.String()
+	default:
+		switch v := e.GetFieldValue(field).(type) {
+		case string:
+			return v
+		case time.Time:
+			if v.IsZero() {
+				return ""
+			}
+			return v.UTC().Format(time.DateTime)
+		case time.Duration:
+			if v == 0 {
+				return ""
+			}
+			return v.String()
+		case uuid.UUID:
+			if v == (uuid.UUID{}) {
+				return ""
+			}
+			return v.String()
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+}
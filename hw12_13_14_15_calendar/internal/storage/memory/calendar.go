@@ -0,0 +1,80 @@
+package memorystorage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+func (s *Storage) AddCalendar(_ context.Context, calendar storage.Calendar) (storage.Calendar, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		calendar.ID = uuid.New()
+		_, ok := s.calendars[calendar.ID]
+		if !ok {
+			break
+		}
+	}
+	calendar.Grants = slices.Clone(calendar.Grants)
+	rememberKey(s, s.calendars, calendar.ID)
+	s.calendars[calendar.ID] = calendar
+	return calendar, nil
+}
+
+func (s *Storage) UpdateCalendar(_ context.Context, calendar storage.Calendar) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.calendars[calendar.ID]; !ok {
+		return fmt.Errorf("%w: ID = %s", storage.ErrCalendarNotFound, calendar.ID)
+	}
+	calendar.Grants = slices.Clone(calendar.Grants)
+	rememberKey(s, s.calendars, calendar.ID)
+	s.calendars[calendar.ID] = calendar
+	return nil
+}
+
+func (s *Storage) DeleteCalendar(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.calendars[id]; !ok {
+		return fmt.Errorf("%w: ID = %s", storage.ErrCalendarNotFound, id)
+	}
+	rememberKey(s, s.calendars, id)
+	delete(s.calendars, id)
+	return nil
+}
+
+func (s *Storage) GetCalendar(_ context.Context, id uuid.UUID) (storage.Calendar, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.calendars[id]
+	if !ok {
+		return storage.Calendar{}, fmt.Errorf("%w: ID = %s", storage.ErrCalendarNotFound, id)
+	}
+	return c, nil
+}
+
+// GetCalendars возвращает календари пользователя и календари, к которым ему дан доступ, упорядоченные по имени.
+func (s *Storage) GetCalendars(_ context.Context, userID uuid.UUID) ([]storage.Calendar, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]storage.Calendar, 0)
+	for _, c := range s.calendars {
+		if c.AccessFor(userID) != "" {
+			res = append(res, c)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Name != res[j].Name {
+			return res[i].Name < res[j].Name
+		}
+		return bytes.Compare(res[i].ID[:], res[j].ID[:]) < 0
+	})
+	return res, nil
+}
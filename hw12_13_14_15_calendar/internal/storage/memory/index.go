@@ -0,0 +1,277 @@
+package memorystorage
+
+import (
+	"bytes"
+	"container/heap"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+// timeRange - ограничения на даты события из условий поиска. Нулевые значения - без ограничения.
+type timeRange struct {
+	startFrom time.Time
+	startTo   time.Time
+	endAfter  time.Time
+}
+
+func (r timeRange) contains(n *treeNode) bool {
+	return !n.start.Before(r.startFrom) &&
+		(r.startTo.IsZero() || n.start.Before(r.startTo)) &&
+		(r.endAfter.IsZero() || n.end.After(r.endAfter))
+}
+
+func (r timeRange) isZero() bool {
+	return r.startFrom.IsZero() && r.startTo.IsZero() && r.endAfter.IsZero()
+}
+
+// rangeOf собирает ограничения на даты из условий верхнего уровня. Даты в условиях сравниваются с точностью
+// до секунды, поэтому границы расширены на секунду: индекс должен вернуть все подходящие события, лишние
+// отсеет searchEvent.
+func rangeOf(search []storage.EventCondition) timeRange {
+	var r timeRange
+	for _, cond := range search {
+		t, ok := cond.Sample.(time.Time)
+		if !ok || cond.IsGroup() {
+			continue
+		}
+		lower := cond.Type == storage.TypeMore || cond.Type == storage.TypeMoreOrEq || cond.Type == storage.TypeEq
+		upper := cond.Type == storage.TypeLess || cond.Type == storage.TypeLessOrEq || cond.Type == storage.TypeEq
+		switch cond.Field { //nolint: exhaustive
+		case storage.EventStartDate:
+			if lower && t.Add(-time.Second).After(r.startFrom) {
+				r.startFrom = t.Add(-time.Second)
+			}
+			if upper && (r.startTo.IsZero() || t.Add(time.Second).Before(r.startTo)) {
+				r.startTo = t.Add(time.Second)
+			}
+		case storage.EventEndDate:
+			if lower && t.Add(-time.Second).After(r.endAfter) {
+				r.endAfter = t.Add(-time.Second)
+			}
+		}
+	}
+	return r
+}
+
+// intervalTree - декартово дерево событий, упорядоченное по (StartDate, ID). В узле хранится наибольший
+// EndDate поддерева, поэтому поиск пересечений с периодом не обходит поддеревья, которые целиком закончились.
+type intervalTree struct {
+	root *treeNode
+	size int
+}
+
+type treeNode struct {
+	start    time.Time
+	end      time.Time
+	id       uuid.UUID
+	maxEnd   time.Time
+	priority uint32
+	left     *treeNode
+	right    *treeNode
+}
+
+func nodeLess(start time.Time, id uuid.UUID, n *treeNode) bool {
+	if !start.Equal(n.start) {
+		return start.Before(n.start)
+	}
+	return bytes.Compare(id[:], n.id[:]) < 0
+}
+
+func (n *treeNode) update() {
+	n.maxEnd = n.end
+	if n.left != nil && n.left.maxEnd.After(n.maxEnd) {
+		n.maxEnd = n.left.maxEnd
+	}
+	if n.right != nil && n.right.maxEnd.After(n.maxEnd) {
+		n.maxEnd = n.right.maxEnd
+	}
+}
+
+func (t *intervalTree) insert(event storage.Event) {
+	n := &treeNode{start: event.StartDate, end: event.EndDate, id: event.ID, priority: rand.Uint32()} //nolint: gosec
+	n.maxEnd = n.end
+	t.root = insertNode(t.root, n)
+	t.size++
+}
+
+func insertNode(root, n *treeNode) *treeNode {
+	if root == nil {
+		return n
+	}
+	if n.priority > root.priority {
+		n.left, n.right = split(root, n.start, n.id)
+		n.update()
+		return n
+	}
+	if nodeLess(n.start, n.id, root) {
+		root.left = insertNode(root.left, n)
+	} else {
+		root.right = insertNode(root.right, n)
+	}
+	root.update()
+	return root
+}
+
+// split делит дерево на узлы меньше (start, id) и остальные.
+func split(n *treeNode, start time.Time, id uuid.UUID) (*treeNode, *treeNode) {
+	if n == nil {
+		return nil, nil
+	}
+	if nodeLess(start, id, n) || (start.Equal(n.start) && id == n.id) {
+		l, r := split(n.left, start, id)
+		n.left = r
+		n.update()
+		return l, n
+	}
+	l, r := split(n.right, start, id)
+	n.right = l
+	n.update()
+	return n, r
+}
+
+func merge(l, r *treeNode) *treeNode {
+	if l == nil {
+		return r
+	}
+	if r == nil {
+		return l
+	}
+	if l.priority > r.priority {
+		l.right = merge(l.right, r)
+		l.update()
+		return l
+	}
+	r.left = merge(l, r.left)
+	r.update()
+	return r
+}
+
+func (t *intervalTree) delete(event storage.Event) {
+	var deleted bool
+	t.root, deleted = deleteNode(t.root, event.StartDate, event.ID)
+	if deleted {
+		t.size--
+	}
+}
+
+func deleteNode(n *treeNode, start time.Time, id uuid.UUID) (*treeNode, bool) {
+	if n == nil {
+		return nil, false
+	}
+	if n.id == id && start.Equal(n.start) {
+		return merge(n.left, n.right), true
+	}
+	var deleted bool
+	if nodeLess(start, id, n) {
+		n.left, deleted = deleteNode(n.left, start, id)
+	} else {
+		n.right, deleted = deleteNode(n.right, start, id)
+	}
+	n.update()
+	return n, deleted
+}
+
+// query вызывает fn для событий, попадающих в r, по возрастанию (StartDate, ID).
+func (t *intervalTree) query(r timeRange, fn func(id uuid.UUID)) {
+	queryNode(t.root, r, fn)
+}
+
+func queryNode(n *treeNode, r timeRange, fn func(id uuid.UUID)) {
+	if n == nil || (!r.endAfter.IsZero() && !n.maxEnd.After(r.endAfter)) {
+		return
+	}
+	if !n.start.Before(r.startFrom) {
+		queryNode(n.left, r, fn)
+	}
+	if r.contains(n) {
+		fn(n.id)
+	}
+	if r.startTo.IsZero() || n.start.Before(r.startTo) {
+		queryNode(n.right, r, fn)
+	}
+}
+
+// notifyQueue - куча неотправленных напоминаний по времени отправки, по элементу на напоминание. Повторяющиеся
+// события в неё не попадают: время напоминания у них своё для каждого экземпляра.
+type notifyQueue struct {
+	items []*notifyItem
+	byID  map[uuid.UUID][]*notifyItem
+}
+
+type notifyItem struct {
+	at  time.Time
+	id  uuid.UUID
+	pos int
+}
+
+func newNotifyQueue() *notifyQueue {
+	return &notifyQueue{byID: make(map[uuid.UUID][]*notifyItem)}
+}
+
+func (q *notifyQueue) Len() int           { return len(q.items) }
+func (q *notifyQueue) Less(i, j int) bool { return q.items[i].at.Before(q.items[j].at) }
+
+func (q *notifyQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+	q.items[i].pos = i
+	q.items[j].pos = j
+}
+
+func (q *notifyQueue) Push(x interface{}) {
+	item := x.(*notifyItem)
+	item.pos = len(q.items)
+	q.items = append(q.items, item)
+}
+
+func (q *notifyQueue) Pop() interface{} {
+	item := q.items[len(q.items)-1]
+	q.items[len(q.items)-1] = nil
+	q.items = q.items[:len(q.items)-1]
+	return item
+}
+
+func (q *notifyQueue) add(event storage.Event) {
+	if event.IsTrashed() || event.IsRecurring() {
+		return
+	}
+	for _, r := range event.Reminders {
+		at := event.StartDate.Add(-1 * r.Before)
+		if at.Unix() <= r.NotifiedAt.Unix() {
+			continue
+		}
+		item := &notifyItem{at: at, id: event.ID}
+		q.byID[event.ID] = append(q.byID[event.ID], item)
+		heap.Push(q, item)
+	}
+}
+
+func (q *notifyQueue) remove(id uuid.UUID) {
+	for _, item := range q.byID[id] {
+		heap.Remove(q, item.pos)
+	}
+	delete(q.byID, id)
+}
+
+// due возвращает события, время отправки напоминаний о которых (с точностью до секунды) раньше t, без повторов.
+// Обходятся только такие элементы кучи и их непосредственные потомки.
+func (q *notifyQueue) due(t time.Time) []uuid.UUID {
+	res := make([]uuid.UUID, 0)
+	seen := make(map[uuid.UUID]struct{})
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if i >= len(q.items) || q.items[i].at.Unix() >= t.Unix() {
+			continue
+		}
+		if _, ok := seen[q.items[i].id]; !ok {
+			seen[q.items[i].id] = struct{}{}
+			res = append(res, q.items[i].id)
+		}
+		stack = append(stack, 2*i+1, 2*i+2)
+	}
+	return res
+}
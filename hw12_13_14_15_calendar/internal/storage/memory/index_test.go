@@ -0,0 +1,237 @@
+package memorystorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/app"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+var indexStart = time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// randomEvents создаёт n событий users пользователей длиной до суток в течение года.
+func randomEvents(rnd *rand.Rand, n, users int) []storage.Event {
+	userIDs := make([]uuid.UUID, users)
+	for i := range userIDs {
+		userIDs[i] = uuid.New()
+	}
+	events := make([]storage.Event, n)
+	for i := range events {
+		start := indexStart.Add(time.Duration(rnd.Intn(365*24*60)) * time.Minute)
+		events[i] = storage.Event{
+			ID:        uuid.New(),
+			UserID:    userIDs[rnd.Intn(users)],
+			Title:     "event",
+			StartDate: start,
+			EndDate:   start.Add(time.Duration(rnd.Intn(24*60)) * time.Minute),
+			Reminders: storage.Reminders{{Before: time.Duration(rnd.Intn(60)) * time.Minute}},
+		}
+	}
+	return events
+}
+
+func TestIntervalTree(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1)) //nolint: gosec
+	events := randomEvents(rnd, 2000, 1)
+	tree := &intervalTree{}
+	for _, e := range events {
+		tree.insert(e)
+	}
+	// удаляем каждое третье событие
+	kept := make([]storage.Event, 0, len(events))
+	starts := make(map[uuid.UUID]time.Time)
+	for i, e := range events {
+		if i%3 == 0 {
+			tree.delete(e)
+			continue
+		}
+		kept = append(kept, e)
+		starts[e.ID] = e.StartDate
+	}
+	require.Equal(t, len(kept), tree.size)
+
+	for i := 0; i < 100; i++ {
+		from := indexStart.Add(time.Duration(rnd.Intn(365*24)) * time.Hour)
+		r := timeRange{endAfter: from, startTo: from.Add(time.Duration(rnd.Intn(72)) * time.Hour)}
+		if i%2 == 0 {
+			r = timeRange{startFrom: from, startTo: r.startTo}
+		}
+
+		want := make([]uuid.UUID, 0)
+		for _, e := range kept {
+			if r.contains(&treeNode{start: e.StartDate, end: e.EndDate}) {
+				want = append(want, e.ID)
+			}
+		}
+		got := make([]uuid.UUID, 0)
+		tree.query(r, func(id uuid.UUID) { got = append(got, id) })
+
+		require.ElementsMatch(t, want, got)
+		require.True(t, sort.SliceIsSorted(got, func(i, j int) bool {
+			return nodeLess(starts[got[i]], got[i], &treeNode{start: starts[got[j]], id: got[j]})
+		}))
+	}
+}
+
+func TestNotifyQueue(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2)) //nolint: gosec
+	events := randomEvents(rnd, 1000, 1)
+	q := newNotifyQueue()
+	for i, e := range events {
+		switch i % 4 {
+		case 0:
+			// уже отправленные напоминания в очередь не попадают
+			e.Reminders = storage.Reminders{{Before: e.Reminders[0].Before, NotifiedAt: e.StartDate}}
+		case 1:
+			e.Reminders = append(e.Reminders, storage.Reminder{Before: e.Reminders[0].Before + 30*time.Minute})
+		}
+		events[i] = e
+		q.add(e)
+	}
+	for _, e := range events[:100] {
+		q.remove(e.ID)
+	}
+
+	now := indexStart.Add(180 * 24 * time.Hour)
+	want := make([]uuid.UUID, 0)
+	for i, e := range events {
+		if i < 100 || i%4 == 0 {
+			continue
+		}
+		// событие попадает в результат один раз, даже если пора отправить несколько напоминаний
+		if e.StartDate.Add(-e.Reminders.Earliest()).Unix() < now.Unix() {
+			want = append(want, e.ID)
+		}
+	}
+	require.ElementsMatch(t, want, q.due(now))
+}
+
+func TestIndexesRollback(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	event := storage.Event{
+		ID:        uuid.New(),
+		UserID:    uuid.New(),
+		StartDate: indexStart,
+		EndDate:   indexStart.Add(time.Hour),
+		Attendees: storage.Attendees{{UserID: uuid.New()}},
+		Reminders: storage.Reminders{{Before: 0}},
+	}
+	s.put(event)
+	errFailed := errors.New("failed")
+
+	err := s.WithTx(ctx, func(tx app.Storage) error {
+		moved := event
+		moved.StartDate = indexStart.Add(48 * time.Hour)
+		moved.EndDate = moved.StartDate.Add(time.Hour)
+		require.NoError(t, tx.UpdateEvent(ctx, moved))
+		return errFailed
+	})
+	require.ErrorIs(t, err, errFailed)
+
+	events, err := s.GetEvents(ctx, []storage.EventCondition{
+		{Field: storage.EventAttendees, Type: storage.TypeEq, Sample: event.Attendees[0].UserID},
+		{Field: storage.EventStartDate, Type: storage.TypeLess, Sample: indexStart.Add(time.Hour)},
+	}, nil, storage.Page{})
+	require.NoError(t, err)
+	require.Equal(t, []storage.Event{event}, events)
+	require.Equal(t, 1, s.byTime.size)
+	require.Len(t, s.notify.due(indexStart.Add(-time.Hour)), 0)
+	require.Len(t, s.notify.due(indexStart.Add(time.Second)), 1)
+}
+
+func benchStorage(b *testing.B, n int) (*Storage, uuid.UUID) {
+	b.Helper()
+	rnd := rand.New(rand.NewSource(3)) //nolint: gosec
+	s := New()
+	// у пользователя около сотни событий при любом размере хранилища
+	events := randomEvents(rnd, n, max(n/100, 1))
+	for _, e := range events {
+		s.put(e)
+	}
+	return s, events[0].UserID
+}
+
+var benchSizes = []int{1_000, 10_000, 100_000}
+
+// Время выборок не должно расти пропорционально числу событий в хранилище.
+func BenchmarkGetEventsForPeriod(b *testing.B) {
+	ctx := context.Background()
+	for _, n := range benchSizes {
+		s, userID := benchStorage(b, n)
+		from := indexStart.Add(100 * 24 * time.Hour)
+		filter := []storage.EventCondition{
+			storage.Or(
+				storage.EventCondition{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
+				storage.EventCondition{Field: storage.EventAttendees, Type: storage.TypeEq, Sample: userID},
+			),
+			{Field: storage.EventStartDate, Type: storage.TypeMoreOrEq, Sample: from},
+			{Field: storage.EventStartDate, Type: storage.TypeLessOrEq, Sample: from.Add(7 * 24 * time.Hour)},
+		}
+		order := []storage.EventSort{{Field: storage.EventStartDate, Direction: storage.DirectionAsc}}
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.GetEvents(ctx, filter, order, storage.Page{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetEventsOverlap(b *testing.B) {
+	ctx := context.Background()
+	for _, n := range benchSizes {
+		s, _ := benchStorage(b, n)
+		from := indexStart.Add(100 * 24 * time.Hour)
+		filter := []storage.EventCondition{
+			{Field: storage.EventStartDate, Type: storage.TypeLess, Sample: from.Add(time.Hour)},
+			{Field: storage.EventEndDate, Type: storage.TypeMore, Sample: from},
+		}
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.GetEvents(ctx, filter, nil, storage.Page{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkNotificationNeededEvents(b *testing.B) {
+	ctx := context.Background()
+	for _, n := range benchSizes {
+		s, _ := benchStorage(b, n)
+		now := indexStart.Add(time.Hour)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.NotificationNeededEvents(ctx, now); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetBusyIntervals(b *testing.B) {
+	ctx := context.Background()
+	for _, n := range benchSizes {
+		s, userID := benchStorage(b, n)
+		from := indexStart.Add(100 * 24 * time.Hour)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.GetBusyIntervals(ctx, []uuid.UUID{userID}, from, from.Add(24*time.Hour)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package memorystorage
+
+import (
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+// Snapshot - полная копия данных хранилища, включая события в корзине.
+type Snapshot struct {
+	Events       []storage.Event
+	History      []storage.HistoryRecord
+	Calendars    []storage.Calendar
+	WorkingHours []storage.WorkingHours
+	// Цвета меток, в событиях снимка хранятся только названия меток
+	Tags []UserTag
+}
+
+// UserTag - метка пользователя с её цветом.
+type UserTag struct {
+	UserID uuid.UUID
+	storage.Tag
+}
+
+// Snapshot возвращает копию всех данных хранилища. История упорядочена по ID записей.
+func (s *Storage) Snapshot() Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap := Snapshot{
+		Events:       make([]storage.Event, 0, len(s.data)),
+		History:      make([]storage.HistoryRecord, 0),
+		Calendars:    make([]storage.Calendar, 0, len(s.calendars)),
+		WorkingHours: make([]storage.WorkingHours, 0, len(s.workingHours)),
+		Tags:         make([]UserTag, 0, len(s.tagColors)),
+	}
+	for _, e := range s.data {
+		snap.Events = append(snap.Events, e)
+	}
+	for _, records := range s.history {
+		snap.History = append(snap.History, records...)
+	}
+	sort.Slice(snap.History, func(i, j int) bool { return snap.History[i].ID < snap.History[j].ID })
+	for _, c := range s.calendars {
+		snap.Calendars = append(snap.Calendars, c)
+	}
+	for _, h := range s.workingHours {
+		snap.WorkingHours = append(snap.WorkingHours, h)
+	}
+	for k, color := range s.tagColors {
+		snap.Tags = append(snap.Tags, UserTag{UserID: k.userID, Tag: storage.Tag{Name: k.name, Color: color}})
+	}
+	return snap
+}
+
+// Restore создаёт хранилище с данными из снимка. ID новых записей истории продолжают нумерацию снимка.
+func Restore(snap Snapshot) *Storage {
+	s := New()
+	for _, e := range snap.Events {
+		s.put(e)
+	}
+	for _, r := range snap.History {
+		s.history[r.EventID] = append(s.history[r.EventID], r)
+		s.historyID = max(s.historyID, r.ID)
+	}
+	for _, c := range snap.Calendars {
+		s.calendars[c.ID] = c
+	}
+	for _, h := range snap.WorkingHours {
+		s.workingHours[h.UserID] = h
+	}
+	// цвета из снимка важнее цветов в событиях
+	for _, t := range snap.Tags {
+		s.tagColors[tagKey{userID: t.UserID, name: t.Name}] = t.Color
+	}
+	return s
+}
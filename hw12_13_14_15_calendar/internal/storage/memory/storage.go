@@ -1,140 +1,349 @@
 package memorystorage
 
 import (
+	"context"
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/app"
 	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
 )
 
 type Storage struct {
-	mu   sync.RWMutex
+	mu   locker
 	data map[uuid.UUID]storage.Event
+	// события пользователя, упорядоченные по дате начала, чтобы не перебирать все события при поиске по UserID
+	byUser map[uuid.UUID]*intervalTree
+	// все события по дате начала - для поиска по периоду без UserID
+	byTime     *intervalTree
+	byAttendee map[uuid.UUID]map[uuid.UUID]struct{}
+	byCalendar map[uuid.UUID]map[uuid.UUID]struct{}
+	recurring  map[uuid.UUID]struct{}
+	// очередь неотправленных уведомлений о неповторяющихся событиях
+	notify *notifyQueue
+	// индекс слов из названия и описания для полнотекстового поиска
+	byToken map[string]map[uuid.UUID]struct{}
+	byTag   map[string]map[uuid.UUID]struct{}
+	// цвета меток по владельцу и названию метки, в событиях хранятся только названия
+	tagColors map[tagKey]string
+	// журнал изменений по ID события
+	history   map[uuid.UUID][]storage.HistoryRecord
+	historyID int64
+	calendars map[uuid.UUID]storage.Calendar
+	// рабочее время по ID пользователя
+	workingHours map[uuid.UUID]storage.WorkingHours
+	// журнал отмены изменений, если хранилище используется внутри WithTx
+	undo *[]func()
 }
 
+type tagKey struct {
+	userID uuid.UUID
+	name   string
+}
+
+type locker interface {
+	Lock()
+	Unlock()
+	RLock()
+	RUnlock()
+}
+
+// noLock - внутри WithTx блокировка уже взята на всю транзакцию.
+type noLock struct{}
+
+func (noLock) Lock()    {}
+func (noLock) Unlock()  {}
+func (noLock) RLock()   {}
+func (noLock) RUnlock() {}
+
 func New() *Storage {
-	return &Storage{data: make(map[uuid.UUID]storage.Event)}
+	return &Storage{
+		mu:           &sync.RWMutex{},
+		data:         make(map[uuid.UUID]storage.Event),
+		byUser:       make(map[uuid.UUID]*intervalTree),
+		byTime:       &intervalTree{},
+		byAttendee:   make(map[uuid.UUID]map[uuid.UUID]struct{}),
+		byCalendar:   make(map[uuid.UUID]map[uuid.UUID]struct{}),
+		recurring:    make(map[uuid.UUID]struct{}),
+		notify:       newNotifyQueue(),
+		byToken:      make(map[string]map[uuid.UUID]struct{}),
+		byTag:        make(map[string]map[uuid.UUID]struct{}),
+		tagColors:    make(map[tagKey]string),
+		history:      make(map[uuid.UUID][]storage.HistoryRecord),
+		calendars:    make(map[uuid.UUID]storage.Calendar),
+		workingHours: make(map[uuid.UUID]storage.WorkingHours),
+	}
 }
 
-func (s *Storage) AddEvent(event storage.Event) (storage.Event, error) {
+// WithTx выполняет fn под одной блокировкой: если fn вернула ошибку, все её изменения откатываются.
+// Внутри уже открытой транзакции fn выполняется в ней же.
+func (s *Storage) WithTx(_ context.Context, fn func(tx app.Storage) error) error {
+	if s.undo != nil {
+		return fn(s)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	for {
+	tx := *s
+	tx.mu = noLock{}
+	tx.undo = &[]func(){}
+	if err := fn(&tx); err != nil {
+		undo := *tx.undo
+		tx.undo = nil
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+		return err
+	}
+	s.historyID = tx.historyID
+
+	return nil
+}
+
+// LockUser ничего не делает: WithTx и так выполняется под общей блокировкой хранилища.
+func (s *Storage) LockUser(context.Context, uuid.UUID) error {
+	return nil
+}
+
+func (s *Storage) onRollback(fn func()) {
+	if s.undo != nil {
+		*s.undo = append(*s.undo, fn)
+	}
+}
+
+// rememberKey запоминает значение по ключу, чтобы восстановить его при откате транзакции.
+func rememberKey[K comparable, V any](s *Storage, m map[K]V, key K) {
+	if s.undo == nil {
+		return
+	}
+	prev, ok := m[key]
+	s.onRollback(func() {
+		if ok {
+			m[key] = prev
+		} else {
+			delete(m, key)
+		}
+	})
+}
+
+// AddEvent сохраняет событие, ID генерируется, если не задан.
+func (s *Storage) AddEvent(_ context.Context, event storage.Event) (storage.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[event.ID]; ok {
+		return storage.Event{}, fmt.Errorf("%w: ID = %s", storage.ErrEventExists, event.ID)
+	}
+	for event.ID == (uuid.UUID{}) {
 		event.ID = uuid.New()
-		_, ok := s.data[event.ID]
-		if !ok {
-			break
+		if _, ok := s.data[event.ID]; ok {
+			event.ID = uuid.UUID{}
 		}
 	}
+	event.Version = 1
 
-	s.data[event.ID] = event
-	return event, nil
+	s.put(event)
+	return s.withColors(s.data[event.ID]), nil
 }
 
-func (s *Storage) UpdateEvent(event storage.Event) error {
+func (s *Storage) UpdateEvent(_ context.Context, event storage.Event) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	_, ok := s.data[event.ID]
+	stored, ok := s.data[event.ID]
 	if !ok {
 		return fmt.Errorf("%w: ID = %s", storage.ErrEventNotFound, event.ID)
 	}
-	s.data[event.ID] = event
+	if stored.Version != event.Version {
+		return fmt.Errorf("%w: ID = %s, version = %d", storage.ErrVersionConflict, event.ID, event.Version)
+	}
+	event.Version++
+	s.put(event)
 	return nil
 }
 
-func (s *Storage) DeleteEvent(id uuid.UUID) error {
+// DeleteEvent удаляет событие, если его версия совпадает с version. Нулевая версия - удаление без проверки.
+func (s *Storage) DeleteEvent(_ context.Context, id uuid.UUID, version int64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	_, ok := s.data[id]
+	stored, ok := s.data[id]
 	if !ok {
 		return fmt.Errorf("%w: ID = %s", storage.ErrEventNotFound, id)
 	}
-	delete(s.data, id)
+	if version != 0 && stored.Version != version {
+		return fmt.Errorf("%w: ID = %s, version = %d", storage.ErrVersionConflict, id, version)
+	}
+	s.remove(id)
 	return nil
 }
 
-func (s *Storage) GetEvent(id uuid.UUID) (storage.Event, error) {
+// TrashEvent перемещает событие в корзину, если его версия совпадает с version (0 - без проверки).
+func (s *Storage) TrashEvent(_ context.Context, id uuid.UUID, version int64, deletedAt time.Time) error {
+	return s.setDeletedAt(id, version, deletedAt)
+}
+
+// RestoreEvent возвращает событие из корзины, если его версия совпадает с version (0 - без проверки).
+func (s *Storage) RestoreEvent(_ context.Context, id uuid.UUID, version int64) error {
+	return s.setDeletedAt(id, version, time.Time{})
+}
+
+func (s *Storage) setDeletedAt(id uuid.UUID, version int64, deletedAt time.Time) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	stored, ok := s.data[id]
+	if !ok {
+		return fmt.Errorf("%w: ID = %s", storage.ErrEventNotFound, id)
+	}
+	if version != 0 && stored.Version != version {
+		return fmt.Errorf("%w: ID = %s, version = %d", storage.ErrVersionConflict, id, version)
+	}
+	stored.DeletedAt = deletedAt
+	stored.Version++
+	s.put(stored)
+	return nil
+}
+
+// SetAttendeeStatus меняет ответ участника на приглашение, версия события при этом не меняется.
+func (s *Storage) SetAttendeeStatus(
+	_ context.Context,
+	eventID uuid.UUID,
+	userID uuid.UUID,
+	status storage.RSVPStatus,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.data[eventID]
+	if !ok {
+		return fmt.Errorf("%w: ID = %s", storage.ErrEventNotFound, eventID)
+	}
+	i := slices.IndexFunc(stored.Attendees, func(a storage.Attendee) bool { return a.UserID == userID })
+	if i < 0 {
+		return fmt.Errorf("%w: event ID = %s, user ID = %s", storage.ErrAttendeeNotFound, eventID, userID)
+	}
+	stored.Attendees = slices.Clone(stored.Attendees)
+	stored.Attendees[i].Status = status
+	s.put(stored)
+	return nil
+}
+
+func (s *Storage) GetEvent(_ context.Context, id uuid.UUID) (storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	e, ok := s.data[id]
 	if !ok {
 		return storage.Event{}, fmt.Errorf("%w: ID = %s", storage.ErrEventNotFound, id)
 	}
-	return e, nil
+	return s.withColors(e), nil
 }
 
-func (s *Storage) DeleteEvents(search []storage.EventCondition) (int64, error) {
+func (s *Storage) DeleteEvents(_ context.Context, search []storage.EventCondition) (int64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	toDelete := make([]uuid.UUID, 0)
-	for k, v := range s.data {
+	for _, v := range s.candidates(search) {
 		b, err := searchEvent(v, search)
 		if err != nil {
 			return 0, err
 		}
 		if b {
-			toDelete = append(toDelete, k)
+			toDelete = append(toDelete, v.ID)
 		}
 	}
 	for _, k := range toDelete {
-		delete(s.data, k)
+		s.remove(k)
 	}
 
 	return int64(len(toDelete)), nil
 }
 
-func (s *Storage) SetEventsNotified(ids []uuid.UUID, notified time.Time) error {
-	for _, id := range ids {
-		if event, ok := s.data[id]; ok {
-			event.NotifiedAt = notified
-			s.data[id] = event
+// SetRemindersNotified отмечает время отправки напоминаний, версия событий при этом не меняется.
+func (s *Storage) SetRemindersNotified(_ context.Context, keys []storage.ReminderKey, notified time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		event, ok := s.data[key.EventID]
+		if !ok {
+			continue
+		}
+		i := slices.IndexFunc(event.Reminders, func(r storage.Reminder) bool { return r.Before == key.Before })
+		if i < 0 {
+			continue
 		}
+		event.Reminders = slices.Clone(event.Reminders)
+		event.Reminders[i].NotifiedAt = notified
+		s.put(event)
 	}
 
 	return nil
 }
 
-func (s *Storage) NotificationNeededEvents(t time.Time) ([]storage.Event, error) {
-	res := make([]storage.Event, 0)
-	var timeToNotify int64
-	for _, event := range s.data {
-		timeToNotify = event.StartDate.Add(-1 * event.NotifyBefore).Unix()
-		// Если время нотификации прошло, и прошлая нотификация была раньше этого времени,
-		// то нужно отправлять новую нотификацию
-		if timeToNotify < t.Unix() && timeToNotify > event.NotifiedAt.Unix() {
-			res = append(res, event)
+// NotificationNeededEvents возвращает напоминания, время отправки которых наступило. Время сравнивается
+// с точностью до секунды, так же как в sqlstorage.
+func (s *Storage) NotificationNeededEvents(_ context.Context, t time.Time) ([]storage.Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]storage.Notification, 0)
+	// у неповторяющихся событий кандидаты - из очереди, у повторяющихся время напоминания своё у каждого экземпляра
+	ids := s.notify.due(t)
+	for id := range s.recurring {
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		notifications, err := s.withColors(s.data[id]).PendingNotifications(t)
+		if err != nil {
+			return nil, err
 		}
+		res = append(res, notifications...)
 	}
 
 	return res, nil
 }
 
-func (s *Storage) GetEvents(search []storage.EventCondition, order []storage.EventSort) ([]storage.Event, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// GetEvents возвращает события по условиям. При постраничной выборке порядок сортировки всегда (StartDate, ID).
+func (s *Storage) GetEvents(
+	_ context.Context,
+	search []storage.EventCondition,
+	order []storage.EventSort,
+	page storage.Page,
+) ([]storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	result := make([]storage.Event, 0, len(s.data))
-	for _, v := range s.data {
+	search = storage.WithoutTrashed(search)
+	candidates := s.candidates(search)
+	result := make([]storage.Event, 0, len(candidates))
+	for _, v := range candidates {
 		b, err := searchEvent(v, search)
 		if err != nil {
 			return []storage.Event{}, err
 		}
-		if b {
-			result = append(result, v)
+		if b && page.After.Before(v) {
+			result = append(result, s.withColors(v))
 		}
 	}
 
+	if !page.IsZero() {
+		sort.Slice(result, func(i, j int) bool {
+			return storage.CursorOf(result[i]).Before(result[j])
+		})
+		if page.Limit > 0 && len(result) > page.Limit {
+			result = result[:page.Limit]
+		}
+		return result, nil
+	}
+
 	if len(order) != 0 {
 		lessComp := func(a interface{}, b interface{}) bool {
 			switch a := a.(type) {
 			case int:
 				return a < b.(int)
+			case int64:
+				return a < b.(int64)
 			case string:
 				return strings.Compare(a, b.(string)) == -1
 			case time.Time:
@@ -163,6 +372,269 @@ func (s *Storage) GetEvents(search []storage.EventCondition, order []storage.Eve
 	return result, nil
 }
 
+func (s *Storage) AddHistory(_ context.Context, record storage.HistoryRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.historyID++
+	record.ID = s.historyID
+	rememberKey(s, s.history, record.EventID)
+	s.history[record.EventID] = append(s.history[record.EventID], record)
+	return nil
+}
+
+func (s *Storage) GetHistory(_ context.Context, eventID uuid.UUID) ([]storage.HistoryRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]storage.HistoryRecord, len(s.history[eventID]))
+	copy(res, s.history[eventID])
+	return res, nil
+}
+
+func (s *Storage) put(event storage.Event) {
+	old, ok := s.data[event.ID]
+	s.onRollback(func() {
+		if ok {
+			s.put(old)
+		} else {
+			s.remove(event.ID)
+		}
+	})
+	if ok {
+		s.unindex(old)
+	}
+	// участники и напоминания не должны меняться через копии события, полученные снаружи
+	event.Attendees = slices.Clone(event.Attendees)
+	event.Reminders = slices.Clone(event.Reminders)
+	event.Tags = s.putTags(event.UserID, event.Tags)
+	s.data[event.ID] = event
+	tree, exists := s.byUser[event.UserID]
+	if !exists {
+		tree = &intervalTree{}
+		s.byUser[event.UserID] = tree
+	}
+	tree.insert(event)
+	s.byTime.insert(event)
+	for _, a := range event.Attendees {
+		addToIndex(s.byAttendee, a.UserID, event.ID)
+	}
+	addToIndex(s.byCalendar, event.CalendarID, event.ID)
+	if event.IsRecurring() {
+		s.recurring[event.ID] = struct{}{}
+	}
+	s.notify.add(event)
+	for _, token := range storage.Tokenize(event.Title + " " + event.Description) {
+		addToIndex(s.byToken, token, event.ID)
+	}
+	for _, tag := range event.Tags {
+		addToIndex(s.byTag, tag.Name, event.ID)
+	}
+}
+
+// putTags сохраняет заданные цвета меток владельца и возвращает метки без цветов для хранения в событии.
+func (s *Storage) putTags(userID uuid.UUID, tags storage.Tags) storage.Tags {
+	if len(tags) == 0 {
+		return nil
+	}
+	res := make(storage.Tags, len(tags))
+	for i, tag := range tags {
+		res[i] = storage.Tag{Name: tag.Name}
+		if tag.Color == "" {
+			continue
+		}
+		key := tagKey{userID: userID, name: tag.Name}
+		rememberKey(s, s.tagColors, key)
+		s.tagColors[key] = tag.Color
+	}
+	return res
+}
+
+// withColors возвращает событие с текущими цветами меток владельца.
+func (s *Storage) withColors(event storage.Event) storage.Event {
+	if len(event.Tags) == 0 {
+		return event
+	}
+	tags := make(storage.Tags, len(event.Tags))
+	for i, tag := range event.Tags {
+		tags[i] = storage.Tag{Name: tag.Name, Color: s.tagColors[tagKey{userID: event.UserID, name: tag.Name}]}
+	}
+	event.Tags = tags
+	return event
+}
+
+func (s *Storage) remove(id uuid.UUID) {
+	event, ok := s.data[id]
+	if !ok {
+		return
+	}
+	s.onRollback(func() { s.put(event) })
+	delete(s.data, id)
+	s.unindex(event)
+}
+
+func (s *Storage) unindex(event storage.Event) {
+	if tree, ok := s.byUser[event.UserID]; ok {
+		tree.delete(event)
+		if tree.size == 0 {
+			delete(s.byUser, event.UserID)
+		}
+	}
+	s.byTime.delete(event)
+	for _, a := range event.Attendees {
+		removeFromIndex(s.byAttendee, a.UserID, event.ID)
+	}
+	removeFromIndex(s.byCalendar, event.CalendarID, event.ID)
+	delete(s.recurring, event.ID)
+	s.notify.remove(event.ID)
+	for _, token := range storage.Tokenize(event.Title + " " + event.Description) {
+		removeFromIndex(s.byToken, token, event.ID)
+	}
+	for _, tag := range event.Tags {
+		removeFromIndex(s.byTag, tag.Name, event.ID)
+	}
+}
+
+func addToIndex[K comparable](index map[K]map[uuid.UUID]struct{}, key K, id uuid.UUID) {
+	ids, ok := index[key]
+	if !ok {
+		ids = make(map[uuid.UUID]struct{})
+		index[key] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func removeFromIndex[K comparable](index map[K]map[uuid.UUID]struct{}, key K, id uuid.UUID) {
+	ids := index[key]
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(index, key)
+	}
+}
+
+// candidates возвращает события, среди которых имеет смысл искать по условиям: пересечение индексов по условиям
+// верхнего уровня (UserID, участник, календарь, метка, повторяемость, полнотекстовый поиск и группа Or из таких
+// условий) с учётом ограничений на даты. Если ни одно условие не покрывается индексами, ищем по периоду или по всем
+// событиям.
+func (s *Storage) candidates(search []storage.EventCondition) []storage.Event {
+	r := rangeOf(search)
+	var ids map[uuid.UUID]struct{}
+	indexed := false
+	for _, cond := range search {
+		found, ok := s.lookup(cond, r)
+		if !ok {
+			continue
+		}
+		if !indexed {
+			ids = found
+			indexed = true
+			continue
+		}
+		ids = intersect(ids, found)
+	}
+
+	if !indexed && !r.isZero() {
+		ids = make(map[uuid.UUID]struct{})
+		s.byTime.query(r, func(id uuid.UUID) { ids[id] = struct{}{} })
+		indexed = true
+	}
+
+	if !indexed {
+		res := make([]storage.Event, 0, len(s.data))
+		for _, v := range s.data {
+			res = append(res, v)
+		}
+		return res
+	}
+
+	res := make([]storage.Event, 0, len(ids))
+	for id := range ids {
+		res = append(res, s.data[id])
+	}
+	return res
+}
+
+// lookup возвращает ID событий, которые могут удовлетворять условию, если для него есть индекс.
+func (s *Storage) lookup(cond storage.EventCondition, r timeRange) (map[uuid.UUID]struct{}, bool) {
+	switch {
+	case cond.Type == storage.TypeOr:
+		res := make(map[uuid.UUID]struct{})
+		for _, c := range cond.Conditions {
+			found, ok := s.lookup(c, r)
+			if !ok {
+				return nil, false
+			}
+			for id := range found {
+				res[id] = struct{}{}
+			}
+		}
+		return res, true
+	case cond.Field == storage.EventUserID && cond.Type == storage.TypeEq:
+		userID, ok := cond.Sample.(uuid.UUID)
+		if !ok {
+			return nil, false
+		}
+		res := make(map[uuid.UUID]struct{})
+		if tree, ok := s.byUser[userID]; ok {
+			tree.query(r, func(id uuid.UUID) { res[id] = struct{}{} })
+		}
+		return res, true
+	case cond.Field == storage.EventAttendees && cond.Type == storage.TypeEq:
+		userID, ok := cond.Sample.(uuid.UUID)
+		return s.byAttendee[userID], ok
+	case cond.Field == storage.EventCalendarID && cond.Type == storage.TypeEq:
+		calendarID, ok := cond.Sample.(uuid.UUID)
+		return s.byCalendar[calendarID], ok
+	case cond.Field == storage.EventCalendarID && cond.Type == storage.TypeIn:
+		calendarIDs, ok := cond.Sample.([]uuid.UUID)
+		if !ok {
+			return nil, false
+		}
+		res := make(map[uuid.UUID]struct{})
+		for _, calendarID := range calendarIDs {
+			for id := range s.byCalendar[calendarID] {
+				res[id] = struct{}{}
+			}
+		}
+		return res, true
+	case cond.Field == storage.EventTags && cond.Type == storage.TypeEq:
+		name, ok := cond.Sample.(string)
+		return s.byTag[name], ok
+	case cond.Field == storage.EventRRule && cond.Type == storage.TypeNotEq && cond.Sample == "":
+		return s.recurring, true
+	case cond.Type == storage.TypeMatch:
+		query, ok := cond.Sample.(string)
+		if !ok {
+			return nil, false
+		}
+		return s.matchTokens(storage.Tokenize(query)), true
+	}
+	return nil, false
+}
+
+// matchTokens возвращает ID событий, содержащих все слова.
+func (s *Storage) matchTokens(tokens []string) map[uuid.UUID]struct{} {
+	if len(tokens) == 0 {
+		return nil
+	}
+	res := s.byToken[tokens[0]]
+	for _, token := range tokens[1:] {
+		res = intersect(res, s.byToken[token])
+	}
+	return res
+}
+
+func intersect(a, b map[uuid.UUID]struct{}) map[uuid.UUID]struct{} {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	res := make(map[uuid.UUID]struct{}, len(a))
+	for id := range a {
+		if _, ok := b[id]; ok {
+			res[id] = struct{}{}
+		}
+	}
+	return res
+}
+
 func searchEvent(event storage.Event, search []storage.EventCondition) (bool, error) {
 	for _, s := range search {
 		b, err := applyCondition(event, s)
@@ -177,14 +649,17 @@ func searchEvent(event storage.Event, search []storage.EventCondition) (bool, er
 }
 
 func applyCondition(event storage.Event, cond storage.EventCondition) (bool, error) {
+	if cond.IsGroup() {
+		return applyGroup(event, cond)
+	}
 	val := event.GetFieldValue(cond.Field)
 
 	// Тут бы со стратегиями и т.п. но очень не хватает времени это всё закодить
 	switch cond.Type {
 	case storage.TypeEq:
-		return val == cond.Sample, nil
+		return eqCmp(val, cond.Sample), nil
 	case storage.TypeNotEq:
-		return val != cond.Sample, nil
+		return !eqCmp(val, cond.Sample), nil
 	case storage.TypeLess:
 		return lessCmp(val, cond.Sample)
 	case storage.TypeLessOrEq:
@@ -201,15 +676,59 @@ func applyCondition(event storage.Event, cond storage.EventCondition) (bool, err
 			return false, err
 		}
 		return !res, nil
+	case storage.TypeMatch:
+		return matchCmp(val, cond.Sample)
 	default:
 		return false, fmt.Errorf("%w: '%s'", storage.ErrUnknownCondition, cond.Type)
 	}
 }
 
+// applyGroup вычисляет группу условий так же, как sqlstorage: пустой AND истинен, пустой OR ложен.
+func applyGroup(event storage.Event, cond storage.EventCondition) (bool, error) {
+	switch cond.Type { //nolint: exhaustive
+	case storage.TypeOr:
+		for _, c := range cond.Conditions {
+			b, err := applyCondition(event, c)
+			if err != nil {
+				return false, err
+			}
+			if b {
+				return true, nil
+			}
+		}
+		return false, nil
+	case storage.TypeNot:
+		b, err := searchEvent(event, cond.Conditions)
+		return !b, err
+	default:
+		return searchEvent(event, cond.Conditions)
+	}
+}
+
+// eqCmp сравнивает значения, для участников и меток события - проверяет, что пользователь (метка) есть среди них.
+func eqCmp(val, sample interface{}) bool {
+	if attendees, ok := val.(storage.Attendees); ok {
+		userID, ok := sample.(uuid.UUID)
+		return ok && attendees.Contains(userID)
+	}
+	if tags, ok := val.(storage.Tags); ok {
+		name, ok := sample.(string)
+		return ok && tags.Contains(name)
+	}
+	// даты, как и в остальных сравнениях, с точностью до секунды и без учёта пояса
+	if v, ok := val.(time.Time); ok {
+		t, ok := sample.(time.Time)
+		return ok && v.Unix() == t.Unix()
+	}
+	return val == sample
+}
+
 func lessCmp(val, sample interface{}) (bool, error) {
 	switch v := val.(type) {
 	case int:
 		return v < sample.(int), nil
+	case int64:
+		return v < sample.(int64), nil
 	case time.Time:
 		return v.Unix() < sample.(time.Time).Unix(), nil
 	default:
@@ -221,6 +740,8 @@ func lessOrEqCmp(val, sample interface{}) (bool, error) {
 	switch v := val.(type) {
 	case int:
 		return v <= sample.(int), nil
+	case int64:
+		return v <= sample.(int64), nil
 	case time.Time:
 		return v.Unix() <= sample.(time.Time).Unix(), nil
 	default:
@@ -232,6 +753,8 @@ func moreCmp(val, sample interface{}) (bool, error) {
 	switch v := val.(type) {
 	case int:
 		return v > sample.(int), nil
+	case int64:
+		return v > sample.(int64), nil
 	case time.Time:
 		return v.Unix() > sample.(time.Time).Unix(), nil
 	default:
@@ -243,6 +766,8 @@ func moreOrEqCmp(val, sample interface{}) (bool, error) {
 	switch v := val.(type) {
 	case int:
 		return v >= sample.(int), nil
+	case int64:
+		return v >= sample.(int64), nil
 	case time.Time:
 		return v.Unix() >= sample.(time.Time).Unix(), nil
 	default:
@@ -275,3 +800,96 @@ func inCmp(val, sample interface{}) (bool, error) {
 	}
 	return false, nil
 }
+
+func matchCmp(val, sample interface{}) (bool, error) {
+	text, ok := val.(string)
+	if !ok {
+		return false, fmt.Errorf("%w: %T", storage.ErrIncomparableType, val)
+	}
+	query, ok := sample.(string)
+	if !ok {
+		return false, fmt.Errorf("%w: %T", storage.ErrIncomparableType, sample)
+	}
+
+	tokens := storage.Tokenize(query)
+	if len(tokens) == 0 {
+		return false, nil
+	}
+	words := make(map[string]struct{})
+	for _, w := range storage.Tokenize(text) {
+		words[w] = struct{}{}
+	}
+	for _, t := range tokens {
+		if _, ok := words[t]; !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// GetBusyIntervals возвращает объединённые занятые интервалы пользователей в периоде [from, to).
+func (s *Storage) GetBusyIntervals(
+	_ context.Context,
+	userIDs []uuid.UUID,
+	from, to time.Time,
+) (map[uuid.UUID][]storage.Interval, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res := make(map[uuid.UUID][]storage.Interval, len(userIDs))
+	for _, id := range userIDs {
+		res[id] = nil
+	}
+	for _, event := range s.busyCandidates(userIDs, from, to) {
+		if event.IsTrashed() || !event.StartDate.Before(to) {
+			continue
+		}
+		if !event.IsRecurring() && !event.EndDate.After(from) {
+			continue
+		}
+		var intervals []storage.Interval
+		for _, userID := range event.BusyOf() {
+			if _, ok := res[userID]; !ok {
+				continue
+			}
+			if intervals == nil {
+				var err error
+				if intervals, err = event.BusyIntervals(from, to); err != nil {
+					return nil, err
+				}
+			}
+			res[userID] = append(res[userID], intervals...)
+		}
+	}
+	for id, intervals := range res {
+		res[id] = storage.MergeIntervals(intervals)
+	}
+
+	return res, nil
+}
+
+// busyCandidates возвращает события пользователей, которые могут пересекаться с периодом [from, to): свои события
+// из дерева по периоду, повторяющиеся события и события, куда пользователи приглашены.
+func (s *Storage) busyCandidates(userIDs []uuid.UUID, from, to time.Time) []storage.Event {
+	ids := make(map[uuid.UUID]struct{})
+	r := timeRange{startTo: to, endAfter: from}
+	for _, userID := range userIDs {
+		if tree, ok := s.byUser[userID]; ok {
+			tree.query(r, func(id uuid.UUID) { ids[id] = struct{}{} })
+		}
+		for id := range s.byAttendee[userID] {
+			ids[id] = struct{}{}
+		}
+	}
+	for id := range s.recurring {
+		if slices.Contains(userIDs, s.data[id].UserID) {
+			ids[id] = struct{}{}
+		}
+	}
+
+	res := make([]storage.Event, 0, len(ids))
+	for id := range ids {
+		res = append(res, s.data[id])
+	}
+	return res
+}
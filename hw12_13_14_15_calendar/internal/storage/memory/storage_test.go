@@ -1,150 +1,233 @@
 package memorystorage
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/app"
 	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
 	"github.com/stretchr/testify/require"
 )
 
 func TestGetEvent(t *testing.T) {
+	ctx := context.Background()
 	id := uuid.New()
 	nonexistentID := uuid.New()
 	event := storage.Event{
-		ID:           id,
-		Title:        "1 hour later, duration 15 minutes",
-		StartDate:    time.Now().Add(time.Hour),
-		EndDate:      time.Now().Add(75 * time.Minute),
-		Description:  "First event desc",
-		UserID:       uuid.New(),
-		NotifyBefore: time.Hour,
+		ID:          id,
+		Title:       "1 hour later, duration 15 minutes",
+		StartDate:   time.Now().Add(time.Hour),
+		EndDate:     time.Now().Add(75 * time.Minute),
+		Description: "First event desc",
+		UserID:      uuid.New(),
+		Reminders:   storage.Reminders{{Before: time.Hour}},
 	}
 
 	s := New()
-	s.data[event.ID] = event
+	s.put(event)
 
-	ev, err := s.GetEvent(id)
+	ev, err := s.GetEvent(ctx, id)
 	require.NoError(t, err)
 	require.Equal(t, event, ev)
 
-	_, err = s.GetEvent(nonexistentID)
+	_, err = s.GetEvent(ctx, nonexistentID)
 	require.Error(t, err)
 	require.ErrorIs(t, err, storage.ErrEventNotFound)
 }
 
 func TestAddEvent(t *testing.T) {
+	ctx := context.Background()
 	event := storage.Event{
-		Title:        "1 hour later, duration 15 minutes",
-		StartDate:    time.Now().Add(time.Hour),
-		EndDate:      time.Now().Add(75 * time.Minute),
-		Description:  "First event desc",
-		UserID:       uuid.New(),
-		NotifyBefore: time.Hour,
+		Title:       "1 hour later, duration 15 minutes",
+		StartDate:   time.Now().Add(time.Hour),
+		EndDate:     time.Now().Add(75 * time.Minute),
+		Description: "First event desc",
+		UserID:      uuid.New(),
+		Reminders:   storage.Reminders{{Before: time.Hour}},
 	}
 
 	s := New()
 	require.Equal(t, 0, len(s.data))
 
-	res, err := s.AddEvent(event)
+	res, err := s.AddEvent(ctx, event)
 	require.NoError(t, err)
 	require.Equal(t, 1, len(s.data))
 	event.ID = res.ID
+	event.Version = 1
 	require.Equal(t, event, s.data[res.ID])
 	require.Equal(t, event, res)
 
-	// Повторное добавление такого же ивента приводит к дублированию данных с под новым ID
-	res, err = s.AddEvent(event)
+	// Повторное добавление такого же ивента без ID приводит к дублированию данных с под новым ID
+	event2 := event
+	event2.ID = uuid.UUID{}
+	res, err = s.AddEvent(ctx, event2)
 	require.NoError(t, err)
 	require.Equal(t, 2, len(s.data))
-	event2 := event
 	event2.ID = res.ID
 	require.Equal(t, event2, s.data[res.ID])
 	require.Equal(t, event2, res)
+
+	// Заданный ID сохраняется, повторно добавить событие с тем же ID нельзя
+	event3 := event
+	event3.ID = uuid.New()
+	res, err = s.AddEvent(ctx, event3)
+	require.NoError(t, err)
+	require.Equal(t, event3, res)
+	_, err = s.AddEvent(ctx, event3)
+	require.ErrorIs(t, err, storage.ErrEventExists)
+	require.Equal(t, 3, len(s.data))
 }
 
 func TestUpdateEvent(t *testing.T) {
+	ctx := context.Background()
 	event := storage.Event{
-		ID:           uuid.New(),
-		Title:        "1 hour later, duration 15 minutes",
-		StartDate:    time.Now().Add(time.Hour),
-		EndDate:      time.Now().Add(75 * time.Minute),
-		Description:  "First event",
-		UserID:       uuid.New(),
-		NotifyBefore: time.Hour,
+		ID:          uuid.New(),
+		Title:       "1 hour later, duration 15 minutes",
+		StartDate:   time.Now().Add(time.Hour),
+		EndDate:     time.Now().Add(75 * time.Minute),
+		Description: "First event",
+		UserID:      uuid.New(),
+		Reminders:   storage.Reminders{{Before: time.Hour}},
 	}
 
 	nonexistentEvent := storage.Event{
-		ID:           uuid.New(),
-		Title:        "1 day later, duration 1 hour",
-		StartDate:    time.Now().Add(24 * time.Hour),
-		EndDate:      time.Now().Add(25 * time.Hour),
-		Description:  "Nonexistent event",
-		UserID:       uuid.New(),
-		NotifyBefore: time.Hour,
+		ID:          uuid.New(),
+		Title:       "1 day later, duration 1 hour",
+		StartDate:   time.Now().Add(24 * time.Hour),
+		EndDate:     time.Now().Add(25 * time.Hour),
+		Description: "Nonexistent event",
+		UserID:      uuid.New(),
+		Reminders:   storage.Reminders{{Before: time.Hour}},
 	}
 
 	s := New()
-	s.data[event.ID] = event
+	s.put(event)
 
 	updatedEvent := event
 	updatedEvent.StartDate = updatedEvent.StartDate.AddDate(0, 0, 1)
 	updatedEvent.EndDate = updatedEvent.EndDate.AddDate(0, 0, 1)
 	updatedEvent.Title = "Updated event"
-	updatedEvent.NotifyBefore = 0
-	err := s.UpdateEvent(updatedEvent)
+	updatedEvent.Reminders = storage.Reminders{{Before: 0}}
+	err := s.UpdateEvent(ctx, updatedEvent)
 	require.NoError(t, err)
+	updatedEvent.Version++
+	require.Equal(t, updatedEvent, s.data[event.ID])
+
+	// Изменение устаревшей версии не проходит
+	staleEvent := event
+	staleEvent.Title = "Stale event"
+	err = s.UpdateEvent(ctx, staleEvent)
+	require.ErrorIs(t, err, storage.ErrVersionConflict)
 	require.Equal(t, updatedEvent, s.data[event.ID])
 
-	err = s.UpdateEvent(nonexistentEvent)
+	err = s.UpdateEvent(ctx, nonexistentEvent)
 	require.Error(t, err)
 	require.ErrorIs(t, err, storage.ErrEventNotFound)
 }
 
 func TestDeleteEvent(t *testing.T) {
+	ctx := context.Background()
 	event := storage.Event{
-		ID:           uuid.New(),
-		Title:        "1 hour later, duration 15 minutes",
-		StartDate:    time.Now().Add(time.Hour),
-		EndDate:      time.Now().Add(75 * time.Minute),
-		Description:  "First event",
-		UserID:       uuid.New(),
-		NotifyBefore: time.Hour,
+		ID:          uuid.New(),
+		Title:       "1 hour later, duration 15 minutes",
+		StartDate:   time.Now().Add(time.Hour),
+		EndDate:     time.Now().Add(75 * time.Minute),
+		Description: "First event",
+		UserID:      uuid.New(),
+		Reminders:   storage.Reminders{{Before: time.Hour}},
 	}
 
 	event2 := storage.Event{
-		ID:           uuid.New(),
-		Title:        "1 day later, duration 1 hour",
-		StartDate:    time.Now().Add(24 * time.Hour),
-		EndDate:      time.Now().Add(25 * time.Hour),
-		Description:  "Nonexistent event",
-		UserID:       uuid.New(),
-		NotifyBefore: time.Hour,
+		ID:          uuid.New(),
+		Title:       "1 day later, duration 1 hour",
+		StartDate:   time.Now().Add(24 * time.Hour),
+		EndDate:     time.Now().Add(25 * time.Hour),
+		Description: "Nonexistent event",
+		UserID:      uuid.New(),
+		Reminders:   storage.Reminders{{Before: time.Hour}},
 	}
 
 	s := New()
-	s.data[event.ID] = event
-	s.data[event2.ID] = event2
+	s.put(event)
+	s.put(event2)
 	require.Equal(t, 2, len(s.data))
 
-	err := s.DeleteEvent(event.ID)
+	err := s.DeleteEvent(ctx, event.ID, 0)
 	require.NoError(t, err)
 	require.Equal(t, 1, len(s.data))
-	_, err = s.GetEvent(event.ID)
+	_, err = s.GetEvent(ctx, event.ID)
 	require.Error(t, err)
 	require.ErrorIs(t, err, storage.ErrEventNotFound)
 
-	ev, err := s.GetEvent(event2.ID)
+	ev, err := s.GetEvent(ctx, event2.ID)
 	require.NoError(t, err)
 	require.Equal(t, event2, ev)
 
-	err = s.DeleteEvent(event.ID)
+	err = s.DeleteEvent(ctx, event.ID, 0)
 	require.Error(t, err)
 	require.ErrorIs(t, err, storage.ErrEventNotFound)
 }
 
+func TestTrashEvent(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	event := storage.Event{
+		ID:        uuid.New(),
+		Title:     "Trashed event",
+		StartDate: time.Now().Add(time.Hour),
+		EndDate:   time.Now().Add(2 * time.Hour),
+		UserID:    userID,
+		Version:   1,
+	}
+
+	s := New()
+	s.put(event)
+
+	deletedAt := time.Now()
+	err := s.TrashEvent(ctx, event.ID, 2, deletedAt)
+	require.ErrorIs(t, err, storage.ErrVersionConflict)
+
+	err = s.TrashEvent(ctx, event.ID, 1, deletedAt)
+	require.NoError(t, err)
+
+	stored, err := s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.True(t, stored.IsTrashed())
+	require.Equal(t, int64(2), stored.Version)
+
+	// По умолчанию события из корзины не выбираются
+	filter := []storage.EventCondition{
+		{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
+	}
+	res, err := s.GetEvents(ctx, filter, []storage.EventSort{}, storage.Page{})
+	require.NoError(t, err)
+	require.Len(t, res, 0)
+
+	filter = append(filter, storage.EventCondition{
+		Field: storage.EventDeletedAt, Type: storage.TypeMore, Sample: time.Time{},
+	})
+	res, err = s.GetEvents(ctx, filter, []storage.EventSort{}, storage.Page{})
+	require.NoError(t, err)
+	require.Equal(t, []storage.Event{stored}, res)
+
+	err = s.RestoreEvent(ctx, event.ID, 2)
+	require.NoError(t, err)
+
+	stored, err = s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.False(t, stored.IsTrashed())
+	require.Equal(t, int64(3), stored.Version)
+
+	err = s.RestoreEvent(ctx, uuid.New(), 0)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+}
+
 func TestGetEvents(t *testing.T) {
+	ctx := context.Background()
 	userID1 := uuid.New()
 	userID2 := uuid.New()
 	userID3 := uuid.New()
@@ -153,76 +236,76 @@ func TestGetEvents(t *testing.T) {
 
 	events := []storage.Event{
 		{
-			ID:           uuid.New(),
-			Title:        "Event 0",
-			StartDate:    now,
-			EndDate:      now.Add(15 * time.Minute),
-			Description:  "User 1, now, duration 15 minutes",
-			UserID:       userID1,
-			NotifyBefore: time.Hour,
+			ID:          uuid.New(),
+			Title:       "Event 0",
+			StartDate:   now,
+			EndDate:     now.Add(15 * time.Minute),
+			Description: "User 1, now, duration 15 minutes",
+			UserID:      userID1,
+			Reminders:   storage.Reminders{{Before: time.Hour}},
 		},
 		{
-			ID:           uuid.New(),
-			Title:        "Event 1",
-			StartDate:    now.Add(time.Hour),
-			EndDate:      now.Add(time.Hour).Add(15 * time.Minute),
-			Description:  "User 1, 1 hour later, duration 15 minutes",
-			UserID:       userID1,
-			NotifyBefore: time.Hour,
+			ID:          uuid.New(),
+			Title:       "Event 1",
+			StartDate:   now.Add(time.Hour),
+			EndDate:     now.Add(time.Hour).Add(15 * time.Minute),
+			Description: "User 1, 1 hour later, duration 15 minutes",
+			UserID:      userID1,
+			Reminders:   storage.Reminders{{Before: time.Hour}},
 		},
 		{
-			ID:           uuid.New(),
-			Title:        "Event 2",
-			StartDate:    now.AddDate(0, 0, 1),
-			EndDate:      now.AddDate(0, 0, 1).Add(15 * time.Minute),
-			Description:  "User 1, 1 day later, duration 15 minutes",
-			UserID:       userID1,
-			NotifyBefore: time.Hour,
+			ID:          uuid.New(),
+			Title:       "Event 2",
+			StartDate:   now.AddDate(0, 0, 1),
+			EndDate:     now.AddDate(0, 0, 1).Add(15 * time.Minute),
+			Description: "User 1, 1 day later, duration 15 minutes",
+			UserID:      userID1,
+			Reminders:   storage.Reminders{{Before: time.Hour}},
 		},
 		{
-			ID:           uuid.New(),
-			Title:        "Event 3",
-			StartDate:    now.AddDate(0, -1, 0),
-			EndDate:      now.AddDate(0, -1, 0).AddDate(0, 0, 1),
-			Description:  "User 2, last month, duration 1 day",
-			UserID:       userID2,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.New(),
+			Title:       "Event 3",
+			StartDate:   now.AddDate(0, -1, 0),
+			EndDate:     now.AddDate(0, -1, 0).AddDate(0, 0, 1),
+			Description: "User 2, last month, duration 1 day",
+			UserID:      userID2,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.New(),
-			Title:        "Event 4",
-			StartDate:    now,
-			EndDate:      now.AddDate(0, 0, 1),
-			Description:  "User 2, now, duration 1 day",
-			UserID:       userID2,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.New(),
+			Title:       "Event 4",
+			StartDate:   now,
+			EndDate:     now.AddDate(0, 0, 1),
+			Description: "User 2, now, duration 1 day",
+			UserID:      userID2,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.New(),
-			Title:        "Event 5",
-			StartDate:    now.Add(time.Hour),
-			EndDate:      now.Add(time.Hour).Add(15 * time.Minute),
-			Description:  "User 2, 1 hour later, duration 15 minutes",
-			UserID:       userID2,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.New(),
+			Title:       "Event 5",
+			StartDate:   now.Add(time.Hour),
+			EndDate:     now.Add(time.Hour).Add(15 * time.Minute),
+			Description: "User 2, 1 hour later, duration 15 minutes",
+			UserID:      userID2,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.New(),
-			Title:        "Event 6",
-			StartDate:    now.AddDate(0, 1, 0),
-			EndDate:      now.AddDate(0, 1, 1),
-			Description:  "User 2, 1 month later, duration 1 day",
-			UserID:       userID2,
-			NotifyBefore: 24 * time.Hour,
+			ID:          uuid.New(),
+			Title:       "Event 6",
+			StartDate:   now.AddDate(0, 1, 0),
+			EndDate:     now.AddDate(0, 1, 1),
+			Description: "User 2, 1 month later, duration 1 day",
+			UserID:      userID2,
+			Reminders:   storage.Reminders{{Before: 24 * time.Hour}},
 		},
 		{
-			ID:           uuid.New(),
-			Title:        "Event 7",
-			StartDate:    now.Add(time.Hour),
-			EndDate:      now.Add(time.Hour).AddDate(0, 0, 1),
-			Description:  "User 3, 1 hour later, duration 1 day",
-			UserID:       userID3,
-			NotifyBefore: 15 * time.Minute,
+			ID:          uuid.New(),
+			Title:       "Event 7",
+			StartDate:   now.Add(time.Hour),
+			EndDate:     now.Add(time.Hour).AddDate(0, 0, 1),
+			Description: "User 3, 1 hour later, duration 1 day",
+			UserID:      userID3,
+			Reminders:   storage.Reminders{{Before: 15 * time.Minute}},
 		},
 	}
 
@@ -230,13 +313,13 @@ func TestGetEvents(t *testing.T) {
 	require.Equal(t, 0, len(s.data))
 
 	for _, e := range events {
-		s.data[e.ID] = e
+		s.put(e)
 	}
 
 	t.Run(
 		"Full list", func(t *testing.T) {
 			t.Parallel()
-			res, err := s.GetEvents([]storage.EventCondition{}, []storage.EventSort{})
+			res, err := s.GetEvents(ctx, []storage.EventCondition{}, []storage.EventSort{}, storage.Page{})
 			require.NoError(t, err)
 			require.ElementsMatch(t, events, res)
 		},
@@ -250,7 +333,7 @@ func TestGetEvents(t *testing.T) {
 				{Field: storage.EventStartDate, Type: storage.TypeLessOrEq, Sample: now},
 			}
 			expected := []storage.Event{events[0], events[3], events[4]}
-			res, err := s.GetEvents(conds, []storage.EventSort{})
+			res, err := s.GetEvents(ctx, conds, []storage.EventSort{}, storage.Page{})
 			require.NoError(t, err)
 			require.ElementsMatch(t, expected, res)
 		},
@@ -270,7 +353,7 @@ func TestGetEvents(t *testing.T) {
 				{Field: storage.EventDescription, Direction: storage.DirectionDesc},
 			}
 			expected := []storage.Event{events[2], events[5], events[1]}
-			res, err := s.GetEvents(conds, order)
+			res, err := s.GetEvents(ctx, conds, order, storage.Page{})
 			require.NoError(t, err)
 			require.Equal(t, expected, res)
 		},
@@ -278,49 +361,50 @@ func TestGetEvents(t *testing.T) {
 }
 
 func TestDeleteEvents(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 
 	now := time.Now()
 	events := []storage.Event{
 		{
-			ID:           uuid.New(),
-			Title:        "Event 0",
-			StartDate:    now,
-			EndDate:      now.Add(15 * time.Minute),
-			Description:  "User 1, now, duration 15 minutes",
-			UserID:       userID,
-			NotifyBefore: time.Hour,
+			ID:          uuid.New(),
+			Title:       "Event 0",
+			StartDate:   now,
+			EndDate:     now.Add(15 * time.Minute),
+			Description: "User 1, now, duration 15 minutes",
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: time.Hour}},
 		},
 		{
-			ID:           uuid.New(),
-			Title:        "Event 1",
-			StartDate:    now.AddDate(0, 0, -1).Add(-2 * time.Hour),
-			EndDate:      now.AddDate(0, 0, -1).Add(-1 * time.Hour),
-			Description:  "User 1, 1 day and 2 hours before, duration 1 hour",
-			UserID:       userID,
-			NotifyBefore: time.Hour,
+			ID:          uuid.New(),
+			Title:       "Event 1",
+			StartDate:   now.AddDate(0, 0, -1).Add(-2 * time.Hour),
+			EndDate:     now.AddDate(0, 0, -1).Add(-1 * time.Hour),
+			Description: "User 1, 1 day and 2 hours before, duration 1 hour",
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: time.Hour}},
 		},
 		{
-			ID:           uuid.New(),
-			Title:        "Event 2",
-			StartDate:    now.AddDate(0, 0, 1),
-			EndDate:      now.AddDate(0, 0, 1).Add(15 * time.Minute),
-			Description:  "User 1, 1 day later, duration 15 minutes",
-			UserID:       userID,
-			NotifyBefore: time.Hour,
+			ID:          uuid.New(),
+			Title:       "Event 2",
+			StartDate:   now.AddDate(0, 0, 1),
+			EndDate:     now.AddDate(0, 0, 1).Add(15 * time.Minute),
+			Description: "User 1, 1 day later, duration 15 minutes",
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: time.Hour}},
 		},
 	}
 	s := New()
 	require.Equal(t, 0, len(s.data))
 
 	for _, e := range events {
-		s.data[e.ID] = e
+		s.put(e)
 	}
 
 	conds := []storage.EventCondition{
 		{Field: storage.EventEndDate, Type: storage.TypeLessOrEq, Sample: now.AddDate(0, 0, -1)},
 	}
-	cnt, err := s.DeleteEvents(conds)
+	cnt, err := s.DeleteEvents(ctx, conds)
 	require.NoError(t, err)
 	require.Equal(t, int64(1), cnt)
 
@@ -331,54 +415,58 @@ func TestDeleteEvents(t *testing.T) {
 	require.Equal(t, expected, s.data)
 }
 
-func TestSetEventsNotified(t *testing.T) {
+func TestSetRemindersNotified(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 
 	now := time.Now()
 	events := []storage.Event{
 		{
-			ID:           uuid.New(),
-			Title:        "Event 0",
-			StartDate:    now,
-			EndDate:      now.Add(15 * time.Minute),
-			Description:  "Notified 1 day ago",
-			UserID:       userID,
-			NotifyBefore: time.Hour,
-			NotifiedAt:   now.AddDate(0, 0, -1),
+			ID:          uuid.New(),
+			Title:       "Event 0",
+			StartDate:   now,
+			EndDate:     now.Add(15 * time.Minute),
+			Description: "Notified 1 day ago",
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: time.Hour, NotifiedAt: now.AddDate(0, 0, -1)}},
 		},
 		{
-			ID:           uuid.New(),
-			Title:        "Event 1",
-			StartDate:    now.AddDate(0, 0, -1).Add(-2 * time.Hour),
-			EndDate:      now.AddDate(0, 0, -1).Add(-1 * time.Hour),
-			Description:  "Notified 2 day ago",
-			UserID:       userID,
-			NotifyBefore: time.Hour,
-			NotifiedAt:   now.AddDate(0, 0, -2),
+			ID:          uuid.New(),
+			Title:       "Event 1",
+			StartDate:   now.AddDate(0, 0, -1).Add(-2 * time.Hour),
+			EndDate:     now.AddDate(0, 0, -1).Add(-1 * time.Hour),
+			Description: "Notified 2 day ago",
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: time.Hour, NotifiedAt: now.AddDate(0, 0, -2)}},
 		},
 		{
-			ID:           uuid.New(),
-			Title:        "Event 2",
-			StartDate:    now.AddDate(0, 0, 1),
-			EndDate:      now.AddDate(0, 0, 1).Add(15 * time.Minute),
-			Description:  "Notified 3 day ago",
-			UserID:       userID,
-			NotifyBefore: time.Hour,
-			NotifiedAt:   now.AddDate(0, 0, -3),
+			ID:          uuid.New(),
+			Title:       "Event 2",
+			StartDate:   now.AddDate(0, 0, 1),
+			EndDate:     now.AddDate(0, 0, 1).Add(15 * time.Minute),
+			Description: "Notified 3 day ago",
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: time.Hour, NotifiedAt: now.AddDate(0, 0, -3)}},
 		},
 	}
 	s := New()
 	require.Equal(t, 0, len(s.data))
 
 	for _, e := range events {
-		s.data[e.ID] = e
+		s.put(e)
 	}
 
-	err := s.SetEventsNotified([]uuid.UUID{events[1].ID, events[2].ID}, now)
+	keys := []storage.ReminderKey{
+		{EventID: events[1].ID, Before: time.Hour},
+		{EventID: events[2].ID, Before: time.Hour},
+		// нет такого напоминания
+		{EventID: events[0].ID, Before: time.Minute},
+	}
+	err := s.SetRemindersNotified(ctx, keys, now)
 	require.NoError(t, err)
 
-	events[1].NotifiedAt = now
-	events[2].NotifiedAt = now
+	events[1].Reminders[0].NotifiedAt = now
+	events[2].Reminders[0].NotifiedAt = now
 	expected := map[uuid.UUID]storage.Event{
 		events[0].ID: events[0],
 		events[1].ID: events[1],
@@ -388,51 +476,513 @@ func TestSetEventsNotified(t *testing.T) {
 }
 
 func TestNotificationNeededEvents(t *testing.T) {
+	ctx := context.Background()
 	userID := uuid.New()
 
 	now := time.Now()
 	events := []storage.Event{
 		{
-			ID:           uuid.New(),
-			Title:        "Event 0",
-			StartDate:    now,
-			EndDate:      now.Add(15 * time.Minute),
-			Description:  "Start now, notify 1 hour, notified day before",
-			UserID:       userID,
-			NotifyBefore: time.Hour,
-			NotifiedAt:   now.AddDate(0, 0, -1),
+			ID:          uuid.New(),
+			Title:       "Event 0",
+			StartDate:   now,
+			EndDate:     now.Add(15 * time.Minute),
+			Description: "Start now, notify 1 hour, notified day before",
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: time.Hour, NotifiedAt: now.AddDate(0, 0, -1)}},
 		},
 		{
-			ID:           uuid.New(),
-			Title:        "Event 1",
-			StartDate:    now.AddDate(0, 0, 1),
-			EndDate:      now.AddDate(0, 0, 1).Add(1 * time.Hour),
-			Description:  "Start tomorrow, notify 1 minute before, notified now",
-			UserID:       userID,
-			NotifyBefore: 24*time.Hour + 1*time.Minute,
-			NotifiedAt:   now,
+			ID:          uuid.New(),
+			Title:       "Event 1",
+			StartDate:   now.AddDate(0, 0, 1),
+			EndDate:     now.AddDate(0, 0, 1).Add(1 * time.Hour),
+			Description: "Start tomorrow, notify 1 minute before, notified now",
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24*time.Hour + 1*time.Minute, NotifiedAt: now}},
 		},
 		{
-			ID:           uuid.New(),
-			Title:        "Event 2",
-			StartDate:    now.AddDate(0, 0, 1),
-			EndDate:      now.AddDate(0, 0, 1).Add(1 * time.Hour),
-			Description:  "Start tomorrow, notify 1 minute before, notified yesterday",
-			UserID:       userID,
-			NotifyBefore: 24*time.Hour + 1*time.Minute,
-			NotifiedAt:   now.AddDate(0, 0, -1),
+			ID:          uuid.New(),
+			Title:       "Event 2",
+			StartDate:   now.AddDate(0, 0, 1),
+			EndDate:     now.AddDate(0, 0, 1).Add(1 * time.Hour),
+			Description: "Start tomorrow, notify 1 minute before, notified yesterday",
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: 24*time.Hour + 1*time.Minute, NotifiedAt: now.AddDate(0, 0, -1)}},
 		},
 	}
 	s := New()
 	require.Equal(t, 0, len(s.data))
 
 	for _, e := range events {
-		s.data[e.ID] = e
+		s.put(e)
 	}
 
-	res, err := s.NotificationNeededEvents(now)
+	res, err := s.NotificationNeededEvents(ctx, now)
 	require.NoError(t, err)
 
-	expected := []storage.Event{events[0], events[2]}
+	expected := []storage.Notification{
+		{Event: events[0], Reminder: events[0].Reminders[0]},
+		{Event: events[2], Reminder: events[2].Reminders[0]},
+	}
 	require.ElementsMatch(t, expected, res)
 }
+
+func TestNotificationNeededRecurringEvents(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	now := time.Date(2023, time.March, 15, 12, 0, 0, 0, time.UTC)
+	events := []storage.Event{
+		{
+			ID:          uuid.New(),
+			Title:       "Event 0",
+			StartDate:   time.Date(2023, time.January, 2, 12, 30, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 2, 13, 0, 0, 0, time.UTC),
+			Description: "Daily at 12:30, notify 1 hour before, notified yesterday",
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: time.Hour, NotifiedAt: now.AddDate(0, 0, -1)}},
+			RRule:       "FREQ=DAILY",
+		},
+		{
+			ID:          uuid.New(),
+			Title:       "Event 1",
+			StartDate:   time.Date(2023, time.January, 2, 12, 30, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 2, 13, 0, 0, 0, time.UTC),
+			Description: "Daily at 12:30, notify 1 hour before, notified 10 minutes ago",
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: time.Hour, NotifiedAt: now.Add(-10 * time.Minute)}},
+			RRule:       "FREQ=DAILY",
+		},
+		{
+			ID:          uuid.New(),
+			Title:       "Event 2",
+			StartDate:   time.Date(2023, time.January, 2, 12, 30, 0, 0, time.UTC),
+			EndDate:     time.Date(2023, time.January, 2, 13, 0, 0, 0, time.UTC),
+			Description: "Daily at 12:30, today's occurrence is excluded",
+			UserID:      userID,
+			Reminders:   storage.Reminders{{Before: time.Hour, NotifiedAt: now.AddDate(0, 0, -1)}},
+			RRule:       "FREQ=DAILY",
+			ExDates:     storage.Dates{time.Date(2023, time.March, 15, 12, 30, 0, 0, time.UTC)},
+		},
+	}
+	s := New()
+	for _, e := range events {
+		s.put(e)
+	}
+
+	res, err := s.NotificationNeededEvents(ctx, now)
+	require.NoError(t, err)
+
+	expected := events[0]
+	expected.StartDate = time.Date(2023, time.March, 15, 12, 30, 0, 0, time.UTC)
+	expected.EndDate = time.Date(2023, time.March, 15, 13, 0, 0, 0, time.UTC)
+	require.Equal(t, []storage.Notification{{Event: expected, Reminder: expected.Reminders[0]}}, res)
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	eventID := uuid.New()
+	userID := uuid.New()
+	s := New()
+
+	records := []storage.HistoryRecord{
+		{EventID: eventID, UserID: userID, Action: storage.ActionCreate, CreatedAt: time.Now()},
+		{EventID: uuid.New(), UserID: userID, Action: storage.ActionCreate, CreatedAt: time.Now()},
+		{
+			EventID:   eventID,
+			UserID:    userID,
+			Action:    storage.ActionUpdate,
+			CreatedAt: time.Now(),
+			Changes:   storage.FieldChanges{{Field: storage.EventTitle, Old: "a", New: "b"}},
+		},
+	}
+	for _, r := range records {
+		require.NoError(t, s.AddHistory(ctx, r))
+	}
+
+	res, err := s.GetHistory(ctx, eventID)
+	require.NoError(t, err)
+	records[0].ID = 1
+	records[2].ID = 3
+	require.Equal(t, []storage.HistoryRecord{records[0], records[2]}, res)
+
+	res, err = s.GetHistory(ctx, uuid.New())
+	require.NoError(t, err)
+	require.Len(t, res, 0)
+}
+
+func TestSearchEvents(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	events := []storage.Event{
+		{ID: uuid.New(), UserID: userID, Title: "Обсуждение миграции", Description: "Переезд БД на PostgreSQL"},
+		{ID: uuid.New(), UserID: userID, Title: "Migration review", Description: "Check the DB migration plan"},
+		{ID: uuid.New(), UserID: uuid.New(), Title: "Migration review", Description: "Another user"},
+	}
+	s := New()
+	for _, e := range events {
+		s.put(e)
+	}
+
+	search := func(query string) []storage.Event {
+		filter := []storage.EventCondition{
+			{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
+			{Field: storage.EventText, Type: storage.TypeMatch, Sample: query},
+		}
+		order := []storage.EventSort{{Field: storage.EventTitle, Direction: storage.DirectionAsc}}
+		res, err := s.GetEvents(ctx, filter, order, storage.Page{})
+		require.NoError(t, err)
+		return res
+	}
+
+	require.Equal(t, []storage.Event{events[1]}, search("MIGRATION plan"))
+	require.Equal(t, []storage.Event{events[0]}, search("postgresql, миграции"))
+	require.Len(t, search("migration meeting"), 0)
+	require.Len(t, search(""), 0)
+
+	// Индекс обновляется при изменении и удалении события
+	updated := events[1]
+	updated.Title = "Meeting"
+	updated.Description = ""
+	s.put(updated)
+	require.Len(t, search("migration"), 0)
+	require.Equal(t, []storage.Event{updated}, search("meeting"))
+
+	s.remove(updated.ID)
+	require.Len(t, search("meeting"), 0)
+	require.NotContains(t, s.byToken, "meeting")
+}
+
+func TestGetEventsPage(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	start := time.Date(2023, time.July, 1, 10, 0, 0, 0, time.UTC)
+	s := New()
+	events := make([]storage.Event, 5)
+	for i := range events {
+		// два последних события начинаются одновременно, порядок между ними определяет ID
+		events[i] = storage.Event{
+			ID:        uuid.New(),
+			UserID:    userID,
+			StartDate: start.Add(time.Duration(min(i, 3)) * time.Hour),
+		}
+		s.put(events[i])
+	}
+	if bytes.Compare(events[3].ID[:], events[4].ID[:]) > 0 {
+		events[3], events[4] = events[4], events[3]
+	}
+
+	filter := []storage.EventCondition{{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID}}
+	res, err := s.GetEvents(ctx, filter, []storage.EventSort{}, storage.Page{Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, events[:2], res)
+
+	res, err = s.GetEvents(ctx, filter, []storage.EventSort{}, storage.Page{Limit: 2, After: storage.CursorOf(res[1])})
+	require.NoError(t, err)
+	require.Equal(t, events[2:4], res)
+
+	res, err = s.GetEvents(ctx, filter, []storage.EventSort{}, storage.Page{Limit: 2, After: storage.CursorOf(res[1])})
+	require.NoError(t, err)
+	require.Equal(t, events[4:], res)
+
+	// Курсор не зависит от представления
+	cursor, err := storage.ParseCursor(storage.CursorOf(events[2]).String())
+	require.NoError(t, err)
+	res, err = s.GetEvents(ctx, filter, []storage.EventSort{}, storage.Page{After: cursor})
+	require.NoError(t, err)
+	require.Equal(t, events[3:], res)
+
+	// даты за пределами диапазона UnixNano
+	for _, date := range []time.Time{
+		time.Date(1500, time.March, 1, 10, 0, 0, 5, time.UTC),
+		time.Date(2500, time.March, 1, 10, 0, 0, 999999999, time.UTC),
+	} {
+		c := storage.Cursor{StartDate: date, ID: uuid.New()}
+		cursor, err = storage.ParseCursor(c.String())
+		require.NoError(t, err)
+		require.Equal(t, c, cursor)
+	}
+
+	_, err = storage.ParseCursor("invalid")
+	require.ErrorIs(t, err, storage.ErrInvalidCursor)
+}
+
+func TestGetEventsConditionGroups(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	start := time.Date(2023, time.July, 1, 10, 0, 0, 0, time.UTC)
+	events := []storage.Event{
+		{ID: uuid.New(), UserID: userID, Title: "Planning", StartDate: start},
+		{ID: uuid.New(), UserID: userID, Title: "Review", StartDate: start.Add(time.Hour)},
+		{ID: uuid.New(), UserID: userID, Title: "Retro", StartDate: start.Add(2 * time.Hour)},
+		{ID: uuid.New(), UserID: uuid.New(), Title: "Planning", StartDate: start},
+	}
+	s := New()
+	for _, e := range events {
+		s.put(e)
+	}
+
+	get := func(conds ...storage.EventCondition) []storage.Event {
+		filter := append([]storage.EventCondition{
+			{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
+		}, conds...)
+		order := []storage.EventSort{{Field: storage.EventStartDate, Direction: storage.DirectionAsc}}
+		res, err := s.GetEvents(ctx, filter, order, storage.Page{})
+		require.NoError(t, err)
+		return res
+	}
+
+	// title = Planning OR title = Retro
+	require.Equal(t, []storage.Event{events[0], events[2]}, get(storage.Or(
+		storage.EventCondition{Field: storage.EventTitle, Type: storage.TypeEq, Sample: "Planning"},
+		storage.EventCondition{Field: storage.EventTitle, Type: storage.TypeEq, Sample: "Retro"},
+	)))
+
+	// NOT (title = Planning) AND (start > 10:00 OR title = Planning)
+	require.Equal(t, events[1:3], get(
+		storage.Not(storage.EventCondition{Field: storage.EventTitle, Type: storage.TypeEq, Sample: "Planning"}),
+		storage.Or(
+			storage.EventCondition{Field: storage.EventStartDate, Type: storage.TypeMore, Sample: start},
+			storage.EventCondition{Field: storage.EventTitle, Type: storage.TypeEq, Sample: "Planning"},
+		),
+	))
+
+	// Вложенные группы: start = 10:00 OR (title = Review AND NOT (start > 11:00))
+	require.Equal(t, events[:2], get(storage.Or(
+		storage.EventCondition{Field: storage.EventStartDate, Type: storage.TypeEq, Sample: start},
+		storage.And(
+			storage.EventCondition{Field: storage.EventTitle, Type: storage.TypeEq, Sample: "Review"},
+			storage.Not(storage.EventCondition{
+				Field: storage.EventStartDate, Type: storage.TypeMore, Sample: start.Add(time.Hour),
+			}),
+		),
+	)))
+
+	// Пустые группы
+	require.Len(t, get(storage.And()), 3)
+	require.Len(t, get(storage.Or()), 0)
+	require.Len(t, get(storage.Not()), 0)
+
+	// Ошибка во вложенном условии не теряется
+	_, err := s.GetEvents(ctx, []storage.EventCondition{storage.Or(
+		storage.EventCondition{Field: storage.EventTitle, Type: storage.TypeLess, Sample: 1},
+	)}, []storage.EventSort{}, storage.Page{})
+	require.Error(t, err)
+}
+
+func TestAttendees(t *testing.T) {
+	ctx := context.Background()
+	ownerID := uuid.New()
+	attendeeID := uuid.New()
+	s := New()
+	event, err := s.AddEvent(ctx, storage.Event{
+		UserID:    ownerID,
+		Attendees: storage.Attendees{{UserID: attendeeID, Status: storage.RSVPNeedsAction}},
+	})
+	require.NoError(t, err)
+	_, err = s.AddEvent(ctx, storage.Event{UserID: ownerID})
+	require.NoError(t, err)
+
+	invited := func(userID uuid.UUID) []storage.Event {
+		filter := []storage.EventCondition{{Field: storage.EventAttendees, Type: storage.TypeEq, Sample: userID}}
+		res, err := s.GetEvents(ctx, filter, []storage.EventSort{}, storage.Page{})
+		require.NoError(t, err)
+		return res
+	}
+	require.Equal(t, []storage.Event{event}, invited(attendeeID))
+	require.Len(t, invited(ownerID), 0)
+
+	require.NoError(t, s.SetAttendeeStatus(ctx, event.ID, attendeeID, storage.RSVPAccepted))
+	stored, _ := s.GetEvent(ctx, event.ID)
+	require.Equal(t, storage.Attendees{{UserID: attendeeID, Status: storage.RSVPAccepted}}, stored.Attendees)
+	require.Equal(t, event.Version, stored.Version)
+	require.Equal(t, []uuid.UUID{ownerID, attendeeID}, stored.Recipients())
+	// Ранее полученная копия события не меняется
+	require.Equal(t, storage.RSVPNeedsAction, event.Attendees[0].Status)
+
+	err = s.SetAttendeeStatus(ctx, event.ID, ownerID, storage.RSVPAccepted)
+	require.ErrorIs(t, err, storage.ErrAttendeeNotFound)
+	err = s.SetAttendeeStatus(ctx, uuid.New(), attendeeID, storage.RSVPAccepted)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+}
+
+func TestCalendars(t *testing.T) {
+	ctx := context.Background()
+	ownerID := uuid.New()
+	readerID := uuid.New()
+	s := New()
+	work, err := s.AddCalendar(ctx, storage.Calendar{
+		OwnerID: ownerID,
+		Name:    "Работа",
+		Grants:  storage.Grants{{UserID: readerID, Access: storage.AccessRead}},
+	})
+	require.NoError(t, err)
+	home, err := s.AddCalendar(ctx, storage.Calendar{OwnerID: ownerID, Name: "Дом"})
+	require.NoError(t, err)
+
+	stored, err := s.GetCalendar(ctx, work.ID)
+	require.NoError(t, err)
+	require.Equal(t, work, stored)
+	require.Equal(t, storage.AccessWrite, stored.AccessFor(ownerID))
+	require.Equal(t, storage.AccessRead, stored.AccessFor(readerID))
+	require.Equal(t, storage.Access(""), stored.AccessFor(uuid.New()))
+
+	calendars, err := s.GetCalendars(ctx, ownerID)
+	require.NoError(t, err)
+	require.Equal(t, []storage.Calendar{home, work}, calendars)
+	calendars, err = s.GetCalendars(ctx, readerID)
+	require.NoError(t, err)
+	require.Equal(t, []storage.Calendar{work}, calendars)
+
+	work.Grants = nil
+	require.NoError(t, s.UpdateCalendar(ctx, work))
+	calendars, err = s.GetCalendars(ctx, readerID)
+	require.NoError(t, err)
+	require.Len(t, calendars, 0)
+
+	require.NoError(t, s.DeleteCalendar(ctx, work.ID))
+	_, err = s.GetCalendar(ctx, work.ID)
+	require.ErrorIs(t, err, storage.ErrCalendarNotFound)
+	require.ErrorIs(t, s.DeleteCalendar(ctx, work.ID), storage.ErrCalendarNotFound)
+	require.ErrorIs(t, s.UpdateCalendar(ctx, work), storage.ErrCalendarNotFound)
+}
+
+func TestGetBusyIntervals(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	attendeeID := uuid.New()
+	freeID := uuid.New()
+	day := func(h int) time.Time {
+		return time.Date(2023, time.July, 10, h, 0, 0, 0, time.UTC)
+	}
+	s := New()
+	for _, e := range []storage.Event{
+		// пересекающиеся и смежные события объединяются
+		{StartDate: day(9), EndDate: day(11), UserID: userID},
+		{StartDate: day(10), EndDate: day(12), UserID: userID},
+		{StartDate: day(12), EndDate: day(13), UserID: userID},
+		// начинается до периода - обрезается
+		{StartDate: day(-2), EndDate: day(1), UserID: userID},
+		// по будням, 10 июля - понедельник
+		{StartDate: day(15).AddDate(0, 0, -14), EndDate: day(16).AddDate(0, 0, -14), UserID: userID,
+			RRule: "FREQ=WEEKLY;BYDAY=MO,TU"},
+		{StartDate: day(20), EndDate: day(21), UserID: userID, DeletedAt: day(0)},
+		{StartDate: day(18), EndDate: day(19), UserID: uuid.New(), Attendees: storage.Attendees{
+			{UserID: attendeeID, Status: storage.RSVPTentative},
+			{UserID: freeID, Status: storage.RSVPDeclined},
+		}},
+	} {
+		_, err := s.AddEvent(ctx, e)
+		require.NoError(t, err)
+	}
+
+	res, err := s.GetBusyIntervals(ctx, []uuid.UUID{userID, attendeeID, freeID}, day(0), day(24))
+	require.NoError(t, err)
+	require.Equal(t, map[uuid.UUID][]storage.Interval{
+		userID: {
+			{Start: day(0), End: day(1)},
+			{Start: day(9), End: day(13)},
+			{Start: day(15), End: day(16)},
+		},
+		attendeeID: {{Start: day(18), End: day(19)}},
+		freeID:     {},
+	}, res)
+}
+
+func TestWorkingHours(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	s := New()
+	res, err := s.GetWorkingHours(ctx, []uuid.UUID{userID})
+	require.NoError(t, err)
+	require.Len(t, res, 0)
+
+	hours := storage.WorkingHours{
+		UserID:   userID,
+		TimeZone: "Europe/Berlin",
+		Start:    9 * time.Hour,
+		End:      17*time.Hour + 30*time.Minute,
+		Weekdays: storage.Weekdays{time.Friday, time.Sunday},
+	}
+	require.NoError(t, s.SetWorkingHours(ctx, hours))
+	res, err = s.GetWorkingHours(ctx, []uuid.UUID{userID, uuid.New()})
+	require.NoError(t, err)
+	require.Equal(t, map[uuid.UUID]storage.WorkingHours{userID: hours}, res)
+
+	// 26 марта 2023 в Берлине переход на летнее время, рабочий день по местным часам не сдвигается
+	from := time.Date(2023, time.March, 24, 12, 0, 0, 0, time.UTC)
+	intervals, err := hours.Intervals(from, from.AddDate(0, 0, 6))
+	require.NoError(t, err)
+	require.Equal(t, []storage.Interval{
+		{Start: from, End: time.Date(2023, time.March, 24, 16, 30, 0, 0, time.UTC)},
+		{
+			Start: time.Date(2023, time.March, 26, 7, 0, 0, 0, time.UTC),
+			End:   time.Date(2023, time.March, 26, 15, 30, 0, 0, time.UTC),
+		},
+	}, intervals)
+}
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	s := New()
+	event, err := s.AddEvent(ctx, storage.Event{
+		Title:     "Планёрка",
+		StartDate: time.Date(2023, time.August, 14, 10, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, time.August, 14, 11, 0, 0, 0, time.UTC),
+		UserID:    userID,
+	})
+	require.NoError(t, err)
+	errFailed := errors.New("failed")
+
+	var added storage.Event
+	err = s.WithTx(ctx, func(tx app.Storage) error {
+		added, err = tx.AddEvent(ctx, storage.Event{Title: "Обед", UserID: userID})
+		require.NoError(t, err)
+		changed := event
+		changed.Title = "Ретро"
+		require.NoError(t, tx.UpdateEvent(ctx, changed))
+		require.NoError(t, tx.AddHistory(ctx, storage.HistoryRecord{EventID: event.ID, UserID: userID}))
+		_, err = tx.AddCalendar(ctx, storage.Calendar{OwnerID: userID, Name: "Работа"})
+		require.NoError(t, err)
+		require.NoError(t, tx.SetWorkingHours(ctx, storage.DefaultWorkingHours(userID)))
+		// внутри транзакции изменения видны
+		stored, err := tx.GetEvent(ctx, event.ID)
+		require.NoError(t, err)
+		require.Equal(t, "Ретро", stored.Title)
+		return errFailed
+	})
+	require.ErrorIs(t, err, errFailed)
+
+	_, err = s.GetEvent(ctx, added.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	stored, err := s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, event, stored)
+	// индекс поиска тоже откатывается
+	search := func(query string) []storage.Event {
+		filter := []storage.EventCondition{{Field: storage.EventText, Type: storage.TypeMatch, Sample: query}}
+		res, err := s.GetEvents(ctx, filter, nil, storage.Page{})
+		require.NoError(t, err)
+		return res
+	}
+	require.Len(t, search("ретро"), 0)
+	require.NotContains(t, s.byToken, "ретро")
+	require.Equal(t, []storage.Event{event}, search("планёрка"))
+	history, err := s.GetHistory(ctx, event.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 0)
+	calendars, err := s.GetCalendars(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, calendars, 0)
+	hours, err := s.GetWorkingHours(ctx, []uuid.UUID{userID})
+	require.NoError(t, err)
+	require.Len(t, hours, 0)
+
+	err = s.WithTx(ctx, func(tx app.Storage) error {
+		added, err = tx.AddEvent(ctx, storage.Event{Title: "Обед", UserID: userID})
+		return err
+	})
+	require.NoError(t, err)
+	_, err = s.GetEvent(ctx, added.ID)
+	require.NoError(t, err)
+}
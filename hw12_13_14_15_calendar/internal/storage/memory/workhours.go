@@ -0,0 +1,32 @@
+package memorystorage
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+// SetWorkingHours сохраняет рабочее время пользователя, заменяя прежнее.
+func (s *Storage) SetWorkingHours(_ context.Context, hours storage.WorkingHours) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hours.Weekdays = slices.Clone(hours.Weekdays)
+	rememberKey(s, s.workingHours, hours.UserID)
+	s.workingHours[hours.UserID] = hours
+	return nil
+}
+
+// GetWorkingHours возвращает рабочее время пользователей, которые его настроили.
+func (s *Storage) GetWorkingHours(_ context.Context, userIDs []uuid.UUID) (map[uuid.UUID]storage.WorkingHours, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make(map[uuid.UUID]storage.WorkingHours, len(userIDs))
+	for _, id := range userIDs {
+		if hours, ok := s.workingHours[id]; ok {
+			res[id] = hours
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page - параметры постраничной выборки: не больше Limit событий, следующих за курсором After
+// в порядке (StartDate, ID). Нулевой Limit - без ограничения количества.
+type Page struct {
+	Limit int
+	After Cursor
+}
+
+func (p Page) IsZero() bool {
+	return p.Limit == 0 && p.After.IsZero()
+}
+
+// Cursor - позиция последнего события на предыдущей странице.
+type Cursor struct {
+	StartDate time.Time
+	ID        uuid.UUID
+}
+
+func CursorOf(event Event) Cursor {
+	return Cursor{StartDate: event.StartDate, ID: event.ID}
+}
+
+func (c Cursor) IsZero() bool {
+	return c.StartDate.IsZero() && c.ID == uuid.UUID{}
+}
+
+// Before сообщает, что событие находится после курсора и должно попасть на следующую страницу.
+func (c Cursor) Before(event Event) bool {
+	if c.IsZero() {
+		return true
+	}
+	if !event.StartDate.Equal(c.StartDate) {
+		return event.StartDate.After(c.StartDate)
+	}
+	return bytes.Compare(event.ID[:], c.ID[:]) > 0
+}
+
+// String кодирует курсор в непрозрачную для клиента строку, пустой курсор - пустая строка.
+// Дата записывается секундами и наносекундами отдельно: UnixNano умещает только 1678-2262 годы.
+func (c Cursor) String() string {
+	if c.IsZero() {
+		return ""
+	}
+	raw := strconv.FormatInt(c.StartDate.Unix(), 10) + "." + strconv.Itoa(c.StartDate.Nanosecond()) + ":" +
+		c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func ParseCursor(s string) (Cursor, error) {
+	if s == "" {
+		return Cursor{}, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("%w: %s", ErrInvalidCursor, err)
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return Cursor{}, ErrInvalidCursor
+	}
+	secStr, nsecStr, ok := strings.Cut(parts[0], ".")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+	sec, err := strconv.ParseInt(secStr, 10, 64)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("%w: %s", ErrInvalidCursor, err)
+	}
+	nsec, err := strconv.ParseInt(nsecStr, 10, 64)
+	if err != nil || nsec < 0 || nsec >= int64(time.Second) {
+		return Cursor{}, fmt.Errorf("%w: invalid nanoseconds '%s'", ErrInvalidCursor, nsecStr)
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return Cursor{}, fmt.Errorf("%w: %s", ErrInvalidCursor, err)
+	}
+
+	return Cursor{StartDate: time.Unix(sec, nsec).UTC(), ID: id}, nil
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reminder - напоминание о событии за Before до начала. У каждого напоминания своё время последней отправки.
+type Reminder struct {
+	Before     time.Duration `db:"notify_before"`
+	NotifiedAt time.Time     `db:"notified_at"`
+}
+
+// Reminders хранятся отдельно от события, у события нет двух напоминаний с одинаковым Before.
+type Reminders []Reminder
+
+func (r Reminders) Find(before time.Duration) (Reminder, bool) {
+	for _, v := range r {
+		if v.Before == before {
+			return v, true
+		}
+	}
+	return Reminder{}, false
+}
+
+// Earliest возвращает самое раннее до начала события напоминание (ноль, если напоминаний нет).
+func (r Reminders) Earliest() time.Duration {
+	var res time.Duration
+	for _, v := range r {
+		res = max(res, v.Before)
+	}
+	return res
+}
+
+// String - времена напоминаний через запятую, время отправки в историю изменений события не попадает.
+func (r Reminders) String() string {
+	res := make([]string, len(r))
+	for i, v := range r {
+		res[i] = v.Before.String()
+	}
+	return strings.Join(res, ",")
+}
+
+// ReminderKey - напоминание конкретного события.
+type ReminderKey struct {
+	EventID uuid.UUID
+	Before  time.Duration
+}
+
+// Notification - напоминание, которое пора отправить, и экземпляр события, о котором оно.
+type Notification struct {
+	Event    Event
+	Reminder Reminder
+}
+
+func (n Notification) Key() ReminderKey {
+	return ReminderKey{EventID: n.Event.ID, Before: n.Reminder.Before}
+}
+
+// PendingNotifications возвращает напоминания события, которые пора отправить на момент t: время напоминания уже
+// наступило и оно позже последней отправки этого напоминания. Для повторяющегося события напоминание
+// отправляется о последнем таком экземпляре. Время сравнивается с точностью до секунды.
+func (e Event) PendingNotifications(t time.Time) ([]Notification, error) {
+	if e.IsTrashed() {
+		return nil, nil
+	}
+
+	var res []Notification
+	for _, r := range e.Reminders {
+		// границы расширены на секунду, точное сравнение - ниже
+		occurrences, err := e.Occurrences(r.NotifiedAt.Add(r.Before-time.Second), t.Add(r.Before+time.Second))
+		if err != nil {
+			return nil, err
+		}
+		for i := len(occurrences) - 1; i >= 0; i-- {
+			notifyAt := occurrences[i].StartDate.Add(-1 * r.Before).Unix()
+			if notifyAt < t.Unix() && notifyAt > r.NotifiedAt.Unix() {
+				res = append(res, Notification{Event: occurrences[i], Reminder: r})
+				break
+			}
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,212 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+const calendarColumns = "id, owner_id, name, color"
+
+func (s *Storage) AddCalendar(ctx context.Context, calendar storage.Calendar) (storage.Calendar, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
+		return storage.Calendar{}, err
+	}
+
+	id := uuid.New()
+	err := s.inTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO Calendars (id, owner_id, name, color) VALUES ($1, $2, $3, $4)",
+			id,
+			calendar.OwnerID,
+			calendar.Name,
+			calendar.Color,
+		)
+		if err != nil {
+			return err
+		}
+		return saveGrants(ctx, tx, id, calendar.Grants)
+	})
+	if err != nil {
+		return storage.Calendar{}, err
+	}
+
+	return s.GetCalendar(ctx, id)
+}
+
+func (s *Storage) UpdateCalendar(ctx context.Context, calendar storage.Calendar) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
+		return err
+	}
+
+	return s.inTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(
+			ctx,
+			"UPDATE Calendars SET owner_id = $2, name = $3, color = $4 WHERE id = $1",
+			calendar.ID,
+			calendar.OwnerID,
+			calendar.Name,
+			calendar.Color,
+		)
+		if err != nil {
+			return err
+		}
+		cnt, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if cnt == 0 {
+			return fmt.Errorf("%w: ID = %s", storage.ErrCalendarNotFound, calendar.ID)
+		}
+
+		return saveGrants(ctx, tx, calendar.ID, calendar.Grants)
+	})
+}
+
+func (s *Storage) DeleteCalendar(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
+		return err
+	}
+
+	res, err := s.conn().ExecContext(ctx, "DELETE FROM Calendars WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if cnt == 0 {
+		return fmt.Errorf("%w: ID = %s", storage.ErrCalendarNotFound, id)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetCalendar(ctx context.Context, id uuid.UUID) (storage.Calendar, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
+		return storage.Calendar{}, err
+	}
+
+	calendar := storage.Calendar{}
+	err := s.conn().GetContext(
+		ctx,
+		&calendar,
+		"SELECT "+calendarColumns+" FROM Calendars WHERE id = $1",
+		id,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fmt.Errorf("%w: ID = %s", storage.ErrCalendarNotFound, id)
+		}
+		return storage.Calendar{}, err
+	}
+
+	calendars := []storage.Calendar{calendar}
+	if err = s.loadGrants(ctx, calendars); err != nil {
+		return storage.Calendar{}, err
+	}
+
+	return calendars[0], nil
+}
+
+// GetCalendars возвращает календари пользователя и календари, к которым ему дан доступ, упорядоченные по имени.
+func (s *Storage) GetCalendars(ctx context.Context, userID uuid.UUID) ([]storage.Calendar, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
+		return nil, err
+	}
+
+	calendars := make([]storage.Calendar, 0)
+	err := s.conn().SelectContext(
+		ctx,
+		&calendars,
+		"SELECT "+calendarColumns+` FROM Calendars
+		WHERE owner_id = $1 OR id IN (SELECT calendar_id FROM CalendarGrants WHERE user_id = $1)
+		ORDER BY name, id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.loadGrants(ctx, calendars); err != nil {
+		return nil, err
+	}
+
+	return calendars, nil
+}
+
+// loadGrants заполняет доступы календарей одним запросом.
+func (s *Storage) loadGrants(ctx context.Context, calendars []storage.Calendar) error {
+	if len(calendars) == 0 {
+		return nil
+	}
+
+	byID := make(map[uuid.UUID]int, len(calendars))
+	in := make([]string, 0, len(calendars))
+	args := make([]interface{}, 0, len(calendars))
+	for i, c := range calendars {
+		byID[c.ID] = i
+		in = append(in, "$"+strconv.Itoa(len(in)+1))
+		args = append(args, c.ID)
+	}
+
+	var rows []struct {
+		CalendarID uuid.UUID `db:"calendar_id"`
+		storage.Grant
+	}
+	err := s.conn().SelectContext(
+		ctx,
+		&rows,
+		"SELECT calendar_id, user_id, access FROM CalendarGrants WHERE calendar_id IN ("+
+			strings.Join(in, ",")+") ORDER BY calendar_id, user_id",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		i := byID[row.CalendarID]
+		calendars[i].Grants = append(calendars[i].Grants, row.Grant)
+	}
+
+	return nil
+}
+
+// saveGrants заменяет доступы к календарю.
+func saveGrants(ctx context.Context, tx *sqlx.Tx, calendarID uuid.UUID, grants storage.Grants) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM CalendarGrants WHERE calendar_id = $1", calendarID); err != nil {
+		return err
+	}
+	for _, g := range grants {
+		_, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO CalendarGrants (calendar_id, user_id, access) VALUES ($1, $2, $3)",
+			calendarID,
+			g.UserID,
+			g.Access,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
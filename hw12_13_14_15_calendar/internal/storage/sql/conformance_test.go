@@ -0,0 +1,14 @@
+package sqlstorage
+
+import (
+	"testing"
+
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		t.Helper()
+		return newSQLite(t)
+	})
+}
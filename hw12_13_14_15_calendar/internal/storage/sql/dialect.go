@@ -0,0 +1,103 @@
+package sqlstorage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+	"github.com/jackc/pgx"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Код ошибки PostgreSQL unique_violation
+const uniqueViolation = "23505"
+
+// dialect - то, чем запросы к разным СУБД отличаются друг от друга. Даты хранятся в UTC: в SQLite они
+// сравниваются как строки.
+type dialect interface {
+	driver() string
+	// match возвращает условие полнотекстового поиска query с параметрами начиная с номера pos.
+	match(query string, pos int) (string, []interface{})
+	// secondsBefore - время в секундах Unix на secs секунд раньше даты в колонке column.
+	secondsBefore(column, secs string) string
+	// timestamp приводит дату (колонку или параметр) к секундам Unix, чтобы её можно было сравнить с secondsBefore.
+	// Дробная часть секунды отбрасывается, как в time.Time.Unix.
+	timestamp(expr string) string
+	isUniqueViolation(err error) bool
+	// lockUser - запрос блокировки с параметром $1 до конца транзакции, пустая строка - блокировка не нужна.
+	lockUser() string
+}
+
+type postgres struct{}
+
+func (postgres) driver() string {
+	return "pgx"
+}
+
+// Поисковый вектор строится парсером "simple", как и storage.Tokenize в memorystorage.
+func (postgres) match(query string, pos int) (string, []interface{}) {
+	return fmt.Sprintf("search_vector @@ plainto_tsquery('simple', $%d)", pos), []interface{}{query}
+}
+
+func (p postgres) secondsBefore(column, secs string) string {
+	return fmt.Sprintf("%s - %s", p.timestamp(column), secs)
+}
+
+func (postgres) timestamp(expr string) string {
+	return fmt.Sprintf("floor(extract(epoch from %s::timestamptz))", expr)
+}
+
+func (postgres) isUniqueViolation(err error) bool {
+	var pgErr pgx.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+// Транзакции READ COMMITTED не видят ещё не подтверждённые события друг друга, поэтому проверки пересечений
+// одного пользователя выполняются по очереди под рекомендательной блокировкой.
+func (postgres) lockUser() string {
+	return "SELECT pg_advisory_xact_lock($1)"
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) driver() string {
+	return "sqlite"
+}
+
+// Поиск идёт по таблице FTS5 с токенизатором unicode61, который, как и storage.Tokenize, делит текст на слова
+// из букв и цифр без учёта регистра. Слова запроса берутся в кавычки, чтобы не разбирались как операторы FTS5.
+func (sqliteDialect) match(query string, pos int) (string, []interface{}) {
+	tokens := storage.Tokenize(query)
+	if len(tokens) == 0 {
+		return "FALSE", nil
+	}
+	for i, t := range tokens {
+		tokens[i] = `"` + t + `"`
+	}
+	where := fmt.Sprintf("num IN (SELECT rowid FROM EventSearch WHERE EventSearch MATCH $%d)", pos)
+	return where, []interface{}{strings.Join(tokens, " ")}
+}
+
+func (sqliteDialect) secondsBefore(column, secs string) string {
+	return fmt.Sprintf("unixepoch(%s) - %s", column, secs)
+}
+
+func (sqliteDialect) timestamp(expr string) string {
+	return "unixepoch(" + expr + ")"
+}
+
+func (sqliteDialect) isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+// Транзакции начинаются с блокировки на запись всей БД (_txlock=immediate), отдельная блокировка не нужна.
+func (sqliteDialect) lockUser() string {
+	return ""
+}
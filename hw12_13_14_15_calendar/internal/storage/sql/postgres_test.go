@@ -0,0 +1,55 @@
+package sqlstorage
+
+import (
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage/storagetest"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/migrations"
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// PostgresDSNEnv - переменная окружения с DSN тестовой БД PostgreSQL, без неё тесты на PostgreSQL пропускаются.
+// Все данные в этой БД удаляются.
+const PostgresDSNEnv = "GOCLNDR_TEST_PG_DSN"
+
+// newPostgres создаёт хранилище в БД dsn со схемой из migrations и пустыми таблицами.
+func newPostgres(t *testing.T, dsn string) *Storage {
+	t.Helper()
+	db, err := sql.Open(postgres{}.driver(), dsn)
+	require.NoError(t, err)
+	goose.SetLogger(goose.NopLogger())
+	require.NoError(t, migrations.Run("up", db, migrations.DialectPostgres, "../../../migrations"))
+	_, err = db.Exec(`TRUNCATE Events, EventAttendees, EventReminders, EventTags, EventHistory, Tags,
+		Calendars, CalendarGrants, WorkingHours CASCADE`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	s := &Storage{
+		dsn:     dsn,
+		dialect: postgres{},
+		timeout: time.Second * 5,
+		mu:      &sync.Mutex{},
+	}
+	t.Cleanup(func() {
+		if s.db != nil {
+			require.NoError(t, s.Close())
+		}
+	})
+	return s
+}
+
+func TestConformancePostgres(t *testing.T) {
+	dsn := os.Getenv(PostgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", PostgresDSNEnv)
+	}
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		t.Helper()
+		return newPostgres(t, dsn)
+	})
+}
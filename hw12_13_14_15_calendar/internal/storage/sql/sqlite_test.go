@@ -0,0 +1,204 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/migrations"
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// newSQLite создаёт хранилище во временном файле SQLite со схемой из migrations.
+func newSQLite(t *testing.T) *Storage {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "calendar.db")
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	goose.SetLogger(goose.NopLogger())
+	require.NoError(t, migrations.Run("up", db, migrations.DialectSQLite, "../../../migrations"))
+	require.NoError(t, db.Close())
+
+	s := NewSQLite(path, time.Second*5)
+	t.Cleanup(func() {
+		if s.db != nil {
+			require.NoError(t, s.Close())
+		}
+	})
+	return s
+}
+
+func TestGetWhereSQLite(t *testing.T) {
+	filter := []storage.EventCondition{
+		{Field: storage.EventText, Type: storage.TypeMatch, Sample: "Retro, Planning"},
+		{Field: storage.EventText, Type: storage.TypeMatch, Sample: "..."},
+		{Field: storage.EventTitle, Type: storage.TypeEq, Sample: "retro"},
+	}
+
+	where, args, err := getWhere(sqliteDialect{}, filter, nil, 1)
+	require.NoError(t, err)
+	require.Equal(t,
+		"num IN (SELECT rowid FROM EventSearch WHERE EventSearch MATCH $1) AND FALSE AND title = $2",
+		where,
+	)
+	require.Equal(t, []interface{}{`"retro" "planning"`, "retro"}, args)
+}
+
+func TestSQLiteEvents(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLite(t)
+	userID := uuid.New()
+	guestID := uuid.New()
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	start := time.Date(2030, 1, 10, 13, 0, 0, 0, loc)
+
+	event, err := s.AddEvent(ctx, storage.Event{
+		Title:       "Планирование релиза",
+		Description: "Обсудить сроки",
+		StartDate:   start,
+		EndDate:     start.Add(time.Hour),
+		UserID:      userID,
+		Reminders:   storage.Reminders{{Before: time.Hour}},
+		Attendees:   storage.Attendees{{UserID: guestID, Status: storage.RSVPNeedsAction}},
+	})
+	require.NoError(t, err)
+	require.NotEqual(t, uuid.UUID{}, event.ID)
+	require.Equal(t, int64(1), event.Version)
+	require.Equal(t, start.UTC(), event.StartDate)
+	require.True(t, event.DeletedAt.IsZero())
+	require.Equal(t, storage.Attendees{{UserID: guestID, Status: storage.RSVPNeedsAction}}, event.Attendees)
+
+	_, err = s.AddEvent(ctx, event)
+	require.ErrorIs(t, err, storage.ErrEventExists)
+
+	event.Title = "Планирование"
+	require.NoError(t, s.UpdateEvent(ctx, event))
+	require.ErrorIs(t, s.UpdateEvent(ctx, event), storage.ErrVersionConflict)
+	require.NoError(t, s.SetAttendeeStatus(ctx, event.ID, guestID, storage.RSVPAccepted))
+
+	// поиск по словам без учёта регистра, в том числе по обновлённому названию
+	search := func(query string) []storage.Event {
+		events, err := s.GetEvents(ctx, []storage.EventCondition{
+			{Field: storage.EventText, Type: storage.TypeMatch, Sample: query},
+		}, nil, storage.Page{})
+		require.NoError(t, err)
+		return events
+	}
+	require.Len(t, search("планирование СРОКИ"), 1)
+	require.Len(t, search("релиза"), 0)
+
+	// период задаётся в другом поясе, даты сравниваются в UTC
+	events, err := s.GetEvents(ctx, []storage.EventCondition{
+		{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
+		{Field: storage.EventStartDate, Type: storage.TypeMoreOrEq, Sample: start.Add(-time.Minute).UTC()},
+		{Field: storage.EventStartDate, Type: storage.TypeLess, Sample: start.Add(time.Minute)},
+	}, []storage.EventSort{{Field: storage.EventStartDate, Direction: storage.DirectionAsc}}, storage.Page{})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, "Планирование", events[0].Title)
+	require.Equal(t, int64(2), events[0].Version)
+	require.Equal(t, storage.RSVPAccepted, events[0].Attendees[0].Status)
+
+	require.NoError(t, s.TrashEvent(ctx, event.ID, 2, start))
+	events, err = s.GetEvents(ctx, []storage.EventCondition{
+		{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
+	}, nil, storage.Page{})
+	require.NoError(t, err)
+	require.Len(t, events, 0)
+	require.NoError(t, s.RestoreEvent(ctx, event.ID, 3))
+
+	cnt, err := s.DeleteEvents(ctx, []storage.EventCondition{
+		{Field: storage.EventAttendees, Type: storage.TypeEq, Sample: guestID},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), cnt)
+	_, err = s.GetEvent(ctx, event.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	require.Len(t, search("планирование"), 0)
+}
+
+func TestSQLiteNotificationNeededEvents(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLite(t)
+	now := time.Date(2030, 1, 10, 10, 0, 0, 0, time.UTC)
+
+	add := func(start time.Time, notifyBefore time.Duration) storage.Event {
+		e, err := s.AddEvent(ctx, storage.Event{
+			Title:     "event",
+			StartDate: start,
+			EndDate:   start.Add(time.Hour),
+			UserID:    uuid.New(),
+			Reminders: storage.Reminders{{Before: notifyBefore}},
+		})
+		require.NoError(t, err)
+		return e
+	}
+	due := add(now.Add(30*time.Minute), time.Hour)
+	add(now.Add(2*time.Hour), time.Hour)
+	notified := add(now.Add(10*time.Minute), time.Hour)
+	keys := []storage.ReminderKey{{EventID: notified.ID, Before: time.Hour}}
+	require.NoError(t, s.SetRemindersNotified(ctx, keys, now.Add(-time.Minute)))
+
+	res, err := s.NotificationNeededEvents(ctx, now)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	require.Equal(t, due.ID, res[0].Event.ID)
+	require.Equal(t, time.Hour, res[0].Reminder.Before)
+}
+
+func TestSQLiteCalendarsAndHistory(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLite(t)
+	ownerID := uuid.New()
+	guestID := uuid.New()
+
+	calendar, err := s.AddCalendar(ctx, storage.Calendar{
+		OwnerID: ownerID,
+		Name:    "work",
+		Grants:  storage.Grants{{UserID: guestID, Access: storage.AccessRead}},
+	})
+	require.NoError(t, err)
+	calendars, err := s.GetCalendars(ctx, guestID)
+	require.NoError(t, err)
+	require.Equal(t, []storage.Calendar{calendar}, calendars)
+	require.NoError(t, s.DeleteCalendar(ctx, calendar.ID))
+	require.ErrorIs(t, s.DeleteCalendar(ctx, calendar.ID), storage.ErrCalendarNotFound)
+
+	eventID := uuid.New()
+	created := time.Date(2030, 1, 10, 10, 0, 0, 0, time.UTC)
+	for _, action := range []storage.HistoryAction{storage.ActionCreate, storage.ActionUpdate} {
+		require.NoError(t, s.AddHistory(ctx, storage.HistoryRecord{
+			EventID:   eventID,
+			UserID:    ownerID,
+			Action:    action,
+			CreatedAt: created,
+			Changes:   storage.FieldChanges{{Field: storage.EventTitle, Old: "a", New: "b"}},
+		}))
+	}
+	history, err := s.GetHistory(ctx, eventID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Less(t, history[0].ID, history[1].ID)
+	require.Equal(t, created, history[1].CreatedAt)
+	require.Equal(t, storage.ActionUpdate, history[1].Action)
+
+	hours := storage.WorkingHours{
+		UserID:   ownerID,
+		TimeZone: "Europe/Moscow",
+		Start:    9 * time.Hour,
+		End:      18 * time.Hour,
+		Weekdays: storage.Weekdays{time.Monday, time.Friday},
+	}
+	require.NoError(t, s.SetWorkingHours(ctx, hours))
+	hours.End = 17 * time.Hour
+	require.NoError(t, s.SetWorkingHours(ctx, hours))
+	stored, err := s.GetWorkingHours(ctx, []uuid.UUID{ownerID, guestID})
+	require.NoError(t, err)
+	require.Equal(t, map[uuid.UUID]storage.WorkingHours{ownerID: hours}, stored)
+}
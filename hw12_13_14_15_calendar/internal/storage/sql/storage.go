@@ -3,32 +3,56 @@ package sqlstorage
 import (
 	"context"
 	"database/sql"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/app"
 	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
 	"github.com/jmoiron/sqlx"
 )
 
 var fieldsMap = map[storage.EventField]string{
-	storage.EventID:           "id",
-	storage.EventTitle:        "title",
-	storage.EventStartDate:    "start_date",
-	storage.EventEndDate:      "end_date",
-	storage.EventDescription:  "description",
-	storage.EventUserID:       "user_id",
-	storage.EventNotifyBefore: "notify_before",
-	storage.EventNotifiedAt:   "notified_at",
+	storage.EventID:          "id",
+	storage.EventTitle:       "title",
+	storage.EventStartDate:   "start_date",
+	storage.EventEndDate:     "end_date",
+	storage.EventDescription: "description",
+	storage.EventUserID:      "user_id",
+	storage.EventRRule:       "rrule",
+	storage.EventVersion:     "version",
+	storage.EventDeletedAt:   "deleted_at",
+	storage.EventCalendarID:  "calendar_id",
+	storage.EventAllDay:      "all_day",
+	storage.EventTimeZone:    "time_zone",
+	storage.EventText:        "search_vector",
 }
 
+const eventColumns = "id, title, description, start_date, end_date, user_id, rrule, exdates, version, deleted_at, " +
+	"calendar_id, all_day, time_zone"
+
 type Storage struct {
 	dsn     string
+	dialect dialect
 	db      *sqlx.DB
 	timeout time.Duration
+	// защищает подключение к БД при первом обращении из нескольких горутин
+	mu *sync.Mutex
+	// открытая транзакция, если хранилище используется внутри WithTx
+	tx *sqlx.Tx
+}
+
+// querier - общие методы *sqlx.DB и *sqlx.Tx, чтобы одни и те же запросы выполнялись и в транзакции, и без неё.
+type querier interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error)
 }
 
 func New(host string, port int, dbname, user, password, sslmode string, timeout time.Duration) *Storage {
@@ -40,17 +64,41 @@ func New(host string, port int, dbname, user, password, sslmode string, timeout
 
 	return &Storage{
 		dsn:     dsn,
+		dialect: postgres{},
+		timeout: timeout,
+		mu:      &sync.Mutex{},
+	}
+}
+
+// NewSQLite создаёт хранилище в файле SQLite path. Схема создаётся миграциями из migrations.
+func NewSQLite(path string, timeout time.Duration) *Storage {
+	// Транзакции сразу берут блокировку на запись, чтобы параллельные транзакции ждали друг друга
+	// (busy_timeout), а не падали при попытке записи.
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)" +
+		"&_time_format=sqlite&_txlock=immediate"
+
+	return &Storage{
+		dsn:     dsn,
+		dialect: sqliteDialect{},
 		timeout: timeout,
+		mu:      &sync.Mutex{},
 	}
 }
 
-func (s Storage) createTimeoutCtx() context.Context {
-	ctx, _ := context.WithTimeout(context.Background(), s.timeout) //nolint: govet
-	return ctx
+// withTimeout ограничивает время запроса к БД, отмена родительского контекста (запроса клиента, остановки
+// сервиса) отменяет и запрос.
+func (s *Storage) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.timeout)
 }
 
 func (s *Storage) Connect(ctx context.Context) error {
-	db, err := sqlx.ConnectContext(ctx, "pgx", s.dsn)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connect(ctx)
+}
+
+func (s *Storage) connect(ctx context.Context) error {
+	db, err := sqlx.ConnectContext(ctx, s.dialect.driver(), s.dsn)
 	if err != nil {
 		return fmt.Errorf("failed to connect to db: %w", err)
 	}
@@ -59,18 +107,95 @@ func (s *Storage) Connect(ctx context.Context) error {
 	return nil
 }
 
-func (s *Storage) Ping() error {
+func (s *Storage) Ping(ctx context.Context) error {
+	if s.tx != nil {
+		return nil
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	s.mu.Lock()
 	if s.db == nil {
-		return s.Connect(s.createTimeoutCtx())
+		err := s.connect(ctx)
+		s.mu.Unlock()
+		return err
 	}
+	s.mu.Unlock()
 
-	if err := s.db.PingContext(s.createTimeoutCtx()); err != nil {
+	if err := s.db.PingContext(ctx); err != nil {
 		return fmt.Errorf("failed to connect to db: %w", err)
 	}
 
 	return nil
 }
 
+func (s *Storage) conn() querier {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+// WithTx выполняет fn в одной транзакции: изменения сохраняются, только если fn не вернула ошибку.
+// Внутри уже открытой транзакции fn выполняется в ней же.
+// Таймаут действует на каждый запрос в транзакции, а не на всю транзакцию.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx app.Storage) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	if err := s.Ping(ctx); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint: errcheck
+
+	txStorage := *s
+	txStorage.tx = tx
+	if err = fn(&txStorage); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// inTx выполняет fn в открытой транзакции WithTx или в новой, если хранилище используется вне WithTx.
+func (s *Storage) inTx(ctx context.Context, fn func(ctx context.Context, tx *sqlx.Tx) error) error {
+	if s.tx != nil {
+		return fn(ctx, s.tx)
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint: errcheck
+
+	if err = fn(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// LockUser блокирует проверку пересечений событий пользователя до конца транзакции WithTx. Ключ блокировки -
+// первые 8 байт ID: совпадение ключей у разных пользователей только заставит их транзакции подождать друг друга.
+func (s *Storage) LockUser(ctx context.Context, userID uuid.UUID) error {
+	query := s.dialect.lockUser()
+	if query == "" {
+		return nil
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
+		return err
+	}
+	if _, err := s.conn().ExecContext(ctx, query, int64(binary.BigEndian.Uint64(userID[:8]))); err != nil {
+		return fmt.Errorf("failed to lock user events: %w", err)
+	}
+	return nil
+}
+
 func (s *Storage) Close() error {
 	err := s.db.Close()
 	if err != nil {
@@ -80,29 +205,49 @@ func (s *Storage) Close() error {
 	return nil
 }
 
-func (s *Storage) AddEvent(event storage.Event) (storage.Event, error) {
-	if err := s.Ping(); err != nil {
+func (s *Storage) AddEvent(ctx context.Context, event storage.Event) (storage.Event, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
 		return storage.Event{}, err
 	}
 
+	// нулевой ID - генерируем новый
+	if event.ID == (uuid.UUID{}) {
+		event.ID = uuid.New()
+	}
 	query, args, err := sqlx.Named(
 		`INSERT INTO Events 
-    	(title, description, start_date, end_date, user_id, notify_before, notified_at)
-        VALUES (:title, :description, :start_date, :end_date, :user_id, :notify_before, :notified_at) RETURNING id`,
-		event,
+    	(id, title, description, start_date, end_date, user_id, rrule, exdates, calendar_id, all_day, time_zone)
+        VALUES (:id, :title, :description, :start_date, :end_date, :user_id, :rrule, :exdates, :calendar_id, :all_day,
+                :time_zone)`,
+		event.In(time.UTC),
 	)
 	if err != nil {
 		return storage.Event{}, err
 	}
-	query = s.db.Rebind(query)
+	query = s.conn().Rebind(query)
 
-	var id uuid.UUID
-	err = s.db.GetContext(s.createTimeoutCtx(), &id, query, args...)
+	err = s.inTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			if s.dialect.isUniqueViolation(err) {
+				return fmt.Errorf("%w: ID = %s", storage.ErrEventExists, event.ID)
+			}
+			return err
+		}
+		if err := saveAttendees(ctx, tx, event.ID, event.Attendees); err != nil {
+			return err
+		}
+		if err := saveReminders(ctx, tx, event.ID, event.Reminders); err != nil {
+			return err
+		}
+		return saveTags(ctx, tx, event.ID, event.UserID, event.Tags)
+	})
 	if err != nil {
 		return storage.Event{}, err
 	}
 
-	res, err := s.GetEvent(id)
+	res, err := s.GetEvent(ctx, event.ID)
 	if err != nil {
 		return storage.Event{}, err
 	}
@@ -110,56 +255,165 @@ func (s *Storage) AddEvent(event storage.Event) (storage.Event, error) {
 	return res, nil
 }
 
-func (s *Storage) UpdateEvent(event storage.Event) error {
-	if err := s.Ping(); err != nil {
+func (s *Storage) UpdateEvent(ctx context.Context, event storage.Event) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
 		return err
 	}
 
-	_, err := s.db.NamedExecContext(
-		s.createTimeoutCtx(),
-		`UPDATE Events SET
+	return s.inTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+		res, err := tx.NamedExecContext(
+			ctx,
+			`UPDATE Events SET
                   title = :title,
                   description = :description,
                   start_date = :start_date,
                   end_date = :end_date,
                   user_id = :user_id,
-                  notify_before = :notify_before,
-                  notified_at = :notified_at
-            WHERE id=:id`,
-		event,
+                  rrule = :rrule,
+                  exdates = :exdates,
+                  calendar_id = :calendar_id,
+                  all_day = :all_day,
+                  time_zone = :time_zone,
+                  version = version + 1
+            WHERE id=:id AND version=:version`,
+			event.In(time.UTC),
+		)
+		if err != nil {
+			return err
+		}
+		if err = s.checkAffected(ctx, res, event.ID, event.Version); err != nil {
+			return err
+		}
+
+		if err = saveAttendees(ctx, tx, event.ID, event.Attendees); err != nil {
+			return err
+		}
+		if err = saveReminders(ctx, tx, event.ID, event.Reminders); err != nil {
+			return err
+		}
+		return saveTags(ctx, tx, event.ID, event.UserID, event.Tags)
+	})
+}
+
+// DeleteEvent удаляет событие, если его версия совпадает с version. Нулевая версия - удаление без проверки.
+func (s *Storage) DeleteEvent(ctx context.Context, id uuid.UUID, version int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
+		return err
+	}
+
+	res, err := s.conn().ExecContext(
+		ctx,
+		"DELETE FROM Events WHERE id = $1 AND ($2 = 0 OR version = $2)",
+		id,
+		version,
 	)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return s.checkAffected(ctx, res, id, version)
 }
 
-func (s *Storage) DeleteEvent(id uuid.UUID) error {
-	if err := s.Ping(); err != nil {
+// TrashEvent перемещает событие в корзину, если его версия совпадает с version (0 - без проверки).
+func (s *Storage) TrashEvent(ctx context.Context, id uuid.UUID, version int64, deletedAt time.Time) error {
+	return s.setDeletedAt(ctx, id, version, deletedAt)
+}
+
+// RestoreEvent возвращает событие из корзины, если его версия совпадает с version (0 - без проверки).
+func (s *Storage) RestoreEvent(ctx context.Context, id uuid.UUID, version int64) error {
+	return s.setDeletedAt(ctx, id, version, time.Time{})
+}
+
+// SetAttendeeStatus меняет ответ участника на приглашение, версия события при этом не меняется.
+func (s *Storage) SetAttendeeStatus(
+	ctx context.Context,
+	eventID uuid.UUID,
+	userID uuid.UUID,
+	status storage.RSVPStatus,
+) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
 		return err
 	}
 
-	_, err := s.db.ExecContext(s.createTimeoutCtx(), "DELETE FROM Events WHERE id = $1", id)
+	res, err := s.conn().ExecContext(
+		ctx,
+		"UPDATE EventAttendees SET status = $3 WHERE event_id = $1 AND user_id = $2",
+		eventID,
+		userID,
+		status,
+	)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if cnt != 0 {
+		return nil
+	}
+	if _, err = s.GetEvent(ctx, eventID); err != nil {
+		return fmt.Errorf("%w: ID = %s", err, eventID)
+	}
+	return fmt.Errorf("%w: event ID = %s, user ID = %s", storage.ErrAttendeeNotFound, eventID, userID)
+}
+
+func (s *Storage) setDeletedAt(ctx context.Context, id uuid.UUID, version int64, deletedAt time.Time) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
+		return err
+	}
+
+	res, err := s.conn().ExecContext(
+		ctx,
+		"UPDATE Events SET deleted_at = $3, version = version + 1 WHERE id = $1 AND ($2 = 0 OR version = $2)",
+		id,
+		version,
+		deletedAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return s.checkAffected(ctx, res, id, version)
+}
+
+// checkAffected различает отсутствие события и несовпадение версии, если запрос не затронул ни одной строки.
+func (s *Storage) checkAffected(ctx context.Context, res sql.Result, id uuid.UUID, version int64) error {
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if cnt != 0 {
+		return nil
+	}
+
+	if _, err = s.GetEvent(ctx, id); err != nil {
+		return fmt.Errorf("%w: ID = %s", err, id)
+	}
+	return fmt.Errorf("%w: ID = %s, version = %d", storage.ErrVersionConflict, id, version)
 }
 
-func (s *Storage) GetEvent(id uuid.UUID) (storage.Event, error) {
-	if err := s.Ping(); err != nil {
+func (s *Storage) GetEvent(ctx context.Context, id uuid.UUID) (storage.Event, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
 		return storage.Event{}, err
 	}
 
 	event := storage.Event{}
-	err := s.db.GetContext(
-		s.createTimeoutCtx(),
+	err := s.conn().GetContext(
+		ctx,
 		&event,
-		`
-SELECT id, title, description, start_date, end_date, user_id, notify_before, notified_at
-FROM Events WHERE id = $1`,
+		"SELECT "+eventColumns+" FROM Events WHERE id = $1",
 		id,
 	)
 	if err != nil {
@@ -169,22 +423,32 @@ FROM Events WHERE id = $1`,
 		return storage.Event{}, err
 	}
 
-	return event, nil
+	events := []storage.Event{event.In(time.UTC)}
+	if err = s.loadRelated(ctx, events); err != nil {
+		return storage.Event{}, err
+	}
+
+	return events[0], nil
 }
 
-func (s *Storage) DeleteEvents(filter []storage.EventCondition) (int64, error) {
+func (s *Storage) DeleteEvents(ctx context.Context, filter []storage.EventCondition) (int64, error) {
 	if len(filter) == 0 {
 		return 0, errors.New("delete: filter required")
 	}
-	if err := s.Ping(); err != nil {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
 		return 0, err
 	}
 
 	args := make([]interface{}, 0, len(filter))
-	where, args := getWhere(filter, args, 1)
+	where, args, err := getWhere(s.dialect, filter, args, 1)
+	if err != nil {
+		return 0, err
+	}
 	query := fmt.Sprintf("DELETE FROM Events WHERE %s", where)
 
-	res, err := s.db.ExecContext(s.createTimeoutCtx(), query, args...)
+	res, err := s.conn().ExecContext(ctx, query, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -197,24 +461,27 @@ func (s *Storage) DeleteEvents(filter []storage.EventCondition) (int64, error) {
 	return cnt, nil
 }
 
-func (s *Storage) SetEventsNotified(ids []uuid.UUID, notified time.Time) error {
-	if len(ids) == 0 {
-		return errors.New("set notified: ids required")
+// SetRemindersNotified отмечает время отправки напоминаний, версия событий при этом не меняется.
+func (s *Storage) SetRemindersNotified(ctx context.Context, keys []storage.ReminderKey, notified time.Time) error {
+	if len(keys) == 0 {
+		return nil
 	}
-	if err := s.Ping(); err != nil {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
 		return err
 	}
 
-	args := make([]interface{}, 1, len(ids)+1)
-	args[0] = notified
-
-	filter := []storage.EventCondition{
-		{Field: storage.EventID, Type: storage.TypeIn, Sample: ids},
+	args := make([]interface{}, 1, 2*len(keys)+1)
+	args[0] = notified.UTC()
+	wheres := make([]string, len(keys))
+	for i, key := range keys {
+		wheres[i] = fmt.Sprintf("(event_id = $%d AND notify_before = $%d)", len(args)+1, len(args)+2)
+		args = append(args, key.EventID, key.Before)
 	}
-	where, args := getWhere(filter, args, 2)
-	query := fmt.Sprintf("UPDATE Events SET notified_at = $1 WHERE %s", where)
+	query := "UPDATE EventReminders SET notified_at = $1 WHERE " + strings.Join(wheres, " OR ")
 
-	_, err := s.db.ExecContext(s.createTimeoutCtx(), query, args...)
+	_, err := s.conn().ExecContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -222,55 +489,353 @@ func (s *Storage) SetEventsNotified(ids []uuid.UUID, notified time.Time) error {
 	return nil
 }
 
-func (s *Storage) NotificationNeededEvents(t time.Time) ([]storage.Event, error) {
-	if err := s.Ping(); err != nil {
-		return []storage.Event{}, err
+// NotificationNeededEvents возвращает напоминания, время отправки которых наступило. Время сравнивается
+// с точностью до секунды.
+func (s *Storage) NotificationNeededEvents(ctx context.Context, t time.Time) ([]storage.Notification, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
+		return nil, err
 	}
 
+	// Для повторяющихся событий нужный экземпляр и неотправленные напоминания вычисляются по правилу повторения,
+	// здесь отбираются только кандидаты.
+	notifyAt := s.dialect.secondsBefore("e.start_date", "r.notify_before/1000000000")
 	query := `
-SELECT id, title, description, start_date, end_date, user_id, notify_before, notified_at 
-FROM Events 
+SELECT ` + eventColumns + `
+FROM Events e
 WHERE 
-	start_date - make_interval(secs => notify_before/1000000000) < $1
-	AND notified_at < start_date - make_interval(secs => notify_before/1000000000)`
-	args := []interface{}{t}
+	deleted_at = $2
+	AND EXISTS (
+		SELECT 1 FROM EventReminders r
+		WHERE 
+			r.event_id = e.id
+			AND ` + notifyAt + ` < ` + s.dialect.timestamp("$1") + `
+			AND (e.rrule <> '' OR ` + s.dialect.timestamp("r.notified_at") + ` < ` + notifyAt + `)
+	)`
+	args := []interface{}{t.UTC(), time.Time{}}
 
 	var events []storage.Event
-	err := s.db.SelectContext(s.createTimeoutCtx(), &events, query, args...)
+	err := s.conn().SelectContext(ctx, &events, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	if err = s.loadRelated(ctx, events); err != nil {
+		return nil, err
+	}
+
+	res := make([]storage.Notification, 0, len(events))
+	for _, event := range events {
+		notifications, err := event.In(time.UTC).PendingNotifications(t)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, notifications...)
+	}
 
-	return events, nil
+	return res, nil
 }
 
-func (s *Storage) GetEvents(filter []storage.EventCondition, sort []storage.EventSort) ([]storage.Event, error) {
-	if err := s.Ping(); err != nil {
+// GetEvents возвращает события по условиям. При постраничной выборке порядок сортировки всегда (StartDate, ID).
+func (s *Storage) GetEvents(
+	ctx context.Context,
+	filter []storage.EventCondition,
+	sort []storage.EventSort,
+	page storage.Page,
+) ([]storage.Event, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
 		return []storage.Event{}, err
 	}
 
 	qb := strings.Builder{}
-	qb.WriteString("SELECT id, title, description, start_date, end_date, user_id, notify_before, notified_at FROM Events")
+	qb.WriteString("SELECT " + eventColumns + " FROM Events")
 
+	filter = storage.WithoutTrashed(filter)
 	args := make([]interface{}, 0, len(filter))
 	if len(filter) > 0 {
-		where, a := getWhere(filter, args, 1)
+		where, a, err := getWhere(s.dialect, filter, args, 1)
+		if err != nil {
+			return []storage.Event{}, err
+		}
 		qb.WriteString(" WHERE ")
 		qb.WriteString(where)
 		args = a
 	}
 
-	if len(sort) > 0 {
+	if !page.After.IsZero() {
+		if len(filter) > 0 {
+			qb.WriteString(" AND ")
+		} else {
+			qb.WriteString(" WHERE ")
+		}
+		qb.WriteString(fmt.Sprintf("(start_date, id) > ($%d, $%d)", len(args)+1, len(args)+2))
+		args = append(args, page.After.StartDate.UTC(), page.After.ID)
+	}
+
+	switch {
+	case !page.IsZero():
+		qb.WriteString(" ORDER BY start_date ASC, id ASC")
+		if page.Limit > 0 {
+			qb.WriteString(" LIMIT " + strconv.Itoa(page.Limit))
+		}
+	case len(sort) > 0:
 		qb.WriteString(" ORDER BY ")
 		qb.WriteString(getSort(sort))
 	}
 
 	var events []storage.Event
-	err := s.db.SelectContext(s.createTimeoutCtx(), &events, qb.String(), args...)
+	err := s.conn().SelectContext(ctx, &events, qb.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.loadRelated(ctx, events); err != nil {
+		return nil, err
+	}
+	return inUTC(events), nil
+}
+
+func (s *Storage) AddHistory(ctx context.Context, record storage.HistoryRecord) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
+		return err
+	}
+
+	record.CreatedAt = record.CreatedAt.UTC()
+	_, err := s.conn().NamedExecContext(
+		ctx,
+		`INSERT INTO EventHistory (event_id, user_id, action, created_at, changes)
+        VALUES (:event_id, :user_id, :action, :created_at, :changes)`,
+		record,
+	)
+
+	return err
+}
+
+func (s *Storage) GetHistory(ctx context.Context, eventID uuid.UUID) ([]storage.HistoryRecord, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
+		return nil, err
+	}
+
+	records := make([]storage.HistoryRecord, 0)
+	err := s.conn().SelectContext(
+		ctx,
+		&records,
+		"SELECT id, event_id, user_id, action, created_at, changes FROM EventHistory WHERE event_id = $1 ORDER BY id",
+		eventID,
+	)
 	if err != nil {
 		return nil, err
 	}
-	return events, nil
+	for i := range records {
+		records[i].CreatedAt = records[i].CreatedAt.UTC()
+	}
+
+	return records, nil
+}
+
+// loadRelated заполняет участников, напоминания и метки событий.
+func (s *Storage) loadRelated(ctx context.Context, events []storage.Event) error {
+	if err := s.loadAttendees(ctx, events); err != nil {
+		return err
+	}
+	if err := s.loadReminders(ctx, events); err != nil {
+		return err
+	}
+	return s.loadTags(ctx, events)
+}
+
+// eventIDs возвращает плейсхолдеры и аргументы для условия event_id IN (...) и позиции событий по ID.
+func eventIDs(events []storage.Event) (string, []interface{}, map[uuid.UUID]int) {
+	byID := make(map[uuid.UUID]int, len(events))
+	in := make([]string, 0, len(events))
+	args := make([]interface{}, 0, len(events))
+	for i, e := range events {
+		byID[e.ID] = i
+		in = append(in, "$"+strconv.Itoa(len(in)+1))
+		args = append(args, e.ID)
+	}
+	return strings.Join(in, ","), args, byID
+}
+
+// loadAttendees заполняет участников событий одним запросом.
+func (s *Storage) loadAttendees(ctx context.Context, events []storage.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	in, args, byID := eventIDs(events)
+	var rows []struct {
+		EventID uuid.UUID `db:"event_id"`
+		storage.Attendee
+	}
+	err := s.conn().SelectContext(
+		ctx,
+		&rows,
+		"SELECT event_id, user_id, status FROM EventAttendees WHERE event_id IN ("+in+") ORDER BY event_id, user_id",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		i := byID[row.EventID]
+		events[i].Attendees = append(events[i].Attendees, row.Attendee)
+	}
+
+	return nil
+}
+
+// saveAttendees заменяет список участников события.
+func saveAttendees(ctx context.Context, tx *sqlx.Tx, eventID uuid.UUID, attendees storage.Attendees) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM EventAttendees WHERE event_id = $1", eventID); err != nil {
+		return err
+	}
+	for _, a := range attendees {
+		_, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO EventAttendees (event_id, user_id, status) VALUES ($1, $2, $3)",
+			eventID,
+			a.UserID,
+			a.Status,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadReminders заполняет напоминания событий одним запросом.
+func (s *Storage) loadReminders(ctx context.Context, events []storage.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	in, args, byID := eventIDs(events)
+	var rows []struct {
+		EventID uuid.UUID `db:"event_id"`
+		storage.Reminder
+	}
+	err := s.conn().SelectContext(
+		ctx,
+		&rows,
+		"SELECT event_id, notify_before, notified_at FROM EventReminders WHERE event_id IN ("+in+") "+
+			"ORDER BY event_id, notify_before",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		i := byID[row.EventID]
+		// как в inUTC: драйвер возвращает время в локальном поясе процесса
+		r := storage.Reminder{Before: row.Before}
+		if !row.NotifiedAt.IsZero() {
+			r.NotifiedAt = row.NotifiedAt.UTC()
+		}
+		events[i].Reminders = append(events[i].Reminders, r)
+	}
+
+	return nil
+}
+
+// saveReminders заменяет напоминания события.
+func saveReminders(ctx context.Context, tx *sqlx.Tx, eventID uuid.UUID, reminders storage.Reminders) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM EventReminders WHERE event_id = $1", eventID); err != nil {
+		return err
+	}
+	for _, r := range reminders {
+		_, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO EventReminders (event_id, notify_before, notified_at) VALUES ($1, $2, $3)",
+			eventID,
+			r.Before,
+			r.NotifiedAt.UTC(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadTags заполняет метки событий одним запросом.
+func (s *Storage) loadTags(ctx context.Context, events []storage.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	in, args, byID := eventIDs(events)
+	var rows []struct {
+		EventID uuid.UUID `db:"event_id"`
+		storage.Tag
+	}
+	err := s.conn().SelectContext(
+		ctx,
+		&rows,
+		"SELECT et.event_id, t.name, t.color FROM EventTags et JOIN Tags t ON t.id = et.tag_id "+
+			"WHERE et.event_id IN ("+in+") ORDER BY et.event_id, t.name",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		i := byID[row.EventID]
+		events[i].Tags = append(events[i].Tags, row.Tag)
+	}
+
+	return nil
+}
+
+// saveTags заменяет метки события. Метки владельца создаются при первом использовании, пустой цвет
+// не меняет цвет уже существующей метки.
+func saveTags(ctx context.Context, tx *sqlx.Tx, eventID, userID uuid.UUID, tags storage.Tags) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM EventTags WHERE event_id = $1", eventID); err != nil {
+		return err
+	}
+	for _, t := range tags {
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO Tags (id, user_id, name, color) VALUES ($1, $2, $3, $4)
+            ON CONFLICT (user_id, name) DO UPDATE
+            SET color = CASE WHEN excluded.color <> '' THEN excluded.color ELSE Tags.color END`,
+			uuid.New(),
+			userID,
+			t.Name,
+			t.Color,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT INTO EventTags (event_id, tag_id) SELECT $1, id FROM Tags WHERE user_id = $2 AND name = $3",
+			eventID,
+			userID,
+			t.Name,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// inUTC приводит даты к UTC: драйвер возвращает TIMESTAMPTZ в локальном поясе процесса.
+func inUTC(events []storage.Event) []storage.Event {
+	for i := range events {
+		events[i] = events[i].In(time.UTC)
+	}
+	return events
 }
 
 func getSort(sorts []storage.EventSort) string {
@@ -284,11 +849,49 @@ func getSort(sorts []storage.EventSort) string {
 	return strings.Join(s, ", ")
 }
 
-func getWhere(filter []storage.EventCondition, args []interface{}, startPos int) (string, []interface{}) {
+// getWhere строит условие WHERE для фильтра. Условие на поле без колонки (например, ExDates) - ошибка, а не
+// запрос без колонки.
+func getWhere(
+	d dialect,
+	filter []storage.EventCondition,
+	args []interface{},
+	startPos int,
+) (string, []interface{}, error) {
 	wheres := make([]string, 0, len(filter))
 	i := startPos
 	for _, v := range filter {
-		if v.Type == storage.TypeIn || v.Type == storage.TypeNotIn {
+		if v.Field == storage.EventAttendees {
+			// участники хранятся в отдельной таблице
+			op := "IN"
+			if v.Type == storage.TypeNotEq {
+				op = "NOT IN"
+			}
+			wheres = append(wheres, fmt.Sprintf("id %s (SELECT event_id FROM EventAttendees WHERE user_id = $%d)", op, i))
+			args = append(args, v.Sample)
+			i++
+			continue
+		}
+		if v.Field == storage.EventTags {
+			// метки тоже в отдельной таблице, ищем по названию метки любого владельца
+			op := "IN"
+			if v.Type == storage.TypeNotEq {
+				op = "NOT IN"
+			}
+			wheres = append(wheres, fmt.Sprintf(
+				"id %s (SELECT et.event_id FROM EventTags et JOIN Tags t ON t.id = et.tag_id WHERE t.name = $%d)",
+				op,
+				i,
+			))
+			args = append(args, v.Sample)
+			i++
+			continue
+		}
+		column, ok := fieldsMap[v.Field]
+		if !ok && !v.IsGroup() && v.Type != storage.TypeMatch {
+			return "", nil, fmt.Errorf("%w: field '%s'", storage.ErrUnknownCondition, v.Field)
+		}
+		switch v.Type { //nolint: exhaustive
+		case storage.TypeIn, storage.TypeNotIn:
 			var inStr []string
 			switch t := v.Sample.(type) {
 			case []string:
@@ -309,20 +912,141 @@ func getWhere(filter []storage.EventCondition, args []interface{}, startPos int)
 					args = append(args, val.String())
 					i++
 				}
-			default:
-				for _, val := range v.Sample.([]interface{}) {
+			case []interface{}:
+				for _, val := range t {
 					inStr = append(inStr, "$"+strconv.Itoa(i))
 					args = append(args, val)
 					i++
 				}
+			default:
+				return "", nil, fmt.Errorf("%w: %T", storage.ErrIncomparableType, v.Sample)
 			}
-			wheres = append(wheres, fmt.Sprintf("%s %s (%s)", fieldsMap[v.Field], v.Type, strings.Join(inStr, ",")))
-		} else {
-			wheres = append(wheres, fmt.Sprintf("%s %s $%d", fieldsMap[v.Field], v.Type, i))
-			args = append(args, v.Sample)
+			wheres = append(wheres, fmt.Sprintf("%s %s (%s)", column, v.Type, strings.Join(inStr, ",")))
+		case storage.TypeAnd, storage.TypeOr, storage.TypeNot:
+			var where string
+			var err error
+			l := len(args)
+			if where, args, err = getGroupWhere(d, v, args, i); err != nil {
+				return "", nil, err
+			}
+			wheres = append(wheres, where)
+			i += len(args) - l
+		case storage.TypeMatch:
+			query, _ := v.Sample.(string)
+			where, a := d.match(query, i)
+			wheres = append(wheres, where)
+			args = append(args, a...)
+			i += len(a)
+		default:
+			sample := v.Sample
+			if t, ok := sample.(time.Time); ok {
+				sample = t.UTC()
+			}
+			wheres = append(wheres, fmt.Sprintf("%s %s $%d", column, v.Type, i))
+			args = append(args, sample)
 			i++
 		}
 	}
 
-	return strings.Join(wheres, " AND "), args
+	return strings.Join(wheres, " AND "), args, nil
+}
+
+// getGroupWhere строит условие для группы в скобках. Пустой AND истинен, пустой OR ложен - как в memorystorage.
+func getGroupWhere(
+	d dialect,
+	group storage.EventCondition,
+	args []interface{},
+	startPos int,
+) (string, []interface{}, error) {
+	if len(group.Conditions) == 0 {
+		if group.Type == storage.TypeOr {
+			return "FALSE", args, nil
+		}
+		if group.Type == storage.TypeNot {
+			return "NOT TRUE", args, nil
+		}
+		return "TRUE", args, nil
+	}
+
+	parts := make([]string, 0, len(group.Conditions))
+	for _, cond := range group.Conditions {
+		var where string
+		var err error
+		l := len(args)
+		if where, args, err = getWhere(d, []storage.EventCondition{cond}, args, startPos); err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, where)
+		startPos += len(args) - l
+	}
+
+	switch group.Type { //nolint: exhaustive
+	case storage.TypeOr:
+		return "(" + strings.Join(parts, " OR ") + ")", args, nil
+	case storage.TypeNot:
+		return "NOT (" + strings.Join(parts, " AND ") + ")", args, nil
+	default:
+		return "(" + strings.Join(parts, " AND ") + ")", args, nil
+	}
+}
+
+// GetBusyIntervals возвращает объединённые занятые интервалы пользователей в периоде [from, to). События
+// пользователей (свои и те, куда они приглашены и не отказались) выбираются одним запросом по периоду,
+// повторяющиеся разворачиваются в экземпляры.
+func (s *Storage) GetBusyIntervals(
+	ctx context.Context,
+	userIDs []uuid.UUID,
+	from, to time.Time,
+) (map[uuid.UUID][]storage.Interval, error) {
+	res := make(map[uuid.UUID][]storage.Interval, len(userIDs))
+	if len(userIDs) == 0 {
+		return res, nil
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{from.UTC(), to.UTC(), time.Time{}, storage.RSVPDeclined}
+	in := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		res[id] = nil
+		in[i] = "$" + strconv.Itoa(len(args)+1)
+		args = append(args, id)
+	}
+	query := `
+SELECT b.user_id AS busy_user_id, e.start_date, e.end_date, e.rrule, e.exdates, e.all_day, e.time_zone
+FROM Events e
+JOIN (
+	SELECT id AS event_id, user_id FROM Events
+	UNION ALL
+	SELECT event_id, user_id FROM EventAttendees WHERE status <> $4
+) b ON b.event_id = e.id
+WHERE
+	b.user_id IN (` + strings.Join(in, ",") + `)
+	AND e.deleted_at = $3
+	AND e.start_date < $2
+	AND (e.rrule <> '' OR e.end_date > $1)`
+
+	var rows []struct {
+		BusyUserID uuid.UUID `db:"busy_user_id"`
+		storage.Event
+	}
+	err := s.conn().SelectContext(ctx, &rows, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		intervals, err := row.Event.In(time.UTC).BusyIntervals(from, to)
+		if err != nil {
+			return nil, err
+		}
+		res[row.BusyUserID] = append(res[row.BusyUserID], intervals...)
+	}
+	for id, intervals := range res {
+		res[id] = storage.MergeIntervals(intervals)
+	}
+
+	return res, nil
 }
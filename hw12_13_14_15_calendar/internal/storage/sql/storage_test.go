@@ -0,0 +1,71 @@
+package sqlstorage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetWhere(t *testing.T) {
+	start := time.Date(2023, time.July, 1, 10, 0, 0, 0, time.UTC)
+	filter := []storage.EventCondition{
+		{Field: storage.EventTitle, Type: storage.TypeEq, Sample: "Planning"},
+		storage.Or(
+			storage.EventCondition{Field: storage.EventStartDate, Type: storage.TypeMore, Sample: start},
+			storage.Not(
+				storage.EventCondition{Field: storage.EventDescription, Type: storage.TypeIn, Sample: []string{"a", "b"}},
+				storage.EventCondition{Field: storage.EventText, Type: storage.TypeMatch, Sample: "retro"},
+			),
+		),
+		{Field: storage.EventRRule, Type: storage.TypeNotEq, Sample: ""},
+	}
+
+	where, args, err := getWhere(postgres{}, filter, []interface{}{"first"}, 2)
+	require.NoError(t, err)
+	require.Equal(t,
+		"title = $2 AND (start_date > $3 OR NOT (description IN ($4,$5) AND "+
+			"search_vector @@ plainto_tsquery('simple', $6))) AND rrule != $7",
+		where,
+	)
+	require.Equal(t, []interface{}{"first", "Planning", start, "a", "b", "retro", ""}, args)
+
+	empty := []storage.EventCondition{storage.And(), storage.Or(), storage.Not()}
+	where, args, err = getWhere(postgres{}, empty, nil, 1)
+	require.NoError(t, err)
+	require.Equal(t, "TRUE AND FALSE AND NOT TRUE", where)
+	require.Len(t, args, 0)
+}
+
+func TestGetWhereUnknownField(t *testing.T) {
+	for _, filter := range [][]storage.EventCondition{
+		{{Field: storage.EventExDates, Type: storage.TypeEq, Sample: []time.Time{}}},
+		{{Field: storage.EventReminders, Type: storage.TypeIn, Sample: []interface{}{1}}},
+		{storage.Or(storage.EventCondition{Field: "Unknown", Type: storage.TypeEq, Sample: 1})},
+	} {
+		_, _, err := getWhere(postgres{}, filter, nil, 1)
+		require.ErrorIs(t, err, storage.ErrUnknownCondition)
+	}
+}
+
+func TestGetWhereAttendees(t *testing.T) {
+	userID := uuid.New()
+	filter := []storage.EventCondition{
+		storage.Or(
+			storage.EventCondition{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
+			storage.EventCondition{Field: storage.EventAttendees, Type: storage.TypeEq, Sample: userID},
+		),
+		{Field: storage.EventAttendees, Type: storage.TypeNotEq, Sample: userID},
+	}
+
+	where, args, err := getWhere(postgres{}, filter, nil, 1)
+	require.NoError(t, err)
+	require.Equal(t,
+		"(user_id = $1 OR id IN (SELECT event_id FROM EventAttendees WHERE user_id = $2)) AND "+
+			"id NOT IN (SELECT event_id FROM EventAttendees WHERE user_id = $3)",
+		where,
+	)
+	require.Equal(t, []interface{}{userID, userID, userID}, args)
+}
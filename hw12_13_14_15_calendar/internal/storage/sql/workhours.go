@@ -0,0 +1,72 @@
+package sqlstorage
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+)
+
+// SetWorkingHours сохраняет рабочее время пользователя, заменяя прежнее.
+func (s *Storage) SetWorkingHours(ctx context.Context, hours storage.WorkingHours) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
+		return err
+	}
+
+	_, err := s.conn().NamedExecContext(
+		ctx,
+		`INSERT INTO WorkingHours (user_id, time_zone, start_time, end_time, weekdays)
+        VALUES (:user_id, :time_zone, :start_time, :end_time, :weekdays)
+        ON CONFLICT (user_id) DO UPDATE SET
+            time_zone = EXCLUDED.time_zone,
+            start_time = EXCLUDED.start_time,
+            end_time = EXCLUDED.end_time,
+            weekdays = EXCLUDED.weekdays`,
+		hours,
+	)
+
+	return err
+}
+
+// GetWorkingHours возвращает рабочее время пользователей, которые его настроили.
+func (s *Storage) GetWorkingHours(
+	ctx context.Context,
+	userIDs []uuid.UUID,
+) (map[uuid.UUID]storage.WorkingHours, error) {
+	res := make(map[uuid.UUID]storage.WorkingHours, len(userIDs))
+	if len(userIDs) == 0 {
+		return res, nil
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
+		return nil, err
+	}
+
+	in := make([]string, len(userIDs))
+	args := make([]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		in[i] = "$" + strconv.Itoa(i+1)
+		args[i] = id
+	}
+	var rows []storage.WorkingHours
+	err := s.conn().SelectContext(
+		ctx,
+		&rows,
+		"SELECT user_id, time_zone, start_time, end_time, weekdays FROM WorkingHours WHERE user_id IN ("+
+			strings.Join(in, ",")+")",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		res[row.UserID] = row
+	}
+
+	return res, nil
+}
@@ -1,14 +1,22 @@
 package storage
 
 import (
+	"database/sql/driver"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/rrule"
 )
 
 var (
 	ErrEventNotFound    = errors.New("event not found")
+	ErrEventExists      = errors.New("event already exists")
+	ErrVersionConflict  = errors.New("version conflict")
 	ErrUnknownCondition = errors.New("uknown condition")
 	ErrIncomparableType = errors.New("incomparable type")
 )
@@ -16,14 +24,27 @@ var (
 type EventField string
 
 const (
-	EventID           EventField = "ID"
-	EventTitle        EventField = "Title"
-	EventStartDate    EventField = "StartDate"
-	EventEndDate      EventField = "EndDate"
-	EventDescription  EventField = "Description"
-	EventUserID       EventField = "UserID"
-	EventNotifyBefore EventField = "NotifyBefore"
-	EventNotifiedAt   EventField = "NotifiedAt"
+	EventID          EventField = "ID"
+	EventTitle       EventField = "Title"
+	EventStartDate   EventField = "StartDate"
+	EventEndDate     EventField = "EndDate"
+	EventDescription EventField = "Description"
+	EventUserID      EventField = "UserID"
+	EventRRule       EventField = "RRule"
+	EventExDates     EventField = "ExDates"
+	EventVersion     EventField = "Version"
+	EventDeletedAt   EventField = "DeletedAt"
+	EventCalendarID  EventField = "CalendarID"
+	EventAllDay      EventField = "AllDay"
+	EventTimeZone    EventField = "TimeZone"
+	// Участники события. Условие TypeEq (TypeNotEq) с uuid.UUID - пользователь есть (нет) среди участников
+	EventAttendees EventField = "Attendees"
+	// Текст события (название и описание) для полнотекстового поиска
+	EventText EventField = "Text"
+	// Метки события. Условие TypeEq (TypeNotEq) со строкой - метка с таким названием есть (нет) у события
+	EventTags EventField = "Tags"
+	// Напоминания события, только для истории изменений, условия на них не поддерживаются
+	EventReminders EventField = "Reminders"
 )
 
 type ConditionType string
@@ -37,6 +58,12 @@ const (
 	TypeMoreOrEq ConditionType = ">="
 	TypeIn       ConditionType = "IN"
 	TypeNotIn    ConditionType = "NOT IN"
+	// TypeMatch - событие содержит все слова из Sample (строка), регистр и порядок слов не важны.
+	TypeMatch ConditionType = "MATCH"
+	// Группы условий: вложенные Conditions объединяются через AND / OR, NOT отрицает их конъюнкцию.
+	TypeAnd ConditionType = "AND"
+	TypeOr  ConditionType = "OR"
+	TypeNot ConditionType = "NOT"
 )
 
 type SortDirection string
@@ -50,6 +77,37 @@ type EventCondition struct {
 	Field  EventField
 	Type   ConditionType
 	Sample interface{}
+	// Вложенные условия для групп TypeAnd, TypeOr, TypeNot
+	Conditions []EventCondition
+}
+
+func And(conds ...EventCondition) EventCondition {
+	return EventCondition{Type: TypeAnd, Conditions: conds}
+}
+
+func Or(conds ...EventCondition) EventCondition {
+	return EventCondition{Type: TypeOr, Conditions: conds}
+}
+
+func Not(conds ...EventCondition) EventCondition {
+	return EventCondition{Type: TypeNot, Conditions: conds}
+}
+
+func (c EventCondition) IsGroup() bool {
+	return c.Type == TypeAnd || c.Type == TypeOr || c.Type == TypeNot
+}
+
+// hasField сообщает, есть ли в дереве условий условие на поле field.
+func hasField(filter []EventCondition, field EventField) bool {
+	for _, cond := range filter {
+		if cond.IsGroup() && hasField(cond.Conditions, field) {
+			return true
+		}
+		if !cond.IsGroup() && cond.Field == field {
+			return true
+		}
+	}
+	return false
 }
 
 type EventSort struct {
@@ -58,14 +116,33 @@ type EventSort struct {
 }
 
 type Event struct {
-	ID           uuid.UUID     `db:"id"`
-	Title        string        `db:"title"`
-	StartDate    time.Time     `db:"start_date"`
-	EndDate      time.Time     `db:"end_date"`
-	Description  string        `db:"description"`
-	UserID       uuid.UUID     `db:"user_id"`
-	NotifyBefore time.Duration `db:"notify_before"`
-	NotifiedAt   time.Time     `db:"notified_at"`
+	ID          uuid.UUID `db:"id"`
+	Title       string    `db:"title"`
+	StartDate   time.Time `db:"start_date"`
+	EndDate     time.Time `db:"end_date"`
+	Description string    `db:"description"`
+	UserID      uuid.UUID `db:"user_id"`
+	RRule       string    `db:"rrule"`
+	ExDates     Dates     `db:"exdates"`
+	// Версия увеличивается при каждом изменении события, изменение и удаление выполняются только
+	// для ожидаемой версии.
+	Version int64 `db:"version"`
+	// Время перемещения в корзину, нулевое значение - событие не удалено.
+	DeletedAt time.Time `db:"deleted_at"`
+	// Календарь события, нулевое значение - личное событие владельца.
+	CalendarID uuid.UUID `db:"calendar_id"`
+	// Приглашённые пользователи, хранятся отдельно от события.
+	Attendees Attendees `db:"-"`
+	// Метки события, хранятся отдельно от события.
+	Tags Tags `db:"-"`
+	// Напоминания о событии, упорядоченные по Before, хранятся отдельно от события.
+	Reminders Reminders `db:"-"`
+	// Событие на целые дни. Даты такого события не зависят от пояса: StartDate - полночь UTC первого дня,
+	// EndDate - полночь UTC дня после последнего, в любом поясе событие занимает те же числа.
+	AllDay bool `db:"all_day"`
+	// Пояс серии повторений (имя IANA): дни недели, границы недель и переходы на летнее время повторяющегося
+	// события считаются в нём, а не в поясе, в котором хранилище вернуло StartDate. Пустое значение - UTC.
+	TimeZone string `db:"time_zone"`
 }
 
 func (e Event) GetFieldValue(field EventField) interface{} {
@@ -82,10 +159,238 @@ func (e Event) GetFieldValue(field EventField) interface{} {
 		return e.Description
 	case EventUserID:
 		return e.UserID
-	case EventNotifyBefore:
-		return e.NotifyBefore
-	case EventNotifiedAt:
-		return e.NotifiedAt
+	case EventRRule:
+		return e.RRule
+	case EventExDates:
+		return e.ExDates
+	case EventVersion:
+		return e.Version
+	case EventDeletedAt:
+		return e.DeletedAt
+	case EventCalendarID:
+		return e.CalendarID
+	case EventAttendees:
+		return e.Attendees
+	case EventText:
+		return e.Title + " " + e.Description
+	case EventTags:
+		return e.Tags
+	case EventReminders:
+		return e.Reminders
+	case EventAllDay:
+		return e.AllDay
+	case EventTimeZone:
+		return e.TimeZone
+	}
+
+	return nil
+}
+
+func (e Event) IsTrashed() bool {
+	return !e.DeletedAt.IsZero()
+}
+
+// WithoutTrashed добавляет к фильтру исключение событий из корзины, если фильтр (в том числе во вложенных
+// группах) сам не задаёт условий на DeletedAt.
+func WithoutTrashed(filter []EventCondition) []EventCondition {
+	if hasField(filter, EventDeletedAt) {
+		return filter
+	}
+
+	res := make([]EventCondition, len(filter), len(filter)+1)
+	copy(res, filter)
+	return append(res, EventCondition{Field: EventDeletedAt, Type: TypeEq, Sample: time.Time{}})
+}
+
+// Tokenize разбивает текст на слова в нижнем регистре, так же как парсер "simple" в PostgreSQL.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]struct{}, len(words))
+	res := make([]string, 0, len(words))
+	for _, w := range words {
+		if _, ok := seen[w]; ok {
+			continue
+		}
+		seen[w] = struct{}{}
+		res = append(res, w)
+	}
+
+	return res
+}
+
+// In переводит даты события в пояс loc, нулевые даты остаются нулевыми (time.Time{}).
+// Даты события на целые дни сохраняют числа: полночь UTC становится полночью в loc.
+func (e Event) In(loc *time.Location) Event {
+	in := func(t time.Time) time.Time {
+		if t.IsZero() {
+			return time.Time{}
+		}
+		return t.In(loc)
+	}
+	days := in
+	if e.AllDay {
+		days = func(t time.Time) time.Time {
+			if t.IsZero() {
+				return time.Time{}
+			}
+			return WallClock(t.UTC(), loc)
+		}
+	}
+	e.StartDate = days(e.StartDate)
+	e.EndDate = days(e.EndDate)
+	e.DeletedAt = in(e.DeletedAt)
+	if e.Reminders != nil {
+		reminders := make(Reminders, len(e.Reminders))
+		for i, r := range e.Reminders {
+			reminders[i] = Reminder{Before: r.Before, NotifiedAt: in(r.NotifiedAt)}
+		}
+		e.Reminders = reminders
+	}
+	if e.ExDates != nil {
+		dates := make(Dates, len(e.ExDates))
+		for i, d := range e.ExDates {
+			dates[i] = days(d)
+		}
+		e.ExDates = dates
+	}
+
+	return e
+}
+
+// WallClock возвращает момент в поясе loc с теми же числом и временем на часах, что у t.
+func WallClock(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+func (e Event) IsRecurring() bool {
+	return e.RRule != ""
+}
+
+// Ended сообщает, что событие (у повторяющегося - последний экземпляр серии) закончилось раньше t.
+func (e Event) Ended(t time.Time) (bool, error) {
+	if !e.IsRecurring() {
+		return e.EndDate.Before(t), nil
+	}
+	rule, err := rrule.Parse(e.RRule)
+	if err != nil {
+		return false, err
+	}
+	loc, err := e.Location()
+	if err != nil {
+		return false, err
+	}
+	// экземпляр, начавшийся не раньше t - длительность, к t ещё не закончился
+	return rule.Ended(e.StartDate.In(loc), t.Add(-e.EndDate.Sub(e.StartDate))), nil
+}
+
+// locations - уже загруженные пояса: time.LoadLocation каждый раз читает базу поясов заново.
+var locations sync.Map
+
+// TimeZone возвращает имя пояса loc для Event.TimeZone, UTC - пустая строка.
+func TimeZone(loc *time.Location) string {
+	if loc == time.UTC {
+		return ""
+	}
+	return loc.String()
+}
+
+// Location возвращает пояс серии повторений события. Даты событий на целые дни от пояса не зависят.
+func (e Event) Location() (*time.Location, error) {
+	if e.AllDay || e.TimeZone == "" {
+		return time.UTC, nil
+	}
+	if loc, ok := locations.Load(e.TimeZone); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(e.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(e.TimeZone, loc)
+	return loc, nil
+}
+
+// Occurrences разворачивает событие в экземпляры, начало которых попадает в [from, to].
+// Экземпляры повторяющегося события имеют ID исходного события и сдвинутые даты начала и окончания.
+func (e Event) Occurrences(from, to time.Time) ([]Event, error) {
+	if !e.IsRecurring() {
+		if e.StartDate.Before(from) || e.StartDate.After(to) {
+			return []Event{}, nil
+		}
+		return []Event{e}, nil
+	}
+
+	rule, err := rrule.Parse(e.RRule)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := e.Location()
+	if err != nil {
+		return nil, err
+	}
+
+	duration := e.EndDate.Sub(e.StartDate)
+	starts := rule.Between(e.StartDate.In(loc), from, to)
+	res := make([]Event, 0, len(starts))
+	for _, start := range starts {
+		if e.ExDates.Contains(start) {
+			continue
+		}
+		// даты экземпляров - в том же поясе, что и у исходного события
+		occurrence := e
+		occurrence.StartDate = start.In(e.StartDate.Location())
+		occurrence.EndDate = occurrence.StartDate.Add(duration)
+		res = append(res, occurrence)
+	}
+
+	return res, nil
+}
+
+// Dates хранится в БД одной строкой с датами в RFC 3339 через запятую.
+type Dates []time.Time
+
+func (d Dates) Contains(t time.Time) bool {
+	for _, v := range d {
+		if v.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d Dates) Value() (driver.Value, error) {
+	strs := make([]string, len(d))
+	for i, v := range d {
+		strs[i] = v.UTC().Format(time.RFC3339Nano)
+	}
+	return strings.Join(strs, ","), nil
+}
+
+func (d *Dates) Scan(src interface{}) error {
+	var str string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	default:
+		return fmt.Errorf("%w: %T", ErrIncomparableType, src)
+	}
+
+	*d = nil
+	if str == "" {
+		return nil
+	}
+	for _, v := range strings.Split(str, ",") {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return err
+		}
+		*d = append(*d, t)
 	}
 
 	return nil
@@ -0,0 +1,955 @@
+// Package storagetest - общие тесты хранилищ: любое хранилище, с которым работают приложение и планировщик,
+// должно их проходить.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/app"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/scheduler"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type Storage interface {
+	app.Storage
+	scheduler.Storage
+}
+
+// Run запускает все тесты. newStorage должна возвращать новое пустое хранилище.
+func Run(t *testing.T, newStorage func(t *testing.T) Storage) {
+	t.Helper()
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s Storage)
+	}{
+		{"Events", testEvents},
+		{"Filters", testFilters},
+		{"Tags", testTags},
+		{"AllDay", testAllDay},
+		{"Sorting", testSorting},
+		{"Paging", testPaging},
+		{"Notifications", testNotifications},
+		{"RecurringNotifications", testRecurringNotifications},
+		{"RecurringTimeZone", testRecurringTimeZone},
+		{"MultipleReminders", testMultipleReminders},
+		{"DeleteEvents", testDeleteEvents},
+		{"WithTx", testWithTx},
+		{"BusyIntervals", testBusyIntervals},
+		{"ConcurrentWrites", testConcurrentWrites},
+		{"ConcurrentCreates", testConcurrentCreates},
+		{"ConcurrentNotifications", testConcurrentNotifications},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStorage(t))
+		})
+	}
+}
+
+var base = time.Date(2030, time.January, 10, 10, 0, 0, 0, time.UTC)
+
+func add(t *testing.T, s Storage, event storage.Event) storage.Event {
+	t.Helper()
+	if event.EndDate.IsZero() {
+		event.EndDate = event.StartDate.Add(time.Hour)
+	}
+	if event.UserID == (uuid.UUID{}) {
+		event.UserID = uuid.New()
+	}
+	res, err := s.AddEvent(context.Background(), event)
+	require.NoError(t, err)
+	return res
+}
+
+func get(
+	t *testing.T,
+	s Storage,
+	filter []storage.EventCondition,
+	order []storage.EventSort,
+	page storage.Page,
+) []storage.Event {
+	t.Helper()
+	res, err := s.GetEvents(context.Background(), filter, order, page)
+	require.NoError(t, err)
+	return res
+}
+
+func titles(events []storage.Event) []string {
+	res := make([]string, len(events))
+	for i, e := range events {
+		res[i] = e.Title
+	}
+	return res
+}
+
+func ids(events []storage.Event) []uuid.UUID {
+	res := make([]uuid.UUID, len(events))
+	for i, e := range events {
+		res[i] = e.ID
+	}
+	return res
+}
+
+func keys(notifications []storage.Notification) []storage.ReminderKey {
+	res := make([]storage.ReminderKey, len(notifications))
+	for i, n := range notifications {
+		res[i] = n.Key()
+	}
+	return res
+}
+
+// notified возвращает названия событий из напоминаний.
+func notified(notifications []storage.Notification) []string {
+	res := make([]string, len(notifications))
+	for i, n := range notifications {
+		res[i] = n.Event.Title
+	}
+	return res
+}
+
+func reminders(befores ...time.Duration) storage.Reminders {
+	res := make(storage.Reminders, len(befores))
+	for i, b := range befores {
+		res[i] = storage.Reminder{Before: b}
+	}
+	return res
+}
+
+func testEvents(t *testing.T, s Storage) {
+	ctx := context.Background()
+	guestID := uuid.New()
+	event := add(t, s, storage.Event{
+		Title:       "Планёрка",
+		Description: "Каждый понедельник",
+		StartDate:   base,
+		Reminders:   reminders(15*time.Minute, 24*time.Hour),
+		Attendees:   storage.Attendees{{UserID: guestID, Status: storage.RSVPNeedsAction}},
+	})
+	require.NotEqual(t, uuid.UUID{}, event.ID)
+	require.Equal(t, int64(1), event.Version)
+
+	stored, err := s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, event.Title, stored.Title)
+	require.Equal(t, event.Description, stored.Description)
+	require.True(t, base.Equal(stored.StartDate))
+	require.True(t, base.Add(time.Hour).Equal(stored.EndDate))
+	require.Equal(t, event.Reminders, stored.Reminders)
+	require.Equal(t, event.Attendees, stored.Attendees)
+
+	_, err = s.AddEvent(ctx, event)
+	require.ErrorIs(t, err, storage.ErrEventExists)
+	_, err = s.GetEvent(ctx, uuid.New())
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+
+	event.Title = "Ретро"
+	require.NoError(t, s.UpdateEvent(ctx, event))
+	require.ErrorIs(t, s.UpdateEvent(ctx, event), storage.ErrVersionConflict)
+	missing := event
+	missing.ID = uuid.New()
+	require.ErrorIs(t, s.UpdateEvent(ctx, missing), storage.ErrEventNotFound)
+
+	require.NoError(t, s.SetAttendeeStatus(ctx, event.ID, guestID, storage.RSVPAccepted))
+	err = s.SetAttendeeStatus(ctx, event.ID, uuid.New(), storage.RSVPAccepted)
+	require.ErrorIs(t, err, storage.ErrAttendeeNotFound)
+	stored, err = s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, "Ретро", stored.Title)
+	// ответ участника версию не меняет
+	require.Equal(t, int64(2), stored.Version)
+	require.Equal(t, storage.RSVPAccepted, stored.Attendees[0].Status)
+
+	// событие в корзине не попадает в выборки, но доступно по ID
+	byUser := []storage.EventCondition{{Field: storage.EventUserID, Type: storage.TypeEq, Sample: event.UserID}}
+	require.ErrorIs(t, s.TrashEvent(ctx, event.ID, 1, base), storage.ErrVersionConflict)
+	require.NoError(t, s.TrashEvent(ctx, event.ID, 2, base))
+	require.Len(t, get(t, s, byUser, nil, storage.Page{}), 0)
+	stored, err = s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.True(t, base.Equal(stored.DeletedAt))
+
+	require.NoError(t, s.RestoreEvent(ctx, event.ID, 3))
+	require.Equal(t, []uuid.UUID{event.ID}, ids(get(t, s, byUser, nil, storage.Page{})))
+	require.ErrorIs(t, s.RestoreEvent(ctx, uuid.New(), 0), storage.ErrEventNotFound)
+}
+
+func testFilters(t *testing.T, s Storage) {
+	userID := uuid.New()
+	guestID := uuid.New()
+	calendarID := uuid.New()
+	add(t, s, storage.Event{
+		Title:       "a",
+		UserID:      userID,
+		StartDate:   base,
+		Description: "Обсуждение бюджета",
+		Tags:        storage.Tags{{Name: "on-call"}},
+	})
+	add(t, s, storage.Event{Title: "b", UserID: userID, StartDate: base.Add(time.Hour), RRule: "FREQ=DAILY"})
+	add(t, s, storage.Event{
+		Title:     "c",
+		UserID:    userID,
+		StartDate: base.Add(2 * time.Hour),
+		EndDate:   base.Add(5 * time.Hour),
+		Attendees: storage.Attendees{{UserID: guestID, Status: storage.RSVPNeedsAction}},
+		Tags:      storage.Tags{{Name: "on-call"}, {Name: "release"}},
+	})
+	add(t, s, storage.Event{Title: "d", StartDate: base.Add(3 * time.Hour), CalendarID: calendarID})
+	add(t, s, storage.Event{
+		Title:       "e",
+		StartDate:   base.Add(4 * time.Hour),
+		Description: "Бюджет на следующий год",
+		Attendees:   storage.Attendees{{UserID: guestID, Status: storage.RSVPDeclined}},
+	})
+
+	cond := func(field storage.EventField, typ storage.ConditionType, sample interface{}) storage.EventCondition {
+		return storage.EventCondition{Field: field, Type: typ, Sample: sample}
+	}
+	tests := []struct {
+		name   string
+		filter []storage.EventCondition
+		want   []string
+	}{
+		{"all", nil, []string{"a", "b", "c", "d", "e"}},
+		{"user", []storage.EventCondition{cond(storage.EventUserID, storage.TypeEq, userID)}, []string{"a", "b", "c"}},
+		{
+			"not user",
+			[]storage.EventCondition{cond(storage.EventUserID, storage.TypeNotEq, userID)},
+			[]string{"d", "e"},
+		},
+		{"title", []storage.EventCondition{cond(storage.EventTitle, storage.TypeEq, "c")}, []string{"c"}},
+		{
+			"title in",
+			[]storage.EventCondition{cond(storage.EventTitle, storage.TypeIn, []string{"a", "e", "x"})},
+			[]string{"a", "e"},
+		},
+		{
+			"id in",
+			[]storage.EventCondition{cond(storage.EventID, storage.TypeIn, []uuid.UUID{uuid.New()})},
+			[]string{},
+		},
+		{
+			"start period",
+			[]storage.EventCondition{
+				cond(storage.EventStartDate, storage.TypeMoreOrEq, base.Add(time.Hour)),
+				cond(storage.EventStartDate, storage.TypeLess, base.Add(3*time.Hour)),
+			},
+			[]string{"b", "c"},
+		},
+		{
+			"strict bounds",
+			[]storage.EventCondition{
+				cond(storage.EventStartDate, storage.TypeMore, base.Add(time.Hour)),
+				cond(storage.EventStartDate, storage.TypeLessOrEq, base.Add(3*time.Hour)),
+			},
+			[]string{"c", "d"},
+		},
+		{
+			"overlap",
+			[]storage.EventCondition{
+				cond(storage.EventStartDate, storage.TypeLess, base.Add(4*time.Hour)),
+				cond(storage.EventEndDate, storage.TypeMore, base.Add(3*time.Hour+30*time.Minute)),
+			},
+			[]string{"c", "d"},
+		},
+		{
+			"period in other time zone",
+			[]storage.EventCondition{
+				cond(storage.EventStartDate, storage.TypeEq, base.In(time.FixedZone("UTC+3", 3*60*60))),
+			},
+			[]string{"a"},
+		},
+		{"recurring", []storage.EventCondition{cond(storage.EventRRule, storage.TypeNotEq, "")}, []string{"b"}},
+		{
+			"attendee",
+			[]storage.EventCondition{cond(storage.EventAttendees, storage.TypeEq, guestID)},
+			[]string{"c", "e"},
+		},
+		{"tag", []storage.EventCondition{cond(storage.EventTags, storage.TypeEq, "on-call")}, []string{"a", "c"}},
+		{
+			"not tag",
+			[]storage.EventCondition{cond(storage.EventTags, storage.TypeNotEq, "release")},
+			[]string{"a", "b", "d", "e"},
+		},
+		{
+			"tags",
+			[]storage.EventCondition{
+				cond(storage.EventTags, storage.TypeEq, "on-call"),
+				cond(storage.EventTags, storage.TypeEq, "release"),
+			},
+			[]string{"c"},
+		},
+		{
+			"calendar in",
+			[]storage.EventCondition{cond(storage.EventCalendarID, storage.TypeIn, []uuid.UUID{calendarID})},
+			[]string{"d"},
+		},
+		{"match", []storage.EventCondition{cond(storage.EventText, storage.TypeMatch, "БЮДЖЕТ")}, []string{"e"}},
+		{
+			"match all words",
+			[]storage.EventCondition{cond(storage.EventText, storage.TypeMatch, "бюджета, обсуждение")},
+			[]string{"a"},
+		},
+		{
+			"or",
+			[]storage.EventCondition{storage.Or(
+				cond(storage.EventUserID, storage.TypeEq, userID),
+				cond(storage.EventAttendees, storage.TypeEq, guestID),
+				cond(storage.EventCalendarID, storage.TypeIn, []uuid.UUID{calendarID}),
+			), cond(storage.EventRRule, storage.TypeEq, "")},
+			[]string{"a", "c", "d", "e"},
+		},
+		{
+			"not",
+			[]storage.EventCondition{
+				cond(storage.EventUserID, storage.TypeEq, userID),
+				storage.Not(cond(storage.EventTitle, storage.TypeIn, []string{"a", "b"})),
+			},
+			[]string{"c"},
+		},
+		{
+			"and inside or",
+			[]storage.EventCondition{storage.Or(
+				storage.And(
+					cond(storage.EventUserID, storage.TypeEq, userID),
+					cond(storage.EventStartDate, storage.TypeMore, base),
+				),
+				cond(storage.EventTitle, storage.TypeEq, "e"),
+			)},
+			[]string{"b", "c", "e"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.ElementsMatch(t, tt.want, titles(get(t, s, tt.filter, nil, storage.Page{})))
+		})
+	}
+}
+
+func testTags(t *testing.T, s Storage) {
+	ctx := context.Background()
+	userID := uuid.New()
+	otherID := uuid.New()
+	first := add(t, s, storage.Event{
+		Title:     "first",
+		UserID:    userID,
+		StartDate: base,
+		Tags:      storage.Tags{{Name: "on-call", Color: "red"}, {Name: "1:1"}},
+	})
+	require.Equal(t, storage.Tags{{Name: "1:1"}, {Name: "on-call", Color: "red"}}, sortTags(first.Tags))
+	// цвет метки общий для событий владельца, пустой цвет его не меняет
+	second := add(t, s, storage.Event{
+		Title:     "second",
+		UserID:    userID,
+		StartDate: base.Add(time.Hour),
+		Tags:      storage.Tags{{Name: "on-call"}},
+	})
+	require.Equal(t, storage.Tags{{Name: "on-call", Color: "red"}}, second.Tags)
+	// у другого пользователя свои метки
+	other := add(t, s, storage.Event{
+		Title:     "other",
+		UserID:    otherID,
+		StartDate: base,
+		Tags:      storage.Tags{{Name: "on-call", Color: "blue"}},
+	})
+	require.Equal(t, storage.Tags{{Name: "on-call", Color: "blue"}}, other.Tags)
+
+	second.Tags = storage.Tags{{Name: "on-call", Color: "green"}, {Name: "release"}}
+	require.NoError(t, s.UpdateEvent(ctx, second))
+	stored, err := s.GetEvent(ctx, first.ID)
+	require.NoError(t, err)
+	require.Equal(t, storage.Tags{{Name: "1:1"}, {Name: "on-call", Color: "green"}}, sortTags(stored.Tags))
+	stored, err = s.GetEvent(ctx, other.ID)
+	require.NoError(t, err)
+	require.Equal(t, storage.Tags{{Name: "on-call", Color: "blue"}}, stored.Tags)
+
+	first.Tags = nil
+	require.NoError(t, s.UpdateEvent(ctx, first))
+	stored, err = s.GetEvent(ctx, first.ID)
+	require.NoError(t, err)
+	require.Len(t, stored.Tags, 0)
+	byTag := []storage.EventCondition{{Field: storage.EventTags, Type: storage.TypeEq, Sample: "on-call"}}
+	require.ElementsMatch(t, []string{"second", "other"}, titles(get(t, s, byTag, nil, storage.Page{})))
+	events := get(t, s, append(byTag, storage.EventCondition{
+		Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID,
+	}), nil, storage.Page{})
+	require.Len(t, events, 1)
+	require.Equal(t, storage.Tags{{Name: "on-call", Color: "green"}, {Name: "release"}}, sortTags(events[0].Tags))
+}
+
+func sortTags(tags storage.Tags) storage.Tags {
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags
+}
+
+// События на целые дни хранятся как обычные, с датами в полночь UTC, и находятся по пересечению с периодом.
+func testAllDay(t *testing.T, s Storage) {
+	ctx := context.Background()
+	userID := uuid.New()
+	day := time.Date(2030, time.January, 8, 0, 0, 0, 0, time.UTC)
+	offsite := add(t, s, storage.Event{
+		Title:     "offsite",
+		UserID:    userID,
+		StartDate: day,
+		EndDate:   day.AddDate(0, 0, 3),
+		AllDay:    true,
+	})
+	add(t, s, storage.Event{Title: "meeting", UserID: userID, StartDate: base})
+
+	stored, err := s.GetEvent(ctx, offsite.ID)
+	require.NoError(t, err)
+	require.True(t, stored.AllDay)
+	require.True(t, day.Equal(stored.StartDate))
+	require.True(t, day.AddDate(0, 0, 3).Equal(stored.EndDate))
+
+	overlap := func(from, to time.Time) []storage.EventCondition {
+		return []storage.EventCondition{
+			{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
+			{Field: storage.EventStartDate, Type: storage.TypeLess, Sample: to},
+			{Field: storage.EventEndDate, Type: storage.TypeMore, Sample: from},
+		}
+	}
+	// начавшееся раньше периода событие попадает в него, день окончания в событие не входит
+	require.ElementsMatch(
+		t,
+		[]string{"offsite", "meeting"},
+		titles(get(t, s, overlap(base, base.Add(24*time.Hour)), nil, storage.Page{})),
+	)
+	require.Empty(t, get(t, s, overlap(day.AddDate(0, 0, 3), day.AddDate(0, 0, 4)), nil, storage.Page{}))
+
+	filter := []storage.EventCondition{{Field: storage.EventAllDay, Type: storage.TypeEq, Sample: true}}
+	require.Equal(t, []string{"offsite"}, titles(get(t, s, filter, nil, storage.Page{})))
+
+	// события на целые дни время не занимают
+	busy, err := s.GetBusyIntervals(ctx, []uuid.UUID{userID}, day, day.AddDate(0, 0, 3))
+	require.NoError(t, err)
+	require.Equal(t, map[uuid.UUID][]storage.Interval{
+		userID: {{Start: base, End: base.Add(time.Hour)}},
+	}, inUTC(busy))
+
+	offsite.AllDay = false
+	require.NoError(t, s.UpdateEvent(ctx, offsite))
+	stored, err = s.GetEvent(ctx, offsite.ID)
+	require.NoError(t, err)
+	require.False(t, stored.AllDay)
+	require.Empty(t, get(t, s, filter, nil, storage.Page{}))
+}
+
+func testSorting(t *testing.T, s Storage) {
+	userID := uuid.New()
+	add(t, s, storage.Event{Title: "b", UserID: userID, StartDate: base, EndDate: base.Add(2 * time.Hour)})
+	add(t, s, storage.Event{Title: "a", UserID: userID, StartDate: base.Add(time.Hour)})
+	add(t, s, storage.Event{Title: "c", UserID: userID, StartDate: base})
+	filter := []storage.EventCondition{{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID}}
+
+	tests := []struct {
+		name  string
+		order []storage.EventSort
+		want  []string
+	}{
+		{
+			"title",
+			[]storage.EventSort{{Field: storage.EventTitle, Direction: storage.DirectionAsc}},
+			[]string{"a", "b", "c"},
+		},
+		{
+			"title desc",
+			[]storage.EventSort{{Field: storage.EventTitle, Direction: storage.DirectionDesc}},
+			[]string{"c", "b", "a"},
+		},
+		{
+			"start and end",
+			[]storage.EventSort{
+				{Field: storage.EventStartDate, Direction: storage.DirectionAsc},
+				{Field: storage.EventEndDate, Direction: storage.DirectionAsc},
+			},
+			[]string{"c", "b", "a"},
+		},
+		{
+			"start desc and title",
+			[]storage.EventSort{
+				{Field: storage.EventStartDate, Direction: storage.DirectionDesc},
+				{Field: storage.EventTitle, Direction: storage.DirectionDesc},
+			},
+			[]string{"a", "c", "b"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, titles(get(t, s, filter, tt.order, storage.Page{})))
+		})
+	}
+}
+
+func testPaging(t *testing.T, s Storage) {
+	userID := uuid.New()
+	events := make([]storage.Event, 7)
+	for i := range events {
+		// события с одинаковым началом упорядочены по ID
+		events[i] = add(t, s, storage.Event{
+			Title:     fmt.Sprint(i),
+			UserID:    userID,
+			StartDate: base.Add(time.Duration(i/2) * time.Hour),
+		})
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return storage.CursorOf(events[i]).Before(events[j])
+	})
+	filter := []storage.EventCondition{{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID}}
+
+	var got []storage.Event
+	page := storage.Page{Limit: 3}
+	for {
+		res := get(t, s, filter, nil, page)
+		require.LessOrEqual(t, len(res), 3)
+		if len(res) == 0 {
+			break
+		}
+		got = append(got, res...)
+		page.After = storage.CursorOf(res[len(res)-1])
+	}
+	require.Equal(t, ids(events), ids(got))
+}
+
+// Напоминания сравниваются с точностью до секунды: время напоминания - начало события минус Before.
+func testNotifications(t *testing.T, s Storage) {
+	ctx := context.Background()
+	// now - середина секунды 10:00:00
+	now := base.Add(500 * time.Millisecond)
+	notifyAt := func(at time.Time, title string) storage.Event {
+		return storage.Event{Title: title, StartDate: at.Add(30 * time.Minute), Reminders: reminders(30 * time.Minute)}
+	}
+
+	add(t, s, notifyAt(base.Add(-time.Second), "due"))
+	add(t, s, notifyAt(base.Add(-time.Hour), "long due"))
+	add(t, s, notifyAt(base, "same second"))
+	add(t, s, notifyAt(base.Add(time.Minute), "future"))
+	event := notifyAt(base.Add(-time.Second), "notified")
+	event.Reminders[0].NotifiedAt = base.Add(-time.Second)
+	add(t, s, event)
+	// уведомили в предыдущую секунду от напоминания, значит о нём ещё не уведомляли
+	event = notifyAt(base.Add(-time.Second), "notified earlier")
+	event.Reminders[0].NotifiedAt = base.Add(-1100 * time.Millisecond)
+	add(t, s, event)
+	// после прошлого уведомления событие перенесли
+	event = notifyAt(base.Add(-time.Minute), "rescheduled")
+	event.Reminders[0].NotifiedAt = base.Add(-2 * time.Hour)
+	add(t, s, event)
+	trashed := add(t, s, notifyAt(base.Add(-time.Second), "trashed"))
+	require.NoError(t, s.TrashEvent(ctx, trashed.ID, 0, base))
+
+	due := func(t *testing.T, at time.Time) []string {
+		t.Helper()
+		res, err := s.NotificationNeededEvents(ctx, at)
+		require.NoError(t, err)
+		return notified(res)
+	}
+	require.ElementsMatch(t, []string{"due", "long due", "notified earlier", "rescheduled"}, due(t, now))
+	require.ElementsMatch(t, []string{"due", "long due", "notified earlier", "rescheduled", "same second"},
+		due(t, base.Add(time.Second)))
+	require.ElementsMatch(t, []string{"long due", "rescheduled"}, due(t, base.Add(-time.Second)))
+
+	events := get(t, s, []storage.EventCondition{
+		{Field: storage.EventTitle, Type: storage.TypeIn, Sample: []string{"due", "long due"}},
+	}, nil, storage.Page{})
+	marked := make([]storage.ReminderKey, len(events))
+	for i, e := range events {
+		marked[i] = storage.ReminderKey{EventID: e.ID, Before: 30 * time.Minute}
+	}
+	require.NoError(t, s.SetRemindersNotified(ctx, marked, now))
+	require.ElementsMatch(t, []string{"notified earlier", "rescheduled"}, due(t, now))
+	for _, e := range events {
+		stored, err := s.GetEvent(ctx, e.ID)
+		require.NoError(t, err)
+		require.True(t, now.Equal(stored.Reminders[0].NotifiedAt))
+		// отметка об уведомлении не меняет версию
+		require.Equal(t, e.Version, stored.Version)
+	}
+}
+
+func testRecurringNotifications(t *testing.T, s Storage) {
+	ctx := context.Background()
+	event := add(t, s, storage.Event{
+		Title:     "daily",
+		StartDate: base.Add(-48 * time.Hour),
+		Reminders: reminders(10 * time.Minute),
+		RRule:     "FREQ=DAILY",
+	})
+	add(t, s, storage.Event{Title: "future", StartDate: base.Add(48 * time.Hour), RRule: "FREQ=DAILY"})
+
+	res, err := s.NotificationNeededEvents(ctx, base.Add(-5*time.Minute))
+	require.NoError(t, err)
+	// приходит ближайший экземпляр серии
+	require.Equal(t, []storage.ReminderKey{{EventID: event.ID, Before: 10 * time.Minute}}, keys(res))
+	require.True(t, base.Equal(res[0].Event.StartDate))
+
+	require.NoError(t, s.SetRemindersNotified(ctx, keys(res), base.Add(-5*time.Minute)))
+	res, err = s.NotificationNeededEvents(ctx, base.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Len(t, res, 0)
+}
+
+// У каждого напоминания своё время отправки: отправленное напоминание не мешает следующему.
+func testMultipleReminders(t *testing.T, s Storage) {
+	ctx := context.Background()
+	event := add(t, s, storage.Event{
+		Title:     "meeting",
+		StartDate: base,
+		Reminders: reminders(15*time.Minute, 24*time.Hour),
+	})
+	recurring := add(t, s, storage.Event{
+		Title:     "daily",
+		StartDate: base,
+		Reminders: reminders(5*time.Minute, time.Hour),
+		RRule:     "FREQ=DAILY",
+	})
+
+	// за 30 минут до начала пора отправить только напоминания за сутки и за час
+	res, err := s.NotificationNeededEvents(ctx, base.Add(-30*time.Minute))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []storage.ReminderKey{
+		{EventID: event.ID, Before: 24 * time.Hour},
+		{EventID: recurring.ID, Before: time.Hour},
+	}, keys(res))
+	for _, n := range res {
+		require.True(t, base.Equal(n.Event.StartDate))
+	}
+	require.NoError(t, s.SetRemindersNotified(ctx, keys(res), base.Add(-30*time.Minute)))
+
+	res, err = s.NotificationNeededEvents(ctx, base.Add(-20*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, res, 0)
+
+	res, err = s.NotificationNeededEvents(ctx, base.Add(-time.Minute))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []storage.ReminderKey{
+		{EventID: event.ID, Before: 15 * time.Minute},
+		{EventID: recurring.ID, Before: 5 * time.Minute},
+	}, keys(res))
+	require.NoError(t, s.SetRemindersNotified(ctx, keys(res), base.Add(-time.Minute)))
+
+	stored, err := s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Len(t, stored.Reminders, 2)
+	for _, r := range stored.Reminders {
+		require.False(t, r.NotifiedAt.IsZero())
+	}
+	// напоминания заменяются вместе с событием
+	stored.Reminders = reminders(time.Hour)
+	require.NoError(t, s.UpdateEvent(ctx, stored))
+	stored, err = s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, reminders(time.Hour), stored.Reminders)
+	res, err = s.NotificationNeededEvents(ctx, base.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, []storage.ReminderKey{{EventID: event.ID, Before: time.Hour}}, keys(res))
+}
+
+func testDeleteEvents(t *testing.T, s Storage) {
+	ctx := context.Background()
+	old := add(t, s, storage.Event{Title: "old", StartDate: base.Add(-48 * time.Hour)})
+	trashed := add(t, s, storage.Event{Title: "trashed", StartDate: base})
+	require.NoError(t, s.TrashEvent(ctx, trashed.ID, 0, base.Add(-24*time.Hour)))
+	kept := add(t, s, storage.Event{Title: "kept", StartDate: base})
+
+	cnt, err := s.DeleteEvents(ctx, []storage.EventCondition{
+		{Field: storage.EventEndDate, Type: storage.TypeLess, Sample: base.Add(-time.Hour)},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), cnt)
+	_, err = s.GetEvent(ctx, old.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+
+	// удаление работает и для событий в корзине, как при её очистке планировщиком
+	cnt, err = s.DeleteEvents(ctx, []storage.EventCondition{
+		{Field: storage.EventDeletedAt, Type: storage.TypeNotEq, Sample: time.Time{}},
+		{Field: storage.EventDeletedAt, Type: storage.TypeLess, Sample: base},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), cnt)
+	_, err = s.GetEvent(ctx, trashed.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	_, err = s.GetEvent(ctx, kept.ID)
+	require.NoError(t, err)
+}
+
+func testWithTx(t *testing.T, s Storage) {
+	ctx := context.Background()
+	event := add(t, s, storage.Event{Title: "kept", StartDate: base})
+	errFailed := errors.New("failed")
+
+	var added storage.Event
+	err := s.WithTx(ctx, func(tx app.Storage) error {
+		var err error
+		added, err = tx.AddEvent(ctx, storage.Event{
+			Title:     "added",
+			UserID:    event.UserID,
+			StartDate: base,
+			EndDate:   base.Add(time.Hour),
+		})
+		require.NoError(t, err)
+		changed := event
+		changed.Title = "changed"
+		require.NoError(t, tx.UpdateEvent(ctx, changed))
+		require.NoError(t, tx.AddHistory(ctx, storage.HistoryRecord{EventID: event.ID, Action: storage.ActionUpdate}))
+		return errFailed
+	})
+	require.ErrorIs(t, err, errFailed)
+
+	_, err = s.GetEvent(ctx, added.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	stored, err := s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, "kept", stored.Title)
+	require.Equal(t, event.Version, stored.Version)
+	history, err := s.GetHistory(ctx, event.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 0)
+
+	err = s.WithTx(ctx, func(tx app.Storage) error {
+		changed := event
+		changed.Title = "changed"
+		return tx.UpdateEvent(ctx, changed)
+	})
+	require.NoError(t, err)
+	stored, err = s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, "changed", stored.Title)
+}
+
+// Повторения считаются в поясе серии, в каком бы поясе хранилище ни вернуло даты события.
+func testRecurringTimeZone(t *testing.T, s Storage) {
+	ctx := context.Background()
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// понедельник 01:00 по Москве - воскресенье 22:00 UTC
+	standup := time.Date(2030, time.January, 7, 1, 0, 0, 0, moscow)
+	userID := uuid.New()
+	weekly := add(t, s, storage.Event{
+		UserID:    userID,
+		StartDate: standup,
+		EndDate:   standup.Add(15 * time.Minute),
+		RRule:     "FREQ=WEEKLY;BYDAY=MO",
+		TimeZone:  "Europe/Moscow",
+	})
+	// 09:00 в Нью-Йорке и после перехода на летнее время 10 марта 2030
+	morning := time.Date(2030, time.March, 4, 9, 0, 0, 0, newYork)
+	meeting := add(t, s, storage.Event{
+		StartDate: morning,
+		EndDate:   morning.Add(time.Hour),
+		RRule:     "FREQ=WEEKLY",
+		TimeZone:  "America/New_York",
+	})
+
+	stored, err := s.GetEvent(ctx, weekly.ID)
+	require.NoError(t, err)
+	require.Equal(t, "Europe/Moscow", stored.TimeZone)
+	occurrences, err := stored.Occurrences(standup, standup.Add(20*24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, occurrences, 3)
+	for i, o := range occurrences {
+		require.Equal(t, standup.AddDate(0, 0, 7*i).UTC(), o.StartDate.UTC())
+	}
+
+	stored, err = s.GetEvent(ctx, meeting.ID)
+	require.NoError(t, err)
+	occurrences, err = stored.Occurrences(morning, morning.Add(10*24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, occurrences, 2)
+	require.Equal(t, morning.AddDate(0, 0, 7).UTC(), occurrences[1].StartDate.UTC())
+	require.Equal(t, 9, occurrences[1].StartDate.In(newYork).Hour())
+
+	busy, err := s.GetBusyIntervals(ctx, []uuid.UUID{userID}, standup.Add(time.Hour), standup.AddDate(0, 0, 8))
+	require.NoError(t, err)
+	next := standup.AddDate(0, 0, 7).UTC()
+	require.Equal(t, map[uuid.UUID][]storage.Interval{
+		userID: {{Start: next, End: next.Add(15 * time.Minute)}},
+	}, inUTC(busy))
+}
+
+func testBusyIntervals(t *testing.T, s Storage) {
+	ctx := context.Background()
+	userID := uuid.New()
+	guestID := uuid.New()
+	add(t, s, storage.Event{UserID: userID, StartDate: base, EndDate: base.Add(time.Hour)})
+	add(t, s, storage.Event{
+		StartDate: base.Add(30 * time.Minute),
+		EndDate:   base.Add(2 * time.Hour),
+		Attendees: storage.Attendees{{UserID: userID, Status: storage.RSVPAccepted}},
+	})
+	add(t, s, storage.Event{
+		StartDate: base.Add(3 * time.Hour),
+		Attendees: storage.Attendees{{UserID: userID, Status: storage.RSVPDeclined}},
+	})
+	add(t, s, storage.Event{
+		UserID:    guestID,
+		StartDate: base.Add(-48*time.Hour + 5*time.Hour),
+		EndDate:   base.Add(-48*time.Hour + 6*time.Hour),
+		RRule:     "FREQ=DAILY",
+	})
+
+	busy, err := s.GetBusyIntervals(ctx, []uuid.UUID{userID, guestID}, base, base.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, map[uuid.UUID][]storage.Interval{
+		userID:  {{Start: base, End: base.Add(2 * time.Hour)}},
+		guestID: {{Start: base.Add(5 * time.Hour), End: base.Add(6 * time.Hour)}},
+	}, inUTC(busy))
+}
+
+func inUTC(busy map[uuid.UUID][]storage.Interval) map[uuid.UUID][]storage.Interval {
+	for _, intervals := range busy {
+		for i := range intervals {
+			intervals[i].Start = intervals[i].Start.UTC()
+			intervals[i].End = intervals[i].End.UTC()
+		}
+	}
+	return busy
+}
+
+// Одновременные изменения одного события: проходит ровно одно изменение с текущей версией.
+func testConcurrentWrites(t *testing.T, s Storage) {
+	ctx := context.Background()
+	event := add(t, s, storage.Event{Title: "event", StartDate: base})
+	const workers = 8
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	added := make(chan storage.Event, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			changed := event
+			changed.Title = fmt.Sprint(i)
+			errs <- s.UpdateEvent(ctx, changed)
+			e, err := s.AddEvent(ctx, storage.Event{
+				Title:     "added",
+				UserID:    event.UserID,
+				StartDate: base.Add(time.Duration(i) * time.Hour),
+				EndDate:   base.Add(time.Duration(i+1) * time.Hour),
+			})
+			if err == nil {
+				added <- e
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	close(added)
+
+	updated := 0
+	for err := range errs {
+		if err == nil {
+			updated++
+			continue
+		}
+		require.ErrorIs(t, err, storage.ErrVersionConflict)
+	}
+	require.Equal(t, 1, updated)
+	require.Len(t, added, workers)
+	stored, err := s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, event.Version+1, stored.Version)
+
+	events := get(t, s, []storage.EventCondition{
+		{Field: storage.EventTitle, Type: storage.TypeEq, Sample: "added"},
+	}, nil, storage.Page{})
+	require.Len(t, events, workers)
+}
+
+// Из одновременно созданных пересекающихся событий пользователя проверку пересечений проходит только одно.
+func testConcurrentCreates(t *testing.T, s Storage) {
+	ctx := context.Background()
+	a := app.New(*zap.NewNop(), s)
+	userID := uuid.New()
+	const workers = 8
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := a.CreateEvent(ctx, userID, storage.Event{
+				Title:     fmt.Sprint(i),
+				StartDate: base.Add(time.Duration(i) * time.Minute),
+				EndDate:   base.Add(time.Hour),
+			}, false)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		require.ErrorIs(t, err, app.ErrDateBusy)
+	}
+	require.Equal(t, 1, created)
+	events := get(t, s, []storage.EventCondition{
+		{Field: storage.EventUserID, Type: storage.TypeEq, Sample: userID},
+	}, nil, storage.Page{})
+	require.Len(t, events, 1)
+}
+
+// Планировщик и приложение работают с хранилищем одновременно.
+func testConcurrentNotifications(t *testing.T, s Storage) {
+	ctx := context.Background()
+	const workers = 4
+	const perWorker = 10
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				start := base.Add(time.Duration(i*perWorker+j) * time.Minute)
+				_, err := s.AddEvent(ctx, storage.Event{
+					Title:     "event",
+					UserID:    uuid.New(),
+					StartDate: start,
+					EndDate:   start.Add(time.Hour),
+					Reminders: reminders(time.Hour, 2*time.Hour),
+				})
+				assert.NoError(t, err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				res, err := s.NotificationNeededEvents(ctx, base)
+				assert.NoError(t, err)
+				assert.NoError(t, s.SetRemindersNotified(ctx, keys(res), base))
+			}
+		}()
+	}
+	wg.Wait()
+
+	res, err := s.NotificationNeededEvents(ctx, base)
+	require.NoError(t, err)
+	require.NoError(t, s.SetRemindersNotified(ctx, keys(res), base))
+	res, err = s.NotificationNeededEvents(ctx, base)
+	require.NoError(t, err)
+	require.Len(t, res, 0)
+	require.Len(t, get(t, s, nil, nil, storage.Page{}), workers*perWorker)
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"strings"
+)
+
+// Tag - метка события. Метки принадлежат владельцу события: цвет метки один для всех его событий с ней.
+type Tag struct {
+	Name  string `db:"name"`
+	Color string `db:"color"`
+}
+
+type Tags []Tag
+
+func (t Tags) Find(name string) (Tag, bool) {
+	for _, v := range t {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Tag{}, false
+}
+
+func (t Tags) Contains(name string) bool {
+	_, ok := t.Find(name)
+	return ok
+}
+
+func (t Tags) Names() []string {
+	res := make([]string, len(t))
+	for i, v := range t {
+		res[i] = v.Name
+	}
+	return res
+}
+
+// String - названия меток через запятую, цвет в историю изменений события не попадает.
+func (t Tags) String() string {
+	return strings.Join(t.Names(), ",")
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inenagl/hw-Go-Prof/hw12_13_14_15_calendar/internal/rrule"
+)
+
+// WorkingHours - рабочее время пользователя: с Start до End от полуночи в поясе TimeZone в дни Weekdays.
+type WorkingHours struct {
+	UserID   uuid.UUID     `db:"user_id"`
+	TimeZone string        `db:"time_zone"`
+	Start    time.Duration `db:"start_time"`
+	End      time.Duration `db:"end_time"`
+	Weekdays Weekdays      `db:"weekdays"`
+}
+
+// DefaultWorkingHours - рабочее время пользователя, который его не настроил: с 9 до 18 UTC по будням.
+func DefaultWorkingHours(userID uuid.UUID) WorkingHours {
+	return WorkingHours{
+		UserID:   userID,
+		TimeZone: "UTC",
+		Start:    9 * time.Hour,
+		End:      18 * time.Hour,
+		Weekdays: Weekdays{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	}
+}
+
+// Intervals возвращает рабочие интервалы в периоде [from, to). Время считается по часам пояса пользователя,
+// поэтому при переходе на летнее время рабочий день не сдвигается.
+func (w WorkingHours) Intervals(from, to time.Time) ([]Interval, error) {
+	loc, err := time.LoadLocation(w.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Interval, 0)
+	local := from.In(loc)
+	for d := 0; ; d++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+d, 0, 0, 0, 0, loc)
+		if !day.Before(to) {
+			break
+		}
+		if !w.Weekdays.Contains(day.Weekday()) {
+			continue
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, int(w.Start), loc)
+		end := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, int(w.End), loc)
+		if !start.Before(to) || !end.After(from) {
+			continue
+		}
+		res = append(res, Interval{Start: maxTime(start, from).UTC(), End: minTime(end, to).UTC()})
+	}
+
+	return res, nil
+}
+
+// Weekdays хранится в БД одной строкой в формате BYDAY ("MO,TU").
+type Weekdays []time.Weekday
+
+func (w Weekdays) Contains(wd time.Weekday) bool {
+	for _, v := range w {
+		if v == wd {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Weekdays) String() string {
+	return rrule.FormatWeekdays(w)
+}
+
+func (w Weekdays) Value() (driver.Value, error) {
+	return w.String(), nil
+}
+
+func (w *Weekdays) Scan(src interface{}) error {
+	var str string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	default:
+		return fmt.Errorf("%w: %T", ErrIncomparableType, src)
+	}
+
+	*w = nil
+	if str == "" {
+		return nil
+	}
+	days, err := rrule.ParseWeekdays(str)
+	if err != nil {
+		return err
+	}
+	*w = days
+	return nil
+}
@@ -244,7 +244,8 @@ func (s *CalendarGRPCSuite) TestGetForWeek() {
 	// Делаем по событию в каждом дне.
 	for i := 0; i < 10; i++ {
 		ev = randomGRPCEvent()
-		start = days[i].Add(randomDuration())
+		// Событие должно закончиться в тот же день, иначе оно пересечётся с событием следующего дня.
+		start = days[i].Add(randomDuration() % (22 * time.Hour))
 		ev.StartDate = timestamppb.New(start)
 		ev.EndDate = timestamppb.New(start.Add(time.Hour))
 
@@ -289,7 +290,8 @@ func (s *CalendarGRPCSuite) TestGetForMonth() {
 	// Делаем по событию в каждом дне.
 	for i := 0; i < 10; i++ {
 		ev = randomGRPCEvent()
-		start = days[i].Add(randomDuration())
+		// Событие должно закончиться в тот же день, иначе оно пересечётся с событием следующего дня.
+		start = days[i].Add(randomDuration() % (22 * time.Hour))
 		ev.StartDate = timestamppb.New(start)
 		ev.EndDate = timestamppb.New(start.Add(time.Hour))
 
@@ -25,6 +25,7 @@ type CalendarRESTSuite struct {
 	userID string
 	client http.Client
 	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func (s *CalendarRESTSuite) SetupSuite() {
@@ -34,10 +35,11 @@ func (s *CalendarRESTSuite) SetupSuite() {
 	}
 	s.addr = "http://" + httpAddr
 	s.client = http.Client{}
-	s.ctx, _ = context.WithTimeout(context.Background(), 5*time.Second) //nolint: govet
+	s.ctx, s.cancel = context.WithTimeout(context.Background(), 5*time.Second)
 }
 
-func (s *CalendarRESTSuite) TeardownSuite() {
+func (s *CalendarRESTSuite) TearDownSuite() {
+	s.cancel()
 }
 
 func (s *CalendarRESTSuite) SetupTest() {
@@ -343,7 +345,8 @@ func (s *CalendarRESTSuite) TestGetForWeek() {
 	// Делаем по событию в каждом дне.
 	for i := 0; i < 10; i++ {
 		ev = randomEvent()
-		start = days[i].Add(randomDuration())
+		// Событие должно закончиться в тот же день, иначе оно пересечётся с событием следующего дня.
+		start = days[i].Add(randomDuration() % (22 * time.Hour))
 		ev.StartDate = start
 		ev.EndDate = start.Add(time.Hour)
 
@@ -391,7 +394,8 @@ func (s *CalendarRESTSuite) TestGetForMonth() {
 	// Делаем по событию в каждом дне.
 	for i := 0; i < 10; i++ {
 		ev = randomEvent()
-		start = days[i].Add(randomDuration())
+		// Событие должно закончиться в тот же день, иначе оно пересечётся с событием следующего дня.
+		start = days[i].Add(randomDuration() % (22 * time.Hour))
 		ev.StartDate = start
 		ev.EndDate = start.Add(time.Hour)
 
@@ -419,6 +423,60 @@ func (s *CalendarRESTSuite) TestGetForMonth() {
 	s.Require().EqualValues(expected, actual)
 }
 
+func (s *CalendarRESTSuite) TestCreateOverlappingEvent() {
+	event := randomEvent()
+	event.EndDate = event.StartDate.Add(time.Hour)
+	res, err := s.client.Do(s.createEventReq(&event))
+	s.Require().NoError(err)
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	overlapping := randomEvent()
+	overlapping.StartDate = event.StartDate.Add(-1 * time.Minute)
+	overlapping.EndDate = event.StartDate.Add(time.Minute)
+	res, err = s.client.Do(s.createEventReq(&overlapping))
+	s.Require().NoError(err)
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusConflict, res.StatusCode)
+
+	req := s.createEventReq(&overlapping)
+	req.URL.RawQuery = internalhttp.AllowOverlapParam + "=true"
+	res, err = s.client.Do(req)
+	s.Require().NoError(err)
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+}
+
+func (s *CalendarRESTSuite) TestRestoreEvent() {
+	event := randomEvent()
+
+	res, err := s.client.Do(s.createEventReq(&event))
+	s.Require().NoError(err)
+	defer res.Body.Close()
+	eventID := s.eventFromHTTPBody(res.Body).ID
+	event.ID = eventID
+
+	res, err = s.client.Do(s.deleteEventReq(eventID))
+	s.Require().NoError(err)
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	req, err := http.NewRequestWithContext(s.ctx, "POST", s.addr+"/event/"+eventID.String()+"/restore", nil)
+	s.Require().NoError(err)
+	req.Header.Add(internalhttp.UserIDHeader, s.userID)
+	res, err = s.client.Do(req)
+	s.Require().NoError(err)
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	// После восстановления событие снова доступно
+	res, err = s.client.Do(s.getEventReq(eventID))
+	s.Require().NoError(err)
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Require().Equal(event, s.eventFromHTTPBody(res.Body))
+}
+
 func TestCalendarRESTSuite(t *testing.T) {
 	suite.Run(t, new(CalendarRESTSuite))
 }
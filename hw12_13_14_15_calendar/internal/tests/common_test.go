@@ -67,17 +67,17 @@ func mapFromEvent(event storage.Event) map[string]interface{} {
 		"Description":  event.Description,
 		"StartDate":    event.StartDate.Format(time.DateTime),
 		"EndDate":      event.EndDate.Format(time.DateTime),
-		"NotifyBefore": event.NotifyBefore,
+		"NotifyBefore": event.Reminders.Earliest(),
 	}
 }
 
 func randomEvent() storage.Event {
 	start := randomDay().Add(randomDuration())
 	return storage.Event{
-		Title:        fake.Sentence(),
-		Description:  fake.Paragraph(),
-		StartDate:    start,
-		EndDate:      start.Add(randomDuration()),
-		NotifyBefore: randomDuration(),
+		Title:       fake.Sentence(),
+		Description: fake.Paragraph(),
+		StartDate:   start,
+		EndDate:     start.Add(randomDuration()),
+		Reminders:   storage.Reminders{{Before: randomDuration()}},
 	}
 }
@@ -1,13 +1,16 @@
--- +goose Up
--- +goose StatementBegin
+package migrations
+
+func init() {
+	register(
+		both(`
 ALTER TABLE Events
 ADD COLUMN notified_at TIMESTAMP;
 CREATE INDEX IF NOT EXISTS start_date_idx ON Events (start_date);
--- +goose StatementEnd
-
--- +goose Down
--- +goose StatementBegin
+`),
+		both(`
 ALTER TABLE Events
 DROP COLUMN notified_at;
 DROP INDEX IF EXISTS start_date_idx;
--- +goose StatementEnd
+`),
+	)
+}
@@ -0,0 +1,20 @@
+package migrations
+
+func init() {
+	register(
+		both(`
+ALTER TABLE Events
+ADD COLUMN rrule TEXT NOT NULL DEFAULT '';
+ALTER TABLE Events
+ADD COLUMN exdates TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS user_recurring_idx ON Events (user_id) WHERE rrule <> '';
+`),
+		both(`
+DROP INDEX IF EXISTS user_recurring_idx;
+ALTER TABLE Events
+DROP COLUMN rrule;
+ALTER TABLE Events
+DROP COLUMN exdates;
+`),
+	)
+}
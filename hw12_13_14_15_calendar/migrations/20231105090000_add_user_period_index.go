@@ -0,0 +1,12 @@
+package migrations
+
+func init() {
+	register(
+		both(`
+CREATE INDEX IF NOT EXISTS user_period_idx ON Events (user_id, start_date, end_date);
+`),
+		both(`
+DROP INDEX IF EXISTS user_period_idx;
+`),
+	)
+}
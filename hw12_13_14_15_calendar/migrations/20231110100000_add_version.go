@@ -0,0 +1,14 @@
+package migrations
+
+func init() {
+	register(
+		both(`
+ALTER TABLE Events
+ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+`),
+		both(`
+ALTER TABLE Events
+DROP COLUMN version;
+`),
+	)
+}
@@ -0,0 +1,23 @@
+package migrations
+
+func init() {
+	register(
+		statements{
+			postgres: `
+ALTER TABLE Events
+ADD COLUMN deleted_at TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00';
+CREATE INDEX IF NOT EXISTS trash_idx ON Events (user_id, deleted_at) WHERE deleted_at <> '0001-01-01 00:00:00';
+`,
+			sqlite: `
+ALTER TABLE Events
+ADD COLUMN deleted_at TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00+00:00';
+CREATE INDEX IF NOT EXISTS trash_idx ON Events (user_id, deleted_at) WHERE deleted_at <> '0001-01-01 00:00:00+00:00';
+`,
+		},
+		both(`
+DROP INDEX IF EXISTS trash_idx;
+ALTER TABLE Events
+DROP COLUMN deleted_at;
+`),
+	)
+}
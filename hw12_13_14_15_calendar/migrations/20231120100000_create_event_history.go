@@ -0,0 +1,34 @@
+package migrations
+
+func init() {
+	register(
+		statements{
+			postgres: `
+CREATE TABLE IF NOT EXISTS EventHistory (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    changes TEXT NOT NULL DEFAULT '[]'
+);
+CREATE INDEX IF NOT EXISTS history_event_idx ON EventHistory (event_id);
+`,
+			sqlite: `
+CREATE TABLE IF NOT EXISTS EventHistory (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    changes TEXT NOT NULL DEFAULT '[]'
+);
+CREATE INDEX IF NOT EXISTS history_event_idx ON EventHistory (event_id);
+`,
+		},
+		both(`
+DROP INDEX IF EXISTS history_event_idx;
+DROP TABLE IF EXISTS EventHistory;
+`),
+	)
+}
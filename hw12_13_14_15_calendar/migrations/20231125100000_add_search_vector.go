@@ -0,0 +1,51 @@
+package migrations
+
+func init() {
+	register(
+		statements{
+			postgres: `
+ALTER TABLE Events
+ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    to_tsvector('simple', coalesce(title, '') || ' ' || coalesce(description, ''))
+) STORED;
+CREATE INDEX IF NOT EXISTS search_idx ON Events USING GIN (search_vector);
+`,
+			sqlite: `
+-- Полнотекстовый поиск по названию и описанию: таблица FTS5, которую синхронизируют триггеры
+CREATE VIRTUAL TABLE IF NOT EXISTS EventSearch USING fts5(
+    title,
+    description,
+    content = 'Events',
+    content_rowid = 'num',
+    tokenize = 'unicode61 remove_diacritics 0'
+);
+CREATE TRIGGER IF NOT EXISTS event_search_insert AFTER INSERT ON Events BEGIN
+    INSERT INTO EventSearch (rowid, title, description) VALUES (new.num, new.title, new.description);
+END;
+CREATE TRIGGER IF NOT EXISTS event_search_delete AFTER DELETE ON Events BEGIN
+    INSERT INTO EventSearch (EventSearch, rowid, title, description)
+    VALUES ('delete', old.num, old.title, old.description);
+END;
+CREATE TRIGGER IF NOT EXISTS event_search_update AFTER UPDATE OF title, description ON Events BEGIN
+    INSERT INTO EventSearch (EventSearch, rowid, title, description)
+    VALUES ('delete', old.num, old.title, old.description);
+    INSERT INTO EventSearch (rowid, title, description) VALUES (new.num, new.title, new.description);
+END;
+INSERT INTO EventSearch (EventSearch) VALUES ('rebuild');
+`,
+		},
+		statements{
+			postgres: `
+DROP INDEX IF EXISTS search_idx;
+ALTER TABLE Events
+DROP COLUMN search_vector;
+`,
+			sqlite: `
+DROP TRIGGER IF EXISTS event_search_update;
+DROP TRIGGER IF EXISTS event_search_delete;
+DROP TRIGGER IF EXISTS event_search_insert;
+DROP TABLE IF EXISTS EventSearch;
+`,
+		},
+	)
+}
@@ -0,0 +1,38 @@
+package migrations
+
+func init() {
+	register(
+		statements{
+			postgres: `
+-- Существующие значения записывались в UTC
+DROP INDEX IF EXISTS trash_idx;
+ALTER TABLE Events
+ALTER COLUMN start_date TYPE TIMESTAMPTZ USING start_date AT TIME ZONE 'UTC',
+ALTER COLUMN end_date TYPE TIMESTAMPTZ USING end_date AT TIME ZONE 'UTC',
+ALTER COLUMN notified_at TYPE TIMESTAMPTZ USING notified_at AT TIME ZONE 'UTC',
+ALTER COLUMN deleted_at DROP DEFAULT,
+ALTER COLUMN deleted_at TYPE TIMESTAMPTZ USING deleted_at AT TIME ZONE 'UTC',
+ALTER COLUMN deleted_at SET DEFAULT '0001-01-01 00:00:00+00';
+CREATE INDEX IF NOT EXISTS trash_idx ON Events (user_id, deleted_at) WHERE deleted_at <> '0001-01-01 00:00:00+00';
+ALTER TABLE EventHistory
+ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC';
+`,
+			// в SQLite даты с самого начала хранятся строками в UTC со смещением
+		},
+		statements{
+			postgres: `
+DROP INDEX IF EXISTS trash_idx;
+ALTER TABLE EventHistory
+ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'UTC';
+ALTER TABLE Events
+ALTER COLUMN start_date TYPE TIMESTAMP USING start_date AT TIME ZONE 'UTC',
+ALTER COLUMN end_date TYPE TIMESTAMP USING end_date AT TIME ZONE 'UTC',
+ALTER COLUMN notified_at TYPE TIMESTAMP USING notified_at AT TIME ZONE 'UTC',
+ALTER COLUMN deleted_at DROP DEFAULT,
+ALTER COLUMN deleted_at TYPE TIMESTAMP USING deleted_at AT TIME ZONE 'UTC',
+ALTER COLUMN deleted_at SET DEFAULT '0001-01-01 00:00:00';
+CREATE INDEX IF NOT EXISTS trash_idx ON Events (user_id, deleted_at) WHERE deleted_at <> '0001-01-01 00:00:00';
+`,
+		},
+	)
+}
@@ -0,0 +1,30 @@
+package migrations
+
+func init() {
+	register(
+		statements{
+			postgres: `
+CREATE TABLE IF NOT EXISTS EventAttendees (
+    event_id UUID NOT NULL REFERENCES Events (id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'needs-action',
+    PRIMARY KEY (event_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS attendee_user_idx ON EventAttendees (user_id);
+`,
+			sqlite: `
+CREATE TABLE IF NOT EXISTS EventAttendees (
+    event_id TEXT NOT NULL REFERENCES Events (id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'needs-action',
+    PRIMARY KEY (event_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS attendee_user_idx ON EventAttendees (user_id);
+`,
+		},
+		both(`
+DROP INDEX IF EXISTS attendee_user_idx;
+DROP TABLE IF EXISTS EventAttendees;
+`),
+	)
+}
@@ -0,0 +1,61 @@
+package migrations
+
+func init() {
+	register(
+		statements{
+			postgres: `
+CREATE TABLE IF NOT EXISTS Calendars (
+    id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    owner_id UUID NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    color VARCHAR(32) NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS calendar_owner_idx ON Calendars (owner_id);
+
+CREATE TABLE IF NOT EXISTS CalendarGrants (
+    calendar_id UUID NOT NULL REFERENCES Calendars (id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    access VARCHAR(16) NOT NULL,
+    PRIMARY KEY (calendar_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS grant_user_idx ON CalendarGrants (user_id);
+
+-- Нулевой UUID - личное событие без календаря
+ALTER TABLE Events
+ADD COLUMN calendar_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000';
+CREATE INDEX IF NOT EXISTS event_calendar_idx ON Events (calendar_id, start_date);
+`,
+			sqlite: `
+CREATE TABLE IF NOT EXISTS Calendars (
+    id TEXT PRIMARY KEY,
+    owner_id TEXT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    color VARCHAR(32) NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS calendar_owner_idx ON Calendars (owner_id);
+
+CREATE TABLE IF NOT EXISTS CalendarGrants (
+    calendar_id TEXT NOT NULL REFERENCES Calendars (id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    access VARCHAR(16) NOT NULL,
+    PRIMARY KEY (calendar_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS grant_user_idx ON CalendarGrants (user_id);
+
+-- Нулевой UUID - личное событие без календаря
+ALTER TABLE Events
+ADD COLUMN calendar_id TEXT NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000';
+CREATE INDEX IF NOT EXISTS event_calendar_idx ON Events (calendar_id, start_date);
+`,
+		},
+		both(`
+DROP INDEX IF EXISTS event_calendar_idx;
+ALTER TABLE Events
+DROP COLUMN calendar_id;
+DROP INDEX IF EXISTS grant_user_idx;
+DROP TABLE IF EXISTS CalendarGrants;
+DROP INDEX IF EXISTS calendar_owner_idx;
+DROP TABLE IF EXISTS Calendars;
+`),
+	)
+}
@@ -0,0 +1,29 @@
+package migrations
+
+func init() {
+	register(
+		statements{
+			postgres: `
+CREATE TABLE IF NOT EXISTS WorkingHours (
+    user_id UUID PRIMARY KEY,
+    time_zone VARCHAR(64) NOT NULL,
+    start_time BIGINT NOT NULL,
+    end_time BIGINT NOT NULL,
+    weekdays VARCHAR(32) NOT NULL
+);
+`,
+			sqlite: `
+CREATE TABLE IF NOT EXISTS WorkingHours (
+    user_id TEXT PRIMARY KEY,
+    time_zone VARCHAR(64) NOT NULL,
+    start_time BIGINT NOT NULL,
+    end_time BIGINT NOT NULL,
+    weekdays VARCHAR(32) NOT NULL
+);
+`,
+		},
+		both(`
+DROP TABLE IF EXISTS WorkingHours;
+`),
+	)
+}
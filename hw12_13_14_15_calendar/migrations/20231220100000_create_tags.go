@@ -0,0 +1,47 @@
+package migrations
+
+func init() {
+	register(
+		statements{
+			postgres: `
+-- Метки принадлежат пользователю (владельцу событий), цвет метки общий для всех его событий
+CREATE TABLE IF NOT EXISTS Tags (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    color VARCHAR(32) NOT NULL DEFAULT '',
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS EventTags (
+    event_id UUID NOT NULL REFERENCES Events (id) ON DELETE CASCADE,
+    tag_id UUID NOT NULL REFERENCES Tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (event_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS event_tag_idx ON EventTags (tag_id);
+`,
+			sqlite: `
+-- Метки принадлежат пользователю (владельцу событий), цвет метки общий для всех его событий
+CREATE TABLE IF NOT EXISTS Tags (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    color VARCHAR(32) NOT NULL DEFAULT '',
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS EventTags (
+    event_id TEXT NOT NULL REFERENCES Events (id) ON DELETE CASCADE,
+    tag_id TEXT NOT NULL REFERENCES Tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (event_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS event_tag_idx ON EventTags (tag_id);
+`,
+		},
+		both(`
+DROP INDEX IF EXISTS event_tag_idx;
+DROP TABLE IF EXISTS EventTags;
+DROP TABLE IF EXISTS Tags;
+`),
+	)
+}
@@ -0,0 +1,15 @@
+package migrations
+
+func init() {
+	register(
+		both(`
+-- События на целые дни: даты - полночь UTC первого дня и дня после последнего
+ALTER TABLE Events
+ADD COLUMN all_day BOOLEAN NOT NULL DEFAULT FALSE;
+`),
+		both(`
+ALTER TABLE Events
+DROP COLUMN all_day;
+`),
+	)
+}
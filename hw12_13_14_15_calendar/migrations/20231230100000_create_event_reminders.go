@@ -0,0 +1,67 @@
+package migrations
+
+func init() {
+	register(
+		statements{
+			postgres: `
+-- Несколько напоминаний у события, у каждого своё время последней отправки
+CREATE TABLE IF NOT EXISTS EventReminders (
+    event_id UUID NOT NULL REFERENCES Events (id) ON DELETE CASCADE,
+    notify_before BIGINT NOT NULL,
+    notified_at TIMESTAMPTZ NOT NULL DEFAULT '0001-01-01 00:00:00+00',
+    PRIMARY KEY (event_id, notify_before)
+);
+INSERT INTO EventReminders (event_id, notify_before, notified_at)
+SELECT id, notify_before, COALESCE(notified_at, '0001-01-01 00:00:00+00')
+FROM Events
+WHERE notify_before > 0;
+ALTER TABLE Events
+DROP COLUMN notify_before,
+DROP COLUMN notified_at;
+`,
+			sqlite: `
+-- Несколько напоминаний у события, у каждого своё время последней отправки
+CREATE TABLE IF NOT EXISTS EventReminders (
+    event_id TEXT NOT NULL REFERENCES Events (id) ON DELETE CASCADE,
+    notify_before INTEGER NOT NULL,
+    notified_at TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00+00:00',
+    PRIMARY KEY (event_id, notify_before)
+);
+INSERT INTO EventReminders (event_id, notify_before, notified_at)
+SELECT id, notify_before, COALESCE(notified_at, '0001-01-01 00:00:00+00:00')
+FROM Events
+WHERE notify_before > 0;
+ALTER TABLE Events DROP COLUMN notify_before;
+ALTER TABLE Events DROP COLUMN notified_at;
+`,
+		},
+		statements{
+			postgres: `
+-- у события остаётся одно, самое раннее до начала, напоминание
+ALTER TABLE Events
+ADD COLUMN notify_before BIGINT,
+ADD COLUMN notified_at TIMESTAMPTZ;
+UPDATE Events e
+SET notify_before = r.notify_before, notified_at = r.notified_at
+FROM (
+    SELECT DISTINCT ON (event_id) event_id, notify_before, notified_at
+    FROM EventReminders
+    ORDER BY event_id, notify_before DESC
+) r
+WHERE r.event_id = e.id;
+DROP TABLE IF EXISTS EventReminders;
+`,
+			sqlite: `
+-- у события остаётся одно, самое раннее до начала, напоминание
+ALTER TABLE Events ADD COLUMN notify_before INTEGER;
+ALTER TABLE Events ADD COLUMN notified_at TIMESTAMP;
+UPDATE Events
+SET notify_before = (SELECT MAX(notify_before) FROM EventReminders r WHERE r.event_id = Events.id),
+    notified_at = (
+        SELECT notified_at FROM EventReminders r WHERE r.event_id = Events.id ORDER BY notify_before DESC LIMIT 1
+    );
+DROP TABLE IF EXISTS EventReminders;
+`,
+		},
+	)
+}
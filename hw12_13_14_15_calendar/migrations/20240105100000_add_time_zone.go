@@ -0,0 +1,15 @@
+package migrations
+
+func init() {
+	register(
+		both(`
+-- Пояс серии повторений (имя IANA), пустая строка - UTC
+ALTER TABLE Events
+ADD COLUMN time_zone TEXT NOT NULL DEFAULT '';
+`),
+		both(`
+ALTER TABLE Events
+DROP COLUMN time_zone;
+`),
+	)
+}
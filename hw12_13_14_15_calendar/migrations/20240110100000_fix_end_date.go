@@ -0,0 +1,15 @@
+package migrations
+
+func init() {
+	register(
+		both(`
+-- События без даты окончания (или с окончанием раньше начала) заканчиваются в момент начала,
+-- иначе они не попадают в выборки за период
+UPDATE Events
+SET end_date = start_date
+WHERE end_date < start_date;
+`),
+		// исходные даты окончания не сохранились
+		statements{},
+	)
+}
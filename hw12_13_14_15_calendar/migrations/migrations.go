@@ -0,0 +1,75 @@
+// Package migrations - миграции схемы БД для PostgreSQL и SQLite с общей последовательностью версий: каждое
+// изменение схемы - одна миграция на Go, SQL для диалектов различается только там, где без этого не обойтись.
+// В SQLite UUID хранятся строками, даты - строками в UTC в формате драйвера
+// ("2006-01-02 15:04:05.999999999+00:00") и сравниваются как строки.
+//
+// Миграции регистрируются в goose при импорте пакета, применяет их Run (cmd/migrate).
+// Новая миграция: файл <версия>_<название>.go, в init которого вызывается register.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/pressly/goose/v3"
+)
+
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+)
+
+var (
+	// mu защищает dialect и настройки goose на время выполнения команды
+	mu      sync.Mutex
+	dialect = DialectPostgres
+)
+
+// Run выполняет команду goose (up, down, status...) над db диалекта name с миграциями из каталога dir.
+func Run(command string, db *sql.DB, name string, dir string, args ...string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	switch name {
+	case DialectPostgres, DialectSQLite:
+	default:
+		return fmt.Errorf("unknown dialect %q", name)
+	}
+	if err := goose.SetDialect(name); err != nil {
+		return err
+	}
+	dialect = name
+	return goose.Run(command, db, dir, args...)
+}
+
+// statements - SQL миграции для каждого диалекта. Пустая строка - в диалекте менять нечего.
+type statements struct {
+	postgres string
+	sqlite   string
+}
+
+// both - SQL, одинаковый для обоих диалектов.
+func both(query string) statements {
+	return statements{postgres: query, sqlite: query}
+}
+
+func (s statements) exec(ctx context.Context, tx *sql.Tx) error {
+	query := s.postgres
+	if dialect == DialectSQLite {
+		query = s.sqlite
+	}
+	if query == "" {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, query)
+	return err
+}
+
+// register добавляет миграцию, версия берётся из имени файла, в котором register вызван.
+func register(up, down statements) {
+	_, filename, _, _ := runtime.Caller(1)
+	goose.AddNamedMigrationContext(filename, up.exec, down.exec)
+}